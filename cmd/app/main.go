@@ -1,20 +1,311 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
 	"qlikOrders/internal/collections"
+	"qlikOrders/internal/jobs"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/metrics"
+	"qlikOrders/internal/ratelimit"
 	"qlikOrders/internal/server"
+	"qlikOrders/internal/tracing"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func main() {
-	// Create a new instance of collections
-	orderCollections := &collections.OrderCollection{}
+	// Customer IDs are hashed with REDACTION_SECRET in logs and erasure records, a random key is used without it,
+	// so the hashes then only match within one run
+	redactionKey := []byte(os.Getenv("REDACTION_SECRET"))
+	randomKey := len(redactionKey) == 0
+	if randomKey {
+		redactionKey = make([]byte, 32)
+		if _, err := rand.Read(redactionKey); err != nil {
+			fatal("Failed to generate a redaction key", err)
+		}
+	}
+
+	// Logs are JSON lines, customer IDs are redacted unless LOG_REDACT_CUSTOMER_IDS=false
+	logConfig := logging.Config{Level: slog.LevelInfo, RedactCustomerIDs: os.Getenv("LOG_REDACT_CUSTOMER_IDS") != "false", RedactionKey: redactionKey}
+	if name := os.Getenv("LOG_LEVEL"); name != "" {
+		level, err := logging.ParseLevel(name)
+		if err != nil {
+			fatal("Invalid LOG_LEVEL", err)
+		}
+		logConfig.Level = level
+	}
+	logger := logging.New(os.Stdout, logConfig)
+	slog.SetDefault(logger)
+	if randomKey {
+		logger.Warn("REDACTION_SECRET is not set, redacted customer IDs and erasure subject refs won't match across restarts")
+	}
+
+	// Gin's debug output isn't structured, it is only printed when GIN_MODE asks for it
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Spans are written as JSON lines to stdout or TRACING_FILE, as set by TRACING_EXPORTER, tracing is off without it
+	tracerProvider, err := newTracerProvider(os.Getenv("TRACING_EXPORTER"), os.Getenv("TRACING_FILE"))
+	if err != nil {
+		fatal("Failed to configure tracing", err)
+	}
+	if tracerProvider != nil {
+		defer tracerProvider.Shutdown(context.Background())
+	}
+
+	// Metrics of requests, ingestion and the store are served on /metrics
+	appMetrics := metrics.New()
+
+	// Caps the orders stored by every tenant
+	var tenantLimit collections.TenantLimit
+	if maxOrders := os.Getenv("TENANT_MAX_ORDERS"); maxOrders != "" {
+		limit, err := strconv.Atoi(maxOrders)
+		if err != nil {
+			fatal("Invalid TENANT_MAX_ORDERS", err)
+		}
+		tenantLimit = collections.TenantLimit{MaxOrders: limit}
+	}
+
+	// Orders are kept in memory, or in the SQLite database at SQLITE_PATH so they survive restarts
+	var orderCollections collections.Collections = &collections.OrderCollection{DefaultLimit: tenantLimit, Logger: logger, Metrics: appMetrics, SubjectKey: redactionKey}
+	sqlitePath := os.Getenv("SQLITE_PATH")
+	durable := sqlitePath != ""
+	if durable {
+		sqlCollection, err := collections.OpenSQLite(sqlitePath)
+		if err != nil {
+			fatal("Failed to open the SQLite database", err)
+		}
+		defer sqlCollection.Close()
+		sqlCollection.DefaultLimit = tenantLimit
+		sqlCollection.Logger = logger
+		sqlCollection.Metrics = appMetrics
+		sqlCollection.SubjectKey = redactionKey
+		orderCollections = sqlCollection
+	}
+
+	// Calls changing data are appended to AUDIT_FILE as JSON lines, or kept in memory without it
+	var auditSink audit.Sink = audit.NewMemorySink()
+	if path := os.Getenv("AUDIT_FILE"); path != "" {
+		fileSink, err := audit.OpenFileSink(path)
+		if err != nil {
+			fatal("Failed to open the audit log", err)
+		}
+		defer fileSink.Close()
+		auditSink = fileSink
+	}
+
+	opts := []server.Option{server.WithLogger(logger), server.WithMetrics(appMetrics), server.WithDebugConfig(environment()), server.WithAudit(auditSink)}
+	if tracerProvider != nil {
+		opts = append(opts, server.WithTracing(tracerProvider))
+	}
+
+	// API keys are loaded from a JSON file of hashed keys, routes are open without it.
+	// Keys created or deleted through /admin/keys are written back to the file.
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		keyStore, err := auth.OpenKeysFile(path)
+		if err != nil {
+			fatal("Failed to load API keys", err)
+		}
+		opts = append(opts, server.WithAPIKeys(keyStore))
+	}
+
+	// Bearer tokens are verified with a shared HS256 secret or the keys of a local JWKS file
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		keys := map[string]any{}
+		if secret := os.Getenv("JWT_HS256_SECRET"); secret != "" {
+			keys["default"] = []byte(secret)
+		}
+		if path := os.Getenv("JWT_JWKS_FILE"); path != "" {
+			jwks, err := auth.LoadJWKS(path)
+			if err != nil {
+				fatal("Failed to load JWKS", err)
+			}
+			for kid, key := range jwks {
+				keys[kid] = key
+			}
+		}
+
+		jwtAuth, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+			Keys:     keys,
+			Issuer:   issuer,
+			Audience: os.Getenv("JWT_AUDIENCE"),
+		})
+		if err != nil {
+			fatal("Failed to configure JWT authentication", err)
+		}
+		opts = append(opts, server.WithJWT(jwtAuth))
+	}
+
+	// Requests per minute for every client and route, and orders every client can ingest per day
+	limiter := &ratelimit.Limiter{Store: ratelimit.NewMemoryStore()}
+	if perMinute := os.Getenv("RATE_LIMIT_PER_MINUTE"); perMinute != "" {
+		requests, err := strconv.Atoi(perMinute)
+		if err != nil {
+			fatal("Invalid RATE_LIMIT_PER_MINUTE", err)
+		}
+		limiter.Default = ratelimit.Limit{Requests: requests, Period: time.Minute}
+	}
+	if perMinute := os.Getenv("ORDERS_RATE_LIMIT_PER_MINUTE"); perMinute != "" {
+		requests, err := strconv.Atoi(perMinute)
+		if err != nil {
+			fatal("Invalid ORDERS_RATE_LIMIT_PER_MINUTE", err)
+		}
+		limiter.Routes = map[string]ratelimit.Limit{"POST /orders": {Requests: requests, Period: time.Minute}}
+	}
+	if dailyOrders := os.Getenv("DAILY_ORDER_QUOTA"); dailyOrders != "" {
+		quota, err := strconv.Atoi(dailyOrders)
+		if err != nil {
+			fatal("Invalid DAILY_ORDER_QUOTA", err)
+		}
+		limiter.DailyOrders = quota
+	}
+	opts = append(opts, server.WithRateLimit(limiter))
+
+	// Anonymous callers are limited by their IP address, X-Forwarded-For is only trusted from TRUSTED_PROXIES
+	trustedProxies, err := server.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+	opts = append(opts, server.WithTrustedProxies(trustedProxies))
+
+	// Import jobs are kept in JOBS_DIR so they survive restarts, unfinished jobs are resumed on startup.
+	// They are imported again from the start unless the orders are in SQLite.
+	jobsDir := os.Getenv("JOBS_DIR")
+	if jobsDir == "" {
+		jobsDir = filepath.Join(os.TempDir(), "qlik-orders-jobs")
+	}
+	jobsConfig := jobs.Config{Dir: jobsDir, Collections: orderCollections, Durable: durable, Limiter: limiter, Audit: auditSink, Logger: logger}
+	if workers := os.Getenv("JOBS_WORKERS"); workers != "" {
+		n, err := strconv.Atoi(workers)
+		if err != nil {
+			fatal("Invalid JOBS_WORKERS", err)
+		}
+		jobsConfig.Workers = n
+	}
+	jobManager, err := jobs.NewManager(jobsConfig)
+	if err != nil {
+		fatal("Failed to start import jobs", err)
+	}
+	jobManager.Start()
+	defer jobManager.Close()
+	opts = append(opts, server.WithJobs(jobManager))
+
+	// The gRPC API shares the collections, authentication and limits of the HTTP API on its own listener
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	listener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		fatal("Failed to listen for gRPC", err)
+	}
+	grpcServer := server.NewGRPCServer(orderCollections, opts...)
+	go func() {
+		logger.Info("starting gRPC server", slog.String("addr", grpcAddr))
+		if err := grpcServer.Serve(listener); err != nil {
+			fatal("gRPC server failed", err)
+		}
+	}()
+	defer grpcServer.GracefulStop()
+
+	// SIGINT and SIGTERM stop the server gracefully, the deferred cleanups then stop the jobs and close the stores
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Inject the collections
-	srv := server.NewServer(orderCollections)
-	fmt.Println("Starting server on port 8080...")
-	if err := srv.Run(":8080"); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	srv := &http.Server{Addr: ":8080", Handler: server.NewServer(orderCollections, opts...)}
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("starting HTTP server", slog.String("addr", srv.Addr))
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		fatal("Server failed to start", err)
+	case <-ctx.Done():
+	}
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("HTTP server didn't shut down cleanly", slog.String(logging.KeyError, err.Error()))
 	}
 }
+
+// shutdownTimeout is how long requests in flight get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// settings lists the environment variables configuring the service
+var settings = []string{
+	"LOG_LEVEL", "LOG_REDACT_CUSTOMER_IDS", "REDACTION_SECRET", gin.EnvGinMode,
+	"TENANT_MAX_ORDERS", "SQLITE_PATH",
+	"API_KEYS_FILE", "JWT_ISSUER", "JWT_AUDIENCE", "JWT_HS256_SECRET", "JWT_JWKS_FILE",
+	"RATE_LIMIT_PER_MINUTE", "ORDERS_RATE_LIMIT_PER_MINUTE", "DAILY_ORDER_QUOTA", "TRUSTED_PROXIES",
+	"JOBS_DIR", "JOBS_WORKERS",
+	"GRPC_ADDR",
+	"TRACING_EXPORTER", "TRACING_FILE",
+	"AUDIT_FILE",
+}
+
+// environment returns the settings that are set, for /debug, which redacts the secret ones
+func environment() map[string]string {
+	config := make(map[string]string)
+	for _, name := range settings {
+		if value, ok := os.LookupEnv(name); ok {
+			config[name] = value
+		}
+	}
+	return config
+}
+
+// newTracerProvider creates the provider of the exporter named by exporter, nil when tracing is off
+func newTracerProvider(exporter, path string) (*sdktrace.TracerProvider, error) {
+	var w io.Writer
+	switch exporter {
+	case "":
+		return nil, nil
+	case "stdout":
+		w = os.Stdout
+	case "file":
+		if path == "" {
+			return nil, errors.New("TRACING_FILE is required by the file exporter")
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+	default:
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER %q", exporter)
+	}
+
+	spanExporter, err := tracing.NewWriterExporter(w)
+	if err != nil {
+		return nil, err
+	}
+	return tracing.NewProvider(spanExporter), nil
+}
+
+// fatal logs a startup error and exits
+func fatal(message string, err error) {
+	slog.Error(message, slog.String(logging.KeyError, err.Error()))
+	os.Exit(1)
+}
@@ -0,0 +1,169 @@
+// Package audit keeps an append-only trail of the calls changing data: who made them, on which orders and how they ended
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/tenant"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Outcomes of audited calls
+const (
+	OutcomeSuccess  = "success"
+	OutcomeRejected = "rejected" // The call was refused, e.g. invalid input, missing scope or quota exceeded
+	OutcomeFailed   = "failed"   // The server failed to carry out the call
+)
+
+// Anonymous is the actor of calls made without credentials, when authentication isn't configured
+const Anonymous = "anonymous"
+
+// MethodGRPC is the method of entries recorded for gRPC calls, their route is the full method name
+const MethodGRPC = "gRPC"
+
+// The keys the orders affected by a request and the erasure it made are stored under in the gin context
+const (
+	orderIDsKey  = "audit.orderIds"
+	erasureIDKey = "audit.erasureId"
+)
+
+// Entry records a call changing data. Customer IDs are never recorded, erasures are identified by the ID of their erasure record.
+type Entry struct {
+	Time      time.Time `json:"time" parquet:"time"`
+	Tenant    string    `json:"tenant" parquet:"tenant"`
+	Actor     string    `json:"actor" parquet:"actor"` // ID of the API key or token subject, or Anonymous
+	Method    string    `json:"method" parquet:"method"`
+	Route     string    `json:"route" parquet:"route"` // Pattern of the route, e.g. /v2/orders
+	OrderIDs  []string  `json:"orderIds" parquet:"orderIds,list"`
+	RequestID string    `json:"requestId" parquet:"requestId"`
+	Status    int       `json:"status" parquet:"status"` // HTTP status, gRPC calls record the status matching their code
+	Outcome   string    `json:"outcome" parquet:"outcome"`
+	ErasureID string    `json:"erasureId,omitempty" parquet:"erasureId"` // Only set on erasures
+}
+
+// Filter selects entries, empty fields match every entry
+type Filter struct {
+	Tenant    string
+	Actor     string
+	Route     string
+	OrderID   string
+	RequestID string
+	Outcome   string
+	// From and To bound the time of the entries, From is inclusive and To exclusive
+	From, To time.Time
+	// Offset skips the first matching entries and Limit caps the entries returned, 0 returns them all
+	Offset, Limit int
+}
+
+// Match reports whether the entry passes the filter
+func (f Filter) Match(entry Entry) bool {
+	switch {
+	case f.Tenant != "" && entry.Tenant != f.Tenant,
+		f.Actor != "" && entry.Actor != f.Actor,
+		f.Route != "" && entry.Route != f.Route,
+		f.RequestID != "" && entry.RequestID != f.RequestID,
+		f.Outcome != "" && entry.Outcome != f.Outcome,
+		!f.From.IsZero() && entry.Time.Before(f.From),
+		!f.To.IsZero() && !entry.Time.Before(f.To):
+		return false
+	}
+	if f.OrderID == "" {
+		return true
+	}
+	for _, id := range entry.OrderIDs {
+		if id == f.OrderID {
+			return true
+		}
+	}
+	return false
+}
+
+// Sink stores entries, implementations must be safe for concurrent use and never change or drop what was appended
+type Sink interface {
+	Append(ctx context.Context, entry Entry) error
+	// Query returns the entries matching filter in the order they were appended, within its offset and limit
+	Query(ctx context.Context, filter Filter) ([]Entry, error)
+}
+
+// Outcome classifies an HTTP status
+func Outcome(status int) string {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return OutcomeFailed
+	case status >= http.StatusBadRequest:
+		return OutcomeRejected
+	}
+	return OutcomeSuccess
+}
+
+// Actor identifies the caller recorded in entries
+func Actor(principal *auth.Principal) string {
+	if principal == nil {
+		return Anonymous
+	}
+	return principal.ID
+}
+
+// Record returns a middleware appending an entry to sink once the request is served, whatever its outcome.
+// It goes before the scope check of a route, so callers turned away are recorded too.
+// Entries that can't be appended are logged, the response is already sent by then.
+func Record(sink Sink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		ctx := c.Request.Context()
+		principal, _ := auth.PrincipalFromContext(c)
+		value, _ := c.Get(orderIDsKey)
+		orderIDs, ok := value.([]string)
+		if !ok {
+			orderIDs = []string{}
+		}
+		status := c.Writer.Status()
+		entry := Entry{
+			Time:      time.Now().UTC(),
+			Tenant:    tenant.FromContext(c),
+			Actor:     Actor(principal),
+			Method:    c.Request.Method,
+			Route:     c.FullPath(),
+			OrderIDs:  orderIDs,
+			RequestID: logging.RequestIDFromContext(ctx),
+			Status:    status,
+			Outcome:   Outcome(status),
+			ErasureID: c.GetString(erasureIDKey),
+		}
+		if err := sink.Append(ctx, entry); err != nil {
+			logging.FromContext(ctx).Error("audit entry not recorded", slog.String(logging.KeyError, err.Error()), slog.String("route", entry.Route))
+		}
+	}
+}
+
+// RecordOrders adds orders to those the request posted or changed, as recorded by Record.
+// Handlers call it once the orders are valid, the outcome of the entry tells whether they were stored.
+func RecordOrders(c *gin.Context, orders []models.Order) {
+	value, _ := c.Get(orderIDsKey)
+	ids, _ := value.([]string)
+	c.Set(orderIDsKey, append(ids, OrderIDs(orders)...))
+}
+
+// RecordErasure adds the orders erased by the request and the ID of the erasure record to its entry
+func RecordErasure(c *gin.Context, record models.ErasureRecord) {
+	value, _ := c.Get(orderIDsKey)
+	ids, _ := value.([]string)
+	c.Set(orderIDsKey, append(ids, record.OrderIDs...))
+	c.Set(erasureIDKey, record.ErasureID)
+}
+
+// OrderIDs lists the IDs of orders
+func OrderIDs(orders []models.Order) []string {
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		ids[i] = order.OrderID
+	}
+	return ids
+}
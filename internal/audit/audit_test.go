@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/tenant"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	at := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	entry := Entry{Time: at, Tenant: "acme", Actor: "key-1", Method: http.MethodPost, Route: "/v2/orders", OrderIDs: []string{"100", "101"}, RequestID: "req-1", Status: http.StatusCreated, Outcome: OutcomeSuccess}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		match  bool
+	}{
+		{"Empty", Filter{}, true},
+		{"Every field", Filter{Tenant: "acme", Actor: "key-1", Route: "/v2/orders", OrderID: "101", RequestID: "req-1", Outcome: OutcomeSuccess, From: at, To: at.Add(time.Second)}, true},
+		{"Other tenant", Filter{Tenant: "other"}, false},
+		{"Other actor", Filter{Actor: "key-2"}, false},
+		{"Other route", Filter{Route: "/orders"}, false},
+		{"Other order", Filter{OrderID: "102"}, false},
+		{"Other request", Filter{RequestID: "req-2"}, false},
+		{"Other outcome", Filter{Outcome: OutcomeRejected}, false},
+		{"After", Filter{From: at.Add(time.Nanosecond)}, false},
+		{"To is exclusive", Filter{To: at}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, tt.filter.Match(entry))
+		})
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, OutcomeSuccess, Outcome(http.StatusCreated))
+	assert.Equal(t, OutcomeRejected, Outcome(http.StatusForbidden))
+	assert.Equal(t, OutcomeRejected, Outcome(http.StatusTooManyRequests))
+	assert.Equal(t, OutcomeFailed, Outcome(http.StatusInternalServerError))
+}
+
+func TestRecord(t *testing.T) {
+	key, secret, err := auth.GenerateKey("writer", "acme", []string{auth.ScopeOrdersWrite})
+	require.NoError(t, err)
+	authentication := auth.New(auth.APIKeyAuthenticator{Store: auth.NewMemoryKeyStore(key)})
+	sink := NewMemorySink()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.RequestID(logging.New(io.Discard, logging.Config{})), authentication.Authenticate(), tenant.Resolve())
+	router.POST("/orders", Record(sink), authentication.Require(auth.ScopeOrdersWrite), func(c *gin.Context) {
+		RecordOrders(c, []models.Order{{OrderID: "100"}})
+		RecordOrders(c, []models.Order{{OrderID: "101"}})
+		c.Status(http.StatusCreated)
+	})
+
+	post := func(secret string) {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set(logging.Header, "req-"+secret)
+		if secret != "" {
+			req.Header.Set("X-API-Key", secret)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	before := time.Now()
+	post(secret)
+	post("")
+
+	entries, err := sink.Query(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.WithinRange(t, entries[0].Time, before, time.Now())
+	entries[0].Time = time.Time{}
+	assert.Equal(t, Entry{
+		Tenant:    "acme",
+		Actor:     key.ID,
+		Method:    http.MethodPost,
+		Route:     "/orders",
+		OrderIDs:  []string{"100", "101"},
+		RequestID: "req-" + secret,
+		Status:    http.StatusCreated,
+		Outcome:   OutcomeSuccess,
+	}, entries[0])
+
+	// Callers turned away are recorded as well
+	assert.Equal(t, Anonymous, entries[1].Actor)
+	assert.Equal(t, models.DefaultTenantID, entries[1].Tenant)
+	assert.Equal(t, []string{}, entries[1].OrderIDs)
+	assert.Equal(t, http.StatusUnauthorized, entries[1].Status)
+	assert.Equal(t, OutcomeRejected, entries[1].Outcome)
+}
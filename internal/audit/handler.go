@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/export"
+	"qlikOrders/internal/tenant"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Formats the trail is served in, the export formats have one row per entry with the order IDs joined in CSV
+var Formats = []codec.Format{codec.FormatJSON, codec.FormatCSV, codec.FormatNDJSON, codec.FormatParquet}
+
+// Outcomes lists every outcome, as accepted by the outcome filter
+var Outcomes = []string{OutcomeSuccess, OutcomeRejected, OutcomeFailed}
+
+// Entries served by a request unless set with ?limit=, which can't go over MaxLimit
+const (
+	DefaultLimit = 1000
+	MaxLimit     = 10000
+)
+
+// entryList is the body of GET /audit in JSON, a page with fewer entries than the limit is the last one
+type entryList struct {
+	Entries []Entry `json:"entries"`
+	Limit   int     `json:"limit"`
+	Offset  int     `json:"offset"`
+}
+
+// Handler serves the entries of the caller's tenant in sink, oldest first.
+// Query parameters filter them by actor, route, orderId, requestId, outcome and time, from and to in RFC 3339,
+// limit and offset page through them.
+// Entries are sent in JSON or exported as CSV, NDJSON or Parquet, depending on the Accept header or ?format=.
+func Handler(sink Sink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, err := codec.Negotiate(c.Query("format"), c.GetHeader("Accept"), Formats...)
+		if err != nil {
+			codec.Render(c, http.StatusNotAcceptable, codec.Status{Error: "Not acceptable", Message: "Supported formats are json, csv, ndjson and parquet"})
+			return
+		}
+
+		filter, err := parseFilter(c)
+		if err != nil {
+			codec.Render(c, http.StatusBadRequest, codec.Status{Error: "Invalid input", Message: err.Error()})
+			return
+		}
+
+		entries, err := sink.Query(c.Request.Context(), filter)
+		if err != nil {
+			_ = c.Error(err)
+			codec.Render(c, http.StatusInternalServerError, codec.Status{Error: "Failed to retrieve the audit log"})
+			return
+		}
+
+		if !format.IsExport() {
+			codec.RenderAs(c, http.StatusOK, format, entryList{Entries: entries, Limit: filter.Limit, Offset: filter.Offset})
+			return
+		}
+		if err := export.Stream(c.Writer, format, "audit", slices.Values(entries)); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// parseFilter reads the filter of a request, entries are always those of the caller's tenant
+func parseFilter(c *gin.Context) (Filter, error) {
+	filter := Filter{
+		Tenant:    tenant.FromContext(c),
+		Actor:     c.Query("actor"),
+		Route:     c.Query("route"),
+		OrderID:   c.Query("orderId"),
+		RequestID: c.Query("requestId"),
+		Outcome:   c.Query("outcome"),
+	}
+	if filter.Outcome != "" && !slices.Contains(Outcomes, filter.Outcome) {
+		return Filter{}, fmt.Errorf("outcome must be one of %v", Outcomes)
+	}
+
+	var err error
+	if filter.From, err = parseTime(c, "from"); err != nil {
+		return Filter{}, err
+	}
+	if filter.To, err = parseTime(c, "to"); err != nil {
+		return Filter{}, err
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultLimit))); err != nil || filter.Limit < 1 || filter.Limit > MaxLimit {
+		return Filter{}, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		return Filter{}, errors.New("offset must be 0 or more")
+	}
+	return filter, nil
+}
+
+func parseTime(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a time in RFC 3339, e.g. 2026-01-02T15:04:05Z", name)
+	}
+	return t, nil
+}
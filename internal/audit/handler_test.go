@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/tenant"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	sink := NewMemorySink()
+	for _, entry := range testEntries {
+		require.NoError(t, sink.Append(context.Background(), entry))
+	}
+
+	key, secret, err := auth.GenerateKey("auditor", "acme", []string{auth.ScopeAuditRead})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(auth.New(auth.APIKeyAuthenticator{Store: auth.NewMemoryKeyStore(key)}).Authenticate(), tenant.Resolve())
+	router.GET("/audit", Handler(sink))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-API-Key", secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		expected []Entry
+	}{
+		{"Tenant only", "/audit", []Entry{testEntries[0], testEntries[2]}},
+		{"Actor and order", "/audit?actor=key-1&orderId=100", testEntries[:1]},
+		{"Outcome", "/audit?outcome=rejected", testEntries[2:]},
+		{"Route", "/audit?route=/v2/customers/:customerId/data", testEntries[2:]},
+		{"Request", "/audit?requestId=req-2", []Entry{}},
+		{"Time range", "/audit?from=2026-03-01T12:01:00Z&to=2026-03-01T13:00:00%2B01:00", []Entry{}},
+		{"Time range including", "/audit?from=2026-03-01T12:00:00Z&to=2026-03-01T12:10:00Z", testEntries[:1]},
+		{"Page", "/audit?limit=1&offset=1", testEntries[2:]},
+		{"Past the last page", "/audit?offset=2", []Entry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.target)
+			require.Equal(t, http.StatusOK, w.Code)
+			var body entryList
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.expected, body.Entries)
+		})
+	}
+
+	t.Run("Default limit", func(t *testing.T) {
+		var body entryList
+		require.NoError(t, json.Unmarshal(get("/audit").Body.Bytes(), &body))
+		assert.Equal(t, DefaultLimit, body.Limit)
+		assert.Equal(t, 0, body.Offset)
+	})
+
+	t.Run("CSV export", func(t *testing.T) {
+		w := get("/audit?format=csv&outcome=success")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `attachment; filename="audit.csv"`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "time,tenant,actor,method,route,orderIds,requestId,status,outcome,erasureId\n"+
+			"2026-03-01T12:00:00Z,acme,key-1,POST,/v2/orders,100,req-1,201,success,\n", w.Body.String())
+	})
+
+	t.Run("Parquet export", func(t *testing.T) {
+		w := get("/audit?format=parquet")
+		require.Equal(t, http.StatusOK, w.Code)
+		read, err := parquet.Read[Entry](bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		require.NoError(t, err)
+		assert.Equal(t, []Entry{testEntries[0], testEntries[2]}, read)
+	})
+
+	invalid := []struct {
+		name   string
+		target string
+		code   int
+	}{
+		{"Unknown outcome", "/audit?outcome=maybe", http.StatusBadRequest},
+		{"Invalid time", "/audit?from=yesterday", http.StatusBadRequest},
+		{"Limit too large", "/audit?limit=10001", http.StatusBadRequest},
+		{"Negative offset", "/audit?offset=-1", http.StatusBadRequest},
+		{"Unknown format", "/audit?format=msgpack", http.StatusNotAcceptable},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, get(tt.target).Code)
+		})
+	}
+}
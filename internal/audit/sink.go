@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// MemorySink keeps entries in memory, for tests and single instance deployments that don't need them to outlive the process
+type MemorySink struct {
+	entries []Entry
+	mutex   sync.RWMutex
+}
+
+var _ Sink = (*MemorySink)(nil)
+
+// NewMemorySink creates an empty memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Append adds an entry
+func (s *MemorySink) Append(_ context.Context, entry Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Query returns the entries matching filter, within its offset and limit
+func (s *MemorySink) Query(_ context.Context, filter Filter) ([]Entry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	page := newPage(filter)
+	for _, entry := range s.entries {
+		if !page.open() {
+			break
+		}
+		page.add(entry)
+	}
+	return page.entries, nil
+}
+
+// FileSink appends entries to a file as lines of JSON. Entries are only ever appended to the file,
+// so the ones written survive restarts and can be shipped by any log collector.
+type FileSink struct {
+	path  string
+	file  *os.File
+	size  int64 // Bytes of whole entries in the file, reads stop there
+	mutex sync.RWMutex
+}
+
+var _ Sink = (*FileSink)(nil)
+
+// OpenFileSink opens the file at path for appending, creating it when missing.
+// A line torn by a crash while appending is cut off, its entry was never reported as appended.
+func OpenFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	size, err := wholeLines(file)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileSink{path: path, file: file, size: size}, nil
+}
+
+// wholeLines returns the size of file up to the end of its last line
+func wholeLines(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	block := make([]byte, 4096)
+	for end := info.Size(); end > 0; {
+		start := max(end-int64(len(block)), 0)
+		n, err := file.ReadAt(block[:end-start], start)
+		if err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(block[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// Append writes an entry as a line and syncs it to disk before returning.
+// A line that can't be written and synced is cut off, so the next entry doesn't end up on the same line.
+func (s *FileSink) Append(_ context.Context, entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err = s.file.Write(append(line, '\n')); err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		_ = s.file.Truncate(s.size)
+		return err
+	}
+	s.size += int64(len(line)) + 1
+	return nil
+}
+
+// Query reads the file from the start and returns the entries matching filter.
+// Only the entries appended before the call are read, appends don't wait for the read.
+func (s *FileSink) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	s.mutex.RLock()
+	size := s.size
+	s.mutex.RUnlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	page := newPage(filter)
+	reader := bufio.NewReader(io.LimitReader(file, size))
+	for line := 1; page.open(); line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A last line without its newline is torn and holds no entry
+			return page.entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("audit log %s, entry %d: %w", s.path, line, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page.add(entry)
+	}
+	return page.entries, nil
+}
+
+// Close closes the file, the sink can't be used afterwards
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// page collects the entries matching a filter, past its offset and up to its limit
+type page struct {
+	filter  Filter
+	skipped int
+	entries []Entry
+}
+
+func newPage(filter Filter) *page {
+	return &page{filter: filter, entries: []Entry{}}
+}
+
+// open reports whether the page takes more entries
+func (p *page) open() bool {
+	return p.filter.Limit <= 0 || len(p.entries) < p.filter.Limit
+}
+
+// add keeps entry when it matches the filter and the offset is reached
+func (p *page) add(entry Entry) {
+	if !p.filter.Match(entry) {
+		return
+	}
+	if p.skipped < p.filter.Offset {
+		p.skipped++
+		return
+	}
+	p.entries = append(p.entries, entry)
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEntries = []Entry{
+	{Time: time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC), Tenant: "acme", Actor: "key-1", Method: "POST", Route: "/v2/orders", OrderIDs: []string{"100"}, RequestID: "req-1", Status: 201, Outcome: OutcomeSuccess},
+	{Time: time.Date(2026, time.March, 1, 12, 5, 0, 0, time.UTC), Tenant: "other", Actor: "key-2", Method: "POST", Route: "/v2/orders", OrderIDs: []string{"100"}, RequestID: "req-2", Status: 201, Outcome: OutcomeSuccess},
+	{Time: time.Date(2026, time.March, 1, 12, 10, 0, 0, time.UTC), Tenant: "acme", Actor: "key-1", Method: "DELETE", Route: "/v2/customers/:customerId/data", OrderIDs: []string{}, RequestID: "req-3", Status: 404, Outcome: OutcomeRejected},
+}
+
+func TestMemorySink(t *testing.T) {
+	ctx := context.Background()
+	sink := NewMemorySink()
+
+	entries, err := sink.Query(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	for _, entry := range testEntries {
+		require.NoError(t, sink.Append(ctx, entry))
+	}
+	entries, err = sink.Query(ctx, Filter{Tenant: "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{testEntries[0], testEntries[2]}, entries)
+
+	// The offset and limit count matching entries
+	entries, err = sink.Query(ctx, Filter{Tenant: "acme", Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, testEntries[2:], entries)
+}
+
+func TestFileSink(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := OpenFileSink(path)
+	require.NoError(t, err)
+	for _, entry := range testEntries[:2] {
+		require.NoError(t, sink.Append(ctx, entry))
+	}
+	require.NoError(t, sink.Close())
+
+	// Entries survive a restart, new ones are appended after them
+	sink, err = OpenFileSink(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { sink.Close() })
+	require.NoError(t, sink.Append(ctx, testEntries[2]))
+
+	entries, err := sink.Query(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, testEntries, entries)
+	entries, err = sink.Query(ctx, Filter{OrderID: "100", Tenant: "other"})
+	require.NoError(t, err)
+	assert.Equal(t, testEntries[1:2], entries)
+	entries, err = sink.Query(ctx, Filter{Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, testEntries[1:2], entries)
+
+	// One line of JSON per entry
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"time":"2026-03-01T12:00:00Z","tenant":"acme","actor":"key-1","method":"POST","route":"/v2/orders","orderIds":["100"],"requestId":"req-1","status":201,"outcome":"success"}`, lines[0])
+}
+
+func TestFileSinkCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte("{\"tenant\":\"acme\"}\nnot json\n"), 0o600))
+
+	sink, err := OpenFileSink(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { sink.Close() })
+
+	_, err = sink.Query(context.Background(), Filter{})
+	assert.ErrorContains(t, err, "entry 2")
+}
+
+func TestFileSinkTornLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := OpenFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Append(ctx, testEntries[0]))
+	require.NoError(t, sink.Close())
+
+	// A crash while appending left half a line behind
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"time":"2026-03-01T12:05:00Z","tenant":"ot`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// The torn line is cut off when the file is opened again, the next entry gets a line of its own
+	sink, err = OpenFileSink(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { sink.Close() })
+	require.NoError(t, sink.Append(ctx, testEntries[2]))
+	entries, err := sink.Query(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{testEntries[0], testEntries[2]}, entries)
+
+	// Lines written past the entries appended by the sink aren't read
+	file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"time":`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	entries, err = sink.Query(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
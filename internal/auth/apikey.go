@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The prefix of generated API keys makes them easy to spot in logs and secret scanners
+const keyPrefix = "qo_"
+
+// ErrKeyNotFound is returned when no API key matches
+var ErrKeyNotFound = errors.New("api key not found")
+
+// APIKey is a stored API key, only the SHA-256 hash of the key itself is kept
+type APIKey struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Hash      string   `json:"hash"`
+	Scopes    []string `json:"scopes"`
+	Tenant    string   `json:"tenant,omitempty"` // Keys without a tenant may act for any tenant
+	CreatedAt string   `json:"createdAt"`
+}
+
+// KeyStore stores API keys by their hash
+type KeyStore interface {
+	Add(key APIKey) error
+	GetByHash(hash string) (APIKey, error)
+	List() ([]APIKey, error)
+	Delete(id string) error
+}
+
+// MemoryKeyStore keeps API keys in memory
+type MemoryKeyStore struct {
+	keys  map[string]APIKey // Keyed by hash
+	mutex sync.RWMutex
+}
+
+var _ KeyStore = (*MemoryKeyStore)(nil)
+
+// NewMemoryKeyStore creates a key store holding the given keys
+func NewMemoryKeyStore(keys ...APIKey) *MemoryKeyStore {
+	store := &MemoryKeyStore{keys: make(map[string]APIKey)}
+	for _, key := range keys {
+		store.keys[key.Hash] = key
+	}
+	return store
+}
+
+// LoadKeysFile loads a JSON array of APIKey from path into a memory key store
+func LoadKeysFile(path string) (*MemoryKeyStore, error) {
+	keys, err := readKeysFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMemoryKeyStore(keys...), nil
+}
+
+func readKeysFile(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.ID == "" || key.Hash == "" {
+			return nil, errors.New("api key is missing an id or hash")
+		}
+	}
+	return keys, nil
+}
+
+// FileKeyStore serves API keys from memory and writes them back to their JSON file on every change,
+// so keys created or revoked through the API stay that way after a restart
+type FileKeyStore struct {
+	*MemoryKeyStore
+	path string
+	// writes serializes changes, so the file and the keys in memory change in the same order
+	writes sync.Mutex
+}
+
+var _ KeyStore = (*FileKeyStore)(nil)
+
+// OpenKeysFile loads a JSON array of APIKey from path into a key store writing its changes back to path
+func OpenKeysFile(path string) (*FileKeyStore, error) {
+	keys, err := readKeysFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileKeyStore{MemoryKeyStore: NewMemoryKeyStore(keys...), path: path}, nil
+}
+
+// Add stores a key, replacing any key with the same hash. Nothing changes when the file can't be written.
+func (s *FileKeyStore) Add(key APIKey) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	keys, err := s.MemoryKeyStore.List()
+	if err != nil {
+		return err
+	}
+	keys = slices.DeleteFunc(keys, func(k APIKey) bool { return k.Hash == key.Hash })
+	if err := s.save(append(keys, key)); err != nil {
+		return err
+	}
+	return s.MemoryKeyStore.Add(key)
+}
+
+// Delete removes the key with the given ID. Nothing changes when the file can't be written.
+func (s *FileKeyStore) Delete(id string) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	keys, err := s.MemoryKeyStore.List()
+	if err != nil {
+		return err
+	}
+	remaining := slices.DeleteFunc(slices.Clone(keys), func(k APIKey) bool { return k.ID == id })
+	if len(remaining) == len(keys) {
+		return ErrKeyNotFound
+	}
+	if err := s.save(remaining); err != nil {
+		return err
+	}
+	return s.MemoryKeyStore.Delete(id)
+}
+
+// save writes the keys atomically, so a crash never leaves a partial file behind
+func (s *FileKeyStore) save(keys []APIKey) error {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Add stores a key, replacing any key with the same hash
+func (s *MemoryKeyStore) Add(key APIKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.keys[key.Hash] = key
+	return nil
+}
+
+// GetByHash looks a key up by the hash of its secret
+func (s *MemoryKeyStore) GetByHash(hash string) (APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	key, ok := s.keys[hash]
+	if !ok {
+		return APIKey{}, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// List returns every key sorted by ID
+func (s *MemoryKeyStore) List() ([]APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// Delete removes the key with the given ID
+func (s *MemoryKeyStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for hash, key := range s.keys {
+		if key.ID == id {
+			delete(s.keys, hash)
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// HashKey hashes the secret of an API key the way it is stored
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateKey creates a new API key and returns it along with its secret.
+// The secret is not stored anywhere and can only be shown to the caller once.
+func GenerateKey(name, tenant string, scopes []string) (APIKey, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return APIKey{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", err
+	}
+
+	plain := keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      HashKey(plain),
+		Scopes:    scopes,
+		Tenant:    tenant,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}, plain, nil
+}
+
+// APIKeyAuthenticator authenticates requests carrying an X-API-Key header or an "Authorization: ApiKey" header
+type APIKeyAuthenticator struct {
+	Store KeyStore
+}
+
+// Scheme implements Authenticator
+func (a APIKeyAuthenticator) Scheme() string {
+	return "ApiKey"
+}
+
+// Authenticate implements Authenticator
+func (a APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	secret := r.Header.Get("X-API-Key")
+	if secret == "" {
+		scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "ApiKey") {
+			return nil, ErrNoCredentials
+		}
+		secret = credentials
+	}
+
+	key, err := a.Store.GetByHash(HashKey(secret))
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{ID: key.ID, Name: key.Name, Scopes: key.Scopes, Tenant: key.Tenant, AnyTenant: key.Tenant == ""}, nil
+}
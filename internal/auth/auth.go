@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes granted to credentials, each route requires one of them
+const (
+	ScopeOrdersWrite    = "orders:write"
+	ScopeCustomersRead  = "customers:read"
+	ScopeCustomersErase = "customers:erase"
+	ScopeSummaryRead    = "summary:read"
+	ScopeReportsRead    = "reports:read"
+	ScopeKeysAdmin      = "keys:admin"
+	ScopeDebugRead      = "debug:read"
+	ScopeAuditRead      = "audit:read"
+)
+
+// AllScopes lists every scope that can be granted
+var AllScopes = []string{
+	ScopeOrdersWrite,
+	ScopeCustomersRead,
+	ScopeCustomersErase,
+	ScopeSummaryRead,
+	ScopeReportsRead,
+	ScopeKeysAdmin,
+	ScopeDebugRead,
+	ScopeAuditRead,
+}
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request holds none of its credentials
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned when credentials are present but not accepted
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// The key the authenticated Principal is stored under in the gin context
+const principalKey = "auth.principal"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID     string
+	Name   string
+	Scopes []string
+	Roles  []string // Only set for token callers
+	Tenant string   // Empty when the credentials are not bound to a tenant
+	// AnyTenant is only set for API keys created without a tenant, the platform keys acting for any tenant.
+	// Other callers without a tenant, such as tokens without a tenant claim, act for the default tenant.
+	AnyTenant bool
+}
+
+// HasScope reports whether the principal was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Authenticator resolves the caller of a request from one kind of credentials
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+	// Scheme names the credentials in the WWW-Authenticate challenge
+	Scheme() string
+}
+
+// Auth checks requests against a list of authenticators, the first one finding credentials decides
+type Auth struct {
+	authenticators []Authenticator
+}
+
+// New creates an Auth trying the authenticators in order
+func New(authenticators ...Authenticator) *Auth {
+	return &Auth{authenticators: authenticators}
+}
+
+// Authenticate returns a middleware resolving the caller of every request.
+// Invalid credentials are rejected with 401, requests without credentials continue anonymously
+// and are rejected by Require on routes needing a scope.
+func (a *Auth) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.Identify(c.Request)
+		if errors.Is(err, ErrNoCredentials) {
+			c.Next()
+			return
+		}
+		if err != nil {
+			a.unauthorized(c)
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// Require returns a middleware rejecting requests without a caller with 401,
+// and callers lacking the scope with 403. It relies on Authenticate running first.
+func (a *Auth) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFromContext(c)
+		if !ok {
+			a.unauthorized(c)
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "Missing required scope " + scope,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (a *Auth) unauthorized(c *gin.Context) {
+	for _, authenticator := range a.authenticators {
+		c.Writer.Header().Add("WWW-Authenticate", authenticator.Scheme())
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+}
+
+// Identify resolves the caller of r with the first authenticator finding credentials in it.
+// It returns ErrNoCredentials when none does, for callers authenticating outside of gin.
+func (a *Auth) Identify(r *http.Request) (*Principal, error) {
+	for _, authenticator := range a.authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// PrincipalFromContext returns the caller authenticated by Require, if any
+func PrincipalFromContext(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*Principal)
+	return principal, ok
+}
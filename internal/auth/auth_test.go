@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(store KeyStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	a := New(APIKeyAuthenticator{Store: store})
+	router.Use(a.Authenticate())
+	router.GET("/summary", a.Require(ScopeSummaryRead), func(c *gin.Context) {
+		principal, _ := PrincipalFromContext(c)
+		c.String(http.StatusOK, principal.Name)
+	})
+	return router
+}
+
+func TestRequire(t *testing.T) {
+	reader := APIKey{ID: "1", Name: "reader", Hash: HashKey("reader-secret"), Scopes: []string{ScopeSummaryRead}}
+	writer := APIKey{ID: "2", Name: "writer", Hash: HashKey("writer-secret"), Scopes: []string{ScopeOrdersWrite}}
+	router := setupRouter(NewMemoryKeyStore(reader, writer))
+
+	tests := []struct {
+		name         string
+		header       string
+		value        string
+		expectedCode int
+	}{
+		{name: "X-API-Key header", header: "X-API-Key", value: "reader-secret", expectedCode: http.StatusOK},
+		{name: "Authorization header", header: "Authorization", value: "ApiKey reader-secret", expectedCode: http.StatusOK},
+		{name: "Missing credentials", expectedCode: http.StatusUnauthorized},
+		{name: "Unknown key", header: "X-API-Key", value: "guess", expectedCode: http.StatusUnauthorized},
+		{name: "Other scheme", header: "Authorization", value: "Basic cmVhZGVy", expectedCode: http.StatusUnauthorized},
+		{name: "Missing scope", header: "X-API-Key", value: "writer-secret", expectedCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/summary", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, "reader", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, secret, err := GenerateKey("ci", "acme", []string{ScopeOrdersWrite})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, key.ID)
+	assert.Equal(t, HashKey(secret), key.Hash)
+	assert.NotContains(t, key.Hash, secret)
+
+	store := NewMemoryKeyStore(key)
+	principal, err := APIKeyAuthenticator{Store: store}.Authenticate(&http.Request{Header: http.Header{"X-Api-Key": {secret}}})
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, principal.ID)
+	assert.Equal(t, "acme", principal.Tenant)
+}
+
+func TestMemoryKeyStore(t *testing.T) {
+	store := NewMemoryKeyStore()
+	assert.NoError(t, store.Add(APIKey{ID: "b", Hash: HashKey("b")}))
+	assert.NoError(t, store.Add(APIKey{ID: "a", Hash: HashKey("a")}))
+
+	keys, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", keys[0].ID)
+	assert.Equal(t, "b", keys[1].ID)
+
+	assert.NoError(t, store.Delete("a"))
+	assert.ErrorIs(t, store.Delete("a"), ErrKeyNotFound)
+	_, err = store.GetByHash(HashKey("a"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestLoadKeysFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("Valid file", func(t *testing.T) {
+		path := filepath.Join(dir, "keys.json")
+		content := `[{"id":"1","name":"admin","hash":"` + HashKey("admin-secret") + `","scopes":["keys:admin"]}]`
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		store, err := LoadKeysFile(path)
+		assert.NoError(t, err)
+
+		key, err := store.GetByHash(HashKey("admin-secret"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ScopeKeysAdmin}, key.Scopes)
+	})
+
+	t.Run("Key without hash", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.json")
+		assert.NoError(t, os.WriteFile(path, []byte(`[{"id":"1"}]`), 0o600))
+
+		_, err := LoadKeysFile(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"id":"1","name":"admin","hash":"` + HashKey("admin-secret") + `","scopes":["keys:admin"]}]`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	store, err := OpenKeysFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Add(APIKey{ID: "2", Name: "reader", Hash: HashKey("reader-secret"), Scopes: []string{ScopeSummaryRead}}))
+	assert.NoError(t, store.Delete("1"))
+	assert.ErrorIs(t, store.Delete("1"), ErrKeyNotFound)
+
+	// Created keys are kept and revoked keys stay revoked after a restart
+	reopened, err := OpenKeysFile(path)
+	assert.NoError(t, err)
+	_, err = reopened.GetByHash(HashKey("admin-secret"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	key, err := reopened.GetByHash(HashKey("reader-secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, "reader", key.Name)
+
+	t.Run("Unwritable file", func(t *testing.T) {
+		store.path = filepath.Join(t.TempDir(), "missing", "keys.json")
+		assert.Error(t, store.Delete("2"))
+		_, err := store.GetByHash(HashKey("reader-secret"))
+		assert.NoError(t, err, "the key isn't revoked in memory when the file keeps it")
+	})
+}
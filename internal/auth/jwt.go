@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultRoleScopes maps the roles issued by the platform to the scopes they grant
+var DefaultRoleScopes = map[string][]string{
+	"reader": {ScopeCustomersRead, ScopeSummaryRead, ScopeReportsRead},
+	"writer": {ScopeOrdersWrite},
+	"admin":  AllScopes,
+}
+
+// JWTConfig configures how bearer tokens are verified
+type JWTConfig struct {
+	// Keys verifying the token signature, by key ID. HS256 uses []byte,
+	// RS256 *rsa.PublicKey and ES256 *ecdsa.PublicKey.
+	// Tokens without a kid header are only accepted when there is a single key.
+	Keys     map[string]any
+	Issuer   string
+	Audience string
+
+	// RoleScopes maps the roles in the token to scopes, DefaultRoleScopes when nil
+	RoleScopes map[string][]string
+	// RoleClaim and TenantClaim name the claims holding the roles and tenant, "roles" and "tenant" when empty
+	RoleClaim   string
+	TenantClaim string
+	// Leeway allows for clock skew when checking expiry
+	Leeway time.Duration
+}
+
+// JWTAuthenticator authenticates requests carrying an "Authorization: Bearer" JSON Web Token
+type JWTAuthenticator struct {
+	config JWTConfig
+	parser *jwt.Parser
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator, issuer and audience are required so tokens meant for other services are rejected
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	if len(config.Keys) == 0 {
+		return nil, errors.New("no keys configured to verify tokens")
+	}
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("issuer and audience are required to verify tokens")
+	}
+	if config.RoleScopes == nil {
+		config.RoleScopes = DefaultRoleScopes
+	}
+	if config.RoleClaim == "" {
+		config.RoleClaim = "roles"
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant"
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(config.Audience),
+		jwt.WithLeeway(config.Leeway),
+	)
+	return &JWTAuthenticator{config: config, parser: parser}, nil
+}
+
+// Scheme implements Authenticator
+func (a *JWTAuthenticator) Scheme() string {
+	return "Bearer"
+}
+
+// Authenticate implements Authenticator
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(token, claims, a.key); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	// The subject identifies the caller in rate limits and the audit log, tokens without one can't be told apart
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+	principal := &Principal{ID: subject, Name: subject}
+	if tenant, ok := claims[a.config.TenantClaim].(string); ok {
+		principal.Tenant = tenant
+	}
+
+	// Roles may be a single string or a list of strings
+	switch roles := claims[a.config.RoleClaim].(type) {
+	case string:
+		principal.Roles = []string{roles}
+	case []any:
+		for _, role := range roles {
+			if role, ok := role.(string); ok {
+				principal.Roles = append(principal.Roles, role)
+			}
+		}
+	}
+
+	for _, role := range principal.Roles {
+		for _, scope := range a.config.RoleScopes[role] {
+			if !slices.Contains(principal.Scopes, scope) {
+				principal.Scopes = append(principal.Scopes, scope)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// key picks the verification key of a token and makes sure it matches the signing algorithm,
+// so a public RSA key can never be used as an HMAC secret
+func (a *JWTAuthenticator) key(token *jwt.Token) (any, error) {
+	var key any
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = a.config.Keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	} else if len(a.config.Keys) == 1 {
+		for _, only := range a.config.Keys {
+			key = only
+		}
+	} else {
+		return nil, errors.New("token has no key id")
+	}
+
+	switch token.Method.Alg() {
+	case "HS256":
+		if _, ok := key.([]byte); ok {
+			return key, nil
+		}
+	case "RS256":
+		if _, ok := key.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case "ES256":
+		if _, ok := key.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	return nil, errors.New("key does not match the signing algorithm")
+}
+
+// jsonWebKey holds the fields of a JWK used by the supported algorithms
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// LoadJWKS reads the keys of a local JSON Web Key Set file, by key ID.
+// RSA, P-256 EC and symmetric (oct) keys are supported, keys for other uses than signing are skipped.
+func LoadJWKS(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys in key set")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeys are generated once, RSA key generation is slow
+type testKeys struct {
+	hmac []byte
+	rsa  *rsa.PrivateKey
+	ec   *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return testKeys{hmac: []byte("test-secret-test-secret-test-sec"), rsa: rsaKey, ec: ecKey}
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":    "user-1",
+		"iss":    "https://issuer.test",
+		"aud":    "qlik-orders",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"roles":  []string{"reader"},
+		"tenant": "acme",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func bearer(token string) *http.Request {
+	return &http.Request{Header: http.Header{"Authorization": {"Bearer " + token}}}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	keys := newTestKeys(t)
+	authenticator, err := NewJWTAuthenticator(JWTConfig{
+		Keys: map[string]any{
+			"hs": keys.hmac,
+			"rs": &keys.rsa.PublicKey,
+			"es": &keys.ec.PublicKey,
+		},
+		Issuer:   "https://issuer.test",
+		Audience: "qlik-orders",
+	})
+	require.NoError(t, err)
+
+	t.Run("Valid tokens", func(t *testing.T) {
+		tokens := map[string]string{
+			"HS256": sign(t, jwt.SigningMethodHS256, "hs", keys.hmac, validClaims()),
+			"RS256": sign(t, jwt.SigningMethodRS256, "rs", keys.rsa, validClaims()),
+			"ES256": sign(t, jwt.SigningMethodES256, "es", keys.ec, validClaims()),
+		}
+		for alg, token := range tokens {
+			principal, err := authenticator.Authenticate(bearer(token))
+
+			assert.NoError(t, err, alg)
+			assert.Equal(t, "user-1", principal.ID)
+			assert.Equal(t, "acme", principal.Tenant)
+			assert.Equal(t, []string{"reader"}, principal.Roles)
+			assert.True(t, principal.HasScope(ScopeSummaryRead))
+			assert.False(t, principal.HasScope(ScopeOrdersWrite))
+		}
+	})
+
+	t.Run("Roles map to scopes", func(t *testing.T) {
+		claims := validClaims()
+		claims["roles"] = "writer"
+		principal, err := authenticator.Authenticate(bearer(sign(t, jwt.SigningMethodHS256, "hs", keys.hmac, claims)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ScopeOrdersWrite}, principal.Scopes)
+	})
+
+	invalid := map[string]func(jwt.MapClaims){
+		"Expired":          func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"Missing expiry":   func(c jwt.MapClaims) { delete(c, "exp") },
+		"Wrong audience":   func(c jwt.MapClaims) { c["aud"] = "other-service" },
+		"Wrong issuer":     func(c jwt.MapClaims) { c["iss"] = "https://evil.test" },
+		"Not yet valid":    func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+		"Missing issuer":   func(c jwt.MapClaims) { delete(c, "iss") },
+		"Missing audience": func(c jwt.MapClaims) { delete(c, "aud") },
+		"Missing subject":  func(c jwt.MapClaims) { delete(c, "sub") },
+		"Empty subject":    func(c jwt.MapClaims) { c["sub"] = "" },
+	}
+	for name, modify := range invalid {
+		t.Run(name, func(t *testing.T) {
+			claims := validClaims()
+			modify(claims)
+			_, err := authenticator.Authenticate(bearer(sign(t, jwt.SigningMethodRS256, "rs", keys.rsa, claims)))
+
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+
+	t.Run("Unknown key id", func(t *testing.T) {
+		_, err := authenticator.Authenticate(bearer(sign(t, jwt.SigningMethodHS256, "other", keys.hmac, validClaims())))
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("Algorithm does not match the key", func(t *testing.T) {
+		// An HMAC token pointing at the RSA key must not be verified with it
+		_, err := authenticator.Authenticate(bearer(sign(t, jwt.SigningMethodHS256, "rs", keys.hmac, validClaims())))
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("Unsigned token", func(t *testing.T) {
+		token := sign(t, jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, validClaims())
+		_, err := authenticator.Authenticate(bearer(token))
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("No bearer token", func(t *testing.T) {
+		_, err := authenticator.Authenticate(&http.Request{Header: http.Header{"X-Api-Key": {"key"}}})
+		assert.ErrorIs(t, err, ErrNoCredentials)
+	})
+}
+
+func TestNewJWTAuthenticatorRequiresConfig(t *testing.T) {
+	_, err := NewJWTAuthenticator(JWTConfig{Issuer: "iss", Audience: "aud"})
+	assert.Error(t, err)
+
+	_, err = NewJWTAuthenticator(JWTConfig{Keys: map[string]any{"hs": []byte("secret")}})
+	assert.Error(t, err)
+}
+
+func TestLoadJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	set := map[string]any{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rs", "use": "sig", "n": encode(keys.rsa.N.Bytes()), "e": encode(big.NewInt(int64(keys.rsa.E)).Bytes())},
+			{"kty": "EC", "kid": "es", "crv": "P-256", "x": encode(keys.ec.X.Bytes()), "y": encode(keys.ec.Y.Bytes())},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": encode(keys.rsa.N.Bytes()), "e": "AQAB"},
+		},
+	}
+	data, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	jwks, err := LoadJWKS(path)
+	require.NoError(t, err)
+	assert.Len(t, jwks, 2, "encryption keys are skipped")
+
+	authenticator, err := NewJWTAuthenticator(JWTConfig{Keys: jwks, Issuer: "https://issuer.test", Audience: "qlik-orders"})
+	require.NoError(t, err)
+
+	_, err = authenticator.Authenticate(bearer(sign(t, jwt.SigningMethodRS256, "rs", keys.rsa, validClaims())))
+	assert.NoError(t, err)
+	_, err = authenticator.Authenticate(bearer(sign(t, jwt.SigningMethodES256, "es", keys.ec, validClaims())))
+	assert.NoError(t, err)
+}
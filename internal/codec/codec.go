@@ -0,0 +1,238 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"qlikOrders/internal/codec/protobuf"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	msgpack "github.com/ugorji/go/codec"
+)
+
+// Format of a request or response body
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatMsgPack  Format = "msgpack"
+	FormatProtobuf Format = "protobuf"
+	FormatCSV      Format = "csv"
+	FormatNDJSON   Format = "ndjson"
+	FormatParquet  Format = "parquet"
+)
+
+// BodyFormats can encode any request or response
+var BodyFormats = []Format{FormatJSON, FormatMsgPack, FormatProtobuf}
+
+// ExportFormats can encode lists of rows, the body formats encode the list as a whole
+var ExportFormats = []Format{FormatJSON, FormatMsgPack, FormatProtobuf, FormatCSV, FormatNDJSON, FormatParquet}
+
+// ErrNotAcceptable is returned by Negotiate when none of the accepted formats is offered
+var ErrNotAcceptable = errors.New("none of the accepted formats is supported")
+
+// ErrUnsupportedType is returned when a value can't be encoded as protobuf
+var ErrUnsupportedType = errors.New("type has no protobuf encoding")
+
+var contentTypes = map[Format]string{
+	FormatJSON:     "application/json",
+	FormatMsgPack:  "application/msgpack",
+	FormatProtobuf: "application/x-protobuf",
+	FormatCSV:      "text/csv",
+	FormatNDJSON:   "application/x-ndjson",
+	FormatParquet:  "application/vnd.apache.parquet",
+}
+
+// mediaTypes maps the accepted media types, including common aliases, to their format
+var mediaTypes = map[string]Format{
+	"application/json":                FormatJSON,
+	"application/msgpack":             FormatMsgPack,
+	"application/x-msgpack":           FormatMsgPack,
+	"application/vnd.msgpack":         FormatMsgPack,
+	"application/x-protobuf":          FormatProtobuf,
+	"application/protobuf":            FormatProtobuf,
+	"application/vnd.google.protobuf": FormatProtobuf,
+	"text/csv":                        FormatCSV,
+	"application/x-ndjson":            FormatNDJSON,
+	"application/ndjson":              FormatNDJSON,
+	"application/jsonl":               FormatNDJSON,
+	"application/vnd.apache.parquet":  FormatParquet,
+	"application/parquet":             FormatParquet,
+	"application/x-parquet":           FormatParquet,
+}
+
+// ContentType of the format
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// IsExport reports whether the format streams rows rather than encoding a whole body
+func (f Format) IsExport() bool {
+	return f == FormatCSV || f == FormatNDJSON || f == FormatParquet
+}
+
+// Negotiate picks the response format among offered from the ?format= query parameter, or else the Accept header.
+// The first offered format is used when the client accepts anything.
+func Negotiate(format, accept string, offered ...Format) (Format, error) {
+	if format != "" {
+		if slices.Contains(offered, Format(format)) {
+			return Format(format), nil
+		}
+		return "", ErrNotAcceptable
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offered[0], nil
+	}
+
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := mediaRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), quality: 1}
+		for _, param := range params[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					r.quality = q
+				}
+			}
+		}
+		if r.quality > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	// Highest quality first, the order of the header breaks ties
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, r := range ranges {
+		switch r.mediaType {
+		case "*/*", "application/*":
+			return offered[0], nil
+		case "text/*":
+			if slices.Contains(offered, FormatCSV) {
+				return FormatCSV, nil
+			}
+		default:
+			if f, ok := mediaTypes[r.mediaType]; ok && slices.Contains(offered, f) {
+				return f, nil
+			}
+		}
+	}
+	return "", ErrNotAcceptable
+}
+
+// RequestFormat returns the body format of a Content-Type.
+// Bodies not declared as MessagePack or Protobuf are read as JSON, like they always were.
+func RequestFormat(contentType string) Format {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return FormatJSON
+	}
+	if f, ok := mediaTypes[mediaType]; ok && (f == FormatMsgPack || f == FormatProtobuf) {
+		return f
+	}
+	return FormatJSON
+}
+
+// msgpackHandle encodes strings with the str types of the current MessagePack spec, fields are named after the json tags
+var msgpackHandle = &msgpack.MsgpackHandle{WriteExt: true}
+
+// Marshal encodes v in a body format, v must implement protobuf.Message to be encoded as protobuf
+func Marshal(format Format, v any) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.Marshal(v)
+	case FormatMsgPack:
+		var b []byte
+		err := msgpack.NewEncoderBytes(&b, msgpackHandle).Encode(v)
+		return b, err
+	case FormatProtobuf:
+		m, ok := v.(protobuf.Message)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+		}
+		return protobuf.Marshal(m), nil
+	}
+	return nil, fmt.Errorf("unsupported body format %q", format)
+}
+
+// Unmarshal decodes data in a body format into v, v must implement protobuf.Unmarshaler to be decoded from protobuf
+func Unmarshal(format Format, data []byte, v any) error {
+	switch format {
+	case FormatJSON:
+		return json.Unmarshal(data, v)
+	case FormatMsgPack:
+		return msgpack.NewDecoderBytes(data, msgpackHandle).Decode(v)
+	case FormatProtobuf:
+		m, ok := v.(protobuf.Unmarshaler)
+		if !ok {
+			return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+		}
+		return m.UnmarshalProto(data)
+	}
+	return fmt.Errorf("unsupported body format %q", format)
+}
+
+// Render writes v in the body format the Accept header asks for, JSON when it asks for none of them
+func Render(c *gin.Context, code int, v any) {
+	format, err := Negotiate("", c.GetHeader("Accept"), BodyFormats...)
+	if err != nil {
+		format = FormatJSON
+	}
+	RenderAs(c, code, format, v)
+}
+
+// RenderAs writes v in a body format, errors of exports are written as JSON
+func RenderAs(c *gin.Context, code int, format Format, v any) {
+	if !slices.Contains(BodyFormats, format) {
+		format = FormatJSON
+	}
+	if format == FormatJSON {
+		// Rendered by gin so JSON responses stay byte for byte the same
+		c.JSON(code, v)
+		return
+	}
+
+	data, err := Marshal(format, v)
+	if err != nil {
+		c.JSON(http.StatusNotAcceptable, Status{Error: "Not acceptable", Message: "The response can't be encoded as " + string(format)})
+		return
+	}
+	c.Data(code, format.ContentType(), data)
+}
+
+// Status is the body of responses holding only an error or a message
+type Status struct {
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s Status) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, s.Error)
+	return protobuf.AppendString(b, 2, s.Message)
+}
+
+func (s *Status) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			s.Error = r.String()
+		case 2:
+			s.Message = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
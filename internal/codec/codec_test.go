@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		format   string
+		accept   string
+		expected Format
+	}{
+		{accept: "", expected: FormatJSON},
+		{accept: "*/*", expected: FormatJSON},
+		{accept: "application/json", expected: FormatJSON},
+		{accept: "application/msgpack", expected: FormatMsgPack},
+		{accept: "application/x-msgpack", expected: FormatMsgPack},
+		{accept: "application/x-protobuf", expected: FormatProtobuf},
+		{accept: "application/protobuf", expected: FormatProtobuf},
+		{accept: "text/csv", expected: FormatCSV},
+		{accept: "text/csv; charset=utf-8", expected: FormatCSV},
+		{accept: "application/x-ndjson", expected: FormatNDJSON},
+		{accept: "application/vnd.apache.parquet", expected: FormatParquet},
+		{accept: "text/html, text/csv;q=0.5, application/x-ndjson;q=0.9", expected: FormatNDJSON},
+		{accept: "text/csv;q=0, */*;q=0.1", expected: FormatJSON},
+		{accept: "application/json;q=0.5, application/x-protobuf", expected: FormatProtobuf},
+		{format: "parquet", accept: "text/csv", expected: FormatParquet},
+		{format: "msgpack", accept: "application/json", expected: FormatMsgPack},
+	}
+
+	for _, tt := range tests {
+		format, err := Negotiate(tt.format, tt.accept, ExportFormats...)
+		assert.NoError(t, err, tt.accept)
+		assert.Equal(t, tt.expected, format, tt.accept)
+	}
+
+	_, err := Negotiate("", "text/html", ExportFormats...)
+	assert.ErrorIs(t, err, ErrNotAcceptable)
+	_, err = Negotiate("xml", "", ExportFormats...)
+	assert.ErrorIs(t, err, ErrNotAcceptable)
+	_, err = Negotiate("", "text/csv", BodyFormats...)
+	assert.ErrorIs(t, err, ErrNotAcceptable)
+}
+
+func TestRequestFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    Format
+	}{
+		{"", FormatJSON},
+		{"application/json", FormatJSON},
+		{"text/plain", FormatJSON},
+		{"not a media type", FormatJSON},
+		{"application/msgpack", FormatMsgPack},
+		{"application/vnd.msgpack", FormatMsgPack},
+		{"application/x-protobuf", FormatProtobuf},
+		{"application/protobuf; proto=qlikorders.OrderList", FormatProtobuf},
+		// Exports aren't request bodies
+		{"text/csv", FormatJSON},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, RequestFormat(tt.contentType), tt.contentType)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	status := Status{Error: "Invalid input", Message: "The body can't be decoded"}
+
+	for _, format := range BodyFormats {
+		data, err := Marshal(format, status)
+		require.NoError(t, err, format)
+
+		var decoded Status
+		require.NoError(t, Unmarshal(format, data, &decoded), format)
+		assert.Equal(t, status, decoded, format)
+	}
+
+	_, err := Marshal(FormatProtobuf, map[string]string{"error": "Invalid input"})
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	assert.ErrorIs(t, Unmarshal(FormatProtobuf, nil, &map[string]string{}), ErrUnsupportedType)
+}
+
+func TestRender(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		accept      string
+		value       any
+		code        int
+		contentType string
+	}{
+		{name: "JSON by default", value: Status{Error: "Not found"}, code: http.StatusNotFound, contentType: "application/json; charset=utf-8"},
+		{name: "MessagePack", accept: "application/msgpack", value: Status{Error: "Not found"}, code: http.StatusNotFound, contentType: "application/msgpack"},
+		{name: "Protobuf", accept: "application/x-protobuf", value: Status{Error: "Not found"}, code: http.StatusNotFound, contentType: "application/x-protobuf"},
+		{name: "JSON for unsupported formats", accept: "text/csv", value: Status{Error: "Not found"}, code: http.StatusNotFound, contentType: "application/json; charset=utf-8"},
+		{name: "Protobuf without a schema", accept: "application/x-protobuf", value: gin.H{"error": "Not found"}, code: http.StatusNotAcceptable, contentType: "application/json; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.Header.Set("Accept", tt.accept)
+
+			Render(c, http.StatusNotFound, tt.value)
+
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package protobuf holds the helpers the types of api/proto/orders.proto are encoded with.
+// Messages are encoded by hand with protowire, so no code generation is needed to build the service.
+package protobuf
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Message is a type encoded as a protobuf message
+type Message interface {
+	AppendProto(b []byte) []byte
+}
+
+// Unmarshaler is a type decoded from a protobuf message
+type Unmarshaler interface {
+	UnmarshalProto(b []byte) error
+}
+
+// Marshal encodes a message
+func Marshal(m Message) []byte {
+	return m.AppendProto(nil)
+}
+
+// AppendString appends a string field, empty strings are left out like proto3 does
+func AppendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// AppendStrings appends a repeated string field
+func AppendStrings(b []byte, num protowire.Number, values []string) []byte {
+	for _, s := range values {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	return b
+}
+
+// AppendInt appends an int64 field, zero is left out like proto3 does
+func AppendInt(b []byte, num protowire.Number, n int) []byte {
+	if n == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(n)))
+}
+
+// AppendBool appends a bool field, false is left out like proto3 does
+func AppendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+// AppendMessage appends an embedded message field
+func AppendMessage(b []byte, num protowire.Number, m Message) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.AppendProto(nil))
+}
+
+// AppendMessages appends a repeated message field
+func AppendMessages[T Message](b []byte, num protowire.Number, messages []T) []byte {
+	for _, m := range messages {
+		b = AppendMessage(b, num, m)
+	}
+	return b
+}
+
+// Reader iterates over the fields of an encoded message:
+//
+//	r := protobuf.NewReader(b)
+//	for r.Next() {
+//		switch r.Field() {
+//		case 1:
+//			m.Name = r.String()
+//		default:
+//			r.Skip()
+//		}
+//	}
+//	return r.Err()
+//
+// Every field must be consumed by exactly one call to String, Int, Bool, Bytes, Message or Skip.
+type Reader struct {
+	b   []byte
+	num protowire.Number
+	typ protowire.Type
+	err error
+}
+
+// NewReader creates a Reader of the message b
+func NewReader(b []byte) *Reader {
+	return &Reader{b: b}
+}
+
+// Next moves to the next field, it returns false at the end of the message or on the first error
+func (r *Reader) Next() bool {
+	if r.err != nil || len(r.b) == 0 {
+		return false
+	}
+	num, typ, n := protowire.ConsumeTag(r.b)
+	if n < 0 {
+		r.err = protowire.ParseError(n)
+		return false
+	}
+	r.num, r.typ, r.b = num, typ, r.b[n:]
+	return true
+}
+
+// Field returns the number of the current field
+func (r *Reader) Field() protowire.Number {
+	return r.num
+}
+
+// String consumes a string field
+func (r *Reader) String() string {
+	return string(r.Bytes())
+}
+
+// Bytes consumes a bytes or embedded message field
+func (r *Reader) Bytes() []byte {
+	if r.typ != protowire.BytesType {
+		r.Skip()
+		return nil
+	}
+	v, n := protowire.ConsumeBytes(r.b)
+	if !r.consumed(n) {
+		return nil
+	}
+	return v
+}
+
+// Int consumes an int64 field
+func (r *Reader) Int() int {
+	if r.typ != protowire.VarintType {
+		r.Skip()
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(r.b)
+	if !r.consumed(n) {
+		return 0
+	}
+	return int(int64(v))
+}
+
+// Bool consumes a bool field
+func (r *Reader) Bool() bool {
+	return r.Int() != 0
+}
+
+// Message consumes an embedded message field into m
+func (r *Reader) Message(m Unmarshaler) {
+	b := r.Bytes()
+	if r.err == nil {
+		if err := m.UnmarshalProto(b); err != nil {
+			r.err = err
+		}
+	}
+}
+
+// Skip consumes a field that isn't known, so newer senders can add fields
+func (r *Reader) Skip() {
+	r.consumed(protowire.ConsumeFieldValue(r.num, r.typ, r.b))
+}
+
+// Err returns the error that stopped the Reader
+func (r *Reader) Err() error {
+	return r.err
+}
+
+func (r *Reader) consumed(n int) bool {
+	if n < 0 {
+		r.err = protowire.ParseError(n)
+		r.b = nil
+		return false
+	}
+	r.b = r.b[n:]
+	return true
+}
@@ -0,0 +1,126 @@
+package collections
+
+import (
+	"math"
+	"qlikOrders/internal/models"
+	"sort"
+)
+
+/*
+The basket index keeps co-occurrence counts of items bought in the same order.
+It is updated incrementally as orders are added or erased, so related item queries
+only have to look at the pairs of a single item instead of every stored order.
+*/
+
+type basketIndex struct {
+	orders     int                       // Orders in the index
+	itemOrders map[string]int            // Orders containing the item
+	pairs      map[string]map[string]int // Orders containing both items, stored in both directions
+}
+
+func newBasketIndex() *basketIndex {
+	return &basketIndex{
+		itemOrders: make(map[string]int),
+		pairs:      make(map[string]map[string]int),
+	}
+}
+
+// add counts an order into the index, delta is 1 to add and -1 to remove
+func (b *basketIndex) add(order models.Order, delta int) {
+	items := distinctItems(order)
+
+	b.orders += delta
+	for i, item := range items {
+		b.itemOrders[item] += delta
+		if b.itemOrders[item] <= 0 {
+			delete(b.itemOrders, item)
+		}
+
+		for _, other := range items[i+1:] {
+			b.addPair(item, other, delta)
+			b.addPair(other, item, delta)
+		}
+	}
+}
+
+func (b *basketIndex) addPair(item, other string, delta int) {
+	related, ok := b.pairs[item]
+	if !ok {
+		related = make(map[string]int)
+		b.pairs[item] = related
+	}
+	related[other] += delta
+	if related[other] <= 0 {
+		delete(related, other)
+		if len(related) == 0 {
+			delete(b.pairs, item)
+		}
+	}
+}
+
+// related lists the items most often bought together with itemID
+func (b *basketIndex) related(itemID string, limit int) ([]models.RelatedItem, bool) {
+	itemCount, ok := b.itemOrders[itemID]
+	if !ok {
+		return nil, false
+	}
+
+	related := []models.RelatedItem{}
+	for other, count := range b.pairs[itemID] {
+		related = append(related, relatedItem(other, count, itemCount, b.itemOrders[other], b.orders))
+	}
+	return rankRelated(related, limit), true
+}
+
+// relatedItem measures how strongly other is associated with an item, from the number of orders
+// containing both, the item, other and any item at all
+func relatedItem(other string, count, itemOrders, otherOrders, orders int) models.RelatedItem {
+	support := float64(count) / float64(orders)
+	confidence := float64(count) / float64(itemOrders)
+	otherSupport := float64(otherOrders) / float64(orders)
+
+	return models.RelatedItem{
+		ItemID:     other,
+		Orders:     count,
+		Support:    round(support),
+		Confidence: round(confidence),
+		Lift:       round(confidence / otherSupport),
+	}
+}
+
+// rankRelated sorts related items, most often bought together first, and keeps limit of them when limit is set
+func rankRelated(related []models.RelatedItem, limit int) []models.RelatedItem {
+	// Stronger associations break ties
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Orders != related[j].Orders {
+			return related[i].Orders > related[j].Orders
+		}
+		if related[i].Lift != related[j].Lift {
+			return related[i].Lift > related[j].Lift
+		}
+		return related[i].ItemID < related[j].ItemID
+	})
+
+	if limit > 0 && len(related) > limit {
+		related = related[:limit]
+	}
+	return related
+}
+
+// distinctItems returns the item IDs of an order, counting items bought several times once
+func distinctItems(order models.Order) []string {
+	seen := make(map[string]bool, len(order.Items))
+	items := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		if !seen[item.ItemID] {
+			seen[item.ItemID] = true
+			items = append(items, item.ItemID)
+		}
+	}
+	return items
+}
+
+// round keeps four decimals
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -0,0 +1,115 @@
+package collections
+
+import (
+	"qlikOrders/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRelatedItems(t *testing.T) {
+	orderCollection := &OrderCollection{}
+	defer resetOrders(orderCollection) // Clean up after test
+
+	// bread is bought with butter twice and with jam once, coffee is never bought with bread
+	orderCollection.AddOrders(testTenant, []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "butter", CostEur: 3}}},
+		{CustomerID: "02", OrderID: "200", Timestamp: "1637245070523", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "butter", CostEur: 3}, {ItemID: "jam", CostEur: 4}}},
+		{CustomerID: "03", OrderID: "300", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "bread", CostEur: 2}}},
+		{CustomerID: "04", OrderID: "400", Timestamp: "1637245070543", Items: []models.Item{{ItemID: "coffee", CostEur: 5}, {ItemID: "jam", CostEur: 4}}},
+	})
+
+	t.Run("Get related items", func(t *testing.T) {
+		related, err := orderCollection.GetRelatedItems(testTenant, "bread", 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []models.RelatedItem{
+			{ItemID: "butter", Orders: 2, Support: 0.5, Confidence: 0.6667, Lift: 1.3333},
+			{ItemID: "jam", Orders: 1, Support: 0.25, Confidence: 0.3333, Lift: 0.6667},
+		}, related)
+	})
+
+	t.Run("Limit related items", func(t *testing.T) {
+		related, err := orderCollection.GetRelatedItems(testTenant, "bread", 1)
+
+		assert.NoError(t, err)
+		assert.Len(t, related, 1)
+		assert.Equal(t, "butter", related[0].ItemID)
+	})
+
+	t.Run("Index is updated on ingestion", func(t *testing.T) {
+		orderCollection.AddOrders(testTenant, []models.Order{
+			{CustomerID: "05", OrderID: "500", Timestamp: "1637245070553", Items: []models.Item{{ItemID: "coffee", CostEur: 5}, {ItemID: "bread", CostEur: 2}}},
+		})
+
+		related, err := orderCollection.GetRelatedItems(testTenant, "coffee", 0)
+
+		assert.NoError(t, err)
+		assert.Len(t, related, 2)
+	})
+
+	t.Run("Index is updated on erasure", func(t *testing.T) {
+		_, err := orderCollection.EraseCustomer(testTenant, "05", models.ErasureModeDelete)
+		assert.NoError(t, err)
+
+		related, err := orderCollection.GetRelatedItems(testTenant, "coffee", 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []models.RelatedItem{{ItemID: "jam", Orders: 1, Support: 0.25, Confidence: 1, Lift: 2}}, related)
+	})
+
+	t.Run("Get related items of unknown item", func(t *testing.T) {
+		_, err := orderCollection.GetRelatedItems(testTenant, "tea", 0)
+
+		assert.ErrorIs(t, err, ErrItemNotFound)
+	})
+
+	t.Run("Index is rebuilt when orders are replaced", func(t *testing.T) {
+		resetOrders(orderCollection)
+		_, err := orderCollection.GetRelatedItems(testTenant, "bread", 0)
+
+		assert.ErrorIs(t, err, ErrItemNotFound)
+	})
+
+	t.Run("Index is rebuilt when orders are replaced by as many others", func(t *testing.T) {
+		orderCollection.Orders = []models.Order{
+			{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "tea", CostEur: 2}, {ItemID: "milk", CostEur: 1}}},
+		}
+		_, err := orderCollection.GetRelatedItems(testTenant, "tea", 0)
+		assert.NoError(t, err)
+
+		orderCollection.Orders = []models.Order{
+			{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "jam", CostEur: 4}}},
+		}
+		_, err = orderCollection.GetRelatedItems(testTenant, "tea", 0)
+		assert.ErrorIs(t, err, ErrItemNotFound)
+	})
+}
+
+// Indexes kept up to date through every kind of change answer like indexes built from scratch
+func TestGetRelatedItemsAfterChanges(t *testing.T) {
+	orderCollection := &OrderCollection{}
+	orderCollection.AddOrders(testTenant, []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "butter", CostEur: 3}}},
+		{CustomerID: "02", OrderID: "200", Timestamp: "1637245070523", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "jam", CostEur: 4}}},
+	})
+	_, err := orderCollection.GetRelatedItems(testTenant, "bread", 0)
+	assert.NoError(t, err)
+
+	// The number of orders is back where it was, but they aren't the same orders
+	_, err = orderCollection.EraseCustomer(testTenant, "01", models.ErasureModePseudonymize)
+	assert.NoError(t, err)
+	_, err = orderCollection.EraseCustomer(testTenant, "02", models.ErasureModeDelete)
+	assert.NoError(t, err)
+	orderCollection.AddOrders(testTenant, []models.Order{
+		{CustomerID: "03", OrderID: "300", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "coffee", CostEur: 5}}},
+	})
+
+	rebuilt := &OrderCollection{Orders: append([]models.Order(nil), orderCollection.Orders...)}
+	for _, item := range []string{"bread", "butter", "coffee", "jam"} {
+		related, err := orderCollection.GetRelatedItems(testTenant, item, 0)
+		expected, expectedErr := rebuilt.GetRelatedItems(testTenant, item, 0)
+		assert.Equal(t, expectedErr, err, item)
+		assert.Equal(t, expected, related, item)
+	}
+}
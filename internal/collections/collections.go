@@ -1,9 +1,19 @@
 package collections
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/metrics"
 	"qlikOrders/internal/models"
+	"sort"
 	"sync"
+	"time"
 )
 
 /*
@@ -11,38 +21,126 @@ According to https://pkg.go.dev/sync#Map, sync.Map is slower than regular maps f
 Will be using a regular map with locking rather than sync.Map.
 */
 
+// Collections stores the orders of every tenant, each method only ever sees the orders of tenantID
 type Collections interface {
-	AddOrders(newOrders []models.Order) error
-	GetItemsByCustomer(customerID string) ([]models.Item, error)
-	GetAllCustomerSummaries() ([]models.Summary, error)
+	AddOrders(tenantID string, newOrders []models.Order) error
+	GetItemsByCustomer(tenantID, customerID string) ([]models.CustomerItem, error)
+	GetOrdersByCustomer(tenantID, customerID string) ([]models.Order, error)
+	GetAllOrders(tenantID string) ([]models.Order, error)
+	// EachOrder yields the orders of a tenant one by one, the iteration stops after an error
+	EachOrder(tenantID string) iter.Seq2[models.Order, error]
+	GetCustomerSummary(tenantID, customerID string) (models.Summary, error)
+	GetAllCustomerSummaries(tenantID string) ([]models.Summary, error)
+	// EachCustomerSummary yields the summaries of the customers of a tenant one by one, sorted by customer ID
+	EachCustomerSummary(tenantID string) iter.Seq2[models.Summary, error]
+	GetRelatedItems(tenantID, itemID string, limit int) ([]models.RelatedItem, error)
+	EraseCustomer(tenantID, customerID string, mode models.ErasureMode) (models.ErasureRecord, error)
+	GetErasureRecords(tenantID string) ([]models.ErasureRecord, error)
 }
+
+// Sized is implemented by collections able to tell the size of their store
+type Sized interface {
+	Stats() Stats
+}
+
+// Pinger is implemented by collections whose store can become unavailable
+type Pinger interface {
+	// Ping returns why the store can't be used, nil when it can
+	Ping(ctx context.Context) error
+}
+
+// ErrCustomerNotFound is returned when no orders are stored for a customer
+var ErrCustomerNotFound = errors.New("customer not found or no items")
+
+// ErrItemNotFound is returned when an item is not part of any stored order
+var ErrItemNotFound = errors.New("item not found")
+
+// ErrTenantLimitExceeded is returned when storing orders would take a tenant over its limit
+var ErrTenantLimitExceeded = errors.New("tenant order limit exceeded")
+
+// TenantLimit caps what a single tenant can store, zero values mean no limit
+type TenantLimit struct {
+	MaxOrders int
+}
+
 type OrderCollection struct {
 	Orders      []models.Order
+	Erasures    []models.ErasureRecord
 	ordersMutex sync.Mutex
+
+	// DefaultLimit applies to every tenant without an entry in Limits
+	DefaultLimit TenantLimit
+	Limits       map[string]TenantLimit
+
+	// Basket indexes per tenant, built on first use, then kept up to date as orders are added or erased.
+	// generation is bumped by every change to the orders, basketsGeneration is the one the indexes are in sync with
+	// and basketsOrders the slice of orders they were built from, so orders set directly on the collection are noticed.
+	baskets           map[string]*basketIndex
+	generation        uint64
+	basketsGeneration uint64
+	basketsOrders     []models.Order
+
+	// Logger logs changes to the stored orders at debug level, the default logger when nil
+	Logger *slog.Logger
+	// Metrics records the orders stored and the time spent waiting for the lock, nothing is recorded when nil
+	Metrics *metrics.Metrics
+	// SubjectKey keys the SubjectRef of erasure records
+	SubjectKey []byte
 }
 
-// AddOrders adds a batch of orders
-func (o *OrderCollection) AddOrders(newOrders []models.Order) error {
-	o.ordersMutex.Lock()
+// Stats is the size of the store across every tenant
+type Stats struct {
+	Tenants   int `json:"tenants"`
+	Orders    int `json:"orders"`
+	Items     int `json:"items"`
+	Customers int `json:"customers"`
+	Erasures  int `json:"erasures"`
+}
+
+var (
+	_ Collections = (*OrderCollection)(nil)
+	_ Sized       = (*OrderCollection)(nil)
+	_ Pinger      = (*OrderCollection)(nil)
+)
+
+// AddOrders adds a batch of orders to a tenant, nothing is stored unless every order is valid
+func (o *OrderCollection) AddOrders(tenantID string, newOrders []models.Order) error {
+	o.lock()
 	defer o.ordersMutex.Unlock()
 
 	for _, order := range newOrders {
-		if err := validateOrder(order); err != nil {
+		if err := order.Validate(); err != nil {
 			return err
 		}
+	}
+
+	if limit := o.limit(tenantID); limit.MaxOrders > 0 && o.countOrders(tenantID)+len(newOrders) > limit.MaxOrders {
+		o.logger().Warn("tenant order limit exceeded", slog.String(logging.KeyTenantID, tenantID), slog.Int("maxOrders", limit.MaxOrders))
+		return ErrTenantLimitExceeded
+	}
+
+	inSync := o.basketsInSync()
+	for _, order := range newOrders {
+		order.TenantID = tenantID
 		o.Orders = append(o.Orders, order)
+		if basket, ok := o.baskets[tenantID]; ok {
+			basket.add(order, 1)
+		}
 	}
+	o.changed(inSync)
+	o.Metrics.OrdersStored(len(newOrders), countItems(newOrders))
+	o.logger().Debug("orders stored", slog.String(logging.KeyTenantID, tenantID), slog.Int("orders", len(newOrders)), slog.Int("storedOrders", len(o.Orders)))
 	return nil
 }
 
 // GetItemsByCustomer retrieves items for a specific customer
-func (o *OrderCollection) GetItemsByCustomer(customerID string) ([]models.CustomerItem, error) {
-	o.ordersMutex.Lock()
+func (o *OrderCollection) GetItemsByCustomer(tenantID, customerID string) ([]models.CustomerItem, error) {
+	o.lock()
 	defer o.ordersMutex.Unlock()
 
 	customerItems := []models.CustomerItem{}
 	for _, order := range o.Orders {
-		if order.CustomerID == customerID {
+		if order.Tenant() == tenantID && order.CustomerID == customerID {
 			for _, v := range order.Items {
 				// Copy over the data and add with the customer ID
 				customerItem := &models.CustomerItem{
@@ -56,19 +154,102 @@ func (o *OrderCollection) GetItemsByCustomer(customerID string) ([]models.Custom
 	}
 
 	if len(customerItems) == 0 {
-		return nil, errors.New("customer not found or no items")
+		return nil, ErrCustomerNotFound
 	}
 	return customerItems, nil
 }
 
-// GetAllCustomerSummaries provides summaries of all customers
-func (o *OrderCollection) GetAllCustomerSummaries() ([]models.Summary, error) {
-	o.ordersMutex.Lock()
+// GetOrdersByCustomer retrieves a copy of every order placed by a specific customer
+func (o *OrderCollection) GetOrdersByCustomer(tenantID, customerID string) ([]models.Order, error) {
+	o.lock()
+	defer o.ordersMutex.Unlock()
+
+	customerOrders := []models.Order{}
+	for _, order := range o.Orders {
+		if order.Tenant() == tenantID && order.CustomerID == customerID {
+			// Copy the items so callers can't modify the stored order
+			order.Items = append([]models.Item(nil), order.Items...)
+			customerOrders = append(customerOrders, order)
+		}
+	}
+
+	if len(customerOrders) == 0 {
+		return nil, ErrCustomerNotFound
+	}
+	return customerOrders, nil
+}
+
+// GetAllOrders retrieves a copy of every order of a tenant
+func (o *OrderCollection) GetAllOrders(tenantID string) ([]models.Order, error) {
+	o.lock()
+	defer o.ordersMutex.Unlock()
+
+	orders := []models.Order{}
+	for _, order := range o.Orders {
+		if order.Tenant() == tenantID {
+			order.Items = append([]models.Item(nil), order.Items...)
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// EachOrder yields a copy of every order of a tenant.
+// The orders are already in memory, only the list of them is copied before they are yielded without holding the lock.
+func (o *OrderCollection) EachOrder(tenantID string) iter.Seq2[models.Order, error] {
+	return func(yield func(models.Order, error) bool) {
+		o.lock()
+		var orders []models.Order
+		for _, order := range o.Orders {
+			if order.Tenant() == tenantID {
+				orders = append(orders, order)
+			}
+		}
+		o.ordersMutex.Unlock()
+
+		// Stored items are never changed, only replaced, so they can be copied without the lock
+		for _, order := range orders {
+			order.Items = append([]models.Item(nil), order.Items...)
+			if !yield(order, nil) {
+				return
+			}
+		}
+	}
+}
+
+// GetCustomerSummary provides the summary of a single customer
+func (o *OrderCollection) GetCustomerSummary(tenantID, customerID string) (models.Summary, error) {
+	o.lock()
+	defer o.ordersMutex.Unlock()
+
+	summary := models.Summary{CustomerID: customerID}
+	for _, order := range o.Orders {
+		if order.Tenant() != tenantID || order.CustomerID != customerID {
+			continue
+		}
+		for _, item := range order.Items {
+			summary.NbrOfPurchasedItems++
+			summary.TotalAmountEur += item.CostEur
+		}
+	}
+
+	if summary.NbrOfPurchasedItems == 0 {
+		return models.Summary{}, ErrCustomerNotFound
+	}
+	return summary, nil
+}
+
+// GetAllCustomerSummaries provides summaries of all customers of a tenant
+func (o *OrderCollection) GetAllCustomerSummaries(tenantID string) ([]models.Summary, error) {
+	o.lock()
 	defer o.ordersMutex.Unlock()
 
 	// Summarize orders for each customer using a map
 	customerSummary := make(map[string]models.Summary)
 	for _, order := range o.Orders { // Iterate over order collection
+		if order.Tenant() != tenantID {
+			continue
+		}
 
 		// for every item in current order object
 		for _, item := range order.Items {
@@ -90,18 +271,258 @@ func (o *OrderCollection) GetAllCustomerSummaries() ([]models.Summary, error) {
 	for _, summary := range customerSummary {
 		summaries = append(summaries, summary)
 	}
+
+	// Map iteration order is random, sort so responses are stable
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CustomerID < summaries[j].CustomerID
+	})
 	return summaries, nil
 }
 
-// Validates order structure to check for any missing fields
-func validateOrder(order models.Order) error {
-	if order.CustomerID == "" || order.OrderID == "" || order.Timestamp == "" || len(order.Items) == 0 {
-		return errors.New("order is missing required fields or has invalid cost")
+// EachCustomerSummary yields the summaries of all customers of a tenant
+func (o *OrderCollection) EachCustomerSummary(tenantID string) iter.Seq2[models.Summary, error] {
+	return func(yield func(models.Summary, error) bool) {
+		summaries, _ := o.GetAllCustomerSummaries(tenantID)
+		for _, summary := range summaries {
+			if !yield(summary, nil) {
+				return
+			}
+		}
+	}
+}
+
+// GetRelatedItems retrieves the items most often bought in the same order as itemID.
+// A limit of 0 returns every related item.
+func (o *OrderCollection) GetRelatedItems(tenantID, itemID string, limit int) ([]models.RelatedItem, error) {
+	o.lock()
+	defer o.ordersMutex.Unlock()
+
+	// Rebuild the indexes when a change didn't keep them in sync
+	if !o.basketsInSync() {
+		o.baskets = nil
+		o.basketsGeneration = o.generation
+		o.basketsOrders = o.Orders
+	}
+
+	basket, ok := o.baskets[tenantID]
+	if !ok {
+		basket = newBasketIndex()
+		for _, order := range o.Orders {
+			if order.Tenant() == tenantID {
+				basket.add(order, 1)
+			}
+		}
+		if o.baskets == nil {
+			o.baskets = make(map[string]*basketIndex)
+		}
+		o.baskets[tenantID] = basket
+	}
+
+	related, ok := basket.related(itemID, limit)
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	return related, nil
+}
+
+// EraseCustomer removes or pseudonymizes every order of a customer and records the erasure.
+// Summaries are derived from the stored orders, so they reflect the erasure straight away.
+func (o *OrderCollection) EraseCustomer(tenantID, customerID string, mode models.ErasureMode) (models.ErasureRecord, error) {
+	o.lock()
+	defer o.ordersMutex.Unlock()
+
+	record := models.ErasureRecord{
+		TenantID:   tenantID,
+		SubjectRef: SubjectRef(o.SubjectKey, customerID),
+		Mode:       mode,
 	}
-	for _, item := range order.Items {
-		if item.ItemID == "" || item.CostEur <= 0 {
-			return errors.New("item is missing required fields or has invalid cost")
+
+	var pseudonym string
+	if mode == models.ErasureModePseudonymize {
+		var err error
+		if pseudonym, err = newPseudonym(); err != nil {
+			return models.ErasureRecord{}, err
 		}
+	} else if mode != models.ErasureModeDelete {
+		return models.ErasureRecord{}, errors.New("unknown erasure mode")
 	}
-	return nil
+
+	inSync := o.basketsInSync()
+	basket := o.baskets[tenantID]
+
+	// Filter in place, keeping every order that doesn't belong to the customer
+	kept := o.Orders[:0]
+	for _, order := range o.Orders {
+		if order.Tenant() != tenantID || order.CustomerID != customerID {
+			kept = append(kept, order)
+			continue
+		}
+		record.OrdersAffected++
+		record.ItemsAffected += len(order.Items)
+		record.OrderIDs = append(record.OrderIDs, order.OrderID)
+		if mode == models.ErasureModePseudonymize {
+			order.CustomerID = pseudonym
+			kept = append(kept, order)
+		} else if basket != nil {
+			basket.add(order, -1)
+		}
+	}
+
+	if record.OrdersAffected == 0 {
+		return models.ErasureRecord{}, ErrCustomerNotFound
+	}
+
+	// Clear the tail so erased orders don't linger in the backing array
+	clear(o.Orders[len(kept):])
+	o.Orders = kept
+	o.changed(inSync)
+
+	id, err := randomHex(8)
+	if err != nil {
+		return models.ErasureRecord{}, err
+	}
+	record.ErasureID = id
+	record.ErasedAt = time.Now().UTC().Format(time.RFC3339)
+	o.Erasures = append(o.Erasures, record)
+	o.logger().Debug("customer erased",
+		slog.String(logging.KeyTenantID, tenantID),
+		slog.String(logging.KeyCustomerID, customerID),
+		slog.String("mode", string(mode)),
+		slog.Int("ordersAffected", record.OrdersAffected),
+	)
+	return record, nil
+}
+
+// GetErasureRecords returns the audit records of all erasures performed for a tenant
+func (o *OrderCollection) GetErasureRecords(tenantID string) ([]models.ErasureRecord, error) {
+	o.lock()
+	defer o.ordersMutex.Unlock()
+
+	records := []models.ErasureRecord{}
+	for _, record := range o.Erasures {
+		if record.TenantID == tenantID {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// Stats counts what is stored across every tenant, customers are counted once per tenant
+func (o *OrderCollection) Stats() Stats {
+	// Metrics scrapes call it, their wait isn't recorded so the lock wait stays the one of the API
+	o.ordersMutex.Lock()
+	defer o.ordersMutex.Unlock()
+
+	type customer struct{ tenantID, customerID string }
+	tenants := make(map[string]struct{})
+	customers := make(map[customer]struct{})
+	stats := Stats{Orders: len(o.Orders), Erasures: len(o.Erasures)}
+	for _, order := range o.Orders {
+		tenants[order.Tenant()] = struct{}{}
+		customers[customer{order.Tenant(), order.CustomerID}] = struct{}{}
+		stats.Items += len(order.Items)
+	}
+	stats.Tenants = len(tenants)
+	stats.Customers = len(customers)
+	return stats
+}
+
+// Ping checks the orders can be reached, it fails when the lock isn't acquired before ctx is done.
+// The orders are in memory, so a lock held for that long is the only way they can't be.
+func (o *OrderCollection) Ping(ctx context.Context) error {
+	acquired := make(chan struct{})
+	go func() {
+		o.ordersMutex.Lock()
+		o.ordersMutex.Unlock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("order collection lock not acquired: %w", ctx.Err())
+	}
+}
+
+// basketsInSync tells whether the basket indexes reflect every change made to the orders
+func (o *OrderCollection) basketsInSync() bool {
+	return o.basketsGeneration == o.generation && sameSlice(o.Orders, o.basketsOrders)
+}
+
+// changed records a change to the orders, the basket indexes stay in sync when they were before it and followed the change
+func (o *OrderCollection) changed(basketsFollowed bool) {
+	o.generation++
+	if basketsFollowed {
+		o.basketsGeneration = o.generation
+		o.basketsOrders = o.Orders
+	}
+}
+
+// sameSlice tells whether a and b are the same slice of the same backing array
+func sameSlice(a, b []models.Order) bool {
+	return len(a) == len(b) && cap(a) == cap(b) && (cap(a) == 0 || &a[:1][0] == &b[:1][0])
+}
+
+// lock acquires the lock of the collection, recording how long it waited for it
+func (o *OrderCollection) lock() {
+	start := time.Now()
+	o.ordersMutex.Lock()
+	o.Metrics.MutexWaited(time.Since(start))
+}
+
+func (o *OrderCollection) logger() *slog.Logger {
+	if o.Logger == nil {
+		return slog.Default()
+	}
+	return o.Logger
+}
+
+// limit returns the limit applying to a tenant
+func (o *OrderCollection) limit(tenantID string) TenantLimit {
+	if limit, ok := o.Limits[tenantID]; ok {
+		return limit
+	}
+	return o.DefaultLimit
+}
+
+func countItems(orders []models.Order) int {
+	items := 0
+	for _, order := range orders {
+		items += len(order.Items)
+	}
+	return items
+}
+
+func (o *OrderCollection) countOrders(tenantID string) int {
+	count := 0
+	for _, order := range o.Orders {
+		if order.Tenant() == tenantID {
+			count++
+		}
+	}
+	return count
+}
+
+// SubjectRef hashes a customer ID with the HMAC key so erasure records never hold the identifier itself.
+// Keyed like the logs, the redacted customer IDs logged are its first 16 hex digits.
+func SubjectRef(key []byte, customerID string) string {
+	return logging.HashCustomerID(key, customerID)
+}
+
+// newPseudonym generates a random identifier that can't be linked back to the customer
+func newPseudonym() (string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+	return "anon-" + id, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
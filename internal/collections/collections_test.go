@@ -1,12 +1,17 @@
 package collections
 
 import (
+	"context"
 	"qlikOrders/internal/models"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// Orders seeded without a tenant belong to the default tenant
+const testTenant = models.DefaultTenantID
+
 // Helper function to reset the orders slice for each test case
 func resetOrders(orderData *OrderCollection) {
 	orderData.Orders = []models.Order{}
@@ -28,7 +33,7 @@ func TestAddOrders(t *testing.T) {
 			},
 		}
 
-		err := orderCollection.AddOrders(orders)
+		err := orderCollection.AddOrders(testTenant, orders)
 		assert.Nil(t, err, "Expected no error")
 	})
 
@@ -44,7 +49,7 @@ func TestAddOrders(t *testing.T) {
 			},
 		}
 
-		err := orderCollection.AddOrders(orders)
+		err := orderCollection.AddOrders(testTenant, orders)
 		assert.Error(t, err, "Expected error for invalid order")
 
 	})
@@ -59,7 +64,7 @@ func TestAddOrders(t *testing.T) {
 				},
 			},
 		}
-		err := orderCollection.AddOrders(orders)
+		err := orderCollection.AddOrders(testTenant, orders)
 		assert.Error(t, err, "Expected error for invalid order")
 	})
 	t.Run("Invalid order missing timestamp", func(t *testing.T) {
@@ -73,7 +78,7 @@ func TestAddOrders(t *testing.T) {
 				},
 			},
 		}
-		err := orderCollection.AddOrders(orders)
+		err := orderCollection.AddOrders(testTenant, orders)
 		assert.Error(t, err, "Expected error for invalid order")
 	})
 	t.Run("Invalid order missing item ID", func(t *testing.T) {
@@ -87,7 +92,7 @@ func TestAddOrders(t *testing.T) {
 				},
 			},
 		}
-		err := orderCollection.AddOrders(orders)
+		err := orderCollection.AddOrders(testTenant, orders)
 		assert.Error(t, err, "Expected error for invalid order")
 	})
 	t.Run("Invalid order missing invalid currency", func(t *testing.T) {
@@ -101,7 +106,7 @@ func TestAddOrders(t *testing.T) {
 				},
 			},
 		}
-		err := orderCollection.AddOrders(orders)
+		err := orderCollection.AddOrders(testTenant, orders)
 		assert.Error(t, err, "Expected error for invalid order")
 	})
 }
@@ -130,10 +135,10 @@ func TestGetItemsByCustomer(t *testing.T) {
 			},
 		},
 	}
-	orderCollection.AddOrders(orders)
+	orderCollection.AddOrders(testTenant, orders)
 
 	t.Run("Get items by existing customer", func(t *testing.T) {
-		items, err := orderCollection.GetItemsByCustomer("01")
+		items, err := orderCollection.GetItemsByCustomer(testTenant, "01")
 
 		assert.NoError(t, err, "Expected no error")
 		assert.Len(t, items, 2, "Expected 2 items")
@@ -141,7 +146,7 @@ func TestGetItemsByCustomer(t *testing.T) {
 
 	t.Run("Get items by non-existing customer", func(t *testing.T) {
 		resetOrders(orderCollection)
-		_, err := orderCollection.GetItemsByCustomer("01")
+		_, err := orderCollection.GetItemsByCustomer(testTenant, "01")
 
 		assert.Error(t, err, "Expected error retrieving non existing customer")
 	})
@@ -187,10 +192,10 @@ func TestGetAllCustomerSummaries(t *testing.T) {
 		},
 	}
 
-	orderCollection.AddOrders(orders)
+	orderCollection.AddOrders(testTenant, orders)
 
 	t.Run("Get summaries of all customers", func(t *testing.T) {
-		summaries, err := orderCollection.GetAllCustomerSummaries()
+		summaries, err := orderCollection.GetAllCustomerSummaries(testTenant)
 
 		assert.NoError(t, err)
 		assert.Len(t, summaries, 2, "expected length of summaries is 2")
@@ -201,9 +206,158 @@ func TestGetAllCustomerSummaries(t *testing.T) {
 
 	t.Run("Get summaries of all customers empty case", func(t *testing.T) {
 		resetOrders(orderCollection)
-		summaries, err := orderCollection.GetAllCustomerSummaries()
+		summaries, err := orderCollection.GetAllCustomerSummaries(testTenant)
 
 		assert.NoError(t, err)
 		assert.Len(t, summaries, 0, "length should be 0")
 	})
 }
+
+func TestGetOrdersByCustomer(t *testing.T) {
+	orderCollection := &OrderCollection{}
+	defer resetOrders(orderCollection) // Clean up after test
+
+	orderCollection.AddOrders(testTenant, []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}}},
+		{CustomerID: "02", OrderID: "200", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "item3", CostEur: 20}}},
+	})
+
+	t.Run("Get orders by existing customer", func(t *testing.T) {
+		orders, err := orderCollection.GetOrdersByCustomer(testTenant, "01")
+
+		assert.NoError(t, err)
+		assert.Len(t, orders, 1)
+		assert.Equal(t, "100", orders[0].OrderID)
+
+		// Modifying the returned order must not change the stored one
+		orders[0].Items[0].CostEur = 99
+		assert.Equal(t, 10, orderCollection.Orders[0].Items[0].CostEur)
+	})
+
+	t.Run("Get orders by non-existing customer", func(t *testing.T) {
+		_, err := orderCollection.GetOrdersByCustomer(testTenant, "99")
+
+		assert.ErrorIs(t, err, ErrCustomerNotFound)
+	})
+}
+
+func TestEraseCustomer(t *testing.T) {
+	seed := func() *OrderCollection {
+		orderCollection := &OrderCollection{}
+		orderCollection.AddOrders(testTenant, []models.Order{
+			{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}}},
+			{CustomerID: "02", OrderID: "200", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "item3", CostEur: 20}}},
+			{CustomerID: "01", OrderID: "101", Timestamp: "1637245070543", Items: []models.Item{{ItemID: "item2", CostEur: 5}}},
+		})
+		return orderCollection
+	}
+
+	t.Run("Delete customer orders", func(t *testing.T) {
+		orderCollection := seed()
+		record, err := orderCollection.EraseCustomer(testTenant, "01", models.ErasureModeDelete)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, record.OrdersAffected)
+		assert.Equal(t, []string{"100", "101"}, record.OrderIDs)
+		assert.NotEmpty(t, record.ErasureID)
+		assert.Len(t, orderCollection.Orders, 1)
+		assert.Equal(t, "02", orderCollection.Orders[0].CustomerID)
+	})
+
+	t.Run("Pseudonymize customer orders", func(t *testing.T) {
+		orderCollection := seed()
+		_, err := orderCollection.EraseCustomer(testTenant, "01", models.ErasureModePseudonymize)
+		assert.NoError(t, err)
+
+		summaries, _ := orderCollection.GetAllCustomerSummaries(testTenant)
+		assert.Len(t, summaries, 2)
+		for _, summary := range summaries {
+			assert.NotEqual(t, "01", summary.CustomerID)
+		}
+
+		// Both orders share the same pseudonym so the summary stays consistent
+		assert.Equal(t, orderCollection.Orders[0].CustomerID, orderCollection.Orders[2].CustomerID)
+	})
+
+	t.Run("Erase non-existing customer", func(t *testing.T) {
+		orderCollection := seed()
+		_, err := orderCollection.EraseCustomer(testTenant, "99", models.ErasureModeDelete)
+
+		assert.ErrorIs(t, err, ErrCustomerNotFound)
+		records, _ := orderCollection.GetErasureRecords(testTenant)
+		assert.Empty(t, records)
+	})
+}
+
+func TestTenantIsolation(t *testing.T) {
+	orderCollection := &OrderCollection{}
+
+	orderCollection.AddOrders("acme", []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}}},
+	})
+	orderCollection.AddOrders("globex", []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item2", CostEur: 20}}},
+	})
+
+	items, err := orderCollection.GetItemsByCustomer("acme", "01")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.CustomerItem{{CustomerID: "01", ItemID: "item1", CostEur: 10}}, items)
+
+	summaries, err := orderCollection.GetAllCustomerSummaries("globex")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Summary{{CustomerID: "01", NbrOfPurchasedItems: 1, TotalAmountEur: 20}}, summaries)
+
+	_, err = orderCollection.GetOrdersByCustomer(testTenant, "01")
+	assert.ErrorIs(t, err, ErrCustomerNotFound)
+
+	_, err = orderCollection.EraseCustomer("acme", "01", models.ErasureModeDelete)
+	assert.NoError(t, err)
+	_, err = orderCollection.GetOrdersByCustomer("globex", "01")
+	assert.NoError(t, err, "erasure must not reach other tenants")
+
+	records, _ := orderCollection.GetErasureRecords("globex")
+	assert.Empty(t, records)
+}
+
+func TestTenantLimit(t *testing.T) {
+	orderCollection := &OrderCollection{Limits: map[string]TenantLimit{"acme": {MaxOrders: 1}}}
+	orders := []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}}},
+		{CustomerID: "01", OrderID: "101", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}}},
+	}
+
+	err := orderCollection.AddOrders("acme", orders)
+	assert.ErrorIs(t, err, ErrTenantLimitExceeded)
+	assert.Empty(t, orderCollection.Orders, "nothing is stored when the batch exceeds the limit")
+
+	assert.NoError(t, orderCollection.AddOrders("acme", orders[:1]))
+	assert.NoError(t, orderCollection.AddOrders("globex", orders), "tenants without a limit are not capped")
+}
+
+func TestStats(t *testing.T) {
+	orderCollection := &OrderCollection{}
+	orderCollection.AddOrders("acme", []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}, {ItemID: "item2", CostEur: 5}}},
+		{CustomerID: "01", OrderID: "101", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}}},
+	})
+	orderCollection.AddOrders("globex", []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item2", CostEur: 20}}},
+		{CustomerID: "02", OrderID: "101", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item2", CostEur: 20}}},
+	})
+	orderCollection.EraseCustomer("globex", "02", models.ErasureModeDelete)
+
+	// Customers with the same ID in two tenants are different customers
+	assert.Equal(t, Stats{Tenants: 2, Orders: 3, Items: 4, Customers: 2, Erasures: 1}, orderCollection.Stats())
+}
+
+func TestPing(t *testing.T) {
+	orderCollection := &OrderCollection{}
+	assert.NoError(t, orderCollection.Ping(context.Background()))
+
+	// A lock held for longer than the deadline makes the orders unreachable
+	orderCollection.ordersMutex.Lock()
+	defer orderCollection.ordersMutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, orderCollection.Ping(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,66 @@
+package collections
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", "file::memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "create_orders", migrations[0].Name)
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations := []Migration{
+		{Version: 1, Name: "create_a", SQL: `CREATE TABLE a (id INTEGER PRIMARY KEY)`},
+		{Version: 2, Name: "create_b", SQL: `CREATE TABLE b (id INTEGER PRIMARY KEY); CREATE INDEX b_id ON b (id)`},
+	}
+
+	applied, err := Migrate(ctx, db, migrations[:1])
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+
+	// Only migrations newer than the schema are applied
+	applied, err = Migrate(ctx, db, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	applied, err = Migrate(ctx, db, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	var versions int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&versions))
+	assert.Equal(t, 2, versions)
+
+	t.Run("Failed migrations are rolled back", func(t *testing.T) {
+		failing := append(migrations, Migration{Version: 3, Name: "broken", SQL: `CREATE TABLE c (id INTEGER); INSERT INTO missing VALUES (1)`})
+		_, err := Migrate(ctx, db, failing)
+		assert.ErrorContains(t, err, "migration 3 broken")
+
+		var tables int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'c'`).Scan(&tables))
+		assert.Zero(t, tables)
+	})
+
+	t.Run("Newer schema", func(t *testing.T) {
+		_, err := Migrate(ctx, db, migrations[:1])
+		assert.ErrorContains(t, err, "newer")
+	})
+}
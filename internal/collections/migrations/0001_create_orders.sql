@@ -0,0 +1,42 @@
+-- Customers are stored once per tenant, so pseudonymizing one updates a single row
+CREATE TABLE customers (
+    id          INTEGER PRIMARY KEY,
+    tenant_id   TEXT NOT NULL,
+    customer_id TEXT NOT NULL,
+    UNIQUE (tenant_id, customer_id)
+);
+
+-- Order IDs aren't unique, like in memory, orders are listed in the order they were added
+CREATE TABLE orders (
+    id           INTEGER PRIMARY KEY,
+    tenant_id    TEXT NOT NULL,
+    customer_ref INTEGER NOT NULL REFERENCES customers (id),
+    order_id     TEXT NOT NULL,
+    timestamp    TEXT NOT NULL
+);
+
+CREATE INDEX orders_tenant ON orders (tenant_id);
+CREATE INDEX orders_customer ON orders (customer_ref);
+
+CREATE TABLE items (
+    id        INTEGER PRIMARY KEY,
+    order_ref INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    item_id   TEXT NOT NULL,
+    cost_eur  INTEGER NOT NULL CHECK (cost_eur > 0)
+);
+
+CREATE INDEX items_order ON items (order_ref);
+CREATE INDEX items_item ON items (item_id);
+
+CREATE TABLE erasures (
+    id              INTEGER PRIMARY KEY,
+    erasure_id      TEXT NOT NULL UNIQUE,
+    tenant_id       TEXT NOT NULL,
+    subject_ref     TEXT NOT NULL,
+    mode            TEXT NOT NULL,
+    orders_affected INTEGER NOT NULL,
+    items_affected  INTEGER NOT NULL,
+    erased_at       TEXT NOT NULL
+);
+
+CREATE INDEX erasures_tenant ON erasures (tenant_id);
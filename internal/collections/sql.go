@@ -0,0 +1,539 @@
+package collections
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/metrics"
+	"qlikOrders/internal/models"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver, registered as "sqlite"
+)
+
+/*
+SQLCollection keeps orders in the tables created by the migrations: customers, orders and their items,
+plus the erasure records. Summaries and related items are counted by the database rather than by looping
+over every order, the queries are written for SQLite.
+*/
+
+// SQLCollection stores the orders of every tenant in a SQL database
+type SQLCollection struct {
+	DB *sql.DB
+
+	// DefaultLimit applies to every tenant without an entry in Limits
+	DefaultLimit TenantLimit
+	Limits       map[string]TenantLimit
+
+	// Logger logs changes to the stored orders at debug level, the default logger when nil
+	Logger *slog.Logger
+	// Metrics records the orders stored, nothing is recorded when nil
+	Metrics *metrics.Metrics
+	// SubjectKey keys the SubjectRef of erasure records
+	SubjectKey []byte
+}
+
+var (
+	_ Collections = (*SQLCollection)(nil)
+	_ Sized       = (*SQLCollection)(nil)
+	_ Pinger      = (*SQLCollection)(nil)
+)
+
+// OpenSQLite opens the SQLite database at path, creating it when it doesn't exist, and migrates its schema.
+// A path of ":memory:" keeps the database in memory for as long as the collection is open.
+func OpenSQLite(path string) (*SQLCollection, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer, a single connection also keeps an in-memory database alive between queries
+	db.SetMaxOpenConns(1)
+
+	migrations, err := Migrations()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := Migrate(context.Background(), db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLCollection{DB: db}, nil
+}
+
+// Close closes the database
+func (s *SQLCollection) Close() error {
+	return s.DB.Close()
+}
+
+// AddOrders adds a batch of orders to a tenant in a single transaction, nothing is stored unless every order is valid
+func (s *SQLCollection) AddOrders(tenantID string, newOrders []models.Order) error {
+	for _, order := range newOrders {
+		if err := order.Validate(); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	err := inTx(ctx, s.DB, func(tx *sql.Tx) error {
+		if limit := s.limit(tenantID); limit.MaxOrders > 0 {
+			var stored int
+			if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders WHERE tenant_id = ?`, tenantID).Scan(&stored); err != nil {
+				return err
+			}
+			if stored+len(newOrders) > limit.MaxOrders {
+				s.logger().Warn("tenant order limit exceeded", slog.String(logging.KeyTenantID, tenantID), slog.Int("maxOrders", limit.MaxOrders))
+				return ErrTenantLimitExceeded
+			}
+		}
+
+		insertCustomer, err := tx.PrepareContext(ctx, `INSERT INTO customers (tenant_id, customer_id) VALUES (?, ?)
+			ON CONFLICT (tenant_id, customer_id) DO UPDATE SET customer_id = excluded.customer_id
+			RETURNING id`)
+		if err != nil {
+			return err
+		}
+		defer insertCustomer.Close()
+		insertOrder, err := tx.PrepareContext(ctx, `INSERT INTO orders (tenant_id, customer_ref, order_id, timestamp) VALUES (?, ?, ?, ?) RETURNING id`)
+		if err != nil {
+			return err
+		}
+		defer insertOrder.Close()
+		insertItem, err := tx.PrepareContext(ctx, `INSERT INTO items (order_ref, item_id, cost_eur) VALUES (?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertItem.Close()
+
+		customerRefs := make(map[string]int64)
+		for _, order := range newOrders {
+			customerRef, ok := customerRefs[order.CustomerID]
+			if !ok {
+				if err := insertCustomer.QueryRowContext(ctx, tenantID, order.CustomerID).Scan(&customerRef); err != nil {
+					return err
+				}
+				customerRefs[order.CustomerID] = customerRef
+			}
+
+			var orderRef int64
+			if err := insertOrder.QueryRowContext(ctx, tenantID, customerRef, order.OrderID, order.Timestamp).Scan(&orderRef); err != nil {
+				return err
+			}
+			for _, item := range order.Items {
+				if _, err := insertItem.ExecContext(ctx, orderRef, item.ItemID, item.CostEur); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Metrics.OrdersStored(len(newOrders), countItems(newOrders))
+	s.logger().Debug("orders stored", slog.String(logging.KeyTenantID, tenantID), slog.Int("orders", len(newOrders)))
+	return nil
+}
+
+// GetItemsByCustomer retrieves items for a specific customer
+func (s *SQLCollection) GetItemsByCustomer(tenantID, customerID string) ([]models.CustomerItem, error) {
+	rows, err := s.DB.Query(`SELECT i.item_id, i.cost_eur
+		FROM items i
+		JOIN orders o ON o.id = i.order_ref
+		JOIN customers c ON c.id = o.customer_ref
+		WHERE c.tenant_id = ? AND c.customer_id = ?
+		ORDER BY o.id, i.id`, tenantID, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customerItems := []models.CustomerItem{}
+	for rows.Next() {
+		item := models.CustomerItem{CustomerID: customerID}
+		if err := rows.Scan(&item.ItemID, &item.CostEur); err != nil {
+			return nil, err
+		}
+		customerItems = append(customerItems, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(customerItems) == 0 {
+		return nil, ErrCustomerNotFound
+	}
+	return customerItems, nil
+}
+
+// GetOrdersByCustomer retrieves every order placed by a specific customer
+func (s *SQLCollection) GetOrdersByCustomer(tenantID, customerID string) ([]models.Order, error) {
+	orders, _, err := s.queryOrders(tenantID, "AND c.customer_id = ?", customerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrCustomerNotFound
+	}
+	return orders, nil
+}
+
+// GetAllOrders retrieves every order of a tenant
+func (s *SQLCollection) GetAllOrders(tenantID string) ([]models.Order, error) {
+	orders, _, err := s.queryOrders(tenantID, "")
+	return orders, err
+}
+
+// pageSize is the number of orders or summaries EachOrder and EachCustomerSummary read per query
+const pageSize = 1000
+
+// EachOrder yields every order of a tenant, read a page at a time so the connection isn't held while they are consumed.
+// Pages are read by separate queries, orders stored or erased in between may or may not be yielded.
+func (s *SQLCollection) EachOrder(tenantID string) iter.Seq2[models.Order, error] {
+	return func(yield func(models.Order, error) bool) {
+		var after int64
+		for {
+			orders, last, err := s.queryOrders(tenantID,
+				"AND o.id IN (SELECT id FROM orders WHERE tenant_id = ? AND id > ? ORDER BY id LIMIT ?)", tenantID, after, pageSize)
+			if err != nil {
+				yield(models.Order{}, err)
+				return
+			}
+			for _, order := range orders {
+				if !yield(order, nil) {
+					return
+				}
+			}
+			if len(orders) < pageSize {
+				return
+			}
+			after = last
+		}
+	}
+}
+
+// GetCustomerSummary provides the summary of a single customer
+func (s *SQLCollection) GetCustomerSummary(tenantID, customerID string) (models.Summary, error) {
+	summaries, err := s.querySummaries(tenantID, "AND c.customer_id = ?", 0, customerID)
+	if err != nil {
+		return models.Summary{}, err
+	}
+	if len(summaries) == 0 {
+		return models.Summary{}, ErrCustomerNotFound
+	}
+	return summaries[0], nil
+}
+
+// GetAllCustomerSummaries provides summaries of all customers of a tenant
+func (s *SQLCollection) GetAllCustomerSummaries(tenantID string) ([]models.Summary, error) {
+	return s.querySummaries(tenantID, "", 0)
+}
+
+// EachCustomerSummary yields the summaries of all customers of a tenant, read a page at a time like EachOrder
+func (s *SQLCollection) EachCustomerSummary(tenantID string) iter.Seq2[models.Summary, error] {
+	return func(yield func(models.Summary, error) bool) {
+		filter, args := "", []any{}
+		for {
+			summaries, err := s.querySummaries(tenantID, filter, pageSize, args...)
+			if err != nil {
+				yield(models.Summary{}, err)
+				return
+			}
+			for _, summary := range summaries {
+				if !yield(summary, nil) {
+					return
+				}
+			}
+			if len(summaries) < pageSize {
+				return
+			}
+			filter, args = "AND c.customer_id > ?", []any{summaries[len(summaries)-1].CustomerID}
+		}
+	}
+}
+
+// GetRelatedItems retrieves the items most often bought in the same order as itemID.
+// A limit of 0 returns every related item.
+func (s *SQLCollection) GetRelatedItems(tenantID, itemID string, limit int) ([]models.RelatedItem, error) {
+	ctx := context.Background()
+	related := []models.RelatedItem{}
+	// A transaction reads the counts of the same orders
+	err := inTx(ctx, s.DB, func(tx *sql.Tx) error {
+		var orders, itemOrders int
+		if err := tx.QueryRowContext(ctx, `SELECT
+			(SELECT COUNT(*) FROM orders WHERE tenant_id = ?),
+			(SELECT COUNT(DISTINCT i.order_ref) FROM items i JOIN orders o ON o.id = i.order_ref WHERE o.tenant_id = ? AND i.item_id = ?)`,
+			tenantID, tenantID, itemID).Scan(&orders, &itemOrders); err != nil {
+			return err
+		}
+		if itemOrders == 0 {
+			return ErrItemNotFound
+		}
+
+		// Baskets count items bought several times in an order once
+		rows, err := tx.QueryContext(ctx, `WITH baskets AS (
+				SELECT DISTINCT i.order_ref, i.item_id
+				FROM items i
+				JOIN orders o ON o.id = i.order_ref
+				WHERE o.tenant_id = ?
+			),
+			item_orders AS (
+				SELECT item_id, COUNT(*) AS orders FROM baskets GROUP BY item_id
+			)
+			SELECT other.item_id, COUNT(*), item_orders.orders
+			FROM baskets item
+			JOIN baskets other ON other.order_ref = item.order_ref AND other.item_id <> item.item_id
+			JOIN item_orders ON item_orders.item_id = other.item_id
+			WHERE item.item_id = ?
+			GROUP BY other.item_id, item_orders.orders`, tenantID, itemID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var other string
+			var count, otherOrders int
+			if err := rows.Scan(&other, &count, &otherOrders); err != nil {
+				return err
+			}
+			related = append(related, relatedItem(other, count, itemOrders, otherOrders, orders))
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rankRelated(related, limit), nil
+}
+
+// EraseCustomer removes or pseudonymizes every order of a customer and records the erasure, in a single transaction
+func (s *SQLCollection) EraseCustomer(tenantID, customerID string, mode models.ErasureMode) (models.ErasureRecord, error) {
+	record := models.ErasureRecord{
+		TenantID:   tenantID,
+		SubjectRef: SubjectRef(s.SubjectKey, customerID),
+		Mode:       mode,
+	}
+
+	var pseudonym string
+	if mode == models.ErasureModePseudonymize {
+		var err error
+		if pseudonym, err = newPseudonym(); err != nil {
+			return models.ErasureRecord{}, err
+		}
+	} else if mode != models.ErasureModeDelete {
+		return models.ErasureRecord{}, errors.New("unknown erasure mode")
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return models.ErasureRecord{}, err
+	}
+	record.ErasureID = id
+	record.ErasedAt = time.Now().UTC().Format(time.RFC3339)
+
+	ctx := context.Background()
+	err = inTx(ctx, s.DB, func(tx *sql.Tx) error {
+		var customerRef int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM customers WHERE tenant_id = ? AND customer_id = ?`, tenantID, customerID).Scan(&customerRef)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCustomerNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT o.order_id, COUNT(i.id)
+			FROM orders o
+			LEFT JOIN items i ON i.order_ref = o.id
+			WHERE o.customer_ref = ?
+			GROUP BY o.id
+			ORDER BY o.id`, customerRef)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var orderID string
+			var items int
+			if err := rows.Scan(&orderID, &items); err != nil {
+				return err
+			}
+			record.OrdersAffected++
+			record.ItemsAffected += items
+			record.OrderIDs = append(record.OrderIDs, orderID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if record.OrdersAffected == 0 {
+			return ErrCustomerNotFound
+		}
+
+		if mode == models.ErasureModePseudonymize {
+			if _, err := tx.ExecContext(ctx, `UPDATE customers SET customer_id = ? WHERE id = ?`, pseudonym, customerRef); err != nil {
+				return err
+			}
+		} else {
+			for _, statement := range []string{
+				`DELETE FROM items WHERE order_ref IN (SELECT id FROM orders WHERE customer_ref = ?)`,
+				`DELETE FROM orders WHERE customer_ref = ?`,
+				`DELETE FROM customers WHERE id = ?`,
+			} {
+				if _, err := tx.ExecContext(ctx, statement, customerRef); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO erasures (erasure_id, tenant_id, subject_ref, mode, orders_affected, items_affected, erased_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			record.ErasureID, tenantID, record.SubjectRef, string(mode), record.OrdersAffected, record.ItemsAffected, record.ErasedAt)
+		return err
+	})
+	if err != nil {
+		return models.ErasureRecord{}, err
+	}
+
+	s.logger().Debug("customer erased",
+		slog.String(logging.KeyTenantID, tenantID),
+		slog.String(logging.KeyCustomerID, customerID),
+		slog.String("mode", string(mode)),
+		slog.Int("ordersAffected", record.OrdersAffected),
+	)
+	return record, nil
+}
+
+// GetErasureRecords returns the audit records of all erasures performed for a tenant
+func (s *SQLCollection) GetErasureRecords(tenantID string) ([]models.ErasureRecord, error) {
+	rows, err := s.DB.Query(`SELECT erasure_id, subject_ref, mode, orders_affected, items_affected, erased_at
+		FROM erasures
+		WHERE tenant_id = ?
+		ORDER BY id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []models.ErasureRecord{}
+	for rows.Next() {
+		record := models.ErasureRecord{TenantID: tenantID}
+		if err := rows.Scan(&record.ErasureID, &record.SubjectRef, &record.Mode, &record.OrdersAffected, &record.ItemsAffected, &record.ErasedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Stats counts what is stored across every tenant, customers are counted once per tenant.
+// Failures are logged and counted as an empty store.
+func (s *SQLCollection) Stats() Stats {
+	var stats Stats
+	err := s.DB.QueryRow(`SELECT
+		(SELECT COUNT(DISTINCT tenant_id) FROM orders),
+		(SELECT COUNT(*) FROM orders),
+		(SELECT COUNT(*) FROM items),
+		(SELECT COUNT(DISTINCT customer_ref) FROM orders),
+		(SELECT COUNT(*) FROM erasures)`).Scan(&stats.Tenants, &stats.Orders, &stats.Items, &stats.Customers, &stats.Erasures)
+	if err != nil {
+		s.logger().Error("failed to count stored orders", slog.String(logging.KeyError, err.Error()))
+		return Stats{}
+	}
+	return stats
+}
+
+// Ping checks the database can be reached before ctx is done
+func (s *SQLCollection) Ping(ctx context.Context) error {
+	if err := s.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+	return nil
+}
+
+// queryOrders lists the orders of a tenant in the order they were added, filter adds conditions on o and c
+func (s *SQLCollection) queryOrders(tenantID, filter string, args ...any) (orders []models.Order, lastRef int64, err error) {
+	rows, err := s.DB.Query(`SELECT o.id, c.customer_id, o.order_id, o.timestamp, i.item_id, i.cost_eur
+		FROM orders o
+		JOIN customers c ON c.id = o.customer_ref
+		JOIN items i ON i.order_ref = o.id
+		WHERE o.tenant_id = ? `+filter+`
+		ORDER BY o.id, i.id`, append([]any{tenantID}, args...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	orders = []models.Order{}
+	for rows.Next() {
+		var ref int64
+		var order models.Order
+		var item models.Item
+		if err := rows.Scan(&ref, &order.CustomerID, &order.OrderID, &order.Timestamp, &item.ItemID, &item.CostEur); err != nil {
+			return nil, 0, err
+		}
+		// Rows of the same order follow each other, the first one starts the order
+		if len(orders) == 0 || ref != lastRef {
+			order.TenantID = tenantID
+			orders = append(orders, order)
+			lastRef = ref
+		}
+		last := &orders[len(orders)-1]
+		last.Items = append(last.Items, item)
+	}
+	return orders, lastRef, rows.Err()
+}
+
+// querySummaries sums the items of every customer of a tenant, filter adds conditions on c.
+// A limit above 0 only returns the first summaries.
+func (s *SQLCollection) querySummaries(tenantID, filter string, limit int, args ...any) ([]models.Summary, error) {
+	query := `SELECT c.customer_id, COUNT(*), SUM(i.cost_eur)
+		FROM items i
+		JOIN orders o ON o.id = i.order_ref
+		JOIN customers c ON c.id = o.customer_ref
+		WHERE c.tenant_id = ? ` + filter + `
+		GROUP BY c.id, c.customer_id
+		ORDER BY c.customer_id`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := s.DB.Query(query, append([]any{tenantID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.Summary{}
+	for rows.Next() {
+		var summary models.Summary
+		if err := rows.Scan(&summary.CustomerID, &summary.NbrOfPurchasedItems, &summary.TotalAmountEur); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+func (s *SQLCollection) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+// limit returns the limit applying to a tenant
+func (s *SQLCollection) limit(tenantID string) TenantLimit {
+	if limit, ok := s.Limits[tenantID]; ok {
+		return limit
+	}
+	return s.DefaultLimit
+}
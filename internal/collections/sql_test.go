@@ -0,0 +1,290 @@
+package collections
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"path/filepath"
+	"qlikOrders/internal/models"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestSQLite(t *testing.T) *SQLCollection {
+	sqlCollection, err := OpenSQLite(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlCollection.Close() })
+	return sqlCollection
+}
+
+var sqlTestOrders = []models.Order{
+	{CustomerID: "02", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "butter", CostEur: 3}}},
+	{CustomerID: "01", OrderID: "200", Timestamp: "1637245070523", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "butter", CostEur: 3}, {ItemID: "jam", CostEur: 4}}},
+	{CustomerID: "03", OrderID: "300", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "bread", CostEur: 2}, {ItemID: "bread", CostEur: 2}}},
+	{CustomerID: "01", OrderID: "300", Timestamp: "1637245070543", Items: []models.Item{{ItemID: "coffee", CostEur: 5}, {ItemID: "jam", CostEur: 4}}},
+}
+
+// The SQL collection answers every query like the in-memory one
+func TestSQLCollectionMatchesOrderCollection(t *testing.T) {
+	sqlCollection := openTestSQLite(t)
+	orderCollection := &OrderCollection{}
+	for _, store := range []Collections{sqlCollection, orderCollection} {
+		require.NoError(t, store.AddOrders("acme", sqlTestOrders))
+		require.NoError(t, store.AddOrders("globex", sqlTestOrders[:1]))
+	}
+
+	type result struct {
+		value any
+		err   error
+	}
+	queries := map[string]func(store Collections) result{
+		"All orders": func(store Collections) result {
+			orders, err := store.GetAllOrders("acme")
+			return result{orders, err}
+		},
+		"No orders": func(store Collections) result {
+			orders, err := store.GetAllOrders("initech")
+			return result{orders, err}
+		},
+		"Orders by customer": func(store Collections) result {
+			orders, err := store.GetOrdersByCustomer("acme", "01")
+			return result{orders, err}
+		},
+		"Orders of unknown customer": func(store Collections) result {
+			orders, err := store.GetOrdersByCustomer("globex", "01")
+			return result{orders, err}
+		},
+		"Items by customer": func(store Collections) result {
+			items, err := store.GetItemsByCustomer("acme", "01")
+			return result{items, err}
+		},
+		"Items of unknown customer": func(store Collections) result {
+			items, err := store.GetItemsByCustomer("acme", "99")
+			return result{items, err}
+		},
+		"Each order": func(store Collections) result {
+			orders, err := collect(store.EachOrder("acme"))
+			return result{orders, err}
+		},
+		"Customer summary": func(store Collections) result {
+			summary, err := store.GetCustomerSummary("acme", "01")
+			return result{summary, err}
+		},
+		"Summary of unknown customer": func(store Collections) result {
+			summary, err := store.GetCustomerSummary("acme", "99")
+			return result{summary, err}
+		},
+		"All summaries": func(store Collections) result {
+			summaries, err := store.GetAllCustomerSummaries("acme")
+			return result{summaries, err}
+		},
+		"No summaries": func(store Collections) result {
+			summaries, err := store.GetAllCustomerSummaries("initech")
+			return result{summaries, err}
+		},
+		"Each summary": func(store Collections) result {
+			summaries, err := collect(store.EachCustomerSummary("acme"))
+			return result{summaries, err}
+		},
+		"Related items": func(store Collections) result {
+			related, err := store.GetRelatedItems("acme", "bread", 0)
+			return result{related, err}
+		},
+		"Limited related items": func(store Collections) result {
+			related, err := store.GetRelatedItems("acme", "jam", 1)
+			return result{related, err}
+		},
+		"Related items of unknown item": func(store Collections) result {
+			related, err := store.GetRelatedItems("globex", "jam", 0)
+			return result{related, err}
+		},
+		"Stats": func(store Collections) result {
+			return result{store.(Sized).Stats(), nil}
+		},
+	}
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, query(orderCollection), query(sqlCollection))
+		})
+	}
+
+	t.Run("After erasures", func(t *testing.T) {
+		for _, store := range []Collections{sqlCollection, orderCollection} {
+			_, err := store.EraseCustomer("acme", "01", models.ErasureModeDelete)
+			require.NoError(t, err)
+			_, err = store.EraseCustomer("acme", "02", models.ErasureModePseudonymize)
+			require.NoError(t, err)
+		}
+		for name, query := range queries {
+			expected := query(orderCollection)
+			actual := query(sqlCollection)
+			// Pseudonyms are random, only the rest of the summaries can be compared
+			if name == "All summaries" || name == "Each summary" {
+				expected.value = withoutPseudonyms(expected.value.([]models.Summary))
+				actual.value = withoutPseudonyms(actual.value.([]models.Summary))
+			}
+			if name == "All orders" || name == "Each order" {
+				expected.value = withoutCustomers(expected.value.([]models.Order))
+				actual.value = withoutCustomers(actual.value.([]models.Order))
+			}
+			assert.Equal(t, expected, actual, name)
+		}
+	})
+}
+
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	values := []T{}
+	for value, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func withoutPseudonyms(summaries []models.Summary) []models.Summary {
+	for i := range summaries {
+		if strings.HasPrefix(summaries[i].CustomerID, "anon-") {
+			summaries[i].CustomerID = "anon"
+		}
+	}
+	return summaries
+}
+
+func withoutCustomers(orders []models.Order) []models.Order {
+	for i := range orders {
+		orders[i].CustomerID = ""
+	}
+	return orders
+}
+
+func TestSQLAddOrders(t *testing.T) {
+	sqlCollection := openTestSQLite(t)
+
+	invalid := append([]models.Order{}, sqlTestOrders[0], models.Order{CustomerID: "01", OrderID: "200", Timestamp: "1637245070513"})
+	assert.Error(t, sqlCollection.AddOrders("acme", invalid))
+	assert.Equal(t, Stats{}, sqlCollection.Stats(), "nothing is stored when an order is invalid")
+
+	require.NoError(t, sqlCollection.AddOrders("acme", sqlTestOrders))
+	orders, err := sqlCollection.GetAllOrders("acme")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", orders[0].TenantID)
+	assert.Equal(t, Stats{Tenants: 1, Orders: 4, Items: 9, Customers: 3}, sqlCollection.Stats())
+}
+
+// Tenants larger than a page are read a page at a time
+func TestSQLEachPages(t *testing.T) {
+	sqlCollection := openTestSQLite(t)
+	orders := make([]models.Order, pageSize*2+1)
+	for i := range orders {
+		orders[i] = models.Order{CustomerID: fmt.Sprintf("%05d", i), OrderID: strconv.Itoa(i), Timestamp: "1637245070513", Items: []models.Item{{ItemID: "bread", CostEur: 2}}}
+	}
+	require.NoError(t, sqlCollection.AddOrders("acme", orders))
+	require.NoError(t, sqlCollection.AddOrders("globex", orders[:1]))
+
+	all, err := sqlCollection.GetAllOrders("acme")
+	require.NoError(t, err)
+	streamed, err := collect(sqlCollection.EachOrder("acme"))
+	require.NoError(t, err)
+	assert.Equal(t, all, streamed)
+
+	summaries, err := sqlCollection.GetAllCustomerSummaries("acme")
+	require.NoError(t, err)
+	streamedSummaries, err := collect(sqlCollection.EachCustomerSummary("acme"))
+	require.NoError(t, err)
+	assert.Equal(t, summaries, streamedSummaries)
+
+	// Stopping early doesn't read further pages
+	count := 0
+	for range sqlCollection.EachOrder("acme") {
+		if count++; count == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestSQLTenantLimit(t *testing.T) {
+	sqlCollection := openTestSQLite(t)
+	sqlCollection.Limits = map[string]TenantLimit{"acme": {MaxOrders: 4}}
+
+	require.NoError(t, sqlCollection.AddOrders("acme", sqlTestOrders[:3]))
+	assert.ErrorIs(t, sqlCollection.AddOrders("acme", sqlTestOrders[:2]), ErrTenantLimitExceeded)
+	assert.Equal(t, 3, sqlCollection.Stats().Orders, "nothing is stored when the batch exceeds the limit")
+
+	assert.NoError(t, sqlCollection.AddOrders("acme", sqlTestOrders[:1]))
+	assert.NoError(t, sqlCollection.AddOrders("globex", sqlTestOrders), "tenants without a limit are not capped")
+}
+
+func TestSQLEraseCustomer(t *testing.T) {
+	sqlCollection := openTestSQLite(t)
+	require.NoError(t, sqlCollection.AddOrders("acme", sqlTestOrders))
+	require.NoError(t, sqlCollection.AddOrders("globex", sqlTestOrders))
+
+	record, err := sqlCollection.EraseCustomer("acme", "01", models.ErasureModePseudonymize)
+	require.NoError(t, err)
+	assert.Equal(t, SubjectRef(nil, "01"), record.SubjectRef)
+	assert.Equal(t, 2, record.OrdersAffected)
+	assert.Equal(t, 5, record.ItemsAffected)
+	assert.Equal(t, []string{"200", "300"}, record.OrderIDs)
+
+	_, err = sqlCollection.GetOrdersByCustomer("acme", "01")
+	assert.ErrorIs(t, err, ErrCustomerNotFound)
+	orders, err := sqlCollection.GetAllOrders("acme")
+	require.NoError(t, err)
+	assert.Len(t, orders, 4, "pseudonymized orders are kept")
+	assert.Equal(t, orders[1].CustomerID, orders[3].CustomerID, "orders of the customer share a pseudonym")
+
+	_, err = sqlCollection.EraseCustomer("acme", "03", models.ErasureModeDelete)
+	require.NoError(t, err)
+	_, err = sqlCollection.EraseCustomer("acme", "03", models.ErasureModeDelete)
+	assert.ErrorIs(t, err, ErrCustomerNotFound)
+	_, err = sqlCollection.EraseCustomer("acme", "02", "shred")
+	assert.Error(t, err)
+
+	records, err := sqlCollection.GetErasureRecords("acme")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	// The order IDs are only returned to the caller of the erasure
+	record.OrderIDs = nil
+	assert.Equal(t, record, records[0])
+	assert.Equal(t, models.ErasureModeDelete, records[1].Mode)
+
+	// Erasures never reach other tenants
+	_, err = sqlCollection.GetOrdersByCustomer("globex", "01")
+	assert.NoError(t, err)
+	records, err = sqlCollection.GetErasureRecords("globex")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.Equal(t, Stats{Tenants: 2, Orders: 7, Items: 16, Customers: 5, Erasures: 2}, sqlCollection.Stats())
+}
+
+func TestSQLPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.db")
+
+	sqlCollection, err := OpenSQLite(path)
+	require.NoError(t, err)
+	require.NoError(t, sqlCollection.AddOrders("acme", sqlTestOrders))
+	require.NoError(t, sqlCollection.Close())
+
+	// Orders survive a restart, the schema isn't migrated again
+	sqlCollection, err = OpenSQLite(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlCollection.Close() })
+	orders, err := sqlCollection.GetAllOrders("acme")
+	require.NoError(t, err)
+	assert.Len(t, orders, len(sqlTestOrders))
+}
+
+func TestSQLPing(t *testing.T) {
+	sqlCollection := openTestSQLite(t)
+	assert.NoError(t, sqlCollection.Ping(context.Background()))
+
+	sqlCollection.Close()
+	assert.Error(t, sqlCollection.Ping(context.Background()))
+}
@@ -0,0 +1,122 @@
+// Package diagnostics describes the running service for the debug routes: its build, configuration, runtime and profiles
+package diagnostics
+
+import (
+	"net/http/pprof"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redacted replaces the values of secret settings
+const Redacted = "[REDACTED]"
+
+// Profiles served by Profile, on top of the named profiles of runtime/pprof such as heap and goroutine
+var Profiles = []string{"allocs", "block", "cmdline", "goroutine", "heap", "mutex", "profile", "symbol", "threadcreate", "trace"}
+
+// started is when the process started serving, as far as uptime is concerned
+var started = time.Now()
+
+// Build describes the binary being run
+type Build struct {
+	GoVersion string `json:"goVersion"`
+	Path      string `json:"path,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// ReadBuild reads the build information embedded in the binary, the VCS fields are empty when it was built without them
+func ReadBuild() Build {
+	build := Build{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	build.Path, build.Version = info.Main.Path, info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
+
+// Runtime is a snapshot of the Go runtime
+type Runtime struct {
+	Goroutines     int     `json:"goroutines"`
+	HeapAllocBytes uint64  `json:"heapAllocBytes"`
+	SysBytes       uint64  `json:"sysBytes"`
+	NumGC          uint32  `json:"numGC"`
+	UptimeSeconds  float64 `json:"uptimeSeconds"`
+}
+
+// ReadRuntime takes a snapshot of the Go runtime, it briefly stops the world to read the memory statistics
+func ReadRuntime() Runtime {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return Runtime{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		UptimeSeconds:  time.Since(started).Seconds(),
+	}
+}
+
+// RedactConfig returns a copy of config with the values of secret settings replaced, e.g. JWT_HS256_SECRET,
+// and the passwords of URLs removed
+func RedactConfig(config map[string]string) map[string]string {
+	redacted := make(map[string]string, len(config))
+	for name, value := range config {
+		redacted[name] = redact(name, value)
+	}
+	return redacted
+}
+
+func redact(name, value string) string {
+	upper := strings.ToUpper(name)
+	for _, secret := range []string{"SECRET", "PASSWORD", "TOKEN", "CREDENTIAL"} {
+		if strings.Contains(upper, secret) {
+			return Redacted
+		}
+	}
+	if strings.HasSuffix(upper, "_KEY") {
+		return Redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return value
+}
+
+// Profile returns the handler serving the pprof profile named by the profile path parameter, see Profiles
+func Profile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Param("profile") {
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			// Serves the named profiles of runtime/pprof, unknown names get 404
+			pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+		}
+	}
+}
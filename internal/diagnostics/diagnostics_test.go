@@ -0,0 +1,66 @@
+package diagnostics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactConfig(t *testing.T) {
+	config := map[string]string{
+		"JWT_HS256_SECRET": "test-secret",
+		"DB_PASSWORD":      "hunter2",
+		"SIGNING_KEY":      "abc",
+		"API_KEYS_FILE":    "/etc/keys.json",
+		"DATABASE_URL":     "postgres://app:hunter2@db:5432/orders",
+		"LOG_LEVEL":        "debug",
+	}
+
+	assert.Equal(t, map[string]string{
+		"JWT_HS256_SECRET": Redacted,
+		"DB_PASSWORD":      Redacted,
+		"SIGNING_KEY":      Redacted,
+		"API_KEYS_FILE":    "/etc/keys.json",
+		"DATABASE_URL":     "postgres://app:xxxxx@db:5432/orders",
+		"LOG_LEVEL":        "debug",
+	}, RedactConfig(config))
+	assert.Equal(t, "test-secret", config["JWT_HS256_SECRET"], "the config itself is left alone")
+}
+
+func TestReadBuild(t *testing.T) {
+	assert.Equal(t, runtime.Version(), ReadBuild().GoVersion)
+}
+
+func TestReadRuntime(t *testing.T) {
+	snapshot := ReadRuntime()
+	assert.Positive(t, snapshot.Goroutines)
+	assert.Positive(t, snapshot.HeapAllocBytes)
+}
+
+func TestProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/debug/pprof/:profile", Profile())
+
+	tests := []struct {
+		url          string
+		expectedCode int
+	}{
+		{"/debug/pprof/goroutine?debug=1", http.StatusOK},
+		{"/debug/pprof/heap", http.StatusOK},
+		{"/debug/pprof/cmdline", http.StatusOK},
+		{"/debug/pprof/unknown", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package export
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"qlikOrders/internal/codec"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// RowGroupSize is the number of rows buffered before a Parquet row group is written out
+const RowGroupSize = 10000
+
+// Stream writes rows to w as a CSV, NDJSON or Parquet download named name.
+// Rows are encoded as they are produced, so only a Parquet row group is ever buffered.
+// Once the first row is written the status can't change anymore, errors past that point only cut the response short.
+func Stream[T any](w http.ResponseWriter, format codec.Format, name string, rows iter.Seq[T]) error {
+	_, err := StreamRows(w, format, name, func(yield func(T, error) bool) {
+		for row := range rows {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	})
+	return err
+}
+
+// StreamRows is Stream for rows read from a store that can fail, reading stops at the first error.
+// Nothing is sent until the encoders write out their first bytes, sent reports whether they did:
+// when it is false the caller can still answer with an error status.
+func StreamRows[T any](w http.ResponseWriter, format codec.Format, name string, rows iter.Seq2[T, error]) (sent bool, err error) {
+	response := &lazyResponse{ResponseWriter: w, contentType: format.ContentType(),
+		disposition: fmt.Sprintf(`attachment; filename="%s.%s"`, name, format)}
+	encoder, err := NewEncoder[T](response, format)
+	if err != nil {
+		return false, err
+	}
+
+	for row, err := range rows {
+		if err != nil {
+			return response.started, err
+		}
+		if err := encoder.Encode(row); err != nil {
+			return response.started, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return response.started, err
+	}
+	// Empty exports may not have written anything
+	response.start()
+	return true, nil
+}
+
+// lazyResponse sends the headers of a download with its first bytes
+type lazyResponse struct {
+	http.ResponseWriter
+	contentType string
+	disposition string
+	started     bool
+}
+
+func (r *lazyResponse) start() {
+	if r.started {
+		return
+	}
+	r.started = true
+	r.Header().Set("Content-Type", r.contentType)
+	r.Header().Set("Content-Disposition", r.disposition)
+	r.WriteHeader(http.StatusOK)
+}
+
+func (r *lazyResponse) Write(b []byte) (int, error) {
+	r.start()
+	return r.ResponseWriter.Write(b)
+}
+
+// Encoder writes rows of T in one of the export formats
+type Encoder[T any] struct {
+	encode func(T) error
+	close  func() error
+}
+
+// NewEncoder creates an encoder of rows of T, which must be a struct.
+// CSV columns and NDJSON fields are named after the json tags, Parquet columns after the parquet tags.
+func NewEncoder[T any](w io.Writer, format codec.Format) (*Encoder[T], error) {
+	switch format {
+	case codec.FormatCSV:
+		return newCSVEncoder[T](w)
+	case codec.FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		return &Encoder[T]{
+			encode: func(row T) error { return encoder.Encode(row) },
+			close:  func() error { return nil },
+		}, nil
+	case codec.FormatParquet:
+		writer := parquet.NewGenericWriter[T](w)
+		buffered := 0
+		return &Encoder[T]{
+			encode: func(row T) error {
+				if _, err := writer.Write([]T{row}); err != nil {
+					return err
+				}
+				if buffered++; buffered == RowGroupSize {
+					buffered = 0
+					return writer.Flush()
+				}
+				return nil
+			},
+			close: writer.Close,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// Encode writes a row
+func (e *Encoder[T]) Encode(row T) error {
+	return e.encode(row)
+}
+
+// Close writes out everything buffered, the encoder can't be used afterwards
+func (e *Encoder[T]) Close() error {
+	return e.close()
+}
+
+// csvColumn is a field of the row struct written as a CSV column
+type csvColumn struct {
+	name  string
+	index int
+}
+
+func newCSVEncoder[T any](w io.Writer) (*Encoder[T], error) {
+	rowType := reflect.TypeFor[T]()
+	if rowType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("CSV rows must be structs, not %s", rowType)
+	}
+
+	var columns []csvColumn
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" || field.Tag.Get("parquet") == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name: name, index: i})
+	}
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	writer := csv.NewWriter(w)
+	// Written out with the first rows, so an empty export still describes its columns
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	return &Encoder[T]{
+		encode: func(row T) error {
+			value := reflect.ValueOf(row)
+			for i, column := range columns {
+				field, err := csvValue(value.Field(column.index))
+				if err != nil {
+					return fmt.Errorf("column %s: %w", column.name, err)
+				}
+				record[i] = field
+			}
+			return writer.Write(record)
+		},
+		close: func() error {
+			writer.Flush()
+			return writer.Error()
+		},
+	}, nil
+}
+
+// csvValue formats a field, lists are joined with semicolons so they fit in a single column.
+// Values with a text form, such as times, are written in it. Strings are escaped with escapeFormula.
+func csvValue(value reflect.Value) (string, error) {
+	if marshaler, ok := value.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return escapeFormula(value.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Slice:
+		values := make([]string, value.Len())
+		for i := range values {
+			v, err := csvValue(value.Index(i))
+			if err != nil {
+				return "", err
+			}
+			values[i] = v
+		}
+		return strings.Join(values, ";"), nil
+	}
+	return "", fmt.Errorf("unsupported kind %s", value.Kind())
+}
+
+// escapeFormula prefixes strings spreadsheets would read as a formula with a quote, so IDs set by clients,
+// such as =HYPERLINK(...), open as text
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
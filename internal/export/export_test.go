@@ -0,0 +1,138 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"qlikOrders/internal/codec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type row struct {
+	Name    string   `json:"name" parquet:"name"`
+	Count   int      `json:"count" parquet:"count"`
+	Tags    []string `json:"tags,omitempty" parquet:"tags,list"`
+	Hidden  string   `json:"-" parquet:"-"`
+	private string
+}
+
+var rows = []row{
+	{Name: "a", Count: 1, Tags: []string{"x", "y"}, Hidden: "secret"},
+	{Name: "b, c", Count: 2},
+}
+
+func TestStreamCSV(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, Stream(w, codec.FormatCSV, "rows", slices.Values(rows)))
+
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="rows.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "name,count,tags\na,1,x;y\n\"b, c\",2,\n", w.Body.String())
+}
+
+func TestStreamCSVFormulas(t *testing.T) {
+	formulas := []row{
+		{Name: "=HYPERLINK(\"http://example.com\")", Count: -1, Tags: []string{"@SUM(A1)", "x"}},
+		{Name: "+1", Count: 2, Tags: []string{"-1"}},
+		{Name: "\tcmd", Count: 3},
+		{Name: "a=b", Count: 4},
+	}
+	w := httptest.NewRecorder()
+	require.NoError(t, Stream(w, codec.FormatCSV, "rows", slices.Values(formulas)))
+
+	// Only text cells are escaped, numbers keep their sign
+	assert.Equal(t, "name,count,tags\n\"'=HYPERLINK(\"\"http://example.com\"\")\",-1,'@SUM(A1);x\n'+1,2,'-1\n'\tcmd,3,\na=b,4,\n", w.Body.String())
+
+	// The other formats hold the values as they are
+	w = httptest.NewRecorder()
+	require.NoError(t, Stream(w, codec.FormatNDJSON, "rows", slices.Values(formulas[:1])))
+	assert.Contains(t, w.Body.String(), `"name":"=HYPERLINK`)
+}
+
+func TestStreamRowsError(t *testing.T) {
+	failing := func(yield func(row, error) bool) {
+		if yield(rows[0], nil) {
+			yield(row{}, errors.New("store failed"))
+		}
+	}
+
+	// Rows buffered by the encoder are never sent, the status can still be chosen
+	w := httptest.NewRecorder()
+	sent, err := StreamRows(w, codec.FormatCSV, "rows", failing)
+	assert.EqualError(t, err, "store failed")
+	assert.False(t, sent)
+	assert.Empty(t, w.Header().Get("Content-Type"))
+	assert.Zero(t, w.Body.Len())
+
+	// NDJSON rows are written out as they come
+	w = httptest.NewRecorder()
+	sent, err = StreamRows(w, codec.FormatNDJSON, "rows", failing)
+	assert.EqualError(t, err, "store failed")
+	assert.True(t, sent)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+}
+
+func TestStreamCSVEmpty(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, Stream(w, codec.FormatCSV, "rows", slices.Values([]row{})))
+	assert.Equal(t, "name,count,tags\n", w.Body.String())
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, Stream(w, codec.FormatNDJSON, "rows", slices.Values(rows)))
+
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"name":"a","count":1,"tags":["x","y"]}`+"\n"+`{"name":"b, c","count":2}`+"\n", w.Body.String())
+}
+
+func TestStreamParquet(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, Stream(w, codec.FormatParquet, "rows", slices.Values(rows)))
+	assert.Equal(t, "application/vnd.apache.parquet", w.Header().Get("Content-Type"))
+
+	read, err := parquet.Read[row](bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, read, 2)
+	assert.Equal(t, "a", read[0].Name)
+	assert.Equal(t, []string{"x", "y"}, read[0].Tags)
+	assert.Empty(t, read[0].Hidden)
+	assert.Equal(t, 2, read[1].Count)
+}
+
+func TestStreamParquetRowGroups(t *testing.T) {
+	many := make([]row, RowGroupSize+1)
+	for i := range many {
+		many[i] = row{Name: strings.Repeat("n", i%10), Count: i}
+	}
+
+	var out bytes.Buffer
+	encoder, err := NewEncoder[row](&out, codec.FormatParquet)
+	require.NoError(t, err)
+	for _, r := range many {
+		require.NoError(t, encoder.Encode(r))
+	}
+	require.NoError(t, encoder.Close())
+
+	file, err := parquet.OpenFile(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	assert.Len(t, file.RowGroups(), 2)
+	assert.Equal(t, int64(len(many)), file.NumRows())
+}
+
+func TestStreamCSVTime(t *testing.T) {
+	type event struct {
+		At time.Time `json:"at"`
+	}
+	w := httptest.NewRecorder()
+	events := []event{{At: time.Date(2026, time.March, 1, 12, 30, 0, 0, time.UTC)}}
+	require.NoError(t, Stream(w, codec.FormatCSV, "events", slices.Values(events)))
+	assert.Equal(t, "at\n2026-03-01T12:30:00Z\n", w.Body.String())
+}
@@ -0,0 +1,80 @@
+// Package health serves the liveness and readiness probes of the orchestrator
+package health
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Paths of the probes, they are open to every caller
+const (
+	LivePath  = "/healthz"
+	ReadyPath = "/readyz"
+)
+
+// DefaultTimeout bounds the time all readiness checks of a probe can take together
+const DefaultTimeout = 2 * time.Second
+
+// Statuses of a probe and of each of its checks
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check is a dependency the service needs to serve requests
+type Check struct {
+	Name string
+	// Check returns why the dependency isn't ready, nil when it is
+	Check func(ctx context.Context) error
+}
+
+// Result is the body of the probes
+type Result struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Live returns the handler of the liveness probe, it succeeds as long as the server serves requests
+func Live() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, Result{Status: StatusOK})
+	}
+}
+
+// Ready returns the handler of the readiness probe, it fails with 503 unless every check passes within timeout
+func Ready(timeout time.Duration, checks ...Check) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		result := Run(ctx, checks...)
+		status := http.StatusOK
+		if result.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, result)
+	}
+}
+
+// Run runs every check, the result is unavailable when any of them fails
+func Run(ctx context.Context, checks ...Check) Result {
+	result := Result{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for _, check := range checks {
+		if err := check.Check(ctx); err != nil {
+			result.Status = StatusUnavailable
+			result.Checks[check.Name] = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			continue
+		}
+		result.Checks[check.Name] = CheckResult{Status: StatusOK}
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, handler gin.HandlerFunc) (int, Result) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/probe", handler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/probe", nil))
+
+	var result Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return w.Code, result
+}
+
+func TestLive(t *testing.T) {
+	code, result := serve(t, Live())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, Result{Status: StatusOK}, result)
+}
+
+func TestReady(t *testing.T) {
+	passing := Check{Name: "storage", Check: func(context.Context) error { return nil }}
+	failing := Check{Name: "jobs", Check: func(context.Context) error { return errors.New("recovering 2 import jobs") }}
+	hanging := Check{Name: "storage", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tests := []struct {
+		name           string
+		checks         []Check
+		expectedCode   int
+		expectedResult Result
+	}{
+		{
+			name:           "No checks",
+			expectedCode:   http.StatusOK,
+			expectedResult: Result{Status: StatusOK},
+		},
+		{
+			name:           "Passing",
+			checks:         []Check{passing},
+			expectedCode:   http.StatusOK,
+			expectedResult: Result{Status: StatusOK, Checks: map[string]CheckResult{"storage": {Status: StatusOK}}},
+		},
+		{
+			name:         "Failing",
+			checks:       []Check{passing, failing},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedResult: Result{Status: StatusUnavailable, Checks: map[string]CheckResult{
+				"storage": {Status: StatusOK},
+				"jobs":    {Status: StatusUnavailable, Error: "recovering 2 import jobs"},
+			}},
+		},
+		{
+			name:         "Timed out",
+			checks:       []Check{hanging},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedResult: Result{Status: StatusUnavailable, Checks: map[string]CheckResult{
+				"storage": {Status: StatusUnavailable, Error: context.DeadlineExceeded.Error()},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, result := serve(t, Ready(10*time.Millisecond, tt.checks...))
+			assert.Equal(t, tt.expectedCode, code)
+			assert.Equal(t, tt.expectedResult, result)
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"qlikOrders/internal/models"
+	"strconv"
+	"strings"
+)
+
+// Format of an import file
+type Format string
+
+const (
+	// FormatNDJSON holds one JSON order per line
+	FormatNDJSON Format = "ndjson"
+	// FormatCSV holds one item per row with a header row, rows of the same order must be next to each other
+	FormatCSV Format = "csv"
+)
+
+// Defaults applied to zero Options
+const (
+	DefaultBatchSize = 100
+	DefaultMaxErrors = 100
+	// DefaultMaxLineBytes allows a line as large as a whole POST /orders body
+	DefaultMaxLineBytes = 1 << 20
+)
+
+// recentOrderIDs is how many of the last orders of a CSV file are remembered to notice rows of an order
+// that aren't next to each other. Rows further apart than that are imported as separate orders.
+const recentOrderIDs = 10000
+
+var (
+	// ErrInvalidHeader is returned when a CSV file doesn't start with a usable header row
+	ErrInvalidHeader = errors.New("invalid CSV header")
+	// ErrLineTooLong is returned when a CSV row is longer than the maximum line size, the rows after it can't be told apart
+	ErrLineTooLong = errors.New("line too long")
+)
+
+// Columns every CSV import must have, in any order
+var csvColumns = []string{"customerId", "orderId", "timestamp", "itemId", "costEur"}
+
+// Options configures an import
+type Options struct {
+	Format Format
+	// BatchSize is the number of orders committed together, a batch is stored completely or not at all
+	BatchSize int
+	// MaxErrors caps the row errors kept in the report, later errors are only counted
+	MaxErrors int
+	// MaxLineBytes caps the size of a line, longer NDJSON lines are rejected and longer CSV rows stop the import
+	MaxLineBytes int
+	// Skip counts the first Skip valid orders as imported without committing them, so an interrupted import can be resumed
+	Skip int
+	// Progress is called with the report after every committed batch
+	Progress func(Report)
+}
+
+// RowError describes a rejected order and the line it started on
+type RowError struct {
+	Line    int    `json:"line"`
+	OrderID string `json:"orderId,omitempty"`
+	Error   string `json:"error"`
+}
+
+// Report summarizes an import
+type Report struct {
+	RowsRead         int        `json:"rowsRead"`
+	OrdersImported   int        `json:"ordersImported"`
+	ItemsImported    int        `json:"itemsImported"`
+	OrdersRejected   int        `json:"ordersRejected"`
+	BatchesCommitted int        `json:"batchesCommitted"`
+	Errors           []RowError `json:"errors"`
+	ErrorsTruncated  bool       `json:"errorsTruncated"`
+}
+
+// CommitFunc stores a batch of valid orders
+type CommitFunc func(orders []models.Order) error
+
+// ParseFormat resolves a format from its name or content type
+func ParseFormat(value string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(strings.Split(value, ";")[0])) {
+	case "ndjson", "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return FormatNDJSON, nil
+	case "csv", "text/csv":
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("unsupported import format %q", value)
+}
+
+// Import reads orders from r and commits them in batches as it goes, so memory use doesn't grow with the file:
+// it is bounded by the batch size, the maximum line size and the order IDs remembered to check CSV rows are contiguous.
+// Invalid orders are rejected with the same rules as POST /orders and reported, the rest of the file is still imported.
+// The report is returned along with any error stopping the import, such as a failed commit or a cancelled ctx.
+func Import(ctx context.Context, r io.Reader, opts Options, commit CommitFunc) (Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = DefaultMaxErrors
+	}
+	if opts.MaxLineBytes <= 0 {
+		opts.MaxLineBytes = DefaultMaxLineBytes
+	}
+
+	imp := &importer{ctx: ctx, opts: opts, commit: commit, report: Report{Errors: []RowError{}}}
+	// Orders are only ever committed in full batches until the end of the file, so skipped orders fill whole batches
+	imp.report.BatchesCommitted = (opts.Skip + opts.BatchSize - 1) / opts.BatchSize
+
+	var err error
+	switch opts.Format {
+	case FormatNDJSON:
+		err = imp.readNDJSON(r)
+	case FormatCSV:
+		err = imp.readCSV(r)
+	default:
+		err = fmt.Errorf("unsupported import format %q", opts.Format)
+	}
+
+	// Whatever is left over is committed once the whole file was read
+	if err == nil {
+		err = imp.flush()
+	}
+	return imp.report, err
+}
+
+type importer struct {
+	ctx     context.Context
+	opts    Options
+	commit  CommitFunc
+	report  Report
+	batch   []models.Order
+	skipped int
+}
+
+// add validates an order read from line and commits the batch once it is full
+func (imp *importer) add(line int, order models.Order) error {
+	if err := order.Validate(); err != nil {
+		imp.reject(line, order.OrderID, err)
+		return nil
+	}
+
+	if imp.skipped < imp.opts.Skip {
+		imp.skipped++
+		imp.report.OrdersImported++
+		imp.report.ItemsImported += len(order.Items)
+		return nil
+	}
+
+	imp.batch = append(imp.batch, order)
+	if len(imp.batch) >= imp.opts.BatchSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+func (imp *importer) flush() error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+	if err := imp.ctx.Err(); err != nil {
+		return err
+	}
+	if err := imp.commit(imp.batch); err != nil {
+		return err
+	}
+
+	imp.report.BatchesCommitted++
+	imp.report.OrdersImported += len(imp.batch)
+	for _, order := range imp.batch {
+		imp.report.ItemsImported += len(order.Items)
+	}
+	imp.batch = nil
+	if imp.opts.Progress != nil {
+		imp.opts.Progress(imp.report)
+	}
+	return nil
+}
+
+func (imp *importer) reject(line int, orderID string, err error) {
+	imp.report.OrdersRejected++
+	if len(imp.report.Errors) >= imp.opts.MaxErrors {
+		imp.report.ErrorsTruncated = true
+		return
+	}
+	imp.report.Errors = append(imp.report.Errors, RowError{Line: line, OrderID: orderID, Error: err.Error()})
+}
+
+func (imp *importer) readNDJSON(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		if err := imp.ctx.Err(); err != nil {
+			return err
+		}
+		data, tooLong, err := readLine(reader, imp.opts.MaxLineBytes)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if tooLong {
+			imp.report.RowsRead++
+			imp.reject(line, "", fmt.Errorf("line is longer than %d bytes", imp.opts.MaxLineBytes))
+		} else if len(strings.TrimSpace(string(data))) > 0 {
+			imp.report.RowsRead++
+
+			var order models.Order
+			if jsonErr := json.Unmarshal(data, &order); jsonErr != nil {
+				imp.reject(line, "", errors.New("line is not a JSON order"))
+			} else if addErr := imp.add(line, order); addErr != nil {
+				return addErr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// readLine reads the next line, up to max bytes of it are kept.
+// The rest of a longer line is read and dropped, so the next call starts on the following line.
+func readLine(reader *bufio.Reader, max int) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return line, tooLong, err
+		}
+	}
+}
+
+// rowLimiter fails reads once a CSV row took more than max bytes, remaining is reset as every row is read.
+// The CSV reader reads ahead, so the limit applies to what it read while parsing the row.
+type rowLimiter struct {
+	r         io.Reader
+	max       int
+	remaining int
+}
+
+func (l *rowLimiter) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, ErrLineTooLong
+	}
+	if len(p) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= n
+	return n, err
+}
+
+func (l *rowLimiter) reset() {
+	// Leaves room for the 4 KiB the CSV reader buffers ahead
+	l.remaining = l.max + 4096
+}
+
+// recentOrders remembers the last IDs added to it, up to its capacity
+type recentOrders struct {
+	ids  []string
+	next int
+	seen map[string]int
+}
+
+func newRecentOrders(capacity int) *recentOrders {
+	return &recentOrders{ids: make([]string, 0, capacity), seen: make(map[string]int)}
+}
+
+func (r *recentOrders) add(id string) {
+	if len(r.ids) < cap(r.ids) {
+		r.ids = append(r.ids, id)
+	} else {
+		evicted := r.ids[r.next]
+		if r.seen[evicted]--; r.seen[evicted] <= 0 {
+			delete(r.seen, evicted)
+		}
+		r.ids[r.next] = id
+		r.next = (r.next + 1) % cap(r.ids)
+	}
+	r.seen[id]++
+}
+
+func (r *recentOrders) contains(id string) bool {
+	return r.seen[id] > 0
+}
+
+func (imp *importer) readCSV(r io.Reader) error {
+	limiter := &rowLimiter{r: r, max: imp.opts.MaxLineBytes}
+	limiter.reset()
+	reader := csv.NewReader(limiter)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("%w: missing the %s column", ErrInvalidHeader, name)
+		}
+	}
+	reader.FieldsPerRecord = len(header)
+	limiter.reset()
+
+	var (
+		current   *models.Order
+		startLine int
+		invalid   error                             // Set when a row of the current order was invalid
+		completed = newRecentOrders(recentOrderIDs) // Orders already passed, their rows must be contiguous
+	)
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		completed.add(current.OrderID)
+		order := *current
+		current = nil
+		if invalid != nil {
+			imp.reject(startLine, order.OrderID, invalid)
+			return nil
+		}
+		return imp.add(startLine, order)
+	}
+
+	for {
+		if err := imp.ctx.Err(); err != nil {
+			return err
+		}
+		record, err := reader.Read()
+		if err == io.EOF {
+			return finish()
+		}
+		if errors.Is(err, ErrLineTooLong) {
+			line, _ := reader.FieldPos(0)
+			return fmt.Errorf("%w: a row after line %d is longer than %d bytes", ErrLineTooLong, line, imp.opts.MaxLineBytes)
+		}
+		limiter.reset()
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			imp.report.RowsRead++
+			imp.reject(parseErr.StartLine, "", errors.New("row is not valid CSV"))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		imp.report.RowsRead++
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			return strings.TrimSpace(record[columns[name]])
+		}
+		orderID := field("orderId")
+
+		if current == nil || current.OrderID != orderID {
+			if err := finish(); err != nil {
+				return err
+			}
+			if completed.contains(orderID) {
+				imp.reject(line, orderID, errors.New("rows of an order must be next to each other"))
+				continue
+			}
+			current = &models.Order{OrderID: orderID, CustomerID: field("customerId"), Timestamp: field("timestamp")}
+			startLine = line
+			invalid = nil
+		}
+
+		if field("customerId") != current.CustomerID || field("timestamp") != current.Timestamp {
+			invalid = fmt.Errorf("line %d: rows of an order must share the customer and timestamp", line)
+		}
+
+		cost, err := strconv.Atoi(field("costEur"))
+		if err != nil {
+			invalid = fmt.Errorf("line %d: costEur is not a whole number", line)
+		}
+		current.Items = append(current.Items, models.Item{ItemID: field("itemId"), CostEur: cost})
+	}
+}
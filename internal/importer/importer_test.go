@@ -0,0 +1,223 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"qlikOrders/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collect returns a commit func storing every batch it receives
+func collect(batches *[][]models.Order) CommitFunc {
+	return func(orders []models.Order) error {
+		*batches = append(*batches, append([]models.Order(nil), orders...))
+		return nil
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for value, expected := range map[string]Format{
+		"ndjson":                  FormatNDJSON,
+		"application/x-ndjson":    FormatNDJSON,
+		"CSV":                     FormatCSV,
+		"text/csv; charset=utf-8": FormatCSV,
+	} {
+		format, err := ParseFormat(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, format, value)
+	}
+
+	_, err := ParseFormat("application/json")
+	assert.Error(t, err)
+}
+
+func TestImportNDJSON(t *testing.T) {
+	input := `{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}
+
+{"customerId":"02","orderId":"51","timestamp":"1637245070513","items":[{"itemId":"20202","costEur":0}]}
+not json
+{"customerId":"03","orderId":"52","timestamp":"1637245070513","items":[{"itemId":"20203","costEur":3},{"itemId":"20204","costEur":4}]}`
+
+	var batches [][]models.Order
+	report, err := Import(context.Background(), strings.NewReader(input), Options{Format: FormatNDJSON}, collect(&batches))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.RowsRead)
+	assert.Equal(t, 2, report.OrdersImported)
+	assert.Equal(t, 3, report.ItemsImported)
+	assert.Equal(t, 2, report.OrdersRejected)
+	assert.Equal(t, 1, report.BatchesCommitted)
+	assert.Equal(t, []RowError{
+		{Line: 3, OrderID: "51", Error: "items[0].costEur must be greater than 0"},
+		{Line: 4, Error: "line is not a JSON order"},
+	}, report.Errors)
+	assert.Len(t, batches, 1)
+	assert.Equal(t, "52", batches[0][1].OrderID)
+}
+
+func TestImportCSV(t *testing.T) {
+	input := `orderId,customerId,timestamp,itemId,costEur
+50,01,1637245070513,20201,2
+50,01,1637245070513,20202,3
+51,02,1637245070513,20203,abc
+52,03,1637245070513,20204,4
+52,04,1637245070513,20205,4
+53,05,1637245070513,20206,5
+50,01,1637245070513,20207,6
+`
+
+	var batches [][]models.Order
+	report, err := Import(context.Background(), strings.NewReader(input), Options{Format: FormatCSV}, collect(&batches))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, report.RowsRead)
+	assert.Equal(t, 2, report.OrdersImported)
+	assert.Equal(t, 3, report.ItemsImported)
+	assert.Equal(t, 3, report.OrdersRejected)
+	assert.Equal(t, []RowError{
+		{Line: 4, OrderID: "51", Error: "line 4: costEur is not a whole number"},
+		{Line: 5, OrderID: "52", Error: "line 6: rows of an order must share the customer and timestamp"},
+		{Line: 8, OrderID: "50", Error: "rows of an order must be next to each other"},
+	}, report.Errors)
+
+	assert.Len(t, batches, 1)
+	assert.Equal(t, models.Order{
+		CustomerID: "01",
+		OrderID:    "50",
+		Timestamp:  "1637245070513",
+		Items:      []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}},
+	}, batches[0][0])
+	assert.Equal(t, "53", batches[0][1].OrderID)
+}
+
+func TestImportLongLines(t *testing.T) {
+	order := `{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}`
+	long := `{"customerId":"01","orderId":"51","timestamp":"1637245070513","items":[{"itemId":"` + strings.Repeat("x", 10000) + `","costEur":2}]}`
+
+	t.Run("NDJSON lines are rejected", func(t *testing.T) {
+		var batches [][]models.Order
+		input := order + "\n" + long + "\n" + order + "\n"
+		report, err := Import(context.Background(), strings.NewReader(input), Options{Format: FormatNDJSON, MaxLineBytes: 1000}, collect(&batches))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, report.OrdersImported)
+		assert.Equal(t, []RowError{{Line: 2, Error: "line is longer than 1000 bytes"}}, report.Errors)
+	})
+
+	t.Run("CSV rows stop the import", func(t *testing.T) {
+		var batches [][]models.Order
+		input := "orderId,customerId,timestamp,itemId,costEur\n50,01,1637245070513,20201,2\n" +
+			`51,01,1637245070513,"` + strings.Repeat("x\n", 10000) + `",2` + "\n"
+		_, err := Import(context.Background(), strings.NewReader(input), Options{Format: FormatCSV, MaxLineBytes: 1000}, collect(&batches))
+
+		assert.ErrorIs(t, err, ErrLineTooLong)
+		assert.Empty(t, batches)
+	})
+}
+
+func TestRecentOrders(t *testing.T) {
+	recent := newRecentOrders(2)
+	for _, id := range []string{"50", "51", "50", "52"} {
+		recent.add(id)
+	}
+
+	// 50 was added again before the first one was forgotten
+	assert.True(t, recent.contains("50"))
+	assert.True(t, recent.contains("52"))
+	assert.False(t, recent.contains("51"))
+	assert.Len(t, recent.seen, 2)
+}
+
+func TestImportCSVInvalidHeader(t *testing.T) {
+	_, err := Import(context.Background(), strings.NewReader("orderId,customerId\n50,01\n"), Options{Format: FormatCSV}, collect(new([][]models.Order)))
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+
+	_, err = Import(context.Background(), strings.NewReader(""), Options{Format: FormatCSV}, collect(new([][]models.Order)))
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestImportBatches(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 7; i++ {
+		input.WriteString(`{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}` + "\n")
+	}
+
+	var batches [][]models.Order
+	report, err := Import(context.Background(), strings.NewReader(input.String()), Options{Format: FormatNDJSON, BatchSize: 3}, collect(&batches))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.BatchesCommitted)
+	assert.Equal(t, 7, report.OrdersImported)
+	assert.Len(t, batches, 3)
+	assert.Len(t, batches[2], 1)
+}
+
+func TestImportMaxErrors(t *testing.T) {
+	input := strings.Repeat("not json\n", 5)
+
+	report, err := Import(context.Background(), strings.NewReader(input), Options{Format: FormatNDJSON, MaxErrors: 2}, collect(new([][]models.Order)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, report.OrdersRejected)
+	assert.Len(t, report.Errors, 2)
+	assert.True(t, report.ErrorsTruncated)
+}
+
+func TestImportCommitError(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 4; i++ {
+		input.WriteString(`{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}` + "\n")
+	}
+
+	commits := 0
+	failure := errors.New("storage unavailable")
+	report, err := Import(context.Background(), strings.NewReader(input.String()), Options{Format: FormatNDJSON, BatchSize: 2}, func(orders []models.Order) error {
+		commits++
+		if commits == 2 {
+			return failure
+		}
+		return nil
+	})
+
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, 1, report.BatchesCommitted)
+	assert.Equal(t, 2, report.OrdersImported)
+}
+
+func TestImportCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	input := `{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}`
+	report, err := Import(ctx, strings.NewReader(input), Options{Format: FormatNDJSON}, collect(new([][]models.Order)))
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, report.OrdersImported)
+}
+
+func TestImportSkip(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&input, `{"customerId":"01","orderId":"%d","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}`+"\n", i)
+	}
+
+	var batches [][]models.Order
+	var progress []int
+	report, err := Import(context.Background(), strings.NewReader(input.String()), Options{
+		Format:    FormatNDJSON,
+		BatchSize: 2,
+		Skip:      2,
+		Progress:  func(r Report) { progress = append(progress, r.OrdersImported) },
+	}, collect(&batches))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, report.OrdersImported)
+	assert.Equal(t, 3, report.BatchesCommitted)
+	assert.Equal(t, []int{4, 5}, progress)
+	assert.Len(t, batches, 2)
+	assert.Equal(t, "2", batches[0][0].OrderID)
+}
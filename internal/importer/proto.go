@@ -0,0 +1,66 @@
+package importer
+
+import "qlikOrders/internal/codec/protobuf"
+
+// Protobuf encoding of the report, following the messages of api/proto/orders.proto
+
+func (e RowError) AppendProto(b []byte) []byte {
+	b = protobuf.AppendInt(b, 1, e.Line)
+	b = protobuf.AppendString(b, 2, e.OrderID)
+	return protobuf.AppendString(b, 3, e.Error)
+}
+
+func (e *RowError) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			e.Line = r.Int()
+		case 2:
+			e.OrderID = r.String()
+		case 3:
+			e.Error = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func (rep Report) AppendProto(b []byte) []byte {
+	b = protobuf.AppendInt(b, 1, rep.RowsRead)
+	b = protobuf.AppendInt(b, 2, rep.OrdersImported)
+	b = protobuf.AppendInt(b, 3, rep.ItemsImported)
+	b = protobuf.AppendInt(b, 4, rep.OrdersRejected)
+	b = protobuf.AppendInt(b, 5, rep.BatchesCommitted)
+	b = protobuf.AppendMessages(b, 6, rep.Errors)
+	return protobuf.AppendBool(b, 7, rep.ErrorsTruncated)
+}
+
+func (rep *Report) UnmarshalProto(b []byte) error {
+	rep.Errors = []RowError{}
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			rep.RowsRead = r.Int()
+		case 2:
+			rep.OrdersImported = r.Int()
+		case 3:
+			rep.ItemsImported = r.Int()
+		case 4:
+			rep.OrdersRejected = r.Int()
+		case 5:
+			rep.BatchesCommitted = r.Int()
+		case 6:
+			var e RowError
+			r.Message(&e)
+			rep.Errors = append(rep.Errors, e)
+		case 7:
+			rep.ErrorsTruncated = r.Bool()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
@@ -0,0 +1,537 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/importer"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Defaults applied to a zero Config
+const (
+	DefaultWorkers   = 2
+	DefaultQueueSize = 100
+)
+
+// ErrJobNotFound is returned when a job doesn't exist or belongs to another tenant
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrQueueFull is returned when too many jobs are waiting to be processed
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrJobFinished is returned when cancelling a job that already finished
+var ErrJobFinished = errors.New("job already finished")
+
+// ErrNoDir is returned by NewManager without a state directory
+var ErrNoDir = errors.New("a job state directory is required")
+
+// Job is an import processed in the background.
+// Its report is updated after every committed batch, so it shows the progress of a running job.
+type Job struct {
+	ID         string          `json:"id"`
+	TenantID   string          `json:"-"`
+	Status     Status          `json:"status"`
+	Format     importer.Format `json:"format"`
+	BatchSize  int             `json:"batchSize"`
+	Report     importer.Report `json:"report"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  string          `json:"createdAt"`
+	StartedAt  string          `json:"startedAt,omitempty"`
+	FinishedAt string          `json:"finishedAt,omitempty"`
+
+	// client is the quota key of the caller who created the job
+	client string
+	origin Origin
+}
+
+// Origin is the call that submitted a job, the batches the job commits are audited as made by it
+type Origin struct {
+	Actor     string `json:"actor"`
+	Method    string `json:"method"`
+	Route     string `json:"route"`
+	RequestID string `json:"requestId"`
+}
+
+// Finished reports whether the job reached a final status
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// state is how a job is persisted, including the fields hidden from API responses
+type state struct {
+	Job
+	Tenant string `json:"tenantId"`
+	Client string `json:"client"`
+	Origin Origin `json:"origin"`
+}
+
+// Config configures a Manager
+type Config struct {
+	// Dir holds the job state and uploaded files, jobs left unfinished in it are resumed by NewManager. Required.
+	Dir         string
+	Collections collections.Collections
+	// Durable is set when Collections keeps orders across restarts. Resumed jobs skip the orders committed
+	// before the restart only then, otherwise those orders are gone and the file is imported again from the top.
+	Durable bool
+	// Limiter counts imported orders against the daily quota of the job's creator, optional
+	Limiter *ratelimit.Limiter
+	// Audit records every committed batch as a call of the job's origin, optional
+	Audit     audit.Sink
+	Workers   int
+	QueueSize int
+	// Logger logs the outcome of jobs, the default logger when nil
+	Logger *slog.Logger
+}
+
+// Manager runs import jobs on a pool of workers.
+// Job state is written to disk on every change, so a restarted Manager resumes unfinished jobs
+// after the last committed batch, or from the start when the collections aren't durable.
+// A batch committed right before a crash may be imported twice.
+type Manager struct {
+	config Config
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	cancels map[string]context.CancelFunc
+	closing bool
+	started bool
+	// recovered holds the jobs left unfinished by the previous Manager
+	recovered []string
+
+	queue  chan string
+	ctx    context.Context
+	stop   context.CancelFunc
+	wg     sync.WaitGroup
+	starts sync.Once
+}
+
+// NewManager creates a Manager and queues the unfinished jobs found in the state directory
+func NewManager(config Config) (*Manager, error) {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if config.Dir == "" {
+		return nil, ErrNoDir
+	}
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		config:  config,
+		jobs:    make(map[string]*Job),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	m.ctx, m.stop = context.WithCancel(context.Background())
+
+	pending, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	m.queue = make(chan string, max(config.QueueSize, len(pending)))
+	for _, id := range pending {
+		m.queue <- id
+	}
+	m.recovered = pending
+	return m, nil
+}
+
+// Start launches the workers, jobs are only queued until it is called
+func (m *Manager) Start() {
+	m.starts.Do(func() {
+		m.mu.Lock()
+		m.started = true
+		m.mu.Unlock()
+		for i := 0; i < m.config.Workers; i++ {
+			m.wg.Add(1)
+			go m.work()
+		}
+	})
+}
+
+// Stats is the state of the jobs of every tenant
+type Stats struct {
+	// Started is set once the workers process jobs
+	Started bool `json:"started"`
+	Queued  int  `json:"queued"`
+	Running int  `json:"running"`
+	// Recovering counts the unfinished jobs of the previous Manager that haven't finished yet
+	Recovering int `json:"recovering"`
+	// QueueSize is the number of jobs that can be queued before new ones are rejected
+	QueueSize int `json:"queueSize"`
+}
+
+// Stats counts the jobs waiting to be processed and being processed
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := Stats{Started: m.started, QueueSize: m.config.QueueSize}
+	for _, job := range m.jobs {
+		switch job.Status {
+		case StatusQueued:
+			stats.Queued++
+		case StatusRunning:
+			stats.Running++
+		}
+	}
+	for _, id := range m.recovered {
+		if !m.jobs[id].Finished() {
+			stats.Recovering++
+		}
+	}
+	return stats
+}
+
+// Close stops the workers and waits for them. Running jobs are interrupted and resumed by the next Manager.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	m.stop()
+	m.wg.Wait()
+}
+
+// Submit stores the file to import and queues a job for it, origin is the call submitting it
+func (m *Manager) Submit(tenantID, client string, origin Origin, opts importer.Options, file io.Reader) (Job, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return Job{}, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = importer.DefaultBatchSize
+	}
+
+	if err := m.spool(id, file); err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:        id,
+		TenantID:  tenantID,
+		Status:    StatusQueued,
+		Format:    opts.Format,
+		BatchSize: opts.BatchSize,
+		Report:    importer.Report{Errors: []importer.RowError{}},
+		CreatedAt: now(),
+		client:    client,
+		origin:    origin,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.save(job); err != nil {
+		os.Remove(m.dataPath(id))
+		return Job{}, err
+	}
+	select {
+	case m.queue <- id:
+	default:
+		os.Remove(m.dataPath(id))
+		os.Remove(m.statePath(id))
+		return Job{}, ErrQueueFull
+	}
+	m.jobs[id] = job
+	return job.snapshot(), nil
+}
+
+// Get returns a job of a tenant
+func (m *Manager) Get(tenantID, id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.TenantID != tenantID {
+		return Job{}, ErrJobNotFound
+	}
+	return job.snapshot(), nil
+}
+
+// Cancel stops a job of a tenant. A running job stops before its next batch, batches already committed are kept.
+func (m *Manager) Cancel(tenantID, id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.TenantID != tenantID {
+		return Job{}, ErrJobNotFound
+	}
+	if job.Finished() {
+		return job.snapshot(), ErrJobFinished
+	}
+
+	if cancel, running := m.cancels[id]; running {
+		// The worker records the cancellation once the import stopped
+		cancel()
+		return job.snapshot(), nil
+	}
+
+	job.Status = StatusCancelled
+	job.FinishedAt = now()
+	os.Remove(m.dataPath(id))
+	m.persist(job)
+	return job.snapshot(), nil
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case id := <-m.queue:
+			m.run(id)
+		}
+	}
+}
+
+func (m *Manager) run(id string) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok || job.Status != StatusQueued || m.closing {
+		// Cancelled while queued, or left for the next Manager
+		m.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+	m.cancels[id] = cancel
+	job.Status = StatusRunning
+	if job.StartedAt == "" {
+		job.StartedAt = now()
+	}
+	m.persist(job)
+	tenantID, client, origin := job.TenantID, job.client, job.origin
+	opts := importer.Options{
+		Format:    job.Format,
+		BatchSize: job.BatchSize,
+		// Orders committed before a restart are skipped
+		Skip: job.Report.OrdersImported,
+		Progress: func(report importer.Report) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			job.Report = report
+			m.persist(job)
+		},
+	}
+	m.mu.Unlock()
+
+	report, err := m.importFile(ctx, id, opts, func(orders []models.Order) error {
+		if err := m.config.Limiter.ReserveOrdersFor(client, len(orders)); err != nil {
+			return err
+		}
+		if err := m.config.Collections.AddOrders(tenantID, orders); err != nil {
+			m.config.Limiter.RefundOrdersFor(client, len(orders))
+			return err
+		}
+		m.audit(ctx, tenantID, origin, orders)
+		return nil
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cancels, id)
+
+	job.Report = report
+	switch {
+	case errors.Is(err, context.Canceled) && m.closing:
+		// Interrupted by Close, the next Manager resumes it
+		job.Status = StatusQueued
+		m.persist(job)
+		return
+	case errors.Is(err, context.Canceled):
+		job.Status = StatusCancelled
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = StatusSucceeded
+	}
+	job.FinishedAt = now()
+	os.Remove(m.dataPath(id))
+	m.persist(job)
+	m.config.Logger.Info("import job finished",
+		slog.String("jobId", job.ID),
+		slog.String(logging.KeyTenantID, job.TenantID),
+		slog.String("status", string(job.Status)),
+		slog.Int("ordersImported", job.Report.OrdersImported),
+		slog.Int("ordersRejected", job.Report.OrdersRejected),
+	)
+}
+
+// audit records a committed batch like the orders of POST /orders/import, entries that can't be appended are logged
+func (m *Manager) audit(ctx context.Context, tenantID string, origin Origin, orders []models.Order) {
+	if m.config.Audit == nil {
+		return
+	}
+	entry := audit.Entry{
+		Time:      time.Now().UTC(),
+		Tenant:    tenantID,
+		Actor:     origin.Actor,
+		Method:    origin.Method,
+		Route:     origin.Route,
+		OrderIDs:  audit.OrderIDs(orders),
+		RequestID: origin.RequestID,
+		Status:    http.StatusOK,
+		Outcome:   audit.OutcomeSuccess,
+	}
+	// The batch is stored even when the job is cancelled right after, so is its entry
+	if err := m.config.Audit.Append(context.WithoutCancel(ctx), entry); err != nil {
+		m.config.Logger.Error("audit entry not recorded", slog.String(logging.KeyError, err.Error()), slog.String("route", entry.Route))
+	}
+}
+
+func (m *Manager) importFile(ctx context.Context, id string, opts importer.Options, commit importer.CommitFunc) (importer.Report, error) {
+	file, err := os.Open(m.dataPath(id))
+	if err != nil {
+		return importer.Report{Errors: []importer.RowError{}}, err
+	}
+	defer file.Close()
+	return importer.Import(ctx, file, opts, commit)
+}
+
+// spool copies the file to import into the state directory
+func (m *Manager) spool(id string, file io.Reader) error {
+	out, err := os.OpenFile(m.dataPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		os.Remove(m.dataPath(id))
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(m.dataPath(id))
+		return err
+	}
+	return nil
+}
+
+// load reads the persisted jobs and returns the IDs of the unfinished ones, oldest first
+func (m *Manager) load() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(m.config.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Job
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s state
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("reading job state %s: %w", filepath.Base(path), err)
+		}
+
+		job := s.Job
+		job.TenantID, job.client, job.origin = s.Tenant, s.Client, s.Origin
+		if job.Report.Errors == nil {
+			job.Report.Errors = []importer.RowError{}
+		}
+		m.jobs[job.ID] = &job
+
+		if !job.Finished() {
+			// Jobs running when the previous Manager stopped are queued again
+			job.Status = StatusQueued
+			if !m.config.Durable {
+				// The orders they committed didn't survive the restart
+				job.Report = importer.Report{Errors: []importer.RowError{}}
+			}
+			pending = append(pending, &job)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt < pending[j].CreatedAt
+	})
+	ids := make([]string, len(pending))
+	for i, job := range pending {
+		ids[i] = job.ID
+	}
+	return ids, nil
+}
+
+// persist saves a job, the in-memory state stays authoritative when the disk is unavailable
+func (m *Manager) persist(job *Job) {
+	if err := m.save(job); err != nil {
+		m.config.Logger.Error("failed to save job", slog.String("jobId", job.ID), slog.String(logging.KeyError, err.Error()))
+	}
+}
+
+// save writes the state of a job atomically, so a crash never leaves a partial file behind
+func (m *Manager) save(job *Job) error {
+	data, err := json.Marshal(state{Job: *job, Tenant: job.TenantID, Client: job.client, Origin: job.origin})
+	if err != nil {
+		return err
+	}
+	tmp := m.statePath(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.statePath(job.ID))
+}
+
+func (m *Manager) statePath(id string) string {
+	return filepath.Join(m.config.Dir, id+".json")
+}
+
+func (m *Manager) dataPath(id string) string {
+	return filepath.Join(m.config.Dir, id+".data")
+}
+
+// snapshot copies a job so callers can read it while the worker updates the original
+func (j *Job) snapshot() Job {
+	job := *j
+	job.Report.Errors = append([]importer.RowError{}, j.Report.Errors...)
+	return job
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,290 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/importer"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ndjson = `{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}
+{"customerId":"02","orderId":"51","timestamp":"1637245070513","items":[{"itemId":"20202","costEur":0}]}
+{"customerId":"03","orderId":"52","timestamp":"1637245070513","items":[{"itemId":"20203","costEur":3}]}
+{"customerId":"04","orderId":"53","timestamp":"1637245070513","items":[{"itemId":"20204","costEur":4}]}
+`
+
+func newManager(t *testing.T, config Config) *Manager {
+	t.Helper()
+	if config.Dir == "" {
+		config.Dir = t.TempDir()
+	}
+	manager, err := NewManager(config)
+	require.NoError(t, err)
+	t.Cleanup(manager.Close)
+	return manager
+}
+
+// waitFinished polls a job until it reaches a final status
+func waitFinished(t *testing.T, manager *Manager, tenantID, id string) Job {
+	t.Helper()
+	var job Job
+	require.Eventually(t, func() bool {
+		job, _ = manager.Get(tenantID, id)
+		return job.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestManagerRunsJobs(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	manager := newManager(t, Config{Collections: collection})
+	manager.Start()
+
+	submitted, err := manager.Submit("acme", "client", Origin{}, importer.Options{Format: importer.FormatNDJSON, BatchSize: 2}, strings.NewReader(ndjson))
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, submitted.Status)
+
+	job := waitFinished(t, manager, "acme", submitted.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+	assert.Equal(t, 3, job.Report.OrdersImported)
+	assert.Equal(t, 1, job.Report.OrdersRejected)
+	assert.Equal(t, 2, job.Report.BatchesCommitted)
+	assert.Len(t, job.Report.Errors, 1)
+	assert.NotEmpty(t, job.FinishedAt)
+
+	orders, _ := collection.GetAllOrders("acme")
+	assert.Len(t, orders, 3)
+
+	// The uploaded file is removed once the job finished
+	_, err = os.Stat(manager.dataPath(job.ID))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestManagerAuditsBatches(t *testing.T) {
+	sink := audit.NewMemorySink()
+	manager := newManager(t, Config{Collections: &collections.OrderCollection{}, Audit: sink})
+	manager.Start()
+
+	origin := Origin{Actor: "key-1", Method: "POST", Route: "/v2/jobs/import", RequestID: "req-1"}
+	submitted, err := manager.Submit("acme", "client", origin, importer.Options{Format: importer.FormatNDJSON, BatchSize: 2}, strings.NewReader(ndjson))
+	require.NoError(t, err)
+	waitFinished(t, manager, "acme", submitted.ID)
+
+	// One entry per committed batch, the rejected order isn't stored so it isn't recorded
+	entries, err := sink.Query(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, []string{"50", "52"}, entries[0].OrderIDs)
+	assert.Equal(t, []string{"53"}, entries[1].OrderIDs)
+	for _, entry := range entries {
+		assert.Equal(t, "acme", entry.Tenant)
+		assert.Equal(t, origin, Origin{Actor: entry.Actor, Method: entry.Method, Route: entry.Route, RequestID: entry.RequestID})
+		assert.Equal(t, audit.OutcomeSuccess, entry.Outcome)
+	}
+}
+
+func TestManagerTenantIsolation(t *testing.T) {
+	manager := newManager(t, Config{Collections: &collections.OrderCollection{}})
+
+	submitted, err := manager.Submit("acme", "client", Origin{}, importer.Options{Format: importer.FormatNDJSON}, strings.NewReader(ndjson))
+	require.NoError(t, err)
+
+	_, err = manager.Get("globex", submitted.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	_, err = manager.Cancel("globex", submitted.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestManagerCancelQueuedJob(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	manager := newManager(t, Config{Collections: collection})
+
+	submitted, err := manager.Submit("acme", "client", Origin{}, importer.Options{Format: importer.FormatNDJSON}, strings.NewReader(ndjson))
+	require.NoError(t, err)
+
+	job, err := manager.Cancel("acme", submitted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCancelled, job.Status)
+
+	_, err = manager.Cancel("acme", submitted.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+
+	// Workers skip the cancelled job
+	manager.Start()
+	manager.Close()
+	orders, _ := collection.GetAllOrders("acme")
+	assert.Empty(t, orders)
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	manager := newManager(t, Config{Collections: &collections.OrderCollection{}, QueueSize: 1})
+
+	_, err := manager.Submit("acme", "client", Origin{}, importer.Options{Format: importer.FormatNDJSON}, strings.NewReader(ndjson))
+	require.NoError(t, err)
+	_, err = manager.Submit("acme", "client", Origin{}, importer.Options{Format: importer.FormatNDJSON}, strings.NewReader(ndjson))
+	assert.ErrorIs(t, err, ErrQueueFull)
+	assert.Equal(t, Stats{Queued: 1, QueueSize: 1}, manager.Stats())
+
+	// Nothing is left behind for the rejected job
+	paths, _ := filepath.Glob(filepath.Join(manager.config.Dir, "*"))
+	assert.Len(t, paths, 2)
+}
+
+func TestManagerResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// State left behind by a Manager that stopped after committing the first batch of two orders
+	interrupted := state{
+		Job: Job{
+			ID:        "0123456789abcdef",
+			Status:    StatusRunning,
+			Format:    importer.FormatNDJSON,
+			BatchSize: 2,
+			Report:    importer.Report{OrdersImported: 2, BatchesCommitted: 1},
+			CreatedAt: "2024-01-01T00:00:00Z",
+		},
+		Tenant: "acme",
+		Client: "client",
+	}
+	data, _ := json.Marshal(interrupted)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, interrupted.ID+".json"), data, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, interrupted.ID+".data"), []byte(ndjson), 0o600))
+
+	collection := &collections.OrderCollection{}
+	manager := newManager(t, Config{Dir: dir, Collections: collection, Durable: true})
+
+	job, err := manager.Get("acme", interrupted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+	assert.Equal(t, Stats{Queued: 1, Recovering: 1, QueueSize: DefaultQueueSize}, manager.Stats())
+
+	manager.Start()
+	job = waitFinished(t, manager, "acme", interrupted.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+	assert.Equal(t, 3, job.Report.OrdersImported)
+	assert.Equal(t, 2, job.Report.BatchesCommitted)
+	assert.Equal(t, Stats{Started: true, QueueSize: DefaultQueueSize}, manager.Stats())
+
+	// Only the order after the committed batch is imported again
+	orders, _ := collection.GetAllOrders("acme")
+	require.Len(t, orders, 1)
+	assert.Equal(t, "53", orders[0].OrderID)
+
+	// Finished jobs are still reported after another restart
+	manager.Close()
+	restarted := newManager(t, Config{Dir: dir, Collections: collection, Durable: true})
+	job, err = restarted.Get("acme", interrupted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, job.Status)
+}
+
+func TestManagerRestartsWithoutDurableCollections(t *testing.T) {
+	dir := t.TempDir()
+
+	// The first batch was committed to collections that were lost with the previous Manager
+	interrupted := state{
+		Job: Job{
+			ID:        "0123456789abcdef",
+			Status:    StatusRunning,
+			Format:    importer.FormatNDJSON,
+			BatchSize: 2,
+			Report:    importer.Report{OrdersImported: 2, BatchesCommitted: 1},
+			CreatedAt: "2024-01-01T00:00:00Z",
+		},
+		Tenant: "acme",
+		Client: "client",
+	}
+	data, _ := json.Marshal(interrupted)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, interrupted.ID+".json"), data, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, interrupted.ID+".data"), []byte(ndjson), 0o600))
+
+	collection := &collections.OrderCollection{}
+	manager := newManager(t, Config{Dir: dir, Collections: collection})
+	job, err := manager.Get("acme", interrupted.ID)
+	require.NoError(t, err)
+	assert.Zero(t, job.Report.OrdersImported)
+
+	manager.Start()
+	job = waitFinished(t, manager, "acme", interrupted.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+	assert.Equal(t, 3, job.Report.OrdersImported)
+	assert.Equal(t, 2, job.Report.BatchesCommitted)
+
+	// The whole file is imported again
+	orders, _ := collection.GetAllOrders("acme")
+	assert.Len(t, orders, 3)
+}
+
+func TestManagerRequiresDir(t *testing.T) {
+	_, err := NewManager(Config{Collections: &collections.OrderCollection{}})
+	assert.ErrorIs(t, err, ErrNoDir)
+}
+
+func TestManagerDailyQuota(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	limiter := &ratelimit.Limiter{Store: ratelimit.NewMemoryStore(), DailyOrders: 2}
+	manager := newManager(t, Config{Collections: collection, Limiter: limiter})
+	manager.Start()
+
+	submitted, err := manager.Submit("acme", "client", Origin{}, importer.Options{Format: importer.FormatNDJSON, BatchSize: 2}, strings.NewReader(ndjson))
+	require.NoError(t, err)
+
+	job := waitFinished(t, manager, "acme", submitted.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, ratelimit.ErrQuotaExceeded.Error(), job.Error)
+	assert.Equal(t, 2, job.Report.OrdersImported)
+
+	orders, _ := collection.GetAllOrders("acme")
+	assert.Len(t, orders, 2)
+}
+
+// blockingCollection holds every AddOrders until release is closed
+type blockingCollection struct {
+	*collections.OrderCollection
+	adding  chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingCollection) AddOrders(tenantID string, orders []models.Order) error {
+	b.adding <- struct{}{}
+	<-b.release
+	return b.OrderCollection.AddOrders(tenantID, orders)
+}
+
+func TestManagerCancelRunningJob(t *testing.T) {
+	collection := &blockingCollection{
+		OrderCollection: &collections.OrderCollection{},
+		adding:          make(chan struct{}, 10),
+		release:         make(chan struct{}),
+	}
+	manager := newManager(t, Config{Collections: collection})
+	manager.Start()
+
+	submitted, err := manager.Submit("acme", "client", Origin{}, importer.Options{Format: importer.FormatNDJSON, BatchSize: 1}, strings.NewReader(ndjson))
+	require.NoError(t, err)
+
+	// Cancel while the first batch is being committed
+	<-collection.adding
+	job, err := manager.Cancel("acme", submitted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, job.Status)
+	close(collection.release)
+
+	job = waitFinished(t, manager, "acme", submitted.ID)
+	assert.Equal(t, StatusCancelled, job.Status)
+	assert.Equal(t, 1, job.Report.OrdersImported)
+
+	orders, _ := collection.GetAllOrders("acme")
+	assert.Len(t, orders, 1)
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name               string
+		config             Config
+		expectedCustomerID string
+	}{
+		{"Redacted", Config{RedactCustomerIDs: true, RedactionKey: []byte("key")}, Redact([]byte("key"), "01")},
+		{"Plain", Config{}, "01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(&buf, tt.config)
+			logger.Info("erased", slog.String(KeyCustomerID, "01"), slog.String("orderId", "50"))
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, "erased", entry["msg"])
+			assert.Equal(t, tt.expectedCustomerID, entry[KeyCustomerID])
+			assert.Equal(t, "50", entry["orderId"])
+		})
+	}
+
+	t.Run("Level", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := New(&buf, Config{Level: slog.LevelWarn})
+		logger.Info("dropped")
+		assert.Empty(t, buf.String())
+	})
+}
+
+func TestRedact(t *testing.T) {
+	key := []byte("key")
+	assert.Len(t, Redact(key, "01"), 16)
+	assert.Equal(t, Redact(key, "01"), Redact(key, "01"))
+	assert.NotEqual(t, Redact(key, "01"), Redact(key, "02"))
+	// The start of the HMAC of "01", as in the subjectRef of erasures
+	assert.Equal(t, HashCustomerID(key, "01")[:16], Redact(key, "01"))
+	assert.Equal(t, "6899448e80c6d314", Redact(key, "01"))
+
+	// Without the key, the plain SHA-256 of an ID doesn't match
+	assert.NotEqual(t, "938db8c9f82c8cb5", Redact(key, "01"))
+	assert.NotEqual(t, Redact(key, "01"), Redact([]byte("other"), "01"))
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("DEBUG")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the request ID, accepted from callers and echoed in every response
+const Header = "X-Request-ID"
+
+// maxRequestIDLength caps the IDs accepted from callers, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequestID returns a middleware giving every request an ID, the one in the X-Request-ID header when it is valid,
+// a generated one otherwise. The ID is echoed in the response header and added to the request context,
+// along with a logger from logger tagged with it.
+func RequestID(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(Header, id)
+
+		ctx := WithRequestID(c.Request.Context(), id)
+		ctx = WithLogger(ctx, logger.With(KeyRequestID, id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs of printable characters safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog returns a middleware logging every request once it is served, at warn level for client errors
+// and error level for server errors. Routes are logged by pattern with the customer ID as its own attribute,
+// so it can be redacted.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", max(0, c.Writer.Size())),
+			slog.String("clientIp", c.ClientIP()),
+		}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		} else {
+			// Unmatched paths have no parameters to tell apart
+			attrs = append(attrs, slog.String("path", c.Request.URL.Path))
+		}
+		if customerID := c.Param("customerId"); customerID != "" {
+			attrs = append(attrs, slog.String(KeyCustomerID, customerID))
+		} else if customerID := c.Query("customerId"); customerID != "" {
+			attrs = append(attrs, slog.String(KeyCustomerID, customerID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String(KeyError, c.Errors.String()))
+		}
+
+		FromContext(c.Request.Context()).LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery returns a middleware answering panicking requests with 500 and logging the panic
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		FromContext(c.Request.Context()).Error("panic serving request", slog.Any(KeyError, err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// EchoRequestID returns a middleware adding the request ID to the JSON object bodies of error responses,
+// as their first field, for the requests match accepts
+func EchoRequestID(match func(*http.Request) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !match(c.Request) {
+			c.Next()
+			return
+		}
+
+		writer := &errorBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.buffered {
+			_, _ = writer.ResponseWriter.Write(withRequestID(writer.body.Bytes(), RequestIDFromContext(c.Request.Context())))
+		}
+	}
+}
+
+// errorBodyWriter holds back the JSON bodies of error responses until they are complete
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	buffered bool
+}
+
+func (w *errorBodyWriter) Write(b []byte) (int, error) {
+	if w.buffered || w.Status() >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.buffered = true
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// withRequestID inserts the request ID into a JSON object, other bodies are returned as they are
+func withRequestID(body []byte, id string) []byte {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if id == "" || len(trimmed) == 0 || trimmed[0] != '{' {
+		return body
+	}
+
+	field := []byte(`{"` + KeyRequestID + `":"` + id + `"`)
+	rest := bytes.TrimLeft(trimmed[1:], " \t\r\n")
+	if len(rest) > 0 && rest[0] != '}' {
+		field = append(field, ',')
+	}
+	return append(field, rest...)
+}
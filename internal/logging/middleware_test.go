@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRouter(buf *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(New(buf, Config{RedactCustomerIDs: true, RedactionKey: []byte("key")})), AccessLog(), Recovery())
+	router.Use(EchoRequestID(func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, "/echo/") }))
+
+	handler := func(c *gin.Context) {
+		FromContext(c.Request.Context()).Info("handled")
+		switch c.Query("outcome") {
+		case "error":
+			_ = c.Error(errors.New("store unavailable"))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed"})
+		case "empty":
+			c.JSON(http.StatusNotFound, gin.H{})
+		case "panic":
+			panic("boom")
+		default:
+			c.JSON(http.StatusOK, gin.H{"message": "ok"})
+		}
+	}
+	router.GET("/customer/:customerId", handler)
+	router.GET("/echo/:customerId", handler)
+	return router
+}
+
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		accepted bool
+	}{
+		{"Accepted", "req-123.abc:1", true},
+		{"Generated when missing", "", false},
+		{"Generated when invalid", "bad id\"", false},
+		{"Generated when too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			router := newRouter(&buf)
+
+			req := httptest.NewRequest(http.MethodGet, "/customer/01", nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(Header)
+			if tt.accepted {
+				assert.Equal(t, tt.header, id)
+			} else {
+				assert.Regexp(t, "^[0-9a-f]{32}$", id)
+			}
+
+			// Both the handler's entry and the access log carry the ID
+			entries := logEntries(t, &buf)
+			require.Len(t, entries, 2)
+			for _, entry := range entries {
+				assert.Equal(t, id, entry[KeyRequestID])
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	router := newRouter(&buf)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customer/01?outcome=error", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 2)
+	access := entries[1]
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "ERROR", access["level"])
+	assert.Equal(t, "/customer/:customerId", access["route"])
+	assert.Equal(t, Redact([]byte("key"), "01"), access[KeyCustomerID])
+	assert.Equal(t, float64(http.StatusInternalServerError), access["status"])
+	assert.Contains(t, access[KeyError], "store unavailable")
+	assert.NotContains(t, buf.String(), `"01"`, "customer IDs are only logged redacted")
+
+	t.Run("Panic", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customer/01?outcome=panic", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, buf.String(), `"msg":"panic serving request"`)
+	})
+}
+
+func TestEchoRequestID(t *testing.T) {
+	tests := []struct {
+		url          string
+		expectedBody string
+	}{
+		{"/echo/01?outcome=error", `{"requestId":"req-1","error":"Failed"}`},
+		{"/echo/01?outcome=empty", `{"requestId":"req-1"}`},
+		{"/echo/01", `{"message":"ok"}`},
+		{"/customer/01?outcome=error", `{"error":"Failed"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			var buf bytes.Buffer
+			router := newRouter(&buf)
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.Header.Set(Header, "req-1")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
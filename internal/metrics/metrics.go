@@ -0,0 +1,211 @@
+// Package metrics exposes Prometheus metrics of requests, ingestion and the store.
+// Every method is safe to call on a nil *Metrics, so code paths without metrics need no checks.
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the name of every metric
+const Namespace = "qlikorders"
+
+// Path the metrics are served on
+const Path = "/metrics"
+
+// Route label of requests not matching any route, so unknown paths don't each get their own series
+const unmatchedRoute = "unmatched"
+
+// StoreSize is the number of orders and distinct customers stored across every tenant
+type StoreSize struct {
+	Orders    int
+	Customers int
+}
+
+// Metrics holds the collectors of the service, registered on their own registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	ordersIngested     prometheus.Counter
+	itemsIngested      prometheus.Counter
+	batchSize          prometheus.Histogram
+	validationFailures *prometheus.CounterVec
+	mutexWait          prometheus.Histogram
+
+	// storeSize reports the size of the store when scraped, nil until a store is observed
+	storeSize atomic.Pointer[func() StoreSize]
+}
+
+// New creates the collectors and registers them, along with the Go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		ordersIngested: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "orders_ingested_total",
+			Help:      "Orders stored.",
+		}),
+		itemsIngested: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "items_ingested_total",
+			Help:      "Items of the orders stored.",
+		}),
+		batchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "batch_size_orders",
+			Help:      "Orders in each batch stored.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+		}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "validation_failures_total",
+			Help:      "Rejected orders by reason, the rule an invalid field breaks or why the batch couldn't be read.",
+		}, []string{"reason"}),
+		mutexWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "collection_mutex_wait_seconds",
+			Help:      "Time spent waiting for the lock of the order collection.",
+			Buckets:   prometheus.ExponentialBuckets(0.000001, 4, 12),
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.requestDuration,
+		m.ordersIngested, m.itemsIngested, m.batchSize, m.validationFailures, m.mutexWait,
+		storeCollector{m},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Registry returns the registry the collectors are registered on
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() gin.HandlerFunc {
+	handler := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return gin.WrapH(handler)
+}
+
+// Middleware counts and times every request by its route, and makes the metrics available to handlers
+// through FromContext
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Request = c.Request.WithContext(WithMetrics(c.Request.Context(), m))
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		labels := prometheus.Labels{"method": c.Request.Method, "route": route, "status": strconv.Itoa(c.Writer.Status())}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveStore reports the size returned by size when the metrics are scraped, it replaces any store observed before.
+// size is called on every scrape and has to be safe for concurrent use.
+func (m *Metrics) ObserveStore(size func() StoreSize) {
+	if m == nil {
+		return
+	}
+	m.storeSize.Store(&size)
+}
+
+func (m *Metrics) size() StoreSize {
+	size := m.storeSize.Load()
+	if size == nil {
+		return StoreSize{}
+	}
+	return (*size)()
+}
+
+var (
+	storeOrdersDesc = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", "store_orders"),
+		"Orders stored across every tenant.", nil, nil)
+	storeCustomersDesc = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", "store_customers"),
+		"Distinct customers with stored orders across every tenant.", nil, nil)
+)
+
+// storeCollector reports the size of the store, measured once per scrape for both gauges
+// since measuring it scans the whole store
+type storeCollector struct {
+	m *Metrics
+}
+
+func (s storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storeOrdersDesc
+	ch <- storeCustomersDesc
+}
+
+func (s storeCollector) Collect(ch chan<- prometheus.Metric) {
+	size := s.m.size()
+	ch <- prometheus.MustNewConstMetric(storeOrdersDesc, prometheus.GaugeValue, float64(size.Orders))
+	ch <- prometheus.MustNewConstMetric(storeCustomersDesc, prometheus.GaugeValue, float64(size.Customers))
+}
+
+// OrdersStored records a batch of orders holding items items being stored
+func (m *Metrics) OrdersStored(orders, items int) {
+	if m == nil {
+		return
+	}
+	m.batchSize.Observe(float64(orders))
+	m.ordersIngested.Add(float64(orders))
+	m.itemsIngested.Add(float64(items))
+}
+
+// ValidationFailed records a batch being rejected, once for every reason
+func (m *Metrics) ValidationFailed(reasons ...string) {
+	if m == nil {
+		return
+	}
+	for _, reason := range reasons {
+		m.validationFailures.WithLabelValues(reason).Inc()
+	}
+}
+
+// MutexWaited records the time spent waiting for the lock of the order collection
+func (m *Metrics) MutexWaited(wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mutexWait.Observe(wait.Seconds())
+}
+
+type contextKey struct{}
+
+// WithMetrics returns a copy of ctx carrying m
+func WithMetrics(ctx context.Context, m *Metrics) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the metrics carried by ctx, nil when there are none, which records nothing
+func FromContext(ctx context.Context) *Metrics {
+	m, _ := ctx.Value(contextKey{}).(*Metrics)
+	return m
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/customer/:customerId/items", func(c *gin.Context) {
+		assert.Same(t, m, FromContext(c.Request.Context()))
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/customer/01/items", "/customer/02/items", "/unknown/1", "/unknown/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Series are labelled with the route, not the path
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/customer/:customerId/items", "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.requestDuration))
+}
+
+func TestIngestion(t *testing.T) {
+	m := New()
+	m.OrdersStored(2, 5)
+	m.OrdersStored(1, 1)
+	m.ValidationFailed("required", "required", "gt")
+	m.MutexWaited(time.Millisecond)
+	m.ObserveStore(func() StoreSize { return StoreSize{Orders: 3, Customers: 2} })
+
+	expected := `
+# HELP qlikorders_orders_ingested_total Orders stored.
+# TYPE qlikorders_orders_ingested_total counter
+qlikorders_orders_ingested_total 3
+# HELP qlikorders_items_ingested_total Items of the orders stored.
+# TYPE qlikorders_items_ingested_total counter
+qlikorders_items_ingested_total 6
+# HELP qlikorders_validation_failures_total Rejected orders by reason, the rule an invalid field breaks or why the batch couldn't be read.
+# TYPE qlikorders_validation_failures_total counter
+qlikorders_validation_failures_total{reason="gt"} 1
+qlikorders_validation_failures_total{reason="required"} 2
+# HELP qlikorders_store_orders Orders stored across every tenant.
+# TYPE qlikorders_store_orders gauge
+qlikorders_store_orders 3
+# HELP qlikorders_store_customers Distinct customers with stored orders across every tenant.
+# TYPE qlikorders_store_customers gauge
+qlikorders_store_customers 2
+`
+	require.NoError(t, testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected),
+		"qlikorders_orders_ingested_total", "qlikorders_items_ingested_total", "qlikorders_validation_failures_total",
+		"qlikorders_store_orders", "qlikorders_store_customers"))
+	assert.Equal(t, 2, histogramCount(t, m, "qlikorders_batch_size_orders"))
+	assert.Equal(t, 1, histogramCount(t, m, "qlikorders_collection_mutex_wait_seconds"))
+}
+
+func TestStoreSizeOncePerScrape(t *testing.T) {
+	m := New()
+	calls := 0
+	m.ObserveStore(func() StoreSize {
+		calls++
+		return StoreSize{Orders: 3, Customers: 2}
+	})
+
+	_, err := m.Registry().Gather()
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "both gauges come from one measure of the store")
+}
+
+func TestNil(t *testing.T) {
+	var m *Metrics
+	assert.Nil(t, FromContext(context.Background()))
+	assert.NotPanics(t, func() {
+		m.OrdersStored(1, 1)
+		m.ValidationFailed("required")
+		m.MutexWaited(time.Millisecond)
+		m.ObserveStore(func() StoreSize { return StoreSize{} })
+	})
+}
+
+func histogramCount(t *testing.T, m *Metrics, name string) int {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return int(family.GetMetric()[0].GetHistogram().GetSampleCount())
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
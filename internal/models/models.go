@@ -1,27 +1,143 @@
 package models
 
+import (
+	"errors"
+	"qlikOrders/internal/validation"
+	"strconv"
+	"time"
+)
+
+// DefaultTenantID owns the orders of callers not bound to a tenant
+const DefaultTenantID = "default"
+
 type Order struct {
+	TenantID   string `json:"-"` // Set from the caller, never from the payload
 	CustomerID string `json:"customerId" validate:"required"`
 	OrderID    string `json:"orderId" validate:"required"`
-	Timestamp  string `json:"timestamp" validate:"required"`
-	Items      []Item `json:"items" validate:"required,dive,required"` // Validate items array
+	Timestamp  string `json:"timestamp" validate:"required,timestamp"`
+	Items      []Item `json:"items" validate:"required,min=1,dive"`
+}
+
+// Tenant returns the tenant owning the order, orders without one belong to the default tenant
+func (o Order) Tenant() string {
+	if o.TenantID == "" {
+		return DefaultTenantID
+	}
+	return o.TenantID
+}
+
+// Validate checks the order and its items against their validate tags
+func (o Order) Validate() error {
+	return validation.Struct(o)
+}
+
+// Time parses the order timestamp, given in milliseconds since the Unix epoch
+func (o Order) Time() (time.Time, error) {
+	ms, err := strconv.ParseInt(o.Timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("timestamp is not in milliseconds since the epoch")
+	}
+	return time.UnixMilli(ms).UTC(), nil
 }
 
 // Item struct to represent an item within an order
 type Item struct {
-	ItemID  string `json:"itemId"`
-	CostEur int    `json:"costEur"`
+	ItemID  string `json:"itemId" validate:"required"`
+	CostEur int    `json:"costEur" validate:"gt=0"`
 }
 
 type CustomerItem struct {
-	CustomerID string `json:"customerId"`
-	ItemID     string `json:"itemId"`
-	CostEur    int    `json:"costEur"`
+	CustomerID string `json:"customerId" parquet:"customerId"`
+	ItemID     string `json:"itemId" parquet:"itemId"`
+	CostEur    int    `json:"costEur" parquet:"costEur"`
+	OrderID    string `json:"orderId,omitempty" parquet:"orderId"`     // Only set when expanded with the order
+	Timestamp  string `json:"timestamp,omitempty" parquet:"timestamp"` // Only set when expanded with the order
+}
+
+// ItemHistory aggregates every purchase of one item by a customer
+type ItemHistory struct {
+	ItemID           string   `json:"itemId" parquet:"itemId"`
+	Units            int      `json:"units" parquet:"units"`
+	TotalAmountEur   int      `json:"totalAmountEur" parquet:"totalAmountEur"`
+	FirstPurchasedAt string   `json:"firstPurchasedAt" parquet:"firstPurchasedAt"`
+	LastPurchasedAt  string   `json:"lastPurchasedAt" parquet:"lastPurchasedAt"`
+	OrderIDs         []string `json:"orderIds,omitempty" parquet:"orderIds,list"` // Only set when expanded with the order
 }
 
 // Summary struct for customer summary
 type Summary struct {
-	CustomerID          string `json:"customerId"`
-	NbrOfPurchasedItems int    `json:"nbrOfPurchasedItems"`
-	TotalAmountEur      int    `json:"totalAmountEur"`
+	CustomerID          string `json:"customerId" parquet:"customerId"`
+	NbrOfPurchasedItems int    `json:"nbrOfPurchasedItems" parquet:"nbrOfPurchasedItems"`
+	TotalAmountEur      int    `json:"totalAmountEur" parquet:"totalAmountEur"`
+	RFM                 *RFM   `json:"rfm,omitempty" parquet:"-"` // Only set on per-customer summaries
+}
+
+// RFM holds the Recency, Frequency and Monetary values of a customer and their quintile scores from 1 to 5
+type RFM struct {
+	CustomerID         string `json:"customerId,omitempty"`
+	LastOrderAt        string `json:"lastOrderAt"`
+	DaysSinceLastOrder int    `json:"daysSinceLastOrder"`
+	Orders             int    `json:"orders"`
+	TotalAmountEur     int    `json:"totalAmountEur"`
+	Recency            int    `json:"recency"`
+	Frequency          int    `json:"frequency"`
+	Monetary           int    `json:"monetary"`
+	Segment            string `json:"segment"` // The three scores concatenated, e.g. "545"
+}
+
+// ErasureMode decides whether a customer's orders are removed or pseudonymized
+type ErasureMode string
+
+const (
+	ErasureModeDelete       ErasureMode = "delete"
+	ErasureModePseudonymize ErasureMode = "pseudonymize"
+)
+
+// ErasureRecord is the audit record kept for every customer erasure
+type ErasureRecord struct {
+	TenantID       string      `json:"-"`
+	ErasureID      string      `json:"erasureId"`
+	SubjectRef     string      `json:"subjectRef"` // HMAC-SHA256 of the erased customer ID keyed with REDACTION_SECRET, see logging.HashCustomerID
+	Mode           ErasureMode `json:"mode"`
+	OrdersAffected int         `json:"ordersAffected"`
+	ItemsAffected  int         `json:"itemsAffected"`
+	ErasedAt       string      `json:"erasedAt"`
+	OrderIDs       []string    `json:"-"` // IDs of the erased orders for the audit log, only set on the record returned by the erasure
+}
+
+// CustomerExport bundles everything stored about a single customer
+type CustomerExport struct {
+	CustomerID string         `json:"customerId"`
+	ExportedAt string         `json:"exportedAt"`
+	Orders     []Order        `json:"orders"`
+	Items      []CustomerItem `json:"items"`
+	Summary    Summary        `json:"summary"`
+}
+
+// Cohort groups customers by the month of their first order
+type Cohort struct {
+	Cohort             string        `json:"cohort"` // First order month, formatted as YYYY-MM
+	Customers          int           `json:"customers"`
+	RepeatPurchaseRate float64       `json:"repeatPurchaseRate"`
+	TotalAmountEur     int           `json:"totalAmountEur"`
+	Months             []CohortMonth `json:"months"`
+}
+
+// CohortMonth holds the activity of a cohort in a month following its first order month
+type CohortMonth struct {
+	Offset              int     `json:"offset"`
+	Month               string  `json:"month"`
+	ActiveCustomers     int     `json:"activeCustomers"`
+	RetentionRate       float64 `json:"retentionRate"`
+	AmountEur           int     `json:"amountEur"`
+	CumulativeAmountEur int     `json:"cumulativeAmountEur"`
+}
+
+// RelatedItem is an item frequently bought in the same order as another item
+type RelatedItem struct {
+	ItemID     string  `json:"itemId"`
+	Orders     int     `json:"orders"`     // Orders containing both items
+	Support    float64 `json:"support"`    // Share of all orders containing both items
+	Confidence float64 `json:"confidence"` // Share of orders with the requested item that also contain this one
+	Lift       float64 `json:"lift"`       // Confidence relative to how often this item is bought at all
 }
@@ -0,0 +1,185 @@
+package models
+
+import "qlikOrders/internal/codec/protobuf"
+
+// Protobuf encoding of the models, following the messages of api/proto/orders.proto
+
+func (i Item) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, i.ItemID)
+	return protobuf.AppendInt(b, 2, i.CostEur)
+}
+
+func (i *Item) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			i.ItemID = r.String()
+		case 2:
+			i.CostEur = r.Int()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func (o Order) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, o.CustomerID)
+	b = protobuf.AppendString(b, 2, o.OrderID)
+	b = protobuf.AppendString(b, 3, o.Timestamp)
+	return protobuf.AppendMessages(b, 4, o.Items)
+}
+
+func (o *Order) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			o.CustomerID = r.String()
+		case 2:
+			o.OrderID = r.String()
+		case 3:
+			o.Timestamp = r.String()
+		case 4:
+			var item Item
+			r.Message(&item)
+			o.Items = append(o.Items, item)
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func (i CustomerItem) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, i.CustomerID)
+	b = protobuf.AppendString(b, 2, i.ItemID)
+	b = protobuf.AppendInt(b, 3, i.CostEur)
+	b = protobuf.AppendString(b, 4, i.OrderID)
+	return protobuf.AppendString(b, 5, i.Timestamp)
+}
+
+func (i *CustomerItem) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			i.CustomerID = r.String()
+		case 2:
+			i.ItemID = r.String()
+		case 3:
+			i.CostEur = r.Int()
+		case 4:
+			i.OrderID = r.String()
+		case 5:
+			i.Timestamp = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func (h ItemHistory) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, h.ItemID)
+	b = protobuf.AppendInt(b, 2, h.Units)
+	b = protobuf.AppendInt(b, 3, h.TotalAmountEur)
+	b = protobuf.AppendString(b, 4, h.FirstPurchasedAt)
+	b = protobuf.AppendString(b, 5, h.LastPurchasedAt)
+	return protobuf.AppendStrings(b, 6, h.OrderIDs)
+}
+
+func (h *ItemHistory) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			h.ItemID = r.String()
+		case 2:
+			h.Units = r.Int()
+		case 3:
+			h.TotalAmountEur = r.Int()
+		case 4:
+			h.FirstPurchasedAt = r.String()
+		case 5:
+			h.LastPurchasedAt = r.String()
+		case 6:
+			h.OrderIDs = append(h.OrderIDs, r.String())
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func (s Summary) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, s.CustomerID)
+	b = protobuf.AppendInt(b, 2, s.NbrOfPurchasedItems)
+	b = protobuf.AppendInt(b, 3, s.TotalAmountEur)
+	if s.RFM != nil {
+		b = protobuf.AppendMessage(b, 4, s.RFM)
+	}
+	return b
+}
+
+func (s *Summary) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			s.CustomerID = r.String()
+		case 2:
+			s.NbrOfPurchasedItems = r.Int()
+		case 3:
+			s.TotalAmountEur = r.Int()
+		case 4:
+			s.RFM = &RFM{}
+			r.Message(s.RFM)
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func (m *RFM) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, m.CustomerID)
+	b = protobuf.AppendString(b, 2, m.LastOrderAt)
+	b = protobuf.AppendInt(b, 3, m.DaysSinceLastOrder)
+	b = protobuf.AppendInt(b, 4, m.Orders)
+	b = protobuf.AppendInt(b, 5, m.TotalAmountEur)
+	b = protobuf.AppendInt(b, 6, m.Recency)
+	b = protobuf.AppendInt(b, 7, m.Frequency)
+	b = protobuf.AppendInt(b, 8, m.Monetary)
+	return protobuf.AppendString(b, 9, m.Segment)
+}
+
+func (m *RFM) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			m.CustomerID = r.String()
+		case 2:
+			m.LastOrderAt = r.String()
+		case 3:
+			m.DaysSinceLastOrder = r.Int()
+		case 4:
+			m.Orders = r.Int()
+		case 5:
+			m.TotalAmountEur = r.Int()
+		case 6:
+			m.Recency = r.Int()
+		case 7:
+			m.Frequency = r.Int()
+		case 8:
+			m.Monetary = r.Int()
+		case 9:
+			m.Segment = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Messages encoded by hand must decode with the published schema into the same fields as the JSON body
+func TestProtoMatchesSchema(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{"../../api/proto"}},
+	}
+	files, err := compiler.Compile(context.Background(), "orders.proto")
+	require.NoError(t, err)
+
+	tests := []struct {
+		message protoreflect.FullName
+		value   interface{ AppendProto([]byte) []byte }
+	}{
+		{"qlikorders.Order", Order{
+			CustomerID: "01",
+			OrderID:    "50",
+			Timestamp:  "1637245070513",
+			Items:      []Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}},
+		}},
+		{"qlikorders.CustomerItem", CustomerItem{CustomerID: "01", ItemID: "20201", CostEur: 2, OrderID: "50", Timestamp: "1637245070513"}},
+		{"qlikorders.ItemHistory", ItemHistory{
+			ItemID:           "20201",
+			Units:            2,
+			TotalAmountEur:   4,
+			FirstPurchasedAt: "1637245070513",
+			LastPurchasedAt:  "1637245070514",
+			OrderIDs:         []string{"50", "51"},
+		}},
+		{"qlikorders.Summary", Summary{CustomerID: "01", NbrOfPurchasedItems: 2, TotalAmountEur: 5}},
+		{"qlikorders.Summary", Summary{CustomerID: "01", NbrOfPurchasedItems: 2, TotalAmountEur: 5, RFM: &RFM{
+			LastOrderAt:        "2021-11-18T14:17:50Z",
+			DaysSinceLastOrder: 3,
+			Orders:             2,
+			TotalAmountEur:     5,
+			Recency:            5,
+			Frequency:          4,
+			Monetary:           5,
+			Segment:            "545",
+		}}},
+	}
+
+	for _, tt := range tests {
+		descriptor, err := files.AsResolver().FindDescriptorByName(tt.message)
+		require.NoError(t, err)
+
+		message := dynamicpb.NewMessage(descriptor.(protoreflect.MessageDescriptor))
+		require.NoError(t, proto.Unmarshal(tt.value.AppendProto(nil), message), tt.message)
+
+		body, err := json.Marshal(tt.value)
+		require.NoError(t, err)
+		var expected map[string]any
+		require.NoError(t, json.Unmarshal(body, &expected))
+
+		assert.Equal(t, withoutZeros(expected), protoFields(message), tt.message)
+	}
+}
+
+// protoFields lists the fields set on a message by their JSON name, numbers decoded like encoding/json does
+func protoFields(m protoreflect.Message) map[string]any {
+	fields := map[string]any{}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsList() {
+			list := make([]any, v.List().Len())
+			for i := range list {
+				list[i] = protoValue(fd, v.List().Get(i))
+			}
+			fields[fd.JSONName()] = list
+			return true
+		}
+		fields[fd.JSONName()] = protoValue(fd, v)
+		return true
+	})
+	return fields
+}
+
+func protoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		return protoFields(v.Message())
+	case protoreflect.Int64Kind:
+		return float64(v.Int())
+	}
+	return v.Interface()
+}
+
+// withoutZeros drops the fields proto3 leaves out of the encoding
+func withoutZeros(fields map[string]any) map[string]any {
+	for name, value := range fields {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				delete(fields, name)
+			}
+		case float64:
+			if v == 0 {
+				delete(fields, name)
+			}
+		case map[string]any:
+			withoutZeros(v)
+		case []any:
+			for _, element := range v {
+				if m, ok := element.(map[string]any); ok {
+					withoutZeros(m)
+				}
+			}
+		}
+	}
+	return fields
+}
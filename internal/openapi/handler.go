@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs.html
+var docsPage string
+
+// Handler serves the document as JSON, it is encoded once as it doesn't change at runtime
+func Handler(doc *Document) gin.HandlerFunc {
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		// The document is built in code, an error is a programming mistake
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// DocsHandler serves a page rendering the document found at specURL.
+// The page is self-contained, so the docs work without access to a CDN.
+func DocsHandler(specURL string) gin.HandlerFunc {
+	page := []byte(strings.Replace(docsPage, "{{SPEC_URL}}", specURL, 1))
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	}
+}
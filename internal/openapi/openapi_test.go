@@ -0,0 +1,104 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Base struct {
+	ID string `json:"id"`
+}
+
+type Node struct {
+	Base
+	Name     string         `json:"name"`
+	Note     string         `json:"note,omitempty"`
+	Secret   string         `json:"-"`
+	Weight   float64        `json:"weight"`
+	Tags     []string       `json:"tags"`
+	Labels   map[string]int `json:"labels,omitempty"`
+	Children []*Node        `json:"children"`
+	Data     []byte         `json:"data,omitempty"`
+	Created  time.Time      `json:"created,omitempty"`
+	hidden   bool
+}
+
+func TestSchema(t *testing.T) {
+	doc := New(Info{Title: "Test", Version: "1"})
+
+	assert.Equal(t, Ref("Node"), doc.Schema(Node{}))
+	assert.Equal(t, ArrayOf(Ref("Node")), doc.Schema([]Node{}))
+
+	node := doc.Components.Schemas["Node"]
+	require.NotNil(t, node)
+	expected := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":       {Type: "string"},
+			"name":     {Type: "string"},
+			"note":     {Type: "string"},
+			"weight":   {Type: "number", Format: "double"},
+			"tags":     ArrayOf(&Schema{Type: "string"}),
+			"labels":   {Type: "object", AdditionalProperties: &Schema{Type: "integer", Format: "int64"}},
+			"children": ArrayOf(Ref("Node")),
+			"data":     {Type: "string", Format: "byte"},
+			"created":  {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"id", "name", "weight", "tags", "children"},
+	}
+	assert.Equal(t, expected, node)
+	assert.NotContains(t, doc.Components.Schemas, "Base", "embedded structs are promoted")
+	assert.NotContains(t, doc.Components.Schemas, "Time", "times are strings")
+}
+
+func TestAdd(t *testing.T) {
+	doc := New(Info{Title: "Test", Version: "1"})
+	doc.Add("GET", "/customer/:customerId/items", &Operation{
+		Parameters: []Parameter{{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}}},
+	})
+	doc.Add("DELETE", "/customer/:customerId/items", &Operation{
+		Parameters: []Parameter{{Name: "customerId", In: "path", Required: true, Description: "Customer", Schema: &Schema{Type: "string"}}},
+	})
+
+	item := doc.Paths["/customer/{customerId}/items"]
+	require.NotNil(t, item)
+	require.Len(t, item.Get.Parameters, 2)
+	assert.Equal(t, Parameter{Name: "customerId", In: "path", Required: true, Schema: &Schema{Type: "string"}}, item.Get.Parameters[0])
+	require.Len(t, item.Delete.Parameters, 1)
+	assert.Equal(t, "Customer", item.Delete.Parameters[0].Description)
+
+	assert.ElementsMatch(t, []string{"GET /customer/{customerId}/items", "DELETE /customer/{customerId}/items"}, doc.Operations())
+	assert.Panics(t, func() { doc.Add("TRACE", "/", &Operation{}) })
+}
+
+type Request struct {
+	ID        string   `json:"id" validate:"required"`
+	Timestamp string   `json:"timestamp" validate:"required,timestamp"`
+	Kind      string   `json:"kind,omitempty" validate:"omitempty,oneof=retail wholesale"`
+	Quantity  int      `json:"quantity,omitempty" validate:"gt=0,lte=10"`
+	Nodes     []Node   `json:"nodes" validate:"required,min=1,dive"`
+	Tags      []string `json:"tags,omitempty" validate:"max=3,dive,min=2"`
+}
+
+func TestSchemaRules(t *testing.T) {
+	doc := New(Info{Title: "Test", Version: "1"})
+	doc.Schema(Request{})
+
+	one, two, three, ten, zero := 1, 2, 3, 10, 0
+	expected := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":        {Type: "string", MinLength: &one},
+			"timestamp": {Type: "string", MinLength: &one, Pattern: "^[0-9]+$", Description: "Milliseconds since the epoch"},
+			"kind":      {Type: "string", Enum: []string{"retail", "wholesale"}},
+			"quantity":  {Type: "integer", Format: "int64", Minimum: &zero, ExclusiveMinimum: true, Maximum: &ten},
+			"nodes":     {Type: "array", MinItems: &one, Items: Ref("Node")},
+			"tags":      {Type: "array", MaxItems: &three, Items: &Schema{Type: "string", MinLength: &two}},
+		},
+		Required: []string{"id", "timestamp", "nodes"},
+	}
+	assert.Equal(t, expected, doc.Components.Schemas["Request"])
+}
@@ -0,0 +1,194 @@
+package openapi
+
+import (
+	"path"
+	"qlikOrders/internal/validation"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema returns the schema of the JSON encoding of v.
+// Structs are added to the components under their type name and referenced, so models are described once.
+func (d *Document) Schema(v any) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+// Ref returns a reference to the component schema named name
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ArrayOf returns the schema of an array of items
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Object returns the schema of an object with properties, all of them required
+func Object(properties map[string]*Schema) *Schema {
+	schema := &Schema{Type: "object", Properties: properties}
+	for name := range properties {
+		schema.Required = append(schema.Required, name)
+	}
+	slices.Sort(schema.Required)
+	return schema
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t == reflect.TypeFor[time.Time]() {
+		// Times are encoded in RFC 3339
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return d.schemaOf(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return ArrayOf(d.schemaOf(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return d.component(t)
+	default:
+		// Interfaces can hold any value
+		return &Schema{}
+	}
+}
+
+// component registers the schema of a struct and returns a reference to it.
+// The first type registered under a name keeps it, types of other packages named the same
+// are prefixed with their package name, e.g. V2Order.
+func (d *Document) component(t reflect.Type) *Schema {
+	name := t.Name()
+	if name == "" {
+		return d.structSchema(t)
+	}
+	if registered, ok := d.components[name]; ok && registered != t {
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	if _, ok := d.components[name]; !ok {
+		// Registered before the fields are walked, so recursive types terminate
+		d.components[name] = t
+		d.Components.Schemas[name] = &Schema{}
+		*d.Components.Schemas[name] = *d.structSchema(t)
+	}
+	return Ref(name)
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	d.addFields(schema, t)
+	return schema
+}
+
+// addFields adds the exported fields of t to schema, following encoding/json: fields of embedded structs are promoted
+func (d *Document) addFields(schema *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schemaOf(field.Type)
+		required := applyRules(property, field.Tag.Get("validate"))
+		schema.Properties[name] = property
+		if required || !strings.Contains(","+opts+",", ",omitempty,") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// applyRules adds the constraints of a validate tag to schema, and reports whether the tag makes the field required.
+// Rules after dive apply to the items of a list. References can't carry constraints, rules on them are left to their component.
+func applyRules(schema *Schema, tag string) bool {
+	required := false
+	target := schema
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		if name == "dive" {
+			if target.Items == nil {
+				return required
+			}
+			target = target.Items
+			continue
+		}
+		if name == "required" && target == schema {
+			required = true
+		}
+		if target.Ref != "" {
+			continue
+		}
+		if name == "required" && target.Type == "string" {
+			// Empty strings are missing to the validator
+			one := 1
+			target.MinLength = &one
+		}
+
+		n, err := strconv.Atoi(param)
+		hasNumber := err == nil
+		switch {
+		case name == validation.RuleTimestamp:
+			target.Pattern = "^[0-9]+$"
+			target.Description = "Milliseconds since the epoch"
+		case name == "oneof":
+			target.Enum = strings.Fields(param)
+		case !hasNumber:
+		case name == "gt":
+			target.Minimum, target.ExclusiveMinimum = &n, true
+		case name == "gte":
+			target.Minimum = &n
+		case name == "lt":
+			target.Maximum, target.ExclusiveMaximum = &n, true
+		case name == "lte":
+			target.Maximum = &n
+		case name == "min" && target.Type == "array":
+			target.MinItems = &n
+		case name == "max" && target.Type == "array":
+			target.MaxItems = &n
+		case name == "min" && target.Type == "string":
+			target.MinLength = &n
+		case name == "max" && target.Type == "string":
+			target.MaxLength = &n
+		case name == "min":
+			target.Minimum = &n
+		case name == "max":
+			target.Maximum = &n
+		}
+	}
+	return required
+}
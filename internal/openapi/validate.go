@@ -0,0 +1,90 @@
+package openapi
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateParameters returns a middleware rejecting requests whose query parameters break the schemas
+// of their operation in doc with 400, before any handler runs. Routes missing from doc are left alone.
+// Empty values are treated as missing, like the handlers do.
+// Routes are looked up with prefix in front of their path, for routes served under several prefixes but described once.
+func ValidateParameters(doc *Document, prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		item, ok := doc.Paths[Path(prefix+c.FullPath())]
+		if !ok {
+			c.Next()
+			return
+		}
+		op := item.Operation(c.Request.Method)
+		if op == nil {
+			c.Next()
+			return
+		}
+
+		for _, param := range op.Parameters {
+			if param.In != "query" {
+				continue
+			}
+			value := c.Query(param.Name)
+			if value == "" {
+				if param.Required {
+					invalidParameter(c, param.Name, "is required")
+					return
+				}
+				continue
+			}
+			if message := check(param.Schema, value); message != "" {
+				invalidParameter(c, param.Name, message)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func invalidParameter(c *gin.Context, name, message string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "message": name + " " + message})
+}
+
+// check returns why value breaks schema, empty when it doesn't
+func check(schema *Schema, value string) string {
+	if schema == nil {
+		return ""
+	}
+	if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+		return "must be one of " + strings.Join(schema.Enum, ", ")
+	}
+
+	switch schema.Type {
+	case "integer":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "must be an integer"
+		}
+		if schema.Minimum != nil && (n < *schema.Minimum || schema.ExclusiveMinimum && n == *schema.Minimum) {
+			if schema.ExclusiveMinimum {
+				return "must be greater than " + strconv.Itoa(*schema.Minimum)
+			}
+			return "must be at least " + strconv.Itoa(*schema.Minimum)
+		}
+		if schema.Maximum != nil && (n > *schema.Maximum || schema.ExclusiveMaximum && n == *schema.Maximum) {
+			if schema.ExclusiveMaximum {
+				return "must be less than " + strconv.Itoa(*schema.Maximum)
+			}
+			return "must be at most " + strconv.Itoa(*schema.Maximum)
+		}
+	case "string":
+		if schema.MinLength != nil && len(value) < *schema.MinLength {
+			return "must have at least " + strconv.Itoa(*schema.MinLength) + " characters"
+		}
+		if schema.MaxLength != nil && len(value) > *schema.MaxLength {
+			return "must have at most " + strconv.Itoa(*schema.MaxLength) + " characters"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	zero, hundred := 0, 100
+
+	doc := New(Info{Title: "Test", Version: "1"})
+	doc.Add(http.MethodGet, "/customer/:customerId/items", &Operation{Parameters: []Parameter{
+		{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Minimum: &zero, Maximum: &hundred}},
+		{Name: "groupBy", In: "query", Schema: &Schema{Type: "string", Enum: []string{"item"}}},
+		{Name: "since", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+	}})
+
+	router := gin.New()
+	router.Use(ValidateParameters(doc, ""))
+	router.GET("/customer/:customerId/items", func(c *gin.Context) { c.Status(http.StatusOK) })
+	// Served without the prefix of its description
+	doc.Add(http.MethodGet, "/v1/orders", &Operation{Parameters: []Parameter{{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Minimum: &zero}}}})
+	router.Group("", ValidateParameters(doc, "/v1")).GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/undocumented", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"Valid", "/customer/01/items?since=1&limit=10&groupBy=item", http.StatusOK, ""},
+		{"Empty values are missing", "/customer/01/items?since=1&limit=&groupBy=", http.StatusOK, ""},
+		{"Missing required", "/customer/01/items?limit=10", http.StatusBadRequest, `{"error":"Invalid input","message":"since is required"}`},
+		{"Not an integer", "/customer/01/items?since=1&limit=ten", http.StatusBadRequest, `{"error":"Invalid input","message":"limit must be an integer"}`},
+		{"Below minimum", "/customer/01/items?since=1&limit=-1", http.StatusBadRequest, `{"error":"Invalid input","message":"limit must be at least 0"}`},
+		{"Above maximum", "/customer/01/items?since=1&limit=101", http.StatusBadRequest, `{"error":"Invalid input","message":"limit must be at most 100"}`},
+		{"Not in enum", "/customer/01/items?since=1&groupBy=order", http.StatusBadRequest, `{"error":"Invalid input","message":"groupBy must be one of item"}`},
+		{"Prefixed", "/orders?limit=-1", http.StatusBadRequest, `{"error":"Invalid input","message":"limit must be at least 0"}`},
+		{"Undocumented route", "/undocumented?limit=ten", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"qlikOrders/internal/auth"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The key the Limiter is stored under in the gin context so handlers can consume quotas
+const limiterKey = "ratelimit.limiter"
+
+// Limiter rate limits requests per client and route, and caps the orders a client ingests per day.
+// Clients are identified by their credentials, or by IP address when anonymous.
+type Limiter struct {
+	Store Store
+	// Default applies to every route without an entry in Routes, zero Requests disables it
+	Default Limit
+	// Routes overrides the limit of a route, keyed by method and path as registered, e.g. "POST /orders"
+	Routes map[string]Limit
+	// DailyOrders caps the orders a client can ingest per UTC day, 0 disables it
+	DailyOrders int
+
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+}
+
+// Middleware returns a middleware rejecting requests over the route's limit with 429.
+// It must run after authentication so authenticated clients are limited by their credentials.
+// versionPrefixes are stripped from the paths, every version of a route shares its limit and the requests counted against it.
+func (l *Limiter) Middleware(versionPrefixes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(limiterKey, l)
+
+		route := c.Request.Method + " " + unversioned(c.FullPath(), versionPrefixes)
+		limit := l.limit(route)
+		if limit.Requests <= 0 {
+			c.Next()
+			return
+		}
+
+		result, err := l.Store.Take(ClientKey(c)+"|"+route, limit, l.now())
+		if err != nil {
+			// Fail open, an unavailable limiter store shouldn't take the API down
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", seconds(result.Reset))
+
+		if !result.Allowed {
+			c.Header("Retry-After", seconds(result.RetryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":   "Too many requests",
+				"message": "Rate limit exceeded, retry after " + seconds(result.RetryAfter) + " seconds",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Allow takes a request of client on route, clients outside of gin name their routes the same way as Routes.
+// It returns false and how long to wait when the limit of the route is reached.
+// A nil Limiter allows everything, and so does an unavailable store.
+func (l *Limiter) Allow(client, route string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	limit := l.limit(route)
+	if limit.Requests <= 0 {
+		return true, 0
+	}
+	result, err := l.Store.Take(client+"|"+route, limit, l.now())
+	if err != nil {
+		return true, 0
+	}
+	return result.Allowed, result.RetryAfter
+}
+
+// unversioned strips the first of prefixes path starts with
+func unversioned(path string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if rest, ok := strings.CutPrefix(path, prefix); ok && strings.HasPrefix(rest, "/") {
+			return rest
+		}
+	}
+	return path
+}
+
+// limit returns the limit of a route, the default one unless overridden
+func (l *Limiter) limit(route string) Limit {
+	if limit, ok := l.Routes[route]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// ErrQuotaExceeded is returned by ReserveOrders when the daily order quota doesn't allow more orders
+var ErrQuotaExceeded = errors.New("daily order quota exceeded")
+
+// ConsumeOrders counts n ingested orders against the client's daily quota.
+// It writes a 429 response and returns false when the quota doesn't allow them.
+// Requests without a Limiter are always allowed.
+func ConsumeOrders(c *gin.Context, n int) bool {
+	if err := ReserveOrders(c, n); err != nil {
+		l, _ := fromContext(c)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Daily order quota exceeded",
+			"message": "The daily quota is " + strconv.Itoa(l.DailyOrders) + " orders, " + c.Writer.Header().Get("X-Quota-Remaining") + " remaining today",
+		})
+		return false
+	}
+	return true
+}
+
+// ReserveOrders counts n ingested orders against the client's daily quota and sets the quota headers.
+// Unlike ConsumeOrders it leaves the response to the caller, returning ErrQuotaExceeded when the quota doesn't allow them.
+func ReserveOrders(c *gin.Context, n int) error {
+	l, ok := fromContext(c)
+	if !ok {
+		return nil
+	}
+
+	result, reset, err := l.consumeOrders(ClientKey(c), n)
+	if err != nil || result == nil {
+		return nil
+	}
+
+	c.Header("X-Quota-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-Quota-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+	if !result.Allowed {
+		c.Header("Retry-After", seconds(reset.Sub(l.now())))
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// RefundOrders gives back orders consumed with ConsumeOrders that ended up not being stored
+func RefundOrders(c *gin.Context, n int) {
+	if l, ok := fromContext(c); ok {
+		l.RefundOrdersFor(ClientKey(c), n)
+	}
+}
+
+// ReserveOrdersFor counts n orders against the daily quota of client, as identified by ClientKey.
+// It lets work outliving the request, such as import jobs, keep counting against the quota of the caller.
+// A nil Limiter allows everything.
+func (l *Limiter) ReserveOrdersFor(client string, n int) error {
+	result, _, err := l.consumeOrders(client, n)
+	if err != nil || result == nil || result.Allowed {
+		return nil
+	}
+	return ErrQuotaExceeded
+}
+
+// RefundOrdersFor gives back orders reserved with ReserveOrdersFor that ended up not being stored
+func (l *Limiter) RefundOrdersFor(client string, n int) {
+	l.consumeOrders(client, -n)
+}
+
+// consumeOrders returns a nil result when the quota is disabled, the store failing open like the middleware
+func (l *Limiter) consumeOrders(client string, n int) (*QuotaResult, time.Time, error) {
+	if l == nil || l.DailyOrders <= 0 {
+		return nil, time.Time{}, nil
+	}
+	reset := endOfDay(l.now())
+	result, err := l.Store.Consume(client+"|orders", n, l.DailyOrders, reset)
+	if err != nil {
+		return nil, reset, err
+	}
+	return &result, reset, nil
+}
+
+func fromContext(c *gin.Context) (*Limiter, bool) {
+	value, ok := c.Get(limiterKey)
+	if !ok {
+		return nil, false
+	}
+	l, ok := value.(*Limiter)
+	return l, ok
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
+// ClientKey identifies the caller by their credentials, or their IP address when anonymous
+func ClientKey(c *gin.Context) string {
+	principal, _ := auth.PrincipalFromContext(c)
+	return KeyFor(principal, c.ClientIP())
+}
+
+// KeyFor identifies a caller outside of gin the same way as ClientKey, principal is nil for anonymous callers
+func KeyFor(principal *auth.Principal, ip string) string {
+	if principal != nil {
+		return "principal:" + principal.ID
+	}
+	return "ip:" + ip
+}
+
+func endOfDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// seconds rounds up so clients never retry too early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/auth"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(limiter *Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	store := auth.NewMemoryKeyStore(auth.APIKey{ID: "client", Hash: auth.HashKey("secret")})
+	router.Use(auth.New(auth.APIKeyAuthenticator{Store: store}).Authenticate())
+	router.Use(limiter.Middleware())
+
+	router.GET("/summary", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/orders", func(c *gin.Context) {
+		n, _ := strconv.Atoi(c.Query("n"))
+		if !ConsumeOrders(c, n) {
+			return
+		}
+		if c.Query("fail") != "" {
+			RefundOrders(c, n)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+	return router
+}
+
+func request(router *gin.Engine, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2021, time.November, 18, 12, 0, 0, 0, time.UTC)
+	router := setupRouter(&Limiter{
+		Store:   NewMemoryStore(),
+		Default: Limit{Requests: 2, Period: time.Minute},
+		Routes:  map[string]Limit{"POST /orders": {Requests: 1, Period: time.Minute}},
+		Now:     func() time.Time { return now },
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+		w := request(router, "GET", "/summary", nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	})
+
+	t.Run("Too many requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(router, "GET", "/summary", nil).Code)
+
+		w := request(router, "GET", "/summary", nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	})
+
+	t.Run("Authenticated clients have their own limit", func(t *testing.T) {
+		w := request(router, "GET", "/summary", map[string]string{"X-API-Key": "secret"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Routes have their own limit", func(t *testing.T) {
+		w := request(router, "POST", "/orders", nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+
+		assert.Equal(t, http.StatusTooManyRequests, request(router, "POST", "/orders", nil).Code)
+	})
+}
+
+func TestMiddlewareVersionPrefixes(t *testing.T) {
+	limiter := &Limiter{
+		Store:  NewMemoryStore(),
+		Routes: map[string]Limit{"POST /orders": {Requests: 2, Period: time.Minute}},
+	}
+	router := gin.New()
+	router.Use(limiter.Middleware("/v1", "/v2"))
+	for _, path := range []string{"/orders", "/v1/orders", "/v2/orders", "/v10/orders"} {
+		router.POST(path, func(c *gin.Context) { c.Status(http.StatusCreated) })
+	}
+
+	// Versions of a route share its limit
+	assert.Equal(t, http.StatusCreated, request(router, "POST", "/v1/orders", nil).Code)
+	assert.Equal(t, http.StatusCreated, request(router, "POST", "/v2/orders", nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, request(router, "POST", "/orders", nil).Code)
+
+	// Only whole path segments are stripped
+	w := request(router, "POST", "/v10/orders", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestConsumeOrders(t *testing.T) {
+	now := time.Date(2021, time.November, 18, 12, 0, 0, 0, time.UTC)
+	router := setupRouter(&Limiter{
+		Store:       NewMemoryStore(),
+		DailyOrders: 5,
+		Now:         func() time.Time { return now },
+	})
+
+	w := request(router, "POST", "/orders?n=3", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Quota-Remaining"))
+
+	// Failed requests give the orders back
+	w = request(router, "POST", "/orders?n=2&fail=true", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = request(router, "POST", "/orders?n=3", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "43200", w.Header().Get("Retry-After"), "the quota resets at midnight UTC")
+
+	w = request(router, "POST", "/orders?n=2", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-Quota-Remaining"))
+
+	// Other clients have their own quota
+	w = request(router, "POST", "/orders?n=5", map[string]string{"X-API-Key": "secret"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
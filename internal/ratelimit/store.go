@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period, with bursts of up to Requests at once
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result describes the state of a token bucket after taking a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next token, only set when not allowed
+	RetryAfter time.Duration
+}
+
+// QuotaResult describes the state of a quota counter after consuming from it
+type QuotaResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Store keeps the state of token buckets and quota counters, implementations must be safe for concurrent use
+type Store interface {
+	// Take removes a token from the bucket of key
+	Take(key string, limit Limit, now time.Time) (Result, error)
+	// Consume adds n to the counter of key for the window ending at reset, nothing is added when it would go over quota.
+	// A negative n gives back what was consumed earlier in the window.
+	Consume(key string, n, quota int, reset time.Time) (QuotaResult, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// period of the bucket's limit, it is full again once idle that long
+	period time.Duration
+}
+
+type counter struct {
+	used  int
+	reset time.Time
+}
+
+// MemoryStore keeps buckets and counters in memory, for a single instance deployment
+type MemoryStore struct {
+	buckets  map[string]*bucket
+	counters map[string]*counter
+	mutex    sync.Mutex
+
+	// Idle entries are swept every sweepEvery calls so the maps don't grow with every client ever seen
+	calls int
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+const sweepEvery = 1000
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]*counter),
+	}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+
+	// Refill for the time passed since the last request
+	elapsed := now.Sub(b.updated)
+	b.tokens = min(capacity, b.tokens+elapsed.Seconds()/perToken.Seconds())
+	b.updated = now
+	b.period = limit.Period
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) * float64(perToken))
+	return result, nil
+}
+
+// Consume implements Store
+func (s *MemoryStore) Consume(key string, n, quota int, reset time.Time) (QuotaResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || !c.reset.Equal(reset) {
+		// A new window starts from zero
+		c = &counter{reset: reset}
+		s.counters[key] = c
+	}
+
+	result := QuotaResult{Limit: quota, Reset: reset}
+	if c.used+n <= quota {
+		c.used = max(0, c.used+n)
+		result.Allowed = true
+	}
+	result.Remaining = max(0, quota-c.used)
+	return result, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again, by the period of their own limit,
+// and counters of past windows
+func (s *MemoryStore) sweep(now time.Time) {
+	s.calls++
+	if s.calls%sweepEvery != 0 {
+		return
+	}
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+	for key, c := range s.counters {
+		if now.After(c.reset) {
+			delete(s.counters, key)
+		}
+	}
+}
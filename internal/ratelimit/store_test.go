@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: time.Minute}
+	now := time.Date(2021, time.November, 18, 12, 0, 0, 0, time.UTC)
+
+	// The burst allows two requests straight away
+	for remaining := 1; remaining >= 0; remaining-- {
+		result, err := store.Take("client", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	result, _ := store.Take("client", limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// Other clients have their own bucket
+	result, _ = store.Take("other", limit, now)
+	assert.True(t, result.Allowed)
+
+	// A token is refilled every 30 seconds
+	result, _ = store.Take("client", limit, now.Add(30*time.Second))
+	assert.True(t, result.Allowed)
+	result, _ = store.Take("client", limit, now.Add(31*time.Second))
+	assert.False(t, result.Allowed)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	hourly := Limit{Requests: 1, Period: time.Hour}
+	now := time.Date(2021, time.November, 18, 12, 0, 0, 0, time.UTC)
+
+	result, _ := store.Take("slow", hourly, now)
+	assert.True(t, result.Allowed)
+
+	// Requests with a shorter period trigger the sweep, the hourly bucket isn't refilled early
+	later := now.Add(2 * time.Minute)
+	for i := 0; i < sweepEvery; i++ {
+		store.Take("fast", Limit{Requests: 10, Period: time.Minute}, later)
+	}
+	result, _ = store.Take("slow", hourly, later)
+	assert.False(t, result.Allowed)
+
+	// Buckets idle for longer than their own period are dropped
+	for i := 0; i < sweepEvery; i++ {
+		store.Take("fast", Limit{Requests: 10, Period: time.Minute}, later.Add(2*time.Hour))
+	}
+	assert.NotContains(t, store.buckets, "slow")
+}
+
+func TestMemoryStoreConsume(t *testing.T) {
+	store := NewMemoryStore()
+	reset := time.Date(2021, time.November, 19, 0, 0, 0, 0, time.UTC)
+
+	result, _ := store.Consume("client", 3, 5, reset)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+
+	// Going over the quota consumes nothing
+	result, _ = store.Consume("client", 3, 5, reset)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+
+	// Refunds give back consumed units
+	result, _ = store.Consume("client", -3, 5, reset)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 5, result.Remaining)
+
+	// The next window starts over
+	store.Consume("client", 5, 5, reset)
+	result, _ = store.Consume("client", 5, 5, reset.Add(24*time.Hour))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
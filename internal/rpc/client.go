@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
+	"qlikOrders/internal/models"
+
+	"google.golang.org/grpc"
+)
+
+// Client calls the Orders service, for Go services using the messages of this package rather than generated code
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient creates a client of the Orders service on conn
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+func (c *Client) AddOrders(ctx context.Context, in *OrderList, opts ...grpc.CallOption) (*codec.Status, error) {
+	out := new(codec.Status)
+	return out, c.invoke(ctx, MethodAddOrders, in, out, opts)
+}
+
+func (c *Client) GetItemsByCustomer(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) (*CustomerItemPage, error) {
+	out := new(CustomerItemPage)
+	return out, c.invoke(ctx, MethodGetItemsByCustomer, in, out, opts)
+}
+
+func (c *Client) GetCustomerSummaries(ctx context.Context, in *SummariesRequest, opts ...grpc.CallOption) (*SummaryList, error) {
+	out := new(SummaryList)
+	return out, c.invoke(ctx, MethodGetCustomerSummaries, in, out, opts)
+}
+
+// StreamItemsByCustomer calls the method as the iteration starts and yields the items as they are received.
+// An error ends the iteration, breaking out of it cancels the call.
+func (c *Client) StreamItemsByCustomer(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) iter.Seq2[models.CustomerItem, error] {
+	return receive[models.CustomerItem](ctx, c, &serviceDesc.Streams[0], MethodStreamItemsByCustomer, in, opts)
+}
+
+// StreamCustomerSummaries calls the method as the iteration starts and yields the summaries as they are received.
+// An error ends the iteration, breaking out of it cancels the call.
+func (c *Client) StreamCustomerSummaries(ctx context.Context, in *SummariesRequest, opts ...grpc.CallOption) iter.Seq2[models.Summary, error] {
+	return receive[models.Summary](ctx, c, &serviceDesc.Streams[1], MethodStreamCustomerSummaries, in, opts)
+}
+
+func (c *Client) invoke(ctx context.Context, method string, in, out any, opts []grpc.CallOption) error {
+	return c.conn.Invoke(ctx, method, in, out, append([]grpc.CallOption{grpc.ForceCodec(Codec{})}, opts...)...)
+}
+
+// receive yields the messages of a server streaming method
+func receive[T any, PT interface {
+	*T
+	protobuf.Unmarshaler
+}](ctx context.Context, c *Client, desc *grpc.StreamDesc, method string, in any, opts []grpc.CallOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var zero T
+		stream, err := c.conn.NewStream(ctx, desc, method, append([]grpc.CallOption{grpc.ForceCodec(Codec{})}, opts...)...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		if err := stream.SendMsg(in); err != nil {
+			yield(zero, err)
+			return
+		}
+		if err := stream.CloseSend(); err != nil {
+			yield(zero, err)
+			return
+		}
+
+		for {
+			var message T
+			err := stream.RecvMsg(PT(&message))
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(message, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"qlikOrders/internal/tenant"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata read from the calls, the HTTP headers of the REST API in lower case
+var credentialKeys = []string{"x-api-key", "authorization"}
+
+// caller is who a call was resolved to act for
+type caller struct {
+	tenant string
+	client string // Identifies the caller for the rate limiter, as ratelimit.ClientKey does
+	actor  string // Identifies the caller in the audit log, as audit.Actor does
+}
+
+type callerKey struct{}
+
+// callerFromContext returns the caller resolved by the interceptor, the default tenant when it didn't run
+func callerFromContext(ctx context.Context) caller {
+	if c, ok := ctx.Value(callerKey{}).(caller); ok {
+		return c
+	}
+	return caller{tenant: models.DefaultTenantID, actor: audit.Anonymous}
+}
+
+// interceptor authenticates, resolves the tenant and rate limits every call, in the order of the gin middleware
+type interceptor struct {
+	auth    *auth.Auth
+	limiter *ratelimit.Limiter
+}
+
+func (i *interceptor) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := i.check(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (i *interceptor) stream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.check(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+}
+
+// check returns the context of a call allowed to go through, along with its caller
+func (i *interceptor) check(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var principal *auth.Principal
+	if i.auth != nil {
+		// Authenticators read credentials from HTTP headers, the metadata carries the same ones
+		r := &http.Request{Header: http.Header{}}
+		for _, key := range credentialKeys {
+			if values := md.Get(key); len(values) > 0 {
+				r.Header.Set(key, values[0])
+			}
+		}
+
+		// Every method requires a scope, so calls without credentials are rejected like on the REST routes
+		var err error
+		principal, err = i.auth.Identify(r)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+		if scope := methodScopes[method]; !principal.HasScope(scope) {
+			return nil, status.Error(codes.PermissionDenied, "Missing required scope "+scope)
+		}
+	}
+
+	var requested string
+	if values := md.Get("x-tenant-id"); len(values) > 0 {
+		requested = values[0]
+	}
+	tenantID, err := tenant.Decide(principal, requested)
+	if errors.Is(err, tenant.ErrInvalidTenant) {
+		return nil, status.Error(codes.InvalidArgument, "Invalid tenant")
+	}
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, "Credentials are bound to another tenant")
+	}
+
+	client := ratelimit.KeyFor(principal, peerIP(ctx))
+	if ok, retryAfter := i.limiter.Allow(client, method); !ok {
+		return nil, status.Errorf(codes.ResourceExhausted, "Rate limit exceeded, retry after %.0f seconds", math.Ceil(retryAfter.Seconds()))
+	}
+
+	return context.WithValue(ctx, callerKey{}, caller{tenant: tenantID, client: client, actor: audit.Actor(principal)}), nil
+}
+
+// peerIP returns the IP address of the caller, or its address when it has none such as over in-process listeners
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// serverStream carries the context of the caller to stream handlers
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
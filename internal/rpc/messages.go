@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
+	"qlikOrders/internal/models"
+)
+
+// Codec encodes the messages of the service, which implement the protobuf interfaces rather than being generated.
+// It is named proto so clients built from api/proto/orders.proto talk to the service unchanged.
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error) {
+	return codec.Marshal(codec.FormatProtobuf, v)
+}
+
+func (Codec) Unmarshal(data []byte, v any) error {
+	return codec.Unmarshal(codec.FormatProtobuf, data, v)
+}
+
+func (Codec) Name() string {
+	return "proto"
+}
+
+// OrderList is the request of AddOrders
+type OrderList struct {
+	Orders []models.Order
+}
+
+func (l *OrderList) AppendProto(b []byte) []byte {
+	return protobuf.AppendMessages(b, 1, l.Orders)
+}
+
+func (l *OrderList) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			var order models.Order
+			r.Message(&order)
+			l.Orders = append(l.Orders, order)
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+// ItemsRequest is the request of GetItemsByCustomer and StreamItemsByCustomer
+type ItemsRequest struct {
+	CustomerID  string
+	ExpandOrder bool
+	Limit       int // 0 returns every item
+	Offset      int
+}
+
+func (q *ItemsRequest) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, q.CustomerID)
+	b = protobuf.AppendBool(b, 2, q.ExpandOrder)
+	b = protobuf.AppendInt(b, 3, q.Limit)
+	return protobuf.AppendInt(b, 4, q.Offset)
+}
+
+func (q *ItemsRequest) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			q.CustomerID = r.String()
+		case 2:
+			q.ExpandOrder = r.Bool()
+		case 3:
+			q.Limit = r.Int()
+		case 4:
+			q.Offset = r.Int()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+// CustomerItemPage is the response of GetItemsByCustomer
+type CustomerItemPage struct {
+	Items  []models.CustomerItem
+	Limit  int
+	Offset int
+	Total  int
+}
+
+func (p *CustomerItemPage) AppendProto(b []byte) []byte {
+	b = protobuf.AppendMessages(b, 1, p.Items)
+	b = protobuf.AppendInt(b, 2, p.Limit)
+	b = protobuf.AppendInt(b, 3, p.Offset)
+	return protobuf.AppendInt(b, 4, p.Total)
+}
+
+func (p *CustomerItemPage) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			var item models.CustomerItem
+			r.Message(&item)
+			p.Items = append(p.Items, item)
+		case 2:
+			p.Limit = r.Int()
+		case 3:
+			p.Offset = r.Int()
+		case 4:
+			p.Total = r.Int()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+// SummariesRequest is the request of GetCustomerSummaries and StreamCustomerSummaries, it has no fields yet
+type SummariesRequest struct{}
+
+func (*SummariesRequest) AppendProto(b []byte) []byte {
+	return b
+}
+
+func (*SummariesRequest) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		r.Skip()
+	}
+	return r.Err()
+}
+
+// SummaryList is the response of GetCustomerSummaries
+type SummaryList struct {
+	Summaries []models.Summary
+}
+
+func (l *SummaryList) AppendProto(b []byte) []byte {
+	return protobuf.AppendMessages(b, 1, l.Summaries)
+}
+
+func (l *SummaryList) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			var summary models.Summary
+			r.Message(&summary)
+			l.Summaries = append(l.Summaries, summary)
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
@@ -0,0 +1,306 @@
+// Package rpc serves the Orders gRPC service of api/proto/orders.proto.
+// It mirrors the REST endpoints on the same Collections, with the validation, authentication and limits of the gin handlers.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"qlikOrders/internal/service/customer"
+	"qlikOrders/internal/service/order"
+	"qlikOrders/internal/tracing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Full names of the methods, also used as routes by the rate limiter
+const (
+	MethodAddOrders               = "/qlikorders.Orders/AddOrders"
+	MethodGetItemsByCustomer      = "/qlikorders.Orders/GetItemsByCustomer"
+	MethodGetCustomerSummaries    = "/qlikorders.Orders/GetCustomerSummaries"
+	MethodStreamItemsByCustomer   = "/qlikorders.Orders/StreamItemsByCustomer"
+	MethodStreamCustomerSummaries = "/qlikorders.Orders/StreamCustomerSummaries"
+)
+
+// methodScopes is the scope every method requires, the same as its REST endpoint
+var methodScopes = map[string]string{
+	MethodAddOrders:               auth.ScopeOrdersWrite,
+	MethodGetItemsByCustomer:      auth.ScopeCustomersRead,
+	MethodGetCustomerSummaries:    auth.ScopeSummaryRead,
+	MethodStreamItemsByCustomer:   auth.ScopeCustomersRead,
+	MethodStreamCustomerSummaries: auth.ScopeSummaryRead,
+}
+
+// Config holds the optional features of the server
+type Config struct {
+	// Auth authenticates callers from the x-api-key and authorization metadata, methods are open when nil
+	Auth *auth.Auth
+	// Limiter limits the calls of every client per method, named as in Method constants, and enforces the daily order quota
+	Limiter *ratelimit.Limiter
+	// Audit records the calls adding orders, they aren't recorded when nil
+	Audit audit.Sink
+}
+
+// NewServer creates a gRPC server exposing the Orders service on collections
+func NewServer(collections collections.Collections, config Config, opts ...grpc.ServerOption) *grpc.Server {
+	interceptor := &interceptor{auth: config.Auth, limiter: config.Limiter}
+	opts = append([]grpc.ServerOption{
+		grpc.ForceServerCodec(Codec{}),
+		// Batches are capped like the body of POST /orders
+		grpc.MaxRecvMsgSize(order.MaxBodyBytes),
+		grpc.ChainUnaryInterceptor(interceptor.unary),
+		grpc.ChainStreamInterceptor(interceptor.stream),
+	}, opts...)
+
+	server := grpc.NewServer(opts...)
+	server.RegisterService(&serviceDesc, &ordersServer{collections: collections, limiter: config.Limiter, audit: config.Audit})
+	return server
+}
+
+// ordersService is implemented by the server of the Orders service
+type ordersService interface {
+	AddOrders(ctx context.Context, in *OrderList) (*codec.Status, error)
+	GetItemsByCustomer(ctx context.Context, in *ItemsRequest) (*CustomerItemPage, error)
+	GetCustomerSummaries(ctx context.Context, in *SummariesRequest) (*SummaryList, error)
+	StreamItemsByCustomer(in *ItemsRequest, stream grpc.ServerStream) error
+	StreamCustomerSummaries(in *SummariesRequest, stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "qlikorders.Orders",
+	HandlerType: (*ordersService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "AddOrders", Handler: unaryHandler(MethodAddOrders, ordersService.AddOrders)},
+		{MethodName: "GetItemsByCustomer", Handler: unaryHandler(MethodGetItemsByCustomer, ordersService.GetItemsByCustomer)},
+		{MethodName: "GetCustomerSummaries", Handler: unaryHandler(MethodGetCustomerSummaries, ordersService.GetCustomerSummaries)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "StreamItemsByCustomer", Handler: streamHandler(ordersService.StreamItemsByCustomer), ServerStreams: true},
+		{StreamName: "StreamCustomerSummaries", Handler: streamHandler(ordersService.StreamCustomerSummaries), ServerStreams: true},
+	},
+	Metadata: "orders.proto",
+}
+
+// methodHandler is the handler of grpc.MethodDesc
+type methodHandler = func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error)
+
+// unaryHandler decodes the request of a unary method and calls it through the interceptors
+func unaryHandler[In any, Out any](method string, call func(ordersService, context.Context, *In) (Out, error)) methodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := new(In)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req any) (any, error) {
+			return call(srv.(ordersService), ctx, req.(*In))
+		}
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: method}, handler)
+	}
+}
+
+// streamHandler decodes the request of a server streaming method and calls it
+func streamHandler[In any](call func(ordersService, *In, grpc.ServerStream) error) grpc.StreamHandler {
+	return func(srv any, stream grpc.ServerStream) error {
+		in := new(In)
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		return call(srv.(ordersService), in, stream)
+	}
+}
+
+type ordersServer struct {
+	collections collections.Collections
+	limiter     *ratelimit.Limiter
+	audit       audit.Sink
+}
+
+// AddOrders validates and stores a batch like POST /orders, counting it against the daily order quota.
+// Every call is recorded in the audit log, whatever its outcome.
+func (s *ordersServer) AddOrders(ctx context.Context, in *OrderList) (*codec.Status, error) {
+	out, err := s.addOrders(ctx, in)
+	orders := in.Orders
+	if status.Code(err) == codes.InvalidArgument {
+		// Like on the REST routes, only valid orders are recorded
+		orders = nil
+	}
+	s.record(ctx, MethodAddOrders, orders, err)
+	return out, err
+}
+
+func (s *ordersServer) addOrders(ctx context.Context, in *OrderList) (*codec.Status, error) {
+	if len(in.Orders) > order.MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "The maximum allowed number of orders in a single request is %d. Please split your request and try again.", order.MaxBatchSize)
+	}
+	if err := order.ValidateOrders(in.Orders); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid input: "+err.Error())
+	}
+
+	caller := callerFromContext(ctx)
+	if err := s.limiter.ReserveOrdersFor(caller.client, len(in.Orders)); err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "Daily order quota exceeded, the quota is %d orders", s.limiter.DailyOrders)
+	}
+
+	err := tracing.Store(ctx, s.collections).AddOrders(caller.tenant, in.Orders)
+	if err != nil {
+		// Nothing was stored, so the orders don't count against the quota
+		s.limiter.RefundOrdersFor(caller.client, len(in.Orders))
+	}
+	if errors.Is(err, collections.ErrTenantLimitExceeded) {
+		return nil, status.Error(codes.PermissionDenied, "Tenant order limit reached")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to add orders")
+	}
+	return &codec.Status{Message: "Orders added successfully"}, nil
+}
+
+// record appends a call changing orders to the audit log, when one is configured
+func (s *ordersServer) record(ctx context.Context, method string, orders []models.Order, err error) {
+	if s.audit == nil {
+		return
+	}
+	caller := callerFromContext(ctx)
+	code := httpStatus(status.Code(err))
+	entry := audit.Entry{
+		Time:      time.Now().UTC(),
+		Tenant:    caller.tenant,
+		Actor:     caller.actor,
+		Method:    audit.MethodGRPC,
+		Route:     method,
+		OrderIDs:  audit.OrderIDs(orders),
+		RequestID: logging.RequestIDFromContext(ctx),
+		Status:    code,
+		Outcome:   audit.Outcome(code),
+	}
+	if err := s.audit.Append(ctx, entry); err != nil {
+		logging.FromContext(ctx).Error("audit entry not recorded", slog.String(logging.KeyError, err.Error()), slog.String("route", method))
+	}
+}
+
+// httpStatus returns the HTTP status matching the code a method returned, as recorded in the audit log
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// GetItemsByCustomer lists the items of a customer like GET /customer/:customerId/items
+func (s *ordersServer) GetItemsByCustomer(ctx context.Context, in *ItemsRequest) (*CustomerItemPage, error) {
+	items, err := s.items(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return &CustomerItemPage{
+		Items:  customer.Paginate(items, in.Limit, in.Offset),
+		Limit:  in.Limit,
+		Offset: in.Offset,
+		Total:  len(items),
+	}, nil
+}
+
+// StreamItemsByCustomer sends the page of GetItemsByCustomer one item at a time, flattening the orders as they are sent
+func (s *ordersServer) StreamItemsByCustomer(in *ItemsRequest, stream grpc.ServerStream) error {
+	orders, err := s.orders(stream.Context(), in)
+	if err != nil {
+		return err
+	}
+	skip, sent := in.Offset, 0
+	for _, order := range orders {
+		for _, item := range customer.FlattenItems([]models.Order{order}, in.ExpandOrder) {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if in.Limit > 0 && sent == in.Limit {
+				return nil
+			}
+			if err := stream.SendMsg(&item); err != nil {
+				return err
+			}
+			sent++
+		}
+	}
+	return nil
+}
+
+func (s *ordersServer) items(ctx context.Context, in *ItemsRequest) ([]models.CustomerItem, error) {
+	orders, err := s.orders(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return customer.FlattenItems(orders, in.ExpandOrder), nil
+}
+
+// orders reads the orders of the customer of an items request, unknown customers are NotFound and other store errors Internal
+func (s *ordersServer) orders(ctx context.Context, in *ItemsRequest) ([]models.Order, error) {
+	if in.CustomerID == "" || in.Limit < 0 || in.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid input")
+	}
+	orders, err := tracing.Store(ctx, s.collections).GetOrdersByCustomer(callerFromContext(ctx).tenant, in.CustomerID)
+	if errors.Is(err, collections.ErrCustomerNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to retrieve items")
+	}
+	return orders, nil
+}
+
+// GetCustomerSummaries lists the summaries of every customer like GET /summary
+func (s *ordersServer) GetCustomerSummaries(ctx context.Context, _ *SummariesRequest) (*SummaryList, error) {
+	summaries, err := s.summaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &SummaryList{Summaries: summaries}, nil
+}
+
+// StreamCustomerSummaries sends the summaries of GetCustomerSummaries one at a time, as they are read from the store.
+// A store failing partway ends the stream with Internal after the summaries already sent.
+func (s *ordersServer) StreamCustomerSummaries(_ *SummariesRequest, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	for summary, err := range tracing.Store(ctx, s.collections).EachCustomerSummary(callerFromContext(ctx).tenant) {
+		if err != nil {
+			return status.Error(codes.Internal, "Failed to retrieve summaries")
+		}
+		if err := stream.SendMsg(&summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ordersServer) summaries(ctx context.Context) ([]models.Summary, error) {
+	summaries, err := tracing.Store(ctx, s.collections).GetAllCustomerSummaries(callerFromContext(ctx).tenant)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to retrieve summaries")
+	}
+	return summaries, nil
+}
@@ -0,0 +1,351 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net"
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var testOrders = []models.Order{
+	{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+	{CustomerID: "01", OrderID: "51", Timestamp: "1637245070523", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+	{CustomerID: "02", OrderID: "52", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "20201", CostEur: 2}}},
+}
+
+// dial serves the collection on an in-process listener and connects to it
+func dial(t *testing.T, collection collections.Collections, config Config) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(collection, config)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestAddOrders(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	client := NewClient(dial(t, collection, Config{}))
+	ctx := context.Background()
+
+	reply, err := client.AddOrders(ctx, &OrderList{Orders: testOrders})
+	require.NoError(t, err)
+	assert.Equal(t, "Orders added successfully", reply.Message)
+
+	stored, err := collection.GetAllOrders(models.DefaultTenantID)
+	require.NoError(t, err)
+	assert.Len(t, stored, len(testOrders))
+
+	tests := []struct {
+		name   string
+		orders []models.Order
+	}{
+		{"Missing fields", []models.Order{{CustomerID: "01", Items: []models.Item{{ItemID: "20201", CostEur: 2}}}}},
+		{"Invalid cost", []models.Order{{CustomerID: "01", OrderID: "53", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201"}}}}},
+		{"Batch too large", []models.Order{testOrders[0], testOrders[0], testOrders[0], testOrders[0], testOrders[0], testOrders[0]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.AddOrders(ctx, &OrderList{Orders: tt.orders})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+
+	stored, err = collection.GetAllOrders(models.DefaultTenantID)
+	require.NoError(t, err)
+	assert.Len(t, stored, len(testOrders))
+}
+
+func TestGetItemsByCustomer(t *testing.T) {
+	collection := &collections.OrderCollection{Orders: testOrders}
+	client := NewClient(dial(t, collection, Config{}))
+	ctx := context.Background()
+
+	page, err := client.GetItemsByCustomer(ctx, &ItemsRequest{CustomerID: "01", ExpandOrder: true, Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, &CustomerItemPage{
+		Items: []models.CustomerItem{
+			{CustomerID: "01", ItemID: "20202", CostEur: 3, OrderID: "50", Timestamp: "1637245070513"},
+			{CustomerID: "01", ItemID: "20203", CostEur: 5, OrderID: "51", Timestamp: "1637245070523"},
+		},
+		Limit:  2,
+		Offset: 1,
+		Total:  3,
+	}, page)
+
+	_, err = client.GetItemsByCustomer(ctx, &ItemsRequest{CustomerID: "99"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetItemsByCustomer(ctx, &ItemsRequest{CustomerID: "01", Limit: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestStreamingVariants(t *testing.T) {
+	collection := &collections.OrderCollection{Orders: testOrders}
+	client := NewClient(dial(t, collection, Config{}))
+	ctx := context.Background()
+
+	t.Run("Items", func(t *testing.T) {
+		for _, request := range []*ItemsRequest{{CustomerID: "01", Offset: 1}, {CustomerID: "01", Offset: 1, Limit: 1}} {
+			page, err := client.GetItemsByCustomer(ctx, request)
+			require.NoError(t, err)
+
+			var streamed []models.CustomerItem
+			for item, err := range client.StreamItemsByCustomer(ctx, request) {
+				require.NoError(t, err)
+				streamed = append(streamed, item)
+			}
+			assert.Equal(t, page.Items, streamed)
+		}
+	})
+
+	t.Run("Summaries", func(t *testing.T) {
+		list, err := client.GetCustomerSummaries(ctx, &SummariesRequest{})
+		require.NoError(t, err)
+		assert.Len(t, list.Summaries, 2)
+
+		var streamed []models.Summary
+		for summary, err := range client.StreamCustomerSummaries(ctx, &SummariesRequest{}) {
+			require.NoError(t, err)
+			streamed = append(streamed, summary)
+		}
+		assert.Equal(t, list.Summaries, streamed)
+	})
+
+	t.Run("Break out", func(t *testing.T) {
+		received := 0
+		for _, err := range client.StreamCustomerSummaries(ctx, &SummariesRequest{}) {
+			require.NoError(t, err)
+			received++
+			break
+		}
+		assert.Equal(t, 1, received)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		var errs []error
+		for _, err := range client.StreamItemsByCustomer(ctx, &ItemsRequest{CustomerID: "99"}) {
+			errs = append(errs, err)
+		}
+		require.Len(t, errs, 1)
+		assert.Equal(t, codes.NotFound, status.Code(errs[0]))
+	})
+}
+
+// failingCollection fails lookups of customers with err, summaries can only be streamed and fail after the first one
+type failingCollection struct {
+	*collections.OrderCollection
+	err error
+}
+
+func (f failingCollection) GetOrdersByCustomer(string, string) ([]models.Order, error) {
+	return nil, f.err
+}
+
+func (f failingCollection) GetAllCustomerSummaries(string) ([]models.Summary, error) {
+	return nil, errors.New("summaries must be streamed")
+}
+
+func (f failingCollection) EachCustomerSummary(tenantID string) iter.Seq2[models.Summary, error] {
+	return func(yield func(models.Summary, error) bool) {
+		for summary, err := range f.OrderCollection.EachCustomerSummary(tenantID) {
+			if !yield(summary, err) {
+				return
+			}
+			yield(models.Summary{}, f.err)
+			return
+		}
+	}
+}
+
+func TestStreamingFromStore(t *testing.T) {
+	collection := failingCollection{&collections.OrderCollection{Orders: testOrders}, errors.New("database is locked")}
+	client := NewClient(dial(t, collection, Config{}))
+	ctx := context.Background()
+
+	// Summaries are sent as they are read, up to the failure
+	var streamed []models.Summary
+	var errs []error
+	for summary, err := range client.StreamCustomerSummaries(ctx, &SummariesRequest{}) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		streamed = append(streamed, summary)
+	}
+	assert.Len(t, streamed, 1)
+	require.Len(t, errs, 1)
+	assert.Equal(t, codes.Internal, status.Code(errs[0]))
+
+	// Store failures aren't reported as unknown customers, and the driver's message isn't sent
+	_, err := client.GetItemsByCustomer(ctx, &ItemsRequest{CustomerID: "01"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "Failed to retrieve items", status.Convert(err).Message())
+	for _, err := range client.StreamItemsByCustomer(ctx, &ItemsRequest{CustomerID: "01"}) {
+		assert.Equal(t, codes.Internal, status.Code(err))
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	writer, writerSecret, err := auth.GenerateKey("writer", "acme", []string{auth.ScopeOrdersWrite, auth.ScopeCustomersRead})
+	require.NoError(t, err)
+	reader, readerSecret, err := auth.GenerateKey("reader", "", []string{auth.ScopeSummaryRead})
+	require.NoError(t, err)
+	store := auth.NewMemoryKeyStore(writer, reader)
+
+	collection := &collections.OrderCollection{Orders: testOrders}
+	client := NewClient(dial(t, collection, Config{Auth: auth.New(auth.APIKeyAuthenticator{Store: store})}))
+	withKey := func(secret string, pairs ...string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), append([]string{"x-api-key", secret}, pairs...)...)
+	}
+
+	_, err = client.GetCustomerSummaries(context.Background(), &SummariesRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.GetCustomerSummaries(withKey("wrong"), &SummariesRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.AddOrders(withKey(readerSecret), &OrderList{Orders: testOrders[:1]})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Keys bound to a tenant only see that tenant
+	_, err = client.AddOrders(withKey(writerSecret), &OrderList{Orders: testOrders[:1]})
+	require.NoError(t, err)
+	page, err := client.GetItemsByCustomer(withKey(writerSecret), &ItemsRequest{CustomerID: "01"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	_, err = client.GetItemsByCustomer(withKey(writerSecret, "x-tenant-id", "other"), &ItemsRequest{CustomerID: "01"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Streams are guarded the same way
+	for _, err := range client.StreamCustomerSummaries(context.Background(), &SummariesRequest{}) {
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	// Other callers pick their tenant
+	list, err := client.GetCustomerSummaries(withKey(readerSecret, "x-tenant-id", "acme"), &SummariesRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.Summaries, 1)
+	_, err = client.GetCustomerSummaries(withKey(readerSecret, "x-tenant-id", "not a tenant"), &SummariesRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAudit(t *testing.T) {
+	writer, writerSecret, err := auth.GenerateKey("writer", "acme", []string{auth.ScopeOrdersWrite, auth.ScopeCustomersRead})
+	require.NoError(t, err)
+	sink := audit.NewMemorySink()
+	config := Config{Auth: auth.New(auth.APIKeyAuthenticator{Store: auth.NewMemoryKeyStore(writer)}), Audit: sink}
+	client := NewClient(dial(t, &collections.OrderCollection{}, config))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", writerSecret)
+
+	_, err = client.AddOrders(ctx, &OrderList{Orders: testOrders[:2]})
+	require.NoError(t, err)
+	_, err = client.AddOrders(ctx, &OrderList{Orders: []models.Order{{CustomerID: "01", OrderID: "53"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetItemsByCustomer(ctx, &ItemsRequest{CustomerID: "01"})
+	require.NoError(t, err)
+
+	// Only the calls adding orders are recorded
+	entries, err := sink.Query(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, "acme", entry.Tenant)
+		assert.Equal(t, writer.ID, entry.Actor)
+		assert.Equal(t, audit.MethodGRPC, entry.Method)
+		assert.Equal(t, MethodAddOrders, entry.Route)
+	}
+	assert.Equal(t, []string{"50", "51"}, entries[0].OrderIDs)
+	assert.Equal(t, http.StatusOK, entries[0].Status)
+	assert.Equal(t, audit.OutcomeSuccess, entries[0].Outcome)
+	assert.Empty(t, entries[1].OrderIDs)
+	assert.Equal(t, http.StatusBadRequest, entries[1].Status)
+	assert.Equal(t, audit.OutcomeRejected, entries[1].Outcome)
+}
+
+func TestLimits(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := &ratelimit.Limiter{
+		Store:       ratelimit.NewMemoryStore(),
+		Routes:      map[string]ratelimit.Limit{MethodGetCustomerSummaries: {Requests: 1, Period: time.Minute}},
+		DailyOrders: 3,
+		Now:         func() time.Time { return now },
+	}
+	collection := &collections.OrderCollection{}
+	client := NewClient(dial(t, collection, Config{Limiter: limiter}))
+	ctx := context.Background()
+
+	_, err := client.GetCustomerSummaries(ctx, &SummariesRequest{})
+	require.NoError(t, err)
+	_, err = client.GetCustomerSummaries(ctx, &SummariesRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = client.AddOrders(ctx, &OrderList{Orders: testOrders[:2]})
+	require.NoError(t, err)
+	_, err = client.AddOrders(ctx, &OrderList{Orders: testOrders[:2]})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = client.AddOrders(ctx, &OrderList{Orders: testOrders[2:]})
+	require.NoError(t, err)
+}
+
+// Clients generated from the schema use the standard protobuf codec, dynamic messages stand in for them
+func TestSchemaClients(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{"../../api/proto"}},
+	}
+	files, err := compiler.Compile(context.Background(), "orders.proto")
+	require.NoError(t, err)
+	message := func(name protoreflect.FullName) *dynamicpb.Message {
+		descriptor, err := files.AsResolver().FindDescriptorByName(name)
+		require.NoError(t, err)
+		return dynamicpb.NewMessage(descriptor.(protoreflect.MessageDescriptor))
+	}
+
+	collection := &collections.OrderCollection{Orders: testOrders}
+	conn := dial(t, collection, Config{})
+
+	request := message("qlikorders.ItemsRequest")
+	request.Set(request.Descriptor().Fields().ByName("customer_id"), protoreflect.ValueOfString("02"))
+	reply := message("qlikorders.CustomerItemPage")
+	require.NoError(t, conn.Invoke(context.Background(), MethodGetItemsByCustomer, request, reply))
+
+	fields := reply.Descriptor().Fields()
+	assert.Equal(t, int64(1), reply.Get(fields.ByName("total")).Int())
+	items := reply.Get(fields.ByName("items")).List()
+	require.Equal(t, 1, items.Len())
+	item := items.Get(0).Message()
+	assert.Equal(t, "20201", item.Get(item.Descriptor().Fields().ByName("item_id")).String())
+
+	// Batches encoded by this package decode with the schema, and the reply of AddOrders as a Status
+	orders := message("qlikorders.OrderList")
+	data, err := Codec{}.Marshal(&OrderList{Orders: testOrders[:1]})
+	require.NoError(t, err)
+	require.NoError(t, proto.Unmarshal(data, orders))
+	added := message("qlikorders.Status")
+	require.NoError(t, conn.Invoke(context.Background(), MethodAddOrders, orders, added))
+	assert.Equal(t, "Orders added successfully", added.Get(added.Descriptor().Fields().ByName("message")).String())
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/logging"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	writer, writerSecret, err := auth.GenerateKey("writer", "acme", []string{auth.ScopeOrdersWrite, auth.ScopeCustomersErase})
+	require.NoError(t, err)
+	reader, readerSecret, err := auth.GenerateKey("reader", "acme", []string{auth.ScopeSummaryRead})
+	require.NoError(t, err)
+	auditor, auditorSecret, err := auth.GenerateKey("auditor", "acme", []string{auth.ScopeAuditRead})
+	require.NoError(t, err)
+	other, otherSecret, err := auth.GenerateKey("other", "other", []string{auth.ScopeOrdersWrite, auth.ScopeAuditRead})
+	require.NoError(t, err)
+
+	sink := audit.NewMemorySink()
+	server := NewServer(versionsCollection(), WithAPIKeys(auth.NewMemoryKeyStore(writer, reader, auditor, other)), WithAudit(sink))
+	serve := func(method, target, secret, requestID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", secret)
+		if requestID != "" {
+			req.Header.Set(logging.Header, requestID)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	valid := `[{"customerId":"04","orderId":"60","timestamp":"1637245070513","currency":"EUR","lines":[{"itemId":"20201","quantity":2,"unitPriceMinor":200}]}]`
+	invalid := `[{"customerId":"04","orderId":"61","timestamp":"1637245070513","currency":"EUR","lines":[{"itemId":"20201","quantity":0,"unitPriceMinor":200}]}]`
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/v2/orders", writerSecret, "req-1", valid).Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/v2/orders", writerSecret, "req-2", invalid).Code)
+	require.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/orders", readerSecret, "req-3", `[]`).Code)
+	erased := serve(http.MethodDelete, "/v1/customers/04/data", writerSecret, "req-4", "")
+	require.Equal(t, http.StatusOK, erased.Code)
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/v2/orders", otherSecret, "req-5", valid).Code)
+	// Reads aren't recorded
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/v2/summary", readerSecret, "", "").Code)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/v2/audit", writerSecret, "", "").Code)
+
+	list := func(target, secret string) []audit.Entry {
+		w := serve(http.MethodGet, target, secret, "", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body struct{ Entries []audit.Entry }
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Entries
+	}
+
+	type recorded struct {
+		Actor, Route, RequestID, Outcome string
+		OrderIDs                         []string
+		Status                           int
+	}
+	summarize := func(entries []audit.Entry) []recorded {
+		var summary []recorded
+		for _, entry := range entries {
+			assert.Equal(t, "acme", entry.Tenant)
+			summary = append(summary, recorded{entry.Actor, entry.Route, entry.RequestID, entry.Outcome, entry.OrderIDs, entry.Status})
+		}
+		return summary
+	}
+
+	// Callers only see the entries of their tenant, customer IDs aren't recorded and invalid orders have no IDs to record
+	entries := list("/v2/audit", auditorSecret)
+	assert.Equal(t, []recorded{
+		{writer.ID, "/v2/orders", "req-1", audit.OutcomeSuccess, []string{"60"}, http.StatusCreated},
+		{writer.ID, "/v2/orders", "req-2", audit.OutcomeRejected, []string{}, http.StatusBadRequest},
+		{reader.ID, "/orders", "req-3", audit.OutcomeRejected, []string{}, http.StatusForbidden},
+		{writer.ID, "/v1/customers/:customerId/data", "req-4", audit.OutcomeSuccess, []string{"60"}, http.StatusOK},
+	}, summarize(entries))
+
+	// Erasures are recorded with the orders they erased and the ID of their erasure record
+	var erasure struct{ Erasure struct{ ErasureID string } }
+	require.NoError(t, json.Unmarshal(erased.Body.Bytes(), &erasure))
+	require.Len(t, entries, 4)
+	assert.NotEmpty(t, erasure.Erasure.ErasureID)
+	assert.Equal(t, erasure.Erasure.ErasureID, entries[3].ErasureID)
+	assert.Empty(t, entries[0].ErasureID)
+	assert.Equal(t, list("/v2/audit", auditorSecret), list("/v1/audit", auditorSecret))
+
+	// The order is found in the entry posting it and the one erasing it
+	assert.Len(t, list("/v2/audit?orderId=60", auditorSecret), 2)
+	assert.Len(t, list("/v2/audit?outcome=rejected&actor="+reader.ID, auditorSecret), 1)
+	assert.Len(t, list("/v2/audit?orderId=60", otherSecret), 1)
+
+	w := serve(http.MethodGet, "/v2/audit?format=ndjson&requestId=req-1", auditorSecret, "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "\n"))
+	assert.Contains(t, w.Body.String(), `"orderIds":["60"]`)
+
+	t.Run("Not served without a sink", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		NewServer(versionsCollection()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/audit", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/rpc"
+	"qlikOrders/internal/tracing"
+
+	"google.golang.org/grpc"
+)
+
+// NewGRPCServer creates the gRPC server of the API, with the authentication, limits, tracing and audit opts configure for the HTTP server
+func NewGRPCServer(collections collections.Collections, opts ...Option) *grpc.Server {
+	config := &options{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	var serverOpts []grpc.ServerOption
+	if config.tracerProvider != nil {
+		serverOpts = append(serverOpts, tracing.ServerOption(config.tracerProvider))
+	}
+	return rpc.NewServer(collections, rpc.Config{Auth: config.newAuth(), Limiter: config.limiter, Audit: config.auditSink}, serverOpts...)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/diagnostics"
+	"qlikOrders/internal/health"
+	"qlikOrders/internal/jobs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes of the debug surface, only served when authentication is configured
+const (
+	debugPath   = "/debug"
+	profilePath = "/debug/pprof/:profile"
+)
+
+// DebugInfo is the body of GET /debug
+type DebugInfo struct {
+	Build   diagnostics.Build   `json:"build"`
+	Config  map[string]string   `json:"config"`
+	Store   *collections.Stats  `json:"store,omitempty"`
+	Jobs    *jobs.Stats         `json:"jobs,omitempty"`
+	Runtime diagnostics.Runtime `json:"runtime"`
+}
+
+// routeHealth registers the liveness and readiness probes
+func routeHealth(router gin.IRoutes, collections collections.Collections, config *options) {
+	router.GET(health.LivePath, health.Live())
+	router.GET(health.ReadyPath, health.Ready(health.DefaultTimeout, readinessChecks(collections, config)...))
+}
+
+// readinessChecks lists what the server needs to serve requests: a reachable store and, with import jobs,
+// workers keeping up with the queue. Orders are kept in memory, so the jobs recovered on startup have to be
+// imported again before the orders are complete.
+func readinessChecks(store collections.Collections, config *options) []health.Check {
+	var checks []health.Check
+	if pinger, ok := store.(collections.Pinger); ok {
+		checks = append(checks, health.Check{Name: "storage", Check: pinger.Ping})
+	}
+	if config.jobs != nil {
+		checks = append(checks, health.Check{Name: "jobs", Check: func(context.Context) error {
+			stats := config.jobs.Stats()
+			switch {
+			case !stats.Started:
+				return fmt.Errorf("import jobs not started")
+			case stats.Recovering > 0:
+				return fmt.Errorf("recovering %d import jobs", stats.Recovering)
+			case stats.Queued >= stats.QueueSize:
+				return fmt.Errorf("%d import jobs queued, the queue is full", stats.Queued)
+			}
+			return nil
+		}})
+	}
+	return checks
+}
+
+// routeDebug registers the debug surface guarded by the debug:read scope. It reports on every tenant,
+// so it is only served to platform keys.
+func routeDebug(router gin.IRoutes, store collections.Collections, config *options, require func(string) gin.HandlerFunc) {
+	router.GET(debugPath, require(auth.ScopeDebugRead), requirePlatform(), func(c *gin.Context) {
+		info := DebugInfo{
+			Build:   diagnostics.ReadBuild(),
+			Config:  diagnostics.RedactConfig(config.debugConfig),
+			Runtime: diagnostics.ReadRuntime(),
+		}
+		if sized, ok := store.(collections.Sized); ok {
+			stats := sized.Stats()
+			info.Store = &stats
+		}
+		if config.jobs != nil {
+			stats := config.jobs.Stats()
+			info.Jobs = &stats
+		}
+		c.JSON(http.StatusOK, info)
+	})
+	router.GET(profilePath, require(auth.ScopeDebugRead), requirePlatform(), diagnostics.Profile())
+}
+
+// requirePlatform rejects callers that aren't platform keys, acting for any tenant
+func requirePlatform() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal, ok := auth.PrincipalFromContext(c); !ok || !principal.AnyTenant {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "Only platform keys can read the debug surface"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/diagnostics"
+	"qlikOrders/internal/health"
+	"qlikOrders/internal/jobs"
+	"qlikOrders/internal/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	manager, err := jobs.NewManager(jobs.Config{Dir: t.TempDir(), Collections: &collections.OrderCollection{}})
+	require.NoError(t, err)
+	t.Cleanup(manager.Close)
+
+	// Probes are served to anonymous callers, whatever the limits
+	keyStore := auth.NewMemoryKeyStore()
+	limiter := &ratelimit.Limiter{Store: ratelimit.NewMemoryStore(), Default: ratelimit.Limit{Requests: 1, Period: time.Minute}}
+	server := NewServer(versionsCollection(), WithAPIKeys(keyStore), WithRateLimit(limiter), WithJobs(manager))
+
+	probe := func(path string) (int, health.Result) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var result health.Result
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return w.Code, result
+	}
+
+	for range 3 {
+		code, result := probe(health.LivePath)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, health.StatusOK, result.Status)
+	}
+
+	code, result := probe(health.ReadyPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.CheckResult{Status: health.StatusOK}, result.Checks["storage"])
+	assert.Equal(t, health.CheckResult{Status: health.StatusUnavailable, Error: "import jobs not started"}, result.Checks["jobs"])
+
+	manager.Start()
+	code, result = probe(health.ReadyPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, result.Status)
+}
+
+func TestDebug(t *testing.T) {
+	keyStore := auth.NewMemoryKeyStore(
+		auth.APIKey{ID: "1", Name: "operator", Hash: auth.HashKey("operator-secret"), Scopes: []string{auth.ScopeDebugRead}},
+		auth.APIKey{ID: "2", Name: "reader", Hash: auth.HashKey("reader-secret"), Scopes: []string{auth.ScopeSummaryRead}},
+	)
+	server := NewServer(versionsCollection(), WithAPIKeys(keyStore), WithDebugConfig(map[string]string{
+		"JWT_HS256_SECRET": "test-secret",
+		"GRPC_ADDR":        ":9090",
+	}))
+
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get(debugPath, "").Code)
+	assert.Equal(t, http.StatusForbidden, get(debugPath, "reader-secret").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/debug/pprof/goroutine", "").Code)
+
+	w := get(debugPath, "operator-secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info DebugInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.NotEmpty(t, info.Build.GoVersion)
+	assert.Equal(t, map[string]string{"JWT_HS256_SECRET": diagnostics.Redacted, "GRPC_ADDR": ":9090"}, info.Config)
+	assert.NotContains(t, w.Body.String(), "test-secret")
+	require.NotNil(t, info.Store)
+	assert.Positive(t, info.Store.Orders)
+	assert.Nil(t, info.Jobs, "jobs are left out when they aren't configured")
+	assert.Positive(t, info.Runtime.Goroutines)
+
+	w = get("/debug/pprof/goroutine?debug=1", "operator-secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine profile")
+
+	t.Run("Not served without authentication", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		NewServer(versionsCollection()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, debugPath, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
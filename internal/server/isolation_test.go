@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantClient sends requests with the credentials of a single caller
+type tenantClient struct {
+	server  *gin.Engine
+	headers map[string]string
+}
+
+func (tc tenantClient) do(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range tc.headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	tc.server.ServeHTTP(w, req)
+	return w
+}
+
+func tenantOrders(itemID string, cost int) []models.Order {
+	return []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: itemID, CostEur: cost}, {ItemID: itemID + "-extra", CostEur: 1}}},
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	keyStore := auth.NewMemoryKeyStore(
+		auth.APIKey{ID: "acme", Hash: auth.HashKey("acme-secret"), Scopes: auth.AllScopes, Tenant: "acme"},
+		auth.APIKey{ID: "globex", Hash: auth.HashKey("globex-secret"), Scopes: auth.AllScopes, Tenant: "globex"},
+		auth.APIKey{ID: "platform", Hash: auth.HashKey("platform-secret"), Scopes: auth.AllScopes},
+	)
+	server := NewServer(&collections.OrderCollection{}, WithAPIKeys(keyStore))
+
+	acme := tenantClient{server, map[string]string{"X-API-Key": "acme-secret"}}
+	globex := tenantClient{server, map[string]string{"X-API-Key": "globex-secret"}}
+
+	// Both tenants have a customer 01 buying different items
+	require.Equal(t, http.StatusCreated, acme.do(t, "POST", "/orders", tenantOrders("anvil", 10)).Code)
+	require.Equal(t, http.StatusCreated, globex.do(t, "POST", "/orders", tenantOrders("widget", 700)).Code)
+
+	t.Run("Summaries only hold the caller's tenant", func(t *testing.T) {
+		var resp summariesResponse
+		w := acme.do(t, "GET", "/summary", nil)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []models.Summary{{CustomerID: "01", NbrOfPurchasedItems: 2, TotalAmountEur: 11}}, resp.Summaries)
+
+		w = globex.do(t, "GET", "/summary", nil)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []models.Summary{{CustomerID: "01", NbrOfPurchasedItems: 2, TotalAmountEur: 701}}, resp.Summaries)
+	})
+
+	t.Run("Customer lookups only hold the caller's tenant", func(t *testing.T) {
+		for _, path := range []string{"/customer/01/items", "/customer/01/summary", "/customers/01/export", "/reports/cohorts", "/reports/rfm"} {
+			w := acme.do(t, "GET", path, nil)
+			assert.Equal(t, http.StatusOK, w.Code, path)
+			assert.NotContains(t, w.Body.String(), "widget", path)
+			assert.NotContains(t, w.Body.String(), "701", path)
+		}
+	})
+
+	t.Run("Related items only hold the caller's tenant", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, acme.do(t, "GET", "/items/anvil/related", nil).Code)
+		assert.Equal(t, http.StatusNotFound, acme.do(t, "GET", "/items/widget/related", nil).Code)
+	})
+
+	t.Run("Bound credentials can't switch tenant", func(t *testing.T) {
+		spoof := tenantClient{server, map[string]string{"X-API-Key": "acme-secret", "X-Tenant-ID": "globex"}}
+		assert.Equal(t, http.StatusForbidden, spoof.do(t, "GET", "/summary", nil).Code)
+	})
+
+	t.Run("Unbound credentials pick the tenant with the header", func(t *testing.T) {
+		platform := tenantClient{server, map[string]string{"X-API-Key": "platform-secret", "X-Tenant-ID": "globex"}}
+		w := platform.do(t, "GET", "/customer/01/items", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "widget")
+		assert.NotContains(t, w.Body.String(), "anvil")
+	})
+
+	t.Run("Erasure only affects the caller's tenant", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, acme.do(t, "DELETE", "/customers/01/data", nil).Code)
+		assert.Equal(t, http.StatusNotFound, acme.do(t, "GET", "/customer/01/items", nil).Code)
+		assert.Equal(t, http.StatusOK, globex.do(t, "GET", "/customer/01/items", nil).Code)
+		assert.Contains(t, acme.do(t, "GET", "/customers/erasures", nil).Body.String(), `"erasureId"`)
+		assert.JSONEq(t, `{"erasures":[]}`, globex.do(t, "GET", "/customers/erasures", nil).Body.String())
+	})
+
+	t.Run("Keys are only managed within the tenant", func(t *testing.T) {
+		w := acme.do(t, "GET", "/admin/keys", nil)
+		assert.Contains(t, w.Body.String(), `"id":"acme"`)
+		assert.NotContains(t, w.Body.String(), `"id":"globex"`)
+		assert.Equal(t, http.StatusNotFound, acme.do(t, "DELETE", "/admin/keys/globex", nil).Code)
+		assert.Equal(t, http.StatusForbidden, acme.do(t, "POST", "/admin/keys", map[string]any{"name": "k", "scopes": []string{"summary:read"}, "tenant": "globex"}).Code)
+	})
+
+	t.Run("Debug is only served to platform keys", func(t *testing.T) {
+		platform := tenantClient{server, map[string]string{"X-API-Key": "platform-secret"}}
+		assert.Equal(t, http.StatusForbidden, acme.do(t, "GET", "/debug", nil).Code)
+		assert.Equal(t, http.StatusForbidden, acme.do(t, "GET", "/debug/pprof/heap", nil).Code)
+		assert.Equal(t, http.StatusForbidden, acme.do(t, "POST", "/admin/keys", map[string]any{"name": "k", "scopes": []string{"debug:read"}}).Code)
+		assert.Equal(t, http.StatusOK, platform.do(t, "GET", "/debug", nil).Code)
+		assert.Equal(t, http.StatusCreated, platform.do(t, "POST", "/admin/keys", map[string]any{"name": "k", "scopes": []string{"debug:read"}}).Code)
+	})
+}
+
+func TestTenantIsolationWithoutAuth(t *testing.T) {
+	server := NewServer(&collections.OrderCollection{})
+
+	anonymous := tenantClient{server, nil}
+	require.Equal(t, http.StatusCreated, anonymous.do(t, "POST", "/orders", tenantOrders("anvil", 10)).Code)
+
+	// Without credentials every request acts for the default tenant, naming another one is refused
+	spoof := tenantClient{server, map[string]string{"X-Tenant-ID": "acme"}}
+	assert.Equal(t, http.StatusForbidden, spoof.do(t, "GET", "/customer/01/items", nil).Code)
+	assert.Equal(t, http.StatusForbidden, spoof.do(t, "POST", "/orders", tenantOrders("anvil", 10)).Code)
+	assert.Equal(t, http.StatusOK, anonymous.do(t, "GET", "/customer/01/items", nil).Code)
+	named := tenantClient{server, map[string]string{"X-Tenant-ID": models.DefaultTenantID}}
+	assert.Equal(t, http.StatusOK, named.do(t, "GET", "/customer/01/items", nil).Code)
+
+	invalid := tenantClient{server, map[string]string{"X-Tenant-ID": "../acme"}}
+	assert.Equal(t, http.StatusBadRequest, invalid.do(t, "GET", "/summary", nil).Code)
+}
+
+func TestTenantIsolationWithJWT(t *testing.T) {
+	secret := []byte("test-secret-test-secret-test-sec")
+	jwtAuth, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+		Keys:     map[string]any{"default": secret},
+		Issuer:   "https://issuer.test",
+		Audience: "qlik-orders",
+	})
+	require.NoError(t, err)
+	keyStore := auth.NewMemoryKeyStore()
+	server := NewServer(&collections.OrderCollection{}, WithJWT(jwtAuth), WithAPIKeys(keyStore))
+
+	token := func(tenantID string) string {
+		claims := jwt.MapClaims{
+			"sub":   "user-1",
+			"iss":   "https://issuer.test",
+			"aud":   "qlik-orders",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": []string{"admin"},
+		}
+		if tenantID != "" {
+			claims["tenant"] = tenantID
+		}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		require.NoError(t, err)
+		return signed
+	}
+
+	acme := tenantClient{server, map[string]string{"Authorization": "Bearer " + token("acme")}}
+	require.Equal(t, http.StatusCreated, acme.do(t, "POST", "/orders", tenantOrders("anvil", 10)).Code)
+
+	// A token without a tenant claim isn't a platform credential, it can't name another tenant
+	spoof := tenantClient{server, map[string]string{"Authorization": "Bearer " + token(""), "X-Tenant-ID": "acme"}}
+	assert.Equal(t, http.StatusForbidden, spoof.do(t, "GET", "/customer/01/items", nil).Code)
+	assert.Equal(t, http.StatusForbidden, spoof.do(t, "DELETE", "/customers/01/data", nil).Code)
+
+	// It acts for the default tenant, which doesn't hold acme's customers
+	unbound := tenantClient{server, map[string]string{"Authorization": "Bearer " + token("")}}
+	assert.Equal(t, http.StatusNotFound, unbound.do(t, "GET", "/customer/01/items", nil).Code)
+	assert.Equal(t, http.StatusOK, acme.do(t, "GET", "/customer/01/items", nil).Code)
+
+	// Nor can it create platform keys to get around that
+	w := unbound.do(t, "POST", "/admin/keys", map[string]any{"name": "k", "scopes": []string{"customers:read"}})
+	require.Equal(t, http.StatusCreated, w.Code)
+	keys, err := keyStore.List()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, models.DefaultTenantID, keys[0].Tenant)
+	assert.Equal(t, http.StatusForbidden, unbound.do(t, "POST", "/admin/keys", map[string]any{"name": "k", "scopes": []string{"customers:read"}, "tenant": "acme"}).Code)
+}
+
+func TestTenantLimits(t *testing.T) {
+	collection := &collections.OrderCollection{
+		DefaultLimit: collections.TenantLimit{MaxOrders: 1},
+		Limits:       map[string]collections.TenantLimit{"acme": {MaxOrders: 2}},
+	}
+	keyStore := auth.NewMemoryKeyStore(
+		auth.APIKey{ID: "acme", Hash: auth.HashKey("acme-secret"), Scopes: auth.AllScopes, Tenant: "acme"},
+		auth.APIKey{ID: "globex", Hash: auth.HashKey("globex-secret"), Scopes: auth.AllScopes, Tenant: "globex"},
+	)
+	server := NewServer(collection, WithAPIKeys(keyStore))
+
+	acme := tenantClient{server, map[string]string{"X-API-Key": "acme-secret"}}
+	globex := tenantClient{server, map[string]string{"X-API-Key": "globex-secret"}}
+
+	assert.Equal(t, http.StatusCreated, globex.do(t, "POST", "/orders", tenantOrders("widget", 20)).Code)
+	assert.Equal(t, http.StatusForbidden, globex.do(t, "POST", "/orders", tenantOrders("widget", 20)).Code)
+
+	// Another tenant's usage doesn't count against acme's own limit
+	assert.Equal(t, http.StatusCreated, acme.do(t, "POST", "/orders", tenantOrders("anvil", 10)).Code)
+	assert.Equal(t, http.StatusCreated, acme.do(t, "POST", "/orders", tenantOrders("anvil", 10)).Code)
+	assert.Equal(t, http.StatusForbidden, acme.do(t, "POST", "/orders", tenantOrders("anvil", 10)).Code)
+}
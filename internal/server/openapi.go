@@ -0,0 +1,621 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/diagnostics"
+	"qlikOrders/internal/health"
+	"qlikOrders/internal/importer"
+	"qlikOrders/internal/jobs"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/metrics"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/openapi"
+	"qlikOrders/internal/service/graph"
+	"qlikOrders/internal/service/item"
+	"qlikOrders/internal/service/keys"
+	"qlikOrders/internal/service/order"
+	v2 "qlikOrders/internal/service/v2"
+	"qlikOrders/internal/tenant"
+	"strings"
+	"time"
+)
+
+// Routes of the API description, they are open to every caller like the metrics
+const (
+	openAPIPath = "/openapi.json"
+	docsPath    = "/docs"
+)
+
+// apiSpec describes the routes of NewServer.
+// Every route registered in NewServer needs an entry here, TestOpenAPIRoutes fails otherwise.
+type apiSpec struct {
+	doc *openapi.Document
+	// schemes names the security schemes of the configured authenticators
+	schemes []string
+	limited bool
+	errors  *openapi.Schema
+
+	// prefix of the paths of the version being described, and suffix keeping its operation IDs apart from other versions
+	prefix, suffix string
+	deprecated     bool
+}
+
+// newSpec builds the OpenAPI document of the routes NewServer registers with config
+func newSpec(config *options) *openapi.Document {
+	s := &apiSpec{
+		doc: openapi.New(openapi.Info{
+			Title:       "Qlik Orders API",
+			Description: "Ingests orders and serves customer items, summaries and reports. v1 is also served without the /v1 prefix.",
+			Version:     "2.0.0",
+		}),
+		limited: config.limiter != nil,
+	}
+	s.errors = s.doc.Schema(codec.Status{})
+	s.securitySchemes(config.authenticators)
+
+	s.prefix, s.suffix, s.deprecated = v1Prefix, "", true
+	s.orders()
+	s.customers()
+	s.reports()
+	s.graphQL()
+	if config.jobs != nil {
+		s.jobs()
+	}
+	if config.keyStore != nil {
+		s.keys()
+	}
+	if config.auditSink != nil {
+		s.audit()
+	}
+
+	s.prefix, s.suffix, s.deprecated = v2Prefix, "V2", false
+	s.errors = s.doc.Schema(v2.Status{})
+	s.ordersV2()
+	s.customersV2()
+	s.reportsV2()
+	if config.keyStore != nil {
+		s.keys()
+	}
+	if config.auditSink != nil {
+		s.audit()
+	}
+
+	// The API description itself isn't versioned
+	s.prefix, s.suffix, s.deprecated = "", "", false
+	s.errors = s.doc.Schema(codec.Status{})
+
+	s.doc.Add(http.MethodGet, openAPIPath, &openapi.Operation{
+		Tags:        []string{"docs"},
+		Summary:     "OpenAPI document of this API",
+		OperationID: "getOpenAPI",
+		Responses:   map[string]*openapi.Response{"200": {Description: "The OpenAPI 3 document", Content: jsonContent(&openapi.Schema{Type: "object"})}},
+	})
+	s.doc.Add(http.MethodGet, docsPath, &openapi.Operation{
+		Tags:        []string{"docs"},
+		Summary:     "Browsable documentation of this API",
+		OperationID: "getDocs",
+		Responses:   map[string]*openapi.Response{"200": {Description: "An HTML page rendering the OpenAPI document", Content: map[string]openapi.MediaType{"text/html": {}}}},
+	})
+	s.health()
+	if len(config.authenticators) > 0 {
+		s.debug()
+	}
+	if config.metrics != nil {
+		s.doc.Add(http.MethodGet, metrics.Path, &openapi.Operation{
+			Tags:        []string{"operations"},
+			Summary:     "Prometheus metrics of requests, ingestion and the store",
+			OperationID: "getMetrics",
+			Responses:   map[string]*openapi.Response{"200": {Description: "The metrics in the Prometheus text format", Content: map[string]openapi.MediaType{"text/plain": {}}}},
+		})
+	}
+	return s.doc
+}
+
+func (s *apiSpec) health() {
+	result := s.doc.Schema(health.Result{})
+	s.doc.Add(http.MethodGet, health.LivePath, &openapi.Operation{
+		Tags:        []string{"operations"},
+		Summary:     "Liveness probe",
+		OperationID: "getHealth",
+		Responses:   map[string]*openapi.Response{"200": {Description: "The server is serving requests", Content: jsonContent(result)}},
+	})
+	s.doc.Add(http.MethodGet, health.ReadyPath, &openapi.Operation{
+		Tags:        []string{"operations"},
+		Summary:     "Readiness probe",
+		Description: "Checks the store can be reached and, with import jobs, that recovered jobs are imported again and the queue isn't full.",
+		OperationID: "getReadiness",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "Every check passed", Content: jsonContent(result)},
+			"503": {Description: "A check failed", Content: jsonContent(result)},
+		},
+	})
+}
+
+func (s *apiSpec) debug() {
+	s.route(http.MethodGet, debugPath, auth.ScopeDebugRead, &openapi.Operation{
+		Tags:        []string{"operations"},
+		Summary:     "Build, configuration, store and runtime of the service",
+		Description: "Values of secret settings are redacted. Only served to platform keys, not bound to a tenant.",
+		OperationID: "getDebug",
+		Responses:   map[string]*openapi.Response{"200": {Description: "The state of the service", Content: jsonContent(s.doc.Schema(DebugInfo{}))}},
+	})
+	s.route(http.MethodGet, profilePath, auth.ScopeDebugRead, &openapi.Operation{
+		Tags:        []string{"operations"},
+		Summary:     "pprof profile",
+		Description: "Takes the `seconds`, `debug` and `gc` parameters of net/http/pprof. Only served to platform keys, not bound to a tenant.",
+		OperationID: "getProfile",
+		Parameters:  []openapi.Parameter{{Name: "profile", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Enum: diagnostics.Profiles}}},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The profile", Content: map[string]openapi.MediaType{"application/octet-stream": {}, "text/plain": {}}},
+			"404": {Description: "Unknown profile", Content: map[string]openapi.MediaType{"text/plain": {}}},
+		},
+	})
+}
+
+func (s *apiSpec) securitySchemes(authenticators []auth.Authenticator) {
+	for _, authenticator := range authenticators {
+		switch authenticator.(type) {
+		case auth.APIKeyAuthenticator:
+			s.addScheme("ApiKey", &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key, also accepted as an \"Authorization: ApiKey\" header"})
+		case *auth.JWTAuthenticator:
+			s.addScheme("Bearer", &openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "JWT whose roles grant the scopes"})
+		}
+	}
+}
+
+func (s *apiSpec) addScheme(name string, scheme *openapi.SecurityScheme) {
+	if s.doc.Components.SecuritySchemes == nil {
+		s.doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{}
+	}
+	s.doc.Components.SecuritySchemes[name] = scheme
+	s.schemes = append(s.schemes, name)
+}
+
+// route adds an operation of the version being described guarded by scope,
+// along with the responses of authentication, tenants and rate limits
+func (s *apiSpec) route(method, path, scope string, op *openapi.Operation) {
+	op.OperationID += s.suffix
+	if s.deprecated {
+		op.Deprecated = true
+		op.Description = joinSentences(op.Description, fmt.Sprintf("Deprecated, served until %s, use %s instead.", v1Sunset.Format(time.DateOnly), v2Prefix))
+	}
+	op.Parameters = append(op.Parameters, openapi.Parameter{
+		Name:        tenant.Header,
+		In:          "header",
+		Description: "Tenant to act for, only API keys not bound to a tenant can name another tenant than their own",
+		Schema:      &openapi.Schema{Type: "string"},
+	}, openapi.Parameter{
+		Name:        logging.Header,
+		In:          "header",
+		Description: "Correlates the request in the logs, echoed in the response. Generated when missing or invalid.",
+		Schema:      &openapi.Schema{Type: "string", MaxLength: intPtr(128), Pattern: "^[A-Za-z0-9._:-]+$"},
+	})
+	s.response(op, "400", "Invalid input or tenant")
+	if len(s.schemes) > 0 {
+		op.Description = joinSentences(op.Description, "Requires the `"+scope+"` scope.")
+		for _, scheme := range s.schemes {
+			op.Security = append(op.Security, openapi.SecurityRequirement{scheme: {}})
+		}
+		s.response(op, "401", "Missing or invalid credentials")
+		s.response(op, "403", "Missing scope, or credentials bound to another tenant")
+	}
+	if s.limited {
+		op.Responses["429"] = &openapi.Response{
+			Description: "Rate limit or daily quota exceeded",
+			Headers:     map[string]openapi.Header{"Retry-After": {Description: "Seconds to wait before retrying", Schema: &openapi.Schema{Type: "integer"}}},
+			Content:     jsonContent(s.errors),
+		}
+	}
+	s.doc.Add(method, s.prefix+path, op)
+}
+
+// response adds an error response unless the operation already describes one for code
+func (s *apiSpec) response(op *openapi.Operation, code, description string) {
+	if _, ok := op.Responses[code]; !ok {
+		op.Responses[code] = &openapi.Response{Description: description, Content: jsonContent(s.errors)}
+	}
+}
+
+func (s *apiSpec) orders() {
+	orderSchema := s.doc.Schema(models.Order{})
+
+	s.route(http.MethodPost, "/orders", auth.ScopeOrdersWrite, &openapi.Operation{
+		Tags:        []string{"orders"},
+		Summary:     "Add a batch of orders",
+		Description: fmt.Sprintf("A batch holds at most %d orders and the body at most %d bytes.", order.MaxBatchSize, order.MaxBodyBytes),
+		OperationID: "addOrders",
+		RequestBody: &openapi.RequestBody{Required: true, Content: bodyContent(openapi.ArrayOf(orderSchema), "OrderList")},
+		Responses: map[string]*openapi.Response{
+			"201": {Description: "Orders added", Content: bodyContent(s.errors, "Status")},
+			"403": {Description: "Tenant order limit reached", Content: bodyContent(s.errors, "Status")},
+			"413": {Description: "Too many orders or body too large", Content: bodyContent(s.errors, "Status")},
+		},
+	})
+	s.route(http.MethodGet, "/orders", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"orders"},
+		Summary:     "List or export orders",
+		Description: "Exports have one row per item, in the columns of CSV imports.",
+		OperationID: "getOrders",
+		Parameters:  []openapi.Parameter{queryParam("customerId", "Keeps the orders of a single customer", &openapi.Schema{Type: "string"}), formatParam()},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The orders", Content: exportContent(openapi.Object(map[string]*openapi.Schema{"orders": openapi.ArrayOf(orderSchema)}), "OrderList")},
+			"406": {Description: "None of the accepted formats is supported", Content: jsonContent(s.errors)},
+		},
+	})
+	s.route(http.MethodPost, "/orders/import", auth.ScopeOrdersWrite, &openapi.Operation{
+		Tags:        []string{"orders"},
+		Summary:     "Import a file of orders",
+		Description: fmt.Sprintf("Orders are committed in batches as the file is read, invalid orders are reported and the rest is imported. The file holds at most %d bytes.", order.MaxImportBytes),
+		OperationID: "importOrders",
+		Parameters:  importParams(),
+		RequestBody: importBody(),
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The import report", Content: bodyContent(s.importResult(), "ImportResult")},
+			"413": {Description: "File too large", Content: bodyContent(s.importResult(), "ImportResult")},
+		},
+	})
+}
+
+// importResult is the body of import responses, errors carry the report of what was imported before them
+func (s *apiSpec) importResult() *openapi.Schema {
+	return &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+		"error":   {Type: "string"},
+		"message": {Type: "string"},
+		"report":  s.doc.Schema(importer.Report{}),
+	}}
+}
+
+func (s *apiSpec) customers() {
+	customerItem := s.doc.Schema(models.CustomerItem{})
+	itemHistory := s.doc.Schema(models.ItemHistory{})
+	summarySchema := s.doc.Schema(models.Summary{})
+	notFound := &openapi.Response{Description: "Customer not found", Content: jsonContent(s.errors)}
+
+	s.route(http.MethodGet, "/customer/:customerId/items", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"customers"},
+		Summary:     "List or export the items purchased by a customer",
+		Description: "Lists every purchased unit, or one entry per item when grouped. Exports ignore the pagination.",
+		OperationID: "getItemsByCustomer",
+		Parameters: []openapi.Parameter{
+			queryParam("groupBy", "Groups the units of each item", &openapi.Schema{Type: "string", Enum: []string{"item"}}),
+			queryParam("expand", "Adds the order of each unit", &openapi.Schema{Type: "string", Enum: []string{"order"}}),
+			queryParam("limit", "Maximum entries returned, 0 returns them all", &openapi.Schema{Type: "integer", Minimum: intPtr(0), Default: 0}),
+			queryParam("offset", "Entries skipped", &openapi.Schema{Type: "integer", Minimum: intPtr(0), Default: 0}),
+			formatParam(),
+		},
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "A page of items",
+				Headers:     map[string]openapi.Header{"X-Total-Count": {Description: "Number of entries across every page", Schema: &openapi.Schema{Type: "integer"}}},
+				Content: exportContent(&openapi.Schema{Type: "object", Required: []string{"items", "limit", "offset", "total"}, Properties: map[string]*openapi.Schema{
+					"items":  openapi.ArrayOf(&openapi.Schema{OneOf: []*openapi.Schema{customerItem, itemHistory}}),
+					"limit":  {Type: "integer"},
+					"offset": {Type: "integer"},
+					"total":  {Type: "integer"},
+				}}, "CustomerItemPage or ItemHistoryPage"),
+			},
+			"404": notFound,
+			"406": {Description: "None of the accepted formats is supported", Content: jsonContent(s.errors)},
+		},
+	})
+	s.route(http.MethodGet, "/summary", auth.ScopeSummaryRead, &openapi.Operation{
+		Tags:        []string{"customers"},
+		Summary:     "List or export the summaries of every customer",
+		OperationID: "getSummaries",
+		Parameters:  []openapi.Parameter{formatParam()},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The summaries", Content: exportContent(openapi.Object(map[string]*openapi.Schema{"summaries": openapi.ArrayOf(summarySchema)}), "SummaryList")},
+			"406": {Description: "None of the accepted formats is supported", Content: jsonContent(s.errors)},
+		},
+	})
+	s.route(http.MethodGet, "/customer/:customerId/summary", auth.ScopeSummaryRead, &openapi.Operation{
+		Tags:        []string{"customers"},
+		Summary:     "Get the summary of a customer, with their RFM scores",
+		OperationID: "getCustomerSummary",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The summary", Content: bodyContent(openapi.Object(map[string]*openapi.Schema{"summary": summarySchema}), "Summary")},
+			"404": notFound,
+		},
+	})
+	s.route(http.MethodGet, "/customers/:customerId/export", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"privacy"},
+		Summary:     "Export everything stored about a customer",
+		OperationID: "exportCustomer",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The customer's data, served as a download", Content: jsonContent(s.doc.Schema(models.CustomerExport{}))},
+			"404": notFound,
+		},
+	})
+	s.erase()
+}
+
+// erase describes the erasure of customers, whose record is the same in every version
+func (s *apiSpec) erase() {
+	notFound := &openapi.Response{Description: "Customer not found", Content: jsonContent(s.errors)}
+
+	s.route(http.MethodDelete, "/customers/:customerId/data", auth.ScopeCustomersErase, &openapi.Operation{
+		Tags:        []string{"privacy"},
+		Summary:     "Erase a customer's data",
+		OperationID: "eraseCustomer",
+		Parameters: []openapi.Parameter{queryParam("mode", "Deletes the orders, or replaces the customer ID with a pseudonym", &openapi.Schema{
+			Type:    "string",
+			Enum:    []string{string(models.ErasureModeDelete), string(models.ErasureModePseudonymize)},
+			Default: string(models.ErasureModeDelete),
+		})},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The erasure record", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"erasure": s.doc.Schema(models.ErasureRecord{})}))},
+			"404": notFound,
+		},
+	})
+	s.route(http.MethodGet, "/customers/erasures", auth.ScopeCustomersErase, &openapi.Operation{
+		Tags:        []string{"privacy"},
+		Summary:     "Erasure records of the tenant, oldest first",
+		OperationID: "listErasures",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The erasure records", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"erasures": openapi.ArrayOf(s.doc.Schema(models.ErasureRecord{}))}))},
+		},
+	})
+}
+
+func (s *apiSpec) reports() {
+	s.route(http.MethodGet, "/reports/cohorts", auth.ScopeReportsRead, &openapi.Operation{
+		Tags:        []string{"reports"},
+		Summary:     "Retention and spend of customers grouped by first order month",
+		OperationID: "getCohorts",
+		Parameters:  []openapi.Parameter{queryParam("months", "Limits how many months after the first order are reported", &openapi.Schema{Type: "integer", Minimum: intPtr(0)})},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The cohorts", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"cohorts": openapi.ArrayOf(s.doc.Schema(models.Cohort{}))}))},
+		},
+	})
+	s.route(http.MethodGet, "/reports/rfm", auth.ScopeReportsRead, &openapi.Operation{
+		Tags:        []string{"reports"},
+		Summary:     "Recency, frequency and monetary scores of every customer",
+		OperationID: "getRFM",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The scores", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"rfm": openapi.ArrayOf(s.doc.Schema(models.RFM{}))}))},
+		},
+	})
+	s.relatedItems()
+}
+
+// relatedItems describes the items bought together, the same in every version
+func (s *apiSpec) relatedItems() {
+	s.route(http.MethodGet, "/items/:itemId/related", auth.ScopeReportsRead, &openapi.Operation{
+		Tags:        []string{"reports"},
+		Summary:     "Items most often purchased in the same order as an item",
+		OperationID: "getRelatedItems",
+		Parameters:  []openapi.Parameter{queryParam("limit", "Maximum related items returned", &openapi.Schema{Type: "integer", Minimum: intPtr(1), Default: item.DefaultRelatedLimit})},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The related items", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{
+				"itemId":  {Type: "string"},
+				"related": openapi.ArrayOf(s.doc.Schema(models.RelatedItem{})),
+			}))},
+			"404": {Description: "Item not found", Content: jsonContent(s.errors)},
+		},
+	})
+}
+
+func (s *apiSpec) graphQL() {
+	result := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+		"data":   {Type: "object"},
+		"errors": openapi.ArrayOf(&openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"message": {Type: "string"}}}),
+	}}
+	responses := func() map[string]*openapi.Response {
+		return map[string]*openapi.Response{
+			"200": {Description: "The result, errors of single fields are reported next to the other fields", Content: jsonContent(result)},
+			"400": {Description: "Invalid query, or query over the depth or complexity limits", Content: jsonContent(result)},
+		}
+	}
+	description := fmt.Sprintf("Queries nested more than %d levels deep, or with an estimated cost over %d, are rejected. Summaries also require the `%s` scope.", graph.MaxDepth, graph.MaxComplexity, auth.ScopeSummaryRead)
+
+	s.route(http.MethodGet, "/graphql", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"graphql"},
+		Summary:     "Run a GraphQL query sent as query parameters",
+		Description: description,
+		OperationID: "getGraphQL",
+		Parameters: []openapi.Parameter{
+			{Name: "query", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}},
+			queryParam("operationName", "", &openapi.Schema{Type: "string"}),
+			queryParam("variables", "Variables encoded as a JSON object", &openapi.Schema{Type: "string"}),
+		},
+		Responses: responses(),
+	})
+	s.route(http.MethodPost, "/graphql", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"graphql"},
+		Summary:     "Run a GraphQL query",
+		Description: description,
+		OperationID: "postGraphQL",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonContent(&openapi.Schema{Type: "object", Required: []string{"query"}, Properties: map[string]*openapi.Schema{
+			"query":         {Type: "string"},
+			"operationName": {Type: "string"},
+			"variables":     {Type: "object"},
+		}})},
+		Responses: responses(),
+	})
+}
+
+func (s *apiSpec) jobs() {
+	job := s.doc.Schema(jobs.Job{})
+	notFound := &openapi.Response{Description: "Job not found", Content: jsonContent(s.errors)}
+
+	s.route(http.MethodPost, "/jobs/import", auth.ScopeOrdersWrite, &openapi.Operation{
+		Tags:        []string{"jobs"},
+		Summary:     "Import a file of orders in the background",
+		Description: "Takes the same files as `POST /orders/import`.",
+		OperationID: "createImportJob",
+		Parameters:  importParams(),
+		RequestBody: importBody(),
+		Responses: map[string]*openapi.Response{
+			"202": {
+				Description: "The queued job",
+				Headers:     map[string]openapi.Header{"Location": {Description: "URL of the job", Schema: &openapi.Schema{Type: "string"}}},
+				Content:     jsonContent(job),
+			},
+			"413": {Description: "File too large", Content: jsonContent(s.errors)},
+			"503": {Description: "Too many jobs queued", Content: jsonContent(s.errors)},
+		},
+	})
+	s.route(http.MethodGet, "/jobs/:jobId", auth.ScopeOrdersWrite, &openapi.Operation{
+		Tags:        []string{"jobs"},
+		Summary:     "Get the status and progress of a job",
+		OperationID: "getJob",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The job", Content: jsonContent(job)},
+			"404": notFound,
+		},
+	})
+	s.route(http.MethodPost, "/jobs/:jobId/cancel", auth.ScopeOrdersWrite, &openapi.Operation{
+		Tags:        []string{"jobs"},
+		Summary:     "Cancel a queued or running job",
+		Description: "A running job stops before its next batch, orders already imported are kept.",
+		OperationID: "cancelJob",
+		Responses: map[string]*openapi.Response{
+			"202": {Description: "The cancelled job", Content: jsonContent(job)},
+			"404": notFound,
+			"409": {Description: "The job already finished", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"error": {Type: "string"}, "job": job}))},
+		},
+	})
+}
+
+func (s *apiSpec) keys() {
+	key := s.doc.Schema(keys.KeyResponse{})
+
+	s.route(http.MethodPost, "/admin/keys", auth.ScopeKeysAdmin, &openapi.Operation{
+		Tags:        []string{"keys"},
+		Summary:     "Create an API key",
+		Description: "The secret is only returned in this response.",
+		OperationID: "createKey",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonContent(s.doc.Schema(keys.CreateKeyRequest{}))},
+		Responses: map[string]*openapi.Response{
+			"201": {Description: "The key and its secret", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"key": key, "secret": {Type: "string"}}))},
+		},
+	})
+	s.route(http.MethodGet, "/admin/keys", auth.ScopeKeysAdmin, &openapi.Operation{
+		Tags:        []string{"keys"},
+		Summary:     "List the API keys",
+		OperationID: "listKeys",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The keys, without their secrets", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"keys": openapi.ArrayOf(key)}))},
+		},
+	})
+	s.route(http.MethodDelete, "/admin/keys/:keyId", auth.ScopeKeysAdmin, &openapi.Operation{
+		Tags:        []string{"keys"},
+		Summary:     "Delete an API key",
+		OperationID: "deleteKey",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "Key deleted", Content: jsonContent(s.errors)},
+			"404": {Description: "Key not found", Content: jsonContent(s.errors)},
+		},
+	})
+}
+
+func (s *apiSpec) audit() {
+	var formats []string
+	for _, format := range audit.Formats {
+		formats = append(formats, string(format))
+	}
+	timeParam := func(name, description string) openapi.Parameter {
+		return queryParam(name, description, &openapi.Schema{Type: "string", Format: "date-time"})
+	}
+
+	s.route(http.MethodGet, "/audit", auth.ScopeAuditRead, &openapi.Operation{
+		Tags:        []string{"audit"},
+		Summary:     "List or export the audit log",
+		Description: "Every call adding, importing, erasing or managing data is recorded with its caller and outcome, entries are listed oldest first a page at a time. Exports have one row per entry.",
+		OperationID: "getAudit",
+		Parameters: []openapi.Parameter{
+			queryParam("actor", "Keeps the calls of an API key or token subject", &openapi.Schema{Type: "string"}),
+			queryParam("route", "Keeps the calls of a route, by pattern, e.g. /v2/orders", &openapi.Schema{Type: "string"}),
+			queryParam("orderId", "Keeps the calls on an order", &openapi.Schema{Type: "string"}),
+			queryParam("requestId", "Keeps the calls of a request", &openapi.Schema{Type: "string"}),
+			queryParam("outcome", "Keeps the calls with an outcome", &openapi.Schema{Type: "string", Enum: audit.Outcomes}),
+			timeParam("from", "Keeps the calls recorded at or after a time"),
+			timeParam("to", "Keeps the calls recorded before a time"),
+			queryParam("limit", "Maximum entries returned", &openapi.Schema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(audit.MaxLimit), Default: audit.DefaultLimit}),
+			queryParam("offset", "Matching entries skipped", &openapi.Schema{Type: "integer", Minimum: intPtr(0), Default: 0}),
+			queryParam("format", "Response format, taking precedence over the Accept header: "+strings.Join(formats, ", "), &openapi.Schema{Type: "string"}),
+		},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The entries", Content: map[string]openapi.MediaType{
+				codec.FormatJSON.ContentType(): {Schema: openapi.Object(map[string]*openapi.Schema{
+					"entries": openapi.ArrayOf(s.doc.Schema(audit.Entry{})),
+					"limit":   {Type: "integer"},
+					"offset":  {Type: "integer"},
+				})},
+				codec.FormatCSV.ContentType():     {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+				codec.FormatNDJSON.ContentType():  {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+				codec.FormatParquet.ContentType(): {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+			}},
+			"406": {Description: "None of the accepted formats is supported", Content: jsonContent(s.errors)},
+		},
+	})
+}
+
+func importBody() *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Description: "Orders in NDJSON, one order per line, or CSV with one row per item",
+		Required:    true,
+		Content: map[string]openapi.MediaType{
+			codec.FormatNDJSON.ContentType(): {Schema: &openapi.Schema{Type: "string"}},
+			codec.FormatCSV.ContentType():    {Schema: &openapi.Schema{Type: "string"}},
+		},
+	}
+}
+
+func importParams() []openapi.Parameter {
+	return []openapi.Parameter{
+		queryParam("format", "Format of the file, read from the Content-Type when missing", &openapi.Schema{Type: "string", Enum: []string{string(importer.FormatNDJSON), string(importer.FormatCSV)}}),
+		queryParam("batchSize", "Orders committed at once", &openapi.Schema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(order.MaxImportBatchSize), Default: importer.DefaultBatchSize}),
+	}
+}
+
+// formatParam lists the formats in its description rather than an enum, unknown formats get 406 like unacceptable Accept headers
+func formatParam() openapi.Parameter {
+	var formats []string
+	for _, format := range codec.ExportFormats {
+		formats = append(formats, string(format))
+	}
+	return queryParam("format", "Response format, taking precedence over the Accept header: "+strings.Join(formats, ", "), &openapi.Schema{Type: "string"})
+}
+
+func queryParam(name, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func jsonContent(schema *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{codec.FormatJSON.ContentType(): {Schema: schema}}
+}
+
+// bodyContent describes a body in every body format, message names the Protobuf message of api/proto/orders.proto
+func bodyContent(schema *openapi.Schema, message string) map[string]openapi.MediaType {
+	content := jsonContent(schema)
+	content[codec.FormatMsgPack.ContentType()] = openapi.MediaType{Schema: schema}
+	content[codec.FormatProtobuf.ContentType()] = openapi.MediaType{Schema: &openapi.Schema{Type: "string", Format: "binary", Description: message + " message"}}
+	return content
+}
+
+// exportContent describes a list in the body formats and the export formats, which have one row per entry
+func exportContent(schema *openapi.Schema, message string) map[string]openapi.MediaType {
+	content := bodyContent(schema, message)
+	for _, format := range codec.ExportFormats {
+		if format.IsExport() {
+			content[format.ContentType()] = openapi.MediaType{Schema: &openapi.Schema{Type: "string", Format: "binary"}}
+		}
+	}
+	return content
+}
+
+func joinSentences(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " " + b
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/jobs"
+	"qlikOrders/internal/metrics"
+	"qlikOrders/internal/openapi"
+	"qlikOrders/internal/ratelimit"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite api/openapi.json from the routes and models")
+
+const specFile = "../../api/openapi.json"
+
+// allOptions enables every optional route and security scheme
+func allOptions(t *testing.T) []Option {
+	collection := &collections.OrderCollection{}
+	manager, err := jobs.NewManager(jobs.Config{Dir: t.TempDir(), Collections: collection})
+	require.NoError(t, err)
+	t.Cleanup(manager.Close)
+
+	jwtAuth, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+		Keys:     map[string]any{"default": []byte("test-secret-test-secret-test-sec")},
+		Issuer:   "https://issuer.test",
+		Audience: "qlik-orders",
+	})
+	require.NoError(t, err)
+
+	return []Option{
+		WithAPIKeys(auth.NewMemoryKeyStore()),
+		WithJWT(jwtAuth),
+		WithRateLimit(&ratelimit.Limiter{Store: ratelimit.NewMemoryStore(), Default: ratelimit.Limit{Requests: 100, Period: time.Minute}}),
+		WithJobs(manager),
+		WithMetrics(metrics.New()),
+		WithAudit(audit.NewMemorySink()),
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"Default", nil},
+		{"All options", allOptions(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &options{}
+			for _, opt := range tt.opts {
+				opt(config)
+			}
+
+			var routes []string
+			for _, route := range NewServer(&collections.OrderCollection{}, tt.opts...).Routes() {
+				routes = append(routes, route.Method+" "+openapi.Path(route.Path))
+			}
+
+			// v1 is also served without its prefix
+			operations := newSpec(config).Operations()
+			for _, operation := range operations {
+				if method, path, _ := strings.Cut(operation, " "); strings.HasPrefix(path, v1Prefix+"/") {
+					operations = append(operations, method+" "+strings.TrimPrefix(path, v1Prefix))
+				}
+			}
+			assert.ElementsMatch(t, routes, operations, "routes of NewServer and the OpenAPI document differ")
+		})
+	}
+}
+
+// TestOpenAPIDocument fails when the routes or models change without api/openapi.json, run with -update to rewrite it
+func TestOpenAPIDocument(t *testing.T) {
+	config := &options{}
+	for _, opt := range allOptions(t) {
+		opt(config)
+	}
+	doc := newSpec(config)
+	actual, err := json.MarshalIndent(doc, "", "  ")
+	require.NoError(t, err)
+	actual = append(actual, '\n')
+
+	if *update {
+		require.NoError(t, os.WriteFile(specFile, actual, 0o644))
+	}
+	expected, err := os.ReadFile(specFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual), "api/openapi.json is out of date, run go test ./internal/server -run TestOpenAPIDocument -update")
+
+	// Every referenced schema is defined
+	var refs []string
+	collectRefs(t, actual, &refs)
+	for _, ref := range refs {
+		name := ref[len("#/components/schemas/"):]
+		assert.Contains(t, doc.Components.Schemas, name, "undefined schema %s", ref)
+	}
+}
+
+func collectRefs(t *testing.T, data []byte, refs *[]string) {
+	var value any
+	require.NoError(t, json.Unmarshal(data, &value))
+	var walk func(any)
+	walk = func(value any) {
+		switch value := value.(type) {
+		case map[string]any:
+			for key, child := range value {
+				if ref, ok := child.(string); ok && key == "$ref" {
+					*refs = append(*refs, ref)
+				}
+				walk(child)
+			}
+		case []any:
+			for _, child := range value {
+				walk(child)
+			}
+		}
+	}
+	walk(value)
+}
+
+func TestOpenAPIEndpoints(t *testing.T) {
+	server := NewServer(&collections.OrderCollection{}, allOptions(t)...)
+
+	// Served without credentials even though every other route requires them
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc openapi.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/v1/customer/{customerId}/items")
+	assert.Contains(t, doc.Paths, "/v2/customer/{customerId}/items")
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `const specURL = "/openapi.json"`)
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/summary", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestParameterValidation(t *testing.T) {
+	server := NewServer(&collections.OrderCollection{})
+
+	tests := []struct {
+		url          string
+		expectedBody string
+	}{
+		{"/customer/01/items?limit=-1", `{"error":"Invalid input","message":"limit must be at least 0"}`},
+		{"/customer/01/items?groupBy=order", `{"error":"Invalid input","message":"groupBy must be one of item"}`},
+		{"/items/20201/related?limit=0", `{"error":"Invalid input","message":"limit must be at least 1"}`},
+		{"/reports/cohorts?months=many", `{"error":"Invalid input","message":"months must be an integer"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
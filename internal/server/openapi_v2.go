@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/openapi"
+	"qlikOrders/internal/service/order"
+	v2 "qlikOrders/internal/service/v2"
+)
+
+func (s *apiSpec) ordersV2() {
+	orderSchema := s.doc.Schema(v2.Order{})
+
+	s.route(http.MethodPost, "/orders", auth.ScopeOrdersWrite, &openapi.Operation{
+		Tags:    []string{"orders"},
+		Summary: "Add a batch of orders",
+		Description: fmt.Sprintf("A batch holds at most %d orders and the body at most %d bytes. Unit prices are in cents and have to be whole euros.",
+			order.MaxBatchSize, order.MaxBodyBytes),
+		OperationID: "addOrders",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonContent(openapi.ArrayOf(orderSchema))},
+		Responses: map[string]*openapi.Response{
+			"201": {Description: "Orders added", Content: jsonContent(s.doc.Schema(codec.Status{}))},
+			"403": {Description: "Tenant order limit reached", Content: jsonContent(s.errors)},
+			"413": {Description: "Too many orders or body too large", Content: jsonContent(s.errors)},
+		},
+	})
+	s.route(http.MethodGet, "/orders", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"orders"},
+		Summary:     "List orders",
+		OperationID: "getOrders",
+		Parameters:  []openapi.Parameter{queryParam("customerId", "Keeps the orders of a single customer", &openapi.Schema{Type: "string"})},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The orders", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"orders": openapi.ArrayOf(orderSchema)}))},
+		},
+	})
+}
+
+func (s *apiSpec) customersV2() {
+	customerLine := s.doc.Schema(v2.CustomerLine{})
+	itemSummary := s.doc.Schema(v2.ItemSummary{})
+	summarySchema := s.doc.Schema(v2.Summary{})
+	notFound := &openapi.Response{Description: "Customer not found", Content: jsonContent(s.errors)}
+
+	s.route(http.MethodGet, "/customer/:customerId/items", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"customers"},
+		Summary:     "List the items purchased by a customer",
+		Description: "Lists the lines of every order, or one entry per item when grouped.",
+		OperationID: "getItemsByCustomer",
+		Parameters: []openapi.Parameter{
+			queryParam("groupBy", "Groups the lines of each item", &openapi.Schema{Type: "string", Enum: []string{"item"}}),
+			queryParam("expand", "Adds the order of each line", &openapi.Schema{Type: "string", Enum: []string{"order"}}),
+			queryParam("limit", "Maximum entries returned, 0 returns them all", &openapi.Schema{Type: "integer", Minimum: intPtr(0), Default: 0}),
+			queryParam("offset", "Entries skipped", &openapi.Schema{Type: "integer", Minimum: intPtr(0), Default: 0}),
+		},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "A page of items", Content: jsonContent(&openapi.Schema{Type: "object", Required: []string{"items", "limit", "offset", "total"}, Properties: map[string]*openapi.Schema{
+				"items":  openapi.ArrayOf(&openapi.Schema{OneOf: []*openapi.Schema{customerLine, itemSummary}}),
+				"limit":  {Type: "integer"},
+				"offset": {Type: "integer"},
+				"total":  {Type: "integer"},
+			}})},
+			"404": notFound,
+		},
+	})
+	s.route(http.MethodGet, "/summary", auth.ScopeSummaryRead, &openapi.Operation{
+		Tags:        []string{"customers"},
+		Summary:     "List the summaries of every customer",
+		OperationID: "getSummaries",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The summaries", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"summaries": openapi.ArrayOf(summarySchema)}))},
+		},
+	})
+	s.route(http.MethodGet, "/customer/:customerId/summary", auth.ScopeSummaryRead, &openapi.Operation{
+		Tags:        []string{"customers"},
+		Summary:     "Get the summary of a customer, with their RFM scores",
+		OperationID: "getCustomerSummary",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The summary", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"summary": summarySchema}))},
+			"404": notFound,
+		},
+	})
+	s.route(http.MethodGet, "/customers/:customerId/export", auth.ScopeCustomersRead, &openapi.Operation{
+		Tags:        []string{"privacy"},
+		Summary:     "Export everything stored about a customer",
+		OperationID: "exportCustomer",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The customer's data, served as a download", Content: jsonContent(s.doc.Schema(v2.Export{}))},
+			"404": notFound,
+		},
+	})
+	s.erase()
+}
+
+func (s *apiSpec) reportsV2() {
+	s.route(http.MethodGet, "/reports/cohorts", auth.ScopeReportsRead, &openapi.Operation{
+		Tags:        []string{"reports"},
+		Summary:     "Retention and spend of customers grouped by first order month",
+		OperationID: "getCohorts",
+		Parameters:  []openapi.Parameter{queryParam("months", "Limits how many months after the first order are reported", &openapi.Schema{Type: "integer", Minimum: intPtr(0)})},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The cohorts", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"cohorts": openapi.ArrayOf(s.doc.Schema(v2.Cohort{}))}))},
+		},
+	})
+	s.route(http.MethodGet, "/reports/rfm", auth.ScopeReportsRead, &openapi.Operation{
+		Tags:        []string{"reports"},
+		Summary:     "Recency, frequency and monetary scores of every customer",
+		OperationID: "getRFM",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The scores", Content: jsonContent(openapi.Object(map[string]*openapi.Schema{"rfm": openapi.ArrayOf(s.doc.Schema(v2.RFM{}))}))},
+		},
+	})
+	s.relatedItems()
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/jobs"
+	"qlikOrders/internal/metrics"
+	"qlikOrders/internal/ratelimit"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures optional features of the server
+type Option func(*options)
+
+type options struct {
+	keyStore       auth.KeyStore
+	authenticators []auth.Authenticator
+	limiter        *ratelimit.Limiter
+	jobs           *jobs.Manager
+	logger         *slog.Logger
+	metrics        *metrics.Metrics
+	tracerProvider trace.TracerProvider
+	debugConfig    map[string]string
+	auditSink      audit.Sink
+	trustedProxies []string
+}
+
+// WithAPIKeys protects every route with the API keys in store and registers the key management routes
+func WithAPIKeys(store auth.KeyStore) Option {
+	return func(o *options) {
+		o.keyStore = store
+		o.authenticators = append(o.authenticators, auth.APIKeyAuthenticator{Store: store})
+	}
+}
+
+// WithJWT protects every route with bearer tokens verified by authenticator, roles in the token grant the scopes
+func WithJWT(authenticator *auth.JWTAuthenticator) Option {
+	return func(o *options) {
+		o.authenticators = append(o.authenticators, authenticator)
+	}
+}
+
+// WithRateLimit limits requests per client and route and enforces the daily order quota
+func WithRateLimit(limiter *ratelimit.Limiter) Option {
+	return func(o *options) {
+		o.limiter = limiter
+	}
+}
+
+// WithTrustedProxies trusts the X-Forwarded-For header of requests coming from proxies, IP addresses or CIDR ranges.
+// Without it the header is ignored, so anonymous callers can't pick the IP address they are rate limited by.
+func WithTrustedProxies(proxies []string) Option {
+	return func(o *options) {
+		o.trustedProxies = proxies
+	}
+}
+
+// ParseTrustedProxies reads a comma separated list of IP addresses and CIDR ranges, such as TRUSTED_PROXIES
+func ParseTrustedProxies(value string) ([]string, error) {
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// WithJobs registers the import job routes, jobs are processed by manager
+func WithJobs(manager *jobs.Manager) Option {
+	return func(o *options) {
+		o.jobs = manager
+	}
+}
+
+// WithLogger logs requests and the events of handlers with logger instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithMetrics records requests and ingestion in m and serves them on /metrics
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithTracing traces requests with provider, through validation into the collections.
+// Callers sending a W3C traceparent header have their trace continued.
+func WithTracing(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = provider
+	}
+}
+
+// WithDebugConfig shows config, the settings the service was started with, on /debug.
+// Values of secret settings are redacted.
+func WithDebugConfig(config map[string]string) Option {
+	return func(o *options) {
+		o.debugConfig = config
+	}
+}
+
+// WithAudit records every call changing data in sink and serves the entries on /audit
+func WithAudit(sink audit.Sink) Option {
+	return func(o *options) {
+		o.auditSink = sink
+	}
+}
+
+// newLogger returns the logger of the server
+func (o *options) newLogger() *slog.Logger {
+	if o.logger == nil {
+		return slog.Default()
+	}
+	return o.logger
+}
+
+// newAuth returns the authentication of the server, nil when none is configured
+func (o *options) newAuth() *auth.Auth {
+	if len(o.authenticators) == 0 {
+		return nil
+	}
+	return auth.New(o.authenticators...)
+}
+
+// requireScope returns the middleware guarding a route with a scope.
+// Routes are left open when no authentication is configured.
+func requireScope(a *auth.Auth) func(scope string) gin.HandlerFunc {
+	if a == nil {
+		return func(string) gin.HandlerFunc {
+			return func(c *gin.Context) { c.Next() }
+		}
+	}
+	return a.Require
+}
+
+// recordAudit returns the middleware recording the calls of a route in the audit log.
+// Routes aren't recorded when no audit sink is configured.
+func (o *options) recordAudit() gin.HandlerFunc {
+	if o.auditSink == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return audit.Record(o.auditSink)
+}
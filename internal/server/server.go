@@ -1,22 +1,99 @@
 package server
 
 import (
+	"log/slog"
+	"net/http"
 	"qlikOrders/internal/collections"
-	"qlikOrders/internal/service/customer"
-	"qlikOrders/internal/service/order"
-	"qlikOrders/internal/service/summary"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/metrics"
+	"qlikOrders/internal/openapi"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 // NewServer creates a new HTTP server with the defined routes
-func NewServer(collections *collections.OrderCollection) *gin.Engine {
-	router := gin.Default()
+func NewServer(collections collections.Collections, opts ...Option) *gin.Engine {
+	config := &options{}
+	for _, opt := range opts {
+		opt(config)
+	}
 
-	// Routes
-	router.POST("/orders", order.AddOrdersHandler(collections))
-	router.GET("/customer/:customerId/items", customer.GetItemsByCustomerHandler(collections))
-	router.GET("/summary", summary.GetSummariesHandler(collections))
+	router := gin.New()
+
+	// The client IP limits anonymous callers, it is only read from X-Forwarded-For when set by a trusted proxy
+	if err := router.SetTrustedProxies(config.trustedProxies); err != nil {
+		config.newLogger().Error("invalid trusted proxies, X-Forwarded-For is ignored", slog.String(logging.KeyError, err.Error()))
+		_ = router.SetTrustedProxies(nil)
+	}
+
+	// Requests are counted and timed as a whole, including the ones rejected by later middlewares
+	if config.metrics != nil {
+		router.Use(config.metrics.Middleware())
+		observeStore(config.metrics, collections)
+	}
+
+	// Every request gets an ID and a logger tagged with it before anything else runs, v1 error bodies stay as they were.
+	// Traced requests also tag their span with the ID, and their logs with the trace ID.
+	if config.tracerProvider != nil {
+		router.Use(tracing.Middleware(config.tracerProvider), logging.RequestID(config.newLogger()), tracing.Correlate())
+	} else {
+		router.Use(logging.RequestID(config.newLogger()))
+	}
+	router.Use(logging.AccessLog(), logging.Recovery())
+	router.Use(logging.EchoRequestID(func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, v2Prefix+"/") }))
+
+	// Probes are registered before authentication and limits, so the orchestrator is never turned away
+	routeHealth(router, collections, config)
+
+	// Callers are authenticated before the tenant they act for is resolved
+	authentication := config.newAuth()
+	if authentication != nil {
+		router.Use(authentication.Authenticate())
+	}
+	router.Use(tenant.Resolve())
+
+	// Limits are applied per client, so they come after authentication, and per route whatever its version
+	if config.limiter != nil {
+		router.Use(config.limiter.Middleware(v1Prefix, v2Prefix))
+	}
+	require := requireScope(authentication)
+
+	// Query parameters are checked against the OpenAPI document before any handler runs
+	spec := newSpec(config)
+	router.Use(openapi.ValidateParameters(spec, ""))
+
+	// v1 is deprecated in favour of v2, the routes without prefix are checked against the v1 operations
+	deprecateV1 := deprecated(v1Deprecation, v1Sunset, v2Prefix)
+	routeV1(router.Group("", deprecateV1, openapi.ValidateParameters(spec, v1Prefix)), collections, config, require)
+	routeV1(router.Group(v1Prefix, deprecateV1), collections, config, require)
+	routeV2(router.Group(v2Prefix), collections, config, require)
+
+	// The API description is open to every caller
+	router.GET(openAPIPath, openapi.Handler(spec))
+	router.GET(docsPath, openapi.DocsHandler(openAPIPath))
+	if config.metrics != nil {
+		router.GET(metrics.Path, config.metrics.Handler())
+	}
+
+	// pprof and the configuration aren't for everyone, the debug surface needs authentication
+	if authentication != nil {
+		routeDebug(router, collections, config, require)
+	}
 
 	return router
 }
+
+// observeStore reports the size of the store in the metrics, when the collections can tell it
+func observeStore(m *metrics.Metrics, store collections.Collections) {
+	sized, ok := store.(collections.Sized)
+	if !ok {
+		return
+	}
+	m.ObserveStore(func() metrics.StoreSize {
+		stats := sized.Stats()
+		return metrics.StoreSize{Orders: stats.Orders, Customers: stats.Customers}
+	})
+}
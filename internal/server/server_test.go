@@ -2,14 +2,30 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"qlikOrders/internal/auth"
 	"qlikOrders/internal/collections"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/metrics"
 	"qlikOrders/internal/models"
+	"qlikOrders/internal/rpc"
+	"qlikOrders/internal/tracing"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 type summariesResponse struct {
@@ -116,3 +132,281 @@ func TestNewServer(t *testing.T) {
 		}
 	})
 }
+
+func TestNewServerWithAPIKeys(t *testing.T) {
+	keyStore := auth.NewMemoryKeyStore(
+		auth.APIKey{ID: "1", Name: "admin", Hash: auth.HashKey("admin-secret"), Scopes: []string{auth.ScopeKeysAdmin}},
+		auth.APIKey{ID: "2", Name: "reader", Hash: auth.HashKey("reader-secret"), Scopes: []string{auth.ScopeSummaryRead}},
+	)
+	server := NewServer(&collections.OrderCollection{}, WithAPIKeys(keyStore))
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		key          string
+		expectedCode int
+	}{
+		{name: "Summary without key", method: "GET", path: "/summary", expectedCode: http.StatusUnauthorized},
+		{name: "Summary with reader key", method: "GET", path: "/summary", key: "reader-secret", expectedCode: http.StatusOK},
+		{name: "Orders with reader key", method: "POST", path: "/orders", key: "reader-secret", expectedCode: http.StatusForbidden},
+		{name: "Keys with reader key", method: "GET", path: "/admin/keys", key: "reader-secret", expectedCode: http.StatusForbidden},
+		{name: "Keys with admin key", method: "GET", path: "/admin/keys", key: "admin-secret", expectedCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestNewServerWithJWT(t *testing.T) {
+	secret := []byte("test-secret-test-secret-test-sec")
+	jwtAuth, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+		Keys:     map[string]any{"default": secret},
+		Issuer:   "https://issuer.test",
+		Audience: "qlik-orders",
+	})
+	assert.NoError(t, err)
+	server := NewServer(&collections.OrderCollection{}, WithJWT(jwtAuth))
+
+	token := func(role string) string {
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":   "user-1",
+			"iss":   "https://issuer.test",
+			"aud":   "qlik-orders",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": []string{role},
+		}).SignedString(secret)
+		return signed
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		role         string
+		expectedCode int
+	}{
+		{name: "Summary without token", method: "GET", path: "/summary", expectedCode: http.StatusUnauthorized},
+		{name: "Summary as reader", method: "GET", path: "/summary", role: "reader", expectedCode: http.StatusOK},
+		{name: "Orders as reader", method: "POST", path: "/orders", role: "reader", expectedCode: http.StatusForbidden},
+		{name: "Orders as writer", method: "POST", path: "/orders", role: "writer", expectedCode: http.StatusBadRequest},
+		{name: "Summary as writer", method: "GET", path: "/summary", role: "writer", expectedCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.role != "" {
+				req.Header.Set("Authorization", "Bearer "+token(tt.role))
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			// A writer passes authentication, the empty body is then rejected by the handler
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestGraphQLScopes(t *testing.T) {
+	keyStore := auth.NewMemoryKeyStore(
+		auth.APIKey{ID: "1", Name: "customers", Hash: auth.HashKey("customers-secret"), Scopes: []string{auth.ScopeCustomersRead}},
+		auth.APIKey{ID: "2", Name: "dashboard", Hash: auth.HashKey("dashboard-secret"), Scopes: []string{auth.ScopeCustomersRead, auth.ScopeSummaryRead}},
+	)
+	testCollection := &collections.OrderCollection{Orders: []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}}},
+	}}
+	server := NewServer(testCollection, WithAPIKeys(keyStore))
+
+	query := func(key, query string) (int, string) {
+		payload, _ := json.Marshal(map[string]string{"query": query})
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	code, _ := query("", `{ customer(id: "01") { id } }`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, body := query("customers-secret", `{ customer(id: "01") { id items { total } } }`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"data": {"customer": {"id": "01", "items": {"total": 1}}}}`, body)
+
+	// Summaries need summary:read on top of the route's scope
+	code, body = query("customers-secret", `{ customer(id: "01") { summary { totalAmountEur } } }`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "missing required scope summary:read")
+
+	code, body = query("dashboard-secret", `{ customer(id: "01") { summary { totalAmountEur } } }`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"data": {"customer": {"summary": {"totalAmountEur": 2}}}}`, body)
+}
+
+func TestNewServerWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	keyStore := auth.NewMemoryKeyStore(auth.APIKey{ID: "1", Name: "reader", Hash: auth.HashKey("reader-secret"), Scopes: []string{auth.ScopeSummaryRead}})
+	server := NewServer(versionsCollection(), WithAPIKeys(keyStore), WithLogger(logging.New(&buf, logging.Config{RedactCustomerIDs: true, RedactionKey: []byte("key")})))
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedBody string
+	}{
+		// v1 error bodies stay byte-compatible, v2 ones carry the request ID
+		{name: "v1", path: "/v1/summary", expectedBody: `{"error":"Unauthorized"}`},
+		{name: "v2", path: "/v2/summary", expectedBody: `{"requestId":"req-1","error":"Unauthorized"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(logging.Header, "req-1")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, "req-1", w.Header().Get(logging.Header))
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			assert.Contains(t, buf.String(), `"requestId":"req-1"`)
+		})
+	}
+
+	t.Run("Customer IDs are redacted", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/customer/01/summary", nil)
+		req.Header.Set("X-API-Key", "reader-secret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, buf.String(), `"customerId":"`+logging.Redact([]byte("key"), "01")+`"`)
+		assert.NotContains(t, buf.String(), `"customerId":"01"`)
+	})
+}
+
+func TestNewServerWithMetrics(t *testing.T) {
+	appMetrics := metrics.New()
+	collection := &collections.OrderCollection{Metrics: appMetrics}
+	server := NewServer(collection, WithMetrics(appMetrics))
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusCreated, post(`[
+		{"customerId": "01", "orderId": "50", "timestamp": "1637245070513", "items": [{"itemId": "20201", "costEur": 2}, {"itemId": "20202", "costEur": 3}]},
+		{"customerId": "02", "orderId": "51", "timestamp": "1637245070513", "items": [{"itemId": "20201", "costEur": 2}]}
+	]`))
+	assert.Equal(t, http.StatusBadRequest, post(`[{"orderId": "52", "timestamp": "1637245070513", "items": [{"itemId": "20201", "costEur": 0}]}]`))
+	assert.Equal(t, http.StatusBadRequest, post(`not json`))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, metrics.Path, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, line := range []string{
+		`qlikorders_http_requests_total{method="POST",route="/v1/orders",status="201"} 1`,
+		`qlikorders_http_requests_total{method="POST",route="/v1/orders",status="400"} 2`,
+		`qlikorders_orders_ingested_total 2`,
+		`qlikorders_items_ingested_total 3`,
+		`qlikorders_batch_size_orders_count 1`,
+		`qlikorders_validation_failures_total{reason="required"} 1`,
+		`qlikorders_validation_failures_total{reason="gt"} 1`,
+		`qlikorders_validation_failures_total{reason="malformed_body"} 1`,
+		`qlikorders_store_orders 2`,
+		`qlikorders_store_customers 2`,
+		`qlikorders_collection_mutex_wait_seconds_count`,
+	} {
+		assert.Contains(t, w.Body.String(), line)
+	}
+}
+
+func TestNewServerWithTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	collection := &collections.OrderCollection{}
+
+	t.Run("HTTP", func(t *testing.T) {
+		server := NewServer(collection, WithTracing(provider))
+		req := httptest.NewRequest(http.MethodPost, "/v2/orders", bytes.NewBufferString(`[
+			{"customerId": "01", "orderId": "50", "timestamp": "1637245070513", "currency": "EUR", "lines": [{"itemId": "20201", "quantity": 2, "unitPriceMinor": 200}]}
+		]`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		// The handler's span is a child of the caller's, the spans of validation and storage are children of the handler's
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended() {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+			spans[span.Name()] = span
+		}
+		require.Contains(t, spans, "/v2/orders")
+		handler := spans["/v2/orders"]
+		assert.Equal(t, "00f067aa0ba902b7", handler.Parent().SpanID().String())
+		for _, name := range []string{"order.decode", "order.validate", "Collections.AddOrders"} {
+			require.Contains(t, spans, name)
+			assert.Equal(t, handler.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+		}
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		listener := bufconn.Listen(1 << 20)
+		grpcServer := NewGRPCServer(collection, WithTracing(provider))
+		go grpcServer.Serve(listener)
+		t.Cleanup(grpcServer.Stop)
+
+		conn, err := grpc.NewClient("passthrough:///bufconn",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			tracing.DialOption(provider),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		// The outbound call carries the trace to the server
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "caller")
+		_, err = rpc.NewClient(conn).GetCustomerSummaries(ctx, &rpc.SummariesRequest{})
+		require.NoError(t, err)
+		parent.End()
+
+		kinds := map[trace.SpanKind]sdktrace.ReadOnlySpan{}
+		var store sdktrace.ReadOnlySpan
+		for _, span := range recorder.Ended() {
+			if span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+				continue
+			}
+			kinds[span.SpanKind()] = span
+			if span.Name() == "Collections.GetAllCustomerSummaries" {
+				store = span
+			}
+		}
+		require.Contains(t, kinds, trace.SpanKindClient)
+		require.Contains(t, kinds, trace.SpanKindServer)
+		assert.Equal(t, kinds[trace.SpanKindClient].SpanContext().SpanID(), kinds[trace.SpanKindServer].Parent().SpanID())
+		require.NotNil(t, store)
+		assert.Equal(t, kinds[trace.SpanKindServer].SpanContext().SpanID(), store.Parent().SpanID())
+	})
+}
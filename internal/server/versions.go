@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/service/customer"
+	"qlikOrders/internal/service/graph"
+	"qlikOrders/internal/service/item"
+	"qlikOrders/internal/service/job"
+	"qlikOrders/internal/service/keys"
+	"qlikOrders/internal/service/order"
+	"qlikOrders/internal/service/privacy"
+	"qlikOrders/internal/service/report"
+	"qlikOrders/internal/service/summary"
+	v2 "qlikOrders/internal/service/v2"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prefixes of the API versions, v1 is also served without a prefix for the integrators predating versioning
+const (
+	v1Prefix = "/v1"
+	v2Prefix = "/v2"
+)
+
+var (
+	// v1Deprecation is when v1 was deprecated in favour of v2
+	v1Deprecation = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	// v1Sunset is when v1 stops being served
+	v1Sunset = time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// deprecated announces on every response that the version is deprecated since at and removed at sunset,
+// with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers and a link to the version replacing it
+func deprecated(at, sunset time.Time, successor string) gin.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(at.Unix(), 10)
+	sunsetDate := sunset.Format(http.TimeFormat)
+	link := "<" + successor + `>; rel="successor-version"`
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunsetDate)
+		c.Header("Link", link)
+		c.Next()
+	}
+}
+
+// routeV1 registers the v1 routes, whose payloads are the models as stored
+func routeV1(group *gin.RouterGroup, collections collections.Collections, config *options, require func(string) gin.HandlerFunc) {
+	audited := config.recordAudit()
+	group.POST("/orders", audited, require(auth.ScopeOrdersWrite), order.AddOrdersHandler(collections))
+	group.GET("/orders", require(auth.ScopeCustomersRead), order.GetOrdersHandler(collections))
+	group.POST("/orders/import", audited, require(auth.ScopeOrdersWrite), order.ImportOrdersHandler(collections))
+	group.GET("/customer/:customerId/items", require(auth.ScopeCustomersRead), customer.GetItemsByCustomerHandler(collections))
+	group.GET("/summary", require(auth.ScopeSummaryRead), summary.GetSummariesHandler(collections))
+	group.GET("/customer/:customerId/summary", require(auth.ScopeSummaryRead), summary.GetCustomerSummaryHandler(collections))
+	group.GET("/customers/:customerId/export", require(auth.ScopeCustomersRead), privacy.ExportCustomerHandler(collections))
+	group.DELETE("/customers/:customerId/data", audited, require(auth.ScopeCustomersErase), privacy.EraseCustomerHandler(collections))
+	group.GET("/customers/erasures", require(auth.ScopeCustomersErase), privacy.ListErasuresHandler(collections))
+	group.GET("/reports/cohorts", require(auth.ScopeReportsRead), report.GetCohortsHandler(collections))
+	group.GET("/reports/rfm", require(auth.ScopeReportsRead), report.GetRFMHandler(collections))
+	group.GET("/items/:itemId/related", require(auth.ScopeReportsRead), item.GetRelatedItemsHandler(collections))
+
+	// Summaries resolved by GraphQL queries also require summary:read
+	graphQL := graph.Handler(collections)
+	group.GET("/graphql", require(auth.ScopeCustomersRead), graphQL)
+	group.POST("/graphql", require(auth.ScopeCustomersRead), graphQL)
+
+	// Import jobs are only available when a job manager is configured
+	if config.jobs != nil {
+		group.POST("/jobs/import", audited, require(auth.ScopeOrdersWrite), job.CreateImportJobHandler(config.jobs))
+		group.GET("/jobs/:jobId", require(auth.ScopeOrdersWrite), job.GetJobHandler(config.jobs))
+		group.POST("/jobs/:jobId/cancel", audited, require(auth.ScopeOrdersWrite), job.CancelJobHandler(config.jobs))
+	}
+
+	routeKeys(group, config, require)
+	routeAudit(group, config, require)
+}
+
+// routeV2 registers the v2 routes. Routes without money or items in their payloads serve the v1 handlers,
+// imports, jobs and GraphQL keep the v1 payloads and are only served by v1.
+func routeV2(group *gin.RouterGroup, collections collections.Collections, config *options, require func(string) gin.HandlerFunc) {
+	audited := config.recordAudit()
+	group.POST("/orders", audited, require(auth.ScopeOrdersWrite), v2.AddOrdersHandler(collections))
+	group.GET("/orders", require(auth.ScopeCustomersRead), v2.GetOrdersHandler(collections))
+	group.GET("/customer/:customerId/items", require(auth.ScopeCustomersRead), v2.GetItemsByCustomerHandler(collections))
+	group.GET("/summary", require(auth.ScopeSummaryRead), v2.GetSummariesHandler(collections))
+	group.GET("/customer/:customerId/summary", require(auth.ScopeSummaryRead), v2.GetCustomerSummaryHandler(collections))
+	group.GET("/customers/:customerId/export", require(auth.ScopeCustomersRead), v2.ExportCustomerHandler(collections))
+	group.DELETE("/customers/:customerId/data", audited, require(auth.ScopeCustomersErase), privacy.EraseCustomerHandler(collections))
+	group.GET("/customers/erasures", require(auth.ScopeCustomersErase), privacy.ListErasuresHandler(collections))
+	group.GET("/reports/cohorts", require(auth.ScopeReportsRead), v2.GetCohortsHandler(collections))
+	group.GET("/reports/rfm", require(auth.ScopeReportsRead), v2.GetRFMHandler(collections))
+	group.GET("/items/:itemId/related", require(auth.ScopeReportsRead), item.GetRelatedItemsHandler(collections))
+
+	routeKeys(group, config, require)
+	routeAudit(group, config, require)
+}
+
+// routeKeys registers key management, only available when API keys are configured
+func routeKeys(group *gin.RouterGroup, config *options, require func(string) gin.HandlerFunc) {
+	if config.keyStore != nil {
+		audited := config.recordAudit()
+		group.POST("/admin/keys", audited, require(auth.ScopeKeysAdmin), keys.CreateKeyHandler(config.keyStore))
+		group.GET("/admin/keys", require(auth.ScopeKeysAdmin), keys.ListKeysHandler(config.keyStore))
+		group.DELETE("/admin/keys/:keyId", audited, require(auth.ScopeKeysAdmin), keys.DeleteKeyHandler(config.keyStore))
+	}
+}
+
+// routeAudit registers the audit log, only available when an audit sink is configured
+func routeAudit(group *gin.RouterGroup, config *options, require func(string) gin.HandlerFunc) {
+	if config.auditSink != nil {
+		group.GET("/audit", require(auth.ScopeAuditRead), audit.Handler(config.auditSink))
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func versionsCollection() *collections.OrderCollection {
+	return &collections.OrderCollection{Orders: []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+		{CustomerID: "01", OrderID: "51", Timestamp: "1640995200000", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+		{CustomerID: "02", OrderID: "52", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20203", CostEur: 4}}},
+		{CustomerID: "03", OrderID: "53", Timestamp: "1643673600000", Items: []models.Item{{ItemID: "20202", CostEur: 3}}},
+	}}
+}
+
+// compatRequest is a v1 request whose response is recorded in testdata/v1
+type compatRequest struct {
+	name    string
+	method  string
+	path    string
+	headers map[string]string
+	body    string
+}
+
+var v1Requests = []compatRequest{
+	{name: "orders", method: "GET", path: "/orders"},
+	{name: "orders-csv", method: "GET", path: "/orders?customerId=01&format=csv"},
+	{name: "orders-ndjson", method: "GET", path: "/orders?format=ndjson"},
+	{name: "items", method: "GET", path: "/customer/01/items"},
+	{name: "items-grouped", method: "GET", path: "/customer/01/items?groupBy=item&expand=order&limit=1&offset=1"},
+	{name: "items-not-found", method: "GET", path: "/customer/99/items"},
+	{name: "items-invalid", method: "GET", path: "/customer/01/items?limit=-1"},
+	{name: "summaries", method: "GET", path: "/summary"},
+	{name: "summaries-msgpack", method: "GET", path: "/summary", headers: map[string]string{"Accept": "application/msgpack"}},
+	{name: "summary", method: "GET", path: "/customer/01/summary"},
+	{name: "export", method: "GET", path: "/customers/01/export"},
+	{name: "erase", method: "DELETE", path: "/customers/02/data?mode=pseudonymize"},
+	{name: "cohorts", method: "GET", path: "/reports/cohorts?months=2"},
+	{name: "rfm", method: "GET", path: "/reports/rfm"},
+	{name: "related", method: "GET", path: "/items/20201/related"},
+	{name: "add-orders", method: "POST", path: "/orders", body: `[{"customerId":"04","orderId":"60","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}]`},
+	{name: "add-orders-invalid", method: "POST", path: "/orders", body: `[{"customerId":"04","orderId":"60","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":0}]}]`},
+	{name: "import", method: "POST", path: "/orders/import?format=ndjson", body: "{\"customerId\":\"04\",\"orderId\":\"60\",\"timestamp\":\"1637245070513\",\"items\":[{\"itemId\":\"20201\",\"costEur\":2}]}\nnot json\n"},
+	{name: "graphql", method: "POST", path: "/graphql", body: `{"query":"{ customer(id: \"01\") { summary { totalAmountEur } items(limit: 2) { total nodes { itemId costEur } } } }"}`},
+}
+
+// timeDependent masks the values depending on the current time or randomness, the rest of a response is compared byte for byte
+var timeDependent = regexp.MustCompile(`"(daysSinceLastOrder|recency|exportedAt|erasedAt|erasureId)":("[^"]*"|\d+)`)
+
+func serveCompat(t *testing.T, prefix string, req compatRequest) []byte {
+	server := NewServer(versionsCollection())
+
+	r := httptest.NewRequest(req.method, prefix+req.path, strings.NewReader(req.body))
+	r.Header.Set("Content-Type", "application/json")
+	for name, value := range req.headers {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	var recorded bytes.Buffer
+	fmt.Fprintf(&recorded, "%d %s\n\n", w.Code, w.Header().Get("Content-Type"))
+	recorded.Write(timeDependent.ReplaceAll(w.Body.Bytes(), []byte(`"$1":"<masked>"`)))
+	return recorded.Bytes()
+}
+
+// TestV1Compatibility fails when a v1 response changes, testdata/v1 holds the responses from before versioning.
+// They are served the same with and without the /v1 prefix. Run with -update only for deliberate changes to v1.
+func TestV1Compatibility(t *testing.T) {
+	for _, prefix := range []string{"", v1Prefix} {
+		for _, req := range v1Requests {
+			t.Run(prefix+req.path, func(t *testing.T) {
+				golden := filepath.Join("testdata", "v1", req.name+".golden")
+				actual := serveCompat(t, prefix, req)
+				if *update && prefix == "" {
+					require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+					require.NoError(t, os.WriteFile(golden, actual, 0o644))
+				}
+
+				expected, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				assert.Equal(t, string(expected), string(actual))
+			})
+		}
+	}
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	server := NewServer(versionsCollection())
+
+	tests := []struct {
+		path       string
+		deprecated bool
+	}{
+		{"/summary", true},
+		{"/v1/summary", true},
+		{"/v1/customer/99/items", true},
+		{"/v2/summary", false},
+		{"/openapi.json", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if !tt.deprecated {
+				assert.Empty(t, w.Header().Get("Deprecation"))
+				assert.Empty(t, w.Header().Get("Sunset"))
+				return
+			}
+			assert.Equal(t, "@1793491200", w.Header().Get("Deprecation"))
+			assert.Equal(t, "Sat, 01 May 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+			assert.Equal(t, `</v2>; rel="successor-version"`, w.Header().Get("Link"))
+		})
+	}
+}
+
+// TestVersionsShareRateLimits alternates the versions of a route, they count against the same limit
+func TestVersionsShareRateLimits(t *testing.T) {
+	limiter := &ratelimit.Limiter{
+		Store:  ratelimit.NewMemoryStore(),
+		Routes: map[string]ratelimit.Limit{"POST /orders": {Requests: 3, Period: time.Minute}},
+	}
+	server := NewServer(versionsCollection(), WithRateLimit(limiter))
+
+	codes := []int{}
+	for _, prefix := range []string{"", v1Prefix, v2Prefix, v1Prefix} {
+		r := httptest.NewRequest(http.MethodPost, prefix+"/orders", strings.NewReader(`[]`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+	assert.NotContains(t, codes[:3], http.StatusTooManyRequests)
+	assert.Equal(t, http.StatusTooManyRequests, codes[3])
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	serve := func(server http.Handler, forwardedFor string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v2/summary", nil)
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+	newLimiter := func() *ratelimit.Limiter {
+		return &ratelimit.Limiter{Store: ratelimit.NewMemoryStore(), Default: ratelimit.Limit{Requests: 1, Period: time.Minute}}
+	}
+
+	// Rotating the header doesn't get a fresh bucket
+	server := NewServer(versionsCollection(), WithRateLimit(newLimiter()))
+	assert.Equal(t, http.StatusOK, serve(server, "203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(server, "203.0.113.2"))
+
+	// Behind a trusted proxy, the addresses it forwards are limited apart
+	proxies, err := ParseTrustedProxies("192.0.2.0/24, 10.0.0.1")
+	require.NoError(t, err)
+	server = NewServer(versionsCollection(), WithRateLimit(newLimiter()), WithTrustedProxies(proxies))
+	assert.Equal(t, http.StatusOK, serve(server, "203.0.113.1"))
+	assert.Equal(t, http.StatusOK, serve(server, "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(server, "203.0.113.2"))
+
+	_, err = ParseTrustedProxies("10.0.0.1,proxy.internal")
+	assert.Error(t, err)
+}
+
+// TestV2 checks v2 serves the orders stored through v1 and the other way around
+func TestV2(t *testing.T) {
+	server := NewServer(versionsCollection())
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/v2/orders", `[{"customerId":"04","orderId":"60","timestamp":"1637245070513","currency":"EUR","lines":[{"itemId":"20201","quantity":2,"unitPriceMinor":200}]}]`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = serve(http.MethodGet, "/v1/customer/04/summary", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"nbrOfPurchasedItems":2,"totalAmountEur":4`)
+
+	w = serve(http.MethodGet, "/v2/customer/01/summary", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"customerId":"01","quantity":4,"totalMinor":1200,"currency":"EUR"`)
+
+	w = serve(http.MethodGet, "/v2/reports/cohorts?months=0", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"cohorts":[
+		{"cohort":"2021-11","customers":3,"repeatPurchaseRate":0.3333,"totalMinor":2200,"currency":"EUR","months":[
+			{"offset":0,"month":"2021-11","activeCustomers":3,"retentionRate":1,"amountMinor":1700,"cumulativeAmountMinor":1700}]},
+		{"cohort":"2022-02","customers":1,"repeatPurchaseRate":0,"totalMinor":300,"currency":"EUR","months":[
+			{"offset":0,"month":"2022-02","activeCustomers":1,"retentionRate":1,"amountMinor":300,"cumulativeAmountMinor":300}]}]}`, w.Body.String())
+
+	// Queries are checked against the v2 operations
+	w = serve(http.MethodGet, "/v2/customer/01/items?limit=-1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Imports and GraphQL keep the v1 payloads and aren't served by v2
+	w = serve(http.MethodPost, "/v2/graphql", `{"query":"{ customers { customerId } }"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,24 +1,197 @@
 package customer
 
 import (
+	"errors"
 	"net/http"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
 	"qlikOrders/internal/collections"
+	"qlikOrders/internal/export"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"slices"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
+// ItemsQuery holds the query parameters of the customer items endpoint, shared by every API version
+type ItemsQuery struct {
+	GroupByItem bool
+	ExpandOrder bool
+	Limit       int // 0 returns every item
+	Offset      int
+}
+
 // GetItemsByCustomerHandler
-// Retrieves list of items for a specific customer
-func GetItemsByCustomerHandler(collections *collections.OrderCollection) gin.HandlerFunc {
+// Retrieves list of items for a specific customer.
+// ?groupBy=item aggregates the purchases per item, ?expand=order adds the order of every purchase,
+// ?limit= and ?offset= page through the result.
+// The page is sent in JSON, MessagePack or Protobuf, or the items are exported as CSV, NDJSON or Parquet,
+// depending on the Accept header or ?format=.
+func GetItemsByCustomerHandler(collections collections.Collections) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		customerID := c.Param("customerId")
-		items, err := collections.GetItemsByCustomer(customerID)
+		store := tracing.Store(c.Request.Context(), collections)
+		query, ok := ParseItemsQuery(c)
+		if !ok {
+			codec.Render(c, http.StatusBadRequest, codec.Status{Error: "Invalid input"})
+			return
+		}
+
+		format, err := codec.Negotiate(c.Query("format"), c.GetHeader("Accept"), codec.ExportFormats...)
+		if err != nil {
+			codec.Render(c, http.StatusNotAcceptable, codec.Status{Error: "Not acceptable", Message: "Supported formats are json, msgpack, protobuf, csv, ndjson and parquet"})
+			return
+		}
 
+		customerID := c.Param("customerId")
+		orders, err := store.GetOrdersByCustomer(tenant.FromContext(c), customerID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			writeLookupError(c, format, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"items": items})
+		if query.GroupByItem {
+			renderItems(c, format, GroupByItem(orders, query.ExpandOrder), query)
+			return
+		}
+		renderItems(c, format, FlattenItems(orders, query.ExpandOrder), query)
+	}
+}
+
+// writeLookupError renders unknown customers as 404, other store errors as 500 without their message
+func writeLookupError(c *gin.Context, format codec.Format, err error) {
+	if errors.Is(err, collections.ErrCustomerNotFound) {
+		codec.RenderAs(c, http.StatusNotFound, format, codec.Status{Error: err.Error()})
+		return
+	}
+	_ = c.Error(err)
+	codec.RenderAs(c, http.StatusInternalServerError, format, codec.Status{Error: "Failed to retrieve items"})
+}
+
+// itemPage is a page of customer items, a CustomerItemPage or ItemHistoryPage in protobuf
+type itemPage[T protobuf.Message] struct {
+	Items  []T `json:"items"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
+
+func (p itemPage[T]) AppendProto(b []byte) []byte {
+	b = protobuf.AppendMessages(b, 1, p.Items)
+	b = protobuf.AppendInt(b, 2, p.Limit)
+	b = protobuf.AppendInt(b, 3, p.Offset)
+	return protobuf.AppendInt(b, 4, p.Total)
+}
+
+func renderItems[T protobuf.Message](c *gin.Context, format codec.Format, items []T, query ItemsQuery) {
+	if format.IsExport() {
+		c.Header("X-Total-Count", strconv.Itoa(len(items)))
+		if err := export.Stream(c.Writer, format, "items", slices.Values(Paginate(items, query.Limit, query.Offset))); err != nil {
+			// The response already started, the error is only logged
+			_ = c.Error(err)
+		}
+		return
+	}
+	codec.RenderAs(c, http.StatusOK, format, itemPage[T]{
+		Items:  Paginate(items, query.Limit, query.Offset),
+		Limit:  query.Limit,
+		Offset: query.Offset,
+		Total:  len(items),
+	})
+}
+
+// ParseItemsQuery reads the grouping, expansion and pagination of an items request, false when one is invalid
+func ParseItemsQuery(c *gin.Context) (ItemsQuery, bool) {
+	var query ItemsQuery
+
+	switch c.Query("groupBy") {
+	case "":
+	case "item":
+		query.GroupByItem = true
+	default:
+		return query, false
+	}
+
+	switch c.Query("expand") {
+	case "":
+	case "order":
+		query.ExpandOrder = true
+	default:
+		return query, false
+	}
+
+	var err error
+	if query.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil || query.Limit < 0 {
+		return query, false
+	}
+	if query.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || query.Offset < 0 {
+		return query, false
+	}
+	return query, true
+}
+
+// FlattenItems lists every purchased unit in the order it was bought
+func FlattenItems(orders []models.Order, expandOrder bool) []models.CustomerItem {
+	items := []models.CustomerItem{}
+	for _, order := range orders {
+		for _, item := range order.Items {
+			customerItem := models.CustomerItem{
+				CustomerID: order.CustomerID,
+				ItemID:     item.ItemID,
+				CostEur:    item.CostEur,
+			}
+			if expandOrder {
+				customerItem.OrderID = order.OrderID
+				customerItem.Timestamp = order.Timestamp
+			}
+			items = append(items, customerItem)
+		}
+	}
+	return items
+}
+
+// GroupByItem aggregates the purchases per item, ordered by when the item was first bought
+func GroupByItem(orders []models.Order, expandOrder bool) []models.ItemHistory {
+	// Orders are stored in the order they were received, sort so first and last purchase are right
+	slices.SortStableFunc(orders, func(a, b models.Order) int {
+		at, _ := a.Time()
+		bt, _ := b.Time()
+		return at.Compare(bt)
+	})
+
+	history := []models.ItemHistory{}
+	index := make(map[string]int)
+	for _, order := range orders {
+		for _, item := range order.Items {
+			i, ok := index[item.ItemID]
+			if !ok {
+				i = len(history)
+				index[item.ItemID] = i
+				history = append(history, models.ItemHistory{ItemID: item.ItemID, FirstPurchasedAt: order.Timestamp})
+			}
+
+			entry := &history[i]
+			entry.Units++
+			entry.TotalAmountEur += item.CostEur
+			entry.LastPurchasedAt = order.Timestamp
+			if expandOrder && !slices.Contains(entry.OrderIDs, order.OrderID) {
+				entry.OrderIDs = append(entry.OrderIDs, order.OrderID)
+			}
+		}
+	}
+	return history
+}
+
+// Paginate returns the page of entries starting at offset, a limit of 0 returns every entry past the offset
+func Paginate[T any](entries []T, limit, offset int) []T {
+	if offset >= len(entries) {
+		return []T{}
+	}
+	entries = entries[offset:]
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
 	}
+	return entries
 }
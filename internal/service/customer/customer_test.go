@@ -2,14 +2,18 @@ package customer
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
 	"qlikOrders/internal/collections"
 	"qlikOrders/internal/models"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetItemsByCustomerHandler(t *testing.T) {
@@ -72,3 +76,250 @@ func TestGetItemsByCustomerHandler(t *testing.T) {
 		assert.Equal(t, "customer not found or no items", response.Error)
 	})
 }
+
+// failingCollection fails every lookup of orders with err
+type failingCollection struct {
+	*collections.OrderCollection
+	err error
+}
+
+func (f failingCollection) GetOrdersByCustomer(string, string) ([]models.Order, error) {
+	return nil, f.err
+}
+
+func TestGetItemsByCustomerHandlerStoreError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/customer/:customerId/items", GetItemsByCustomerHandler(failingCollection{&collections.OrderCollection{}, errors.New("database is locked")}))
+
+	req, _ := http.NewRequest("GET", "/customer/01/items", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Store failures aren't reported as unknown customers, and the driver's message isn't sent
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to retrieve items"}`, w.Body.String())
+}
+
+func TestGetItemsByCustomerHandlerHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Orders are received out of order on purpose
+	testCollection := &collections.OrderCollection{
+		Orders: []models.Order{
+			{CustomerID: "01", OrderID: "52", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "20201", CostEur: 3}}},
+			{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20201", CostEur: 2}}},
+			{CustomerID: "01", OrderID: "51", Timestamp: "1637245070523", Items: []models.Item{{ItemID: "20202", CostEur: 5}}},
+		},
+	}
+	router.GET("/customer/:customerId/items", GetItemsByCustomerHandler(testCollection))
+
+	t.Run("Group by item", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customer/01/items?groupBy=item&expand=order", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Items []models.ItemHistory `json:"items"`
+			Total int                  `json:"total"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, response.Total)
+		assert.Equal(t, []models.ItemHistory{
+			{ItemID: "20201", Units: 3, TotalAmountEur: 7, FirstPurchasedAt: "1637245070513", LastPurchasedAt: "1637245070533", OrderIDs: []string{"50", "52"}},
+			{ItemID: "20202", Units: 1, TotalAmountEur: 5, FirstPurchasedAt: "1637245070523", LastPurchasedAt: "1637245070523", OrderIDs: []string{"51"}},
+		}, response.Items)
+	})
+
+	t.Run("Expand order with pagination", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customer/01/items?expand=order&limit=2&offset=1", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Items  []models.CustomerItem `json:"items"`
+			Total  int                   `json:"total"`
+			Limit  int                   `json:"limit"`
+			Offset int                   `json:"offset"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, response.Total)
+		assert.Equal(t, 2, response.Limit)
+		assert.Equal(t, 1, response.Offset)
+		assert.Equal(t, []models.CustomerItem{
+			{CustomerID: "01", ItemID: "20201", CostEur: 2, OrderID: "50", Timestamp: "1637245070513"},
+			{CustomerID: "01", ItemID: "20201", CostEur: 2, OrderID: "50", Timestamp: "1637245070513"},
+		}, response.Items)
+	})
+
+	t.Run("Offset past the end", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customer/01/items?offset=10", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"items":[]`)
+	})
+
+	t.Run("Invalid query", func(t *testing.T) {
+		for _, query := range []string{"groupBy=order", "expand=customer", "limit=-1", "offset=abc"} {
+			req, _ := http.NewRequest("GET", "/customer/01/items?"+query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+}
+
+func TestGetItemsByCustomerHandlerExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	testCollection := &collections.OrderCollection{Orders: []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+		{CustomerID: "01", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20201", CostEur: 2}}},
+	}}
+	router.GET("/customer/:customerId/items", GetItemsByCustomerHandler(testCollection))
+
+	tests := []struct {
+		name         string
+		target       string
+		accept       string
+		expectedCode int
+		expectedBody string
+		total        string
+	}{
+		{
+			name:         "CSV",
+			target:       "/customer/01/items?limit=2",
+			accept:       "text/csv",
+			expectedCode: http.StatusOK,
+			expectedBody: "customerId,itemId,costEur,orderId,timestamp\n01,20201,2,,\n01,20202,3,,\n",
+			total:        "3",
+		},
+		{
+			name:         "CSV grouped by item with orders",
+			target:       "/customer/01/items?groupBy=item&expand=order",
+			accept:       "text/csv",
+			expectedCode: http.StatusOK,
+			expectedBody: "itemId,units,totalAmountEur,firstPurchasedAt,lastPurchasedAt,orderIds\n" +
+				"20201,2,4,1637245070513,1637245070514,50;51\n" +
+				"20202,1,3,1637245070513,1637245070513,50\n",
+			total: "2",
+		},
+		{
+			name:         "NDJSON with offset",
+			target:       "/customer/01/items?offset=2&format=ndjson",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"customerId":"01","itemId":"20201","costEur":2}` + "\n",
+			total:        "3",
+		},
+		{
+			name:         "Not acceptable",
+			target:       "/customer/01/items",
+			accept:       "text/html",
+			expectedCode: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.target, nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+				assert.Equal(t, tt.total, w.Header().Get("X-Total-Count"))
+			}
+		})
+	}
+}
+
+// customerItemPage decodes a CustomerItemPage
+type customerItemPage struct {
+	Items  []models.CustomerItem `json:"items"`
+	Limit  int                   `json:"limit"`
+	Offset int                   `json:"offset"`
+	Total  int                   `json:"total"`
+}
+
+func (p *customerItemPage) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			var item models.CustomerItem
+			r.Message(&item)
+			p.Items = append(p.Items, item)
+		case 2:
+			p.Limit = r.Int()
+		case 3:
+			p.Offset = r.Int()
+		case 4:
+			p.Total = r.Int()
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func TestGetItemsByCustomerHandlerFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	testCollection := &collections.OrderCollection{
+		Orders: []models.Order{
+			{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+			{CustomerID: "01", OrderID: "51", Timestamp: "1637245070523", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+		},
+	}
+	router.GET("/customer/:customerId/items", GetItemsByCustomerHandler(testCollection))
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/customer/01/items?expand=order&limit=2&offset=1", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var expected customerItemPage
+	w := get("application/json")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expected))
+	require.Len(t, expected.Items, 2)
+
+	for _, format := range []codec.Format{codec.FormatMsgPack, codec.FormatProtobuf} {
+		w := get(format.ContentType())
+		require.Equal(t, http.StatusOK, w.Code, format)
+		assert.Equal(t, format.ContentType(), w.Header().Get("Content-Type"))
+
+		var decoded customerItemPage
+		require.NoError(t, codec.Unmarshal(format, w.Body.Bytes(), &decoded), format)
+		assert.Equal(t, expected, decoded, format)
+	}
+
+	t.Run("Errors in the accepted format", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customer/01/items?limit=-1", nil)
+		req.Header.Set("Accept", "application/msgpack")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var status codec.Status
+		require.NoError(t, codec.Unmarshal(codec.FormatMsgPack, w.Body.Bytes(), &status))
+		assert.Equal(t, "Invalid input", status.Error)
+	})
+}
@@ -0,0 +1,117 @@
+// Package graph serves a GraphQL API over the orders, customer items and summaries of the Collections,
+// letting dashboards fetch a customer, their items and summary in a single round trip.
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// MaxRequestBytes caps the size of a request body, queries are expected to be small
+const MaxRequestBytes = 64 << 10
+
+// request is a GraphQL request, sent as a JSON body or as query parameters of a GET
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type contextKey int
+
+const (
+	tenantKey contextKey = iota
+	principalKey
+)
+
+// tenantFromContext returns the tenant the request acts for
+func tenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey).(string)
+	return tenantID
+}
+
+// requireSummaryScope guards the summaries, the route itself only requires customers:read.
+// Callers are only missing from the context when no authentication is configured.
+func requireSummaryScope(ctx context.Context) error {
+	principal, ok := ctx.Value(principalKey).(*auth.Principal)
+	if ok && !principal.HasScope(auth.ScopeSummaryRead) {
+		return errors.New("missing required scope " + auth.ScopeSummaryRead)
+	}
+	return nil
+}
+
+// Handler
+// Runs GraphQL queries, sent as JSON with a POST or as the query parameter of a GET.
+// Queries over MaxDepth or MaxComplexity are rejected with 400 before anything is fetched.
+func Handler(store collections.Collections) gin.HandlerFunc {
+	schema, err := newSchema(store)
+	if err != nil {
+		// The schema is static, an error is a programming mistake
+		panic(err)
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		body := c.Request.Body
+		if body == nil {
+			body = http.NoBody
+		}
+		if c.Request.Method == http.MethodGet {
+			req.Query = c.Query("query")
+			req.OperationName = c.Query("operationName")
+			if variables := c.Query("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+					c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("invalid variables"))})
+					return
+				}
+			}
+		} else if err := json.NewDecoder(io.LimitReader(body, MaxRequestBytes)).Decode(&req); err != nil {
+			c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("invalid request body"))})
+			return
+		}
+		if req.Query == "" {
+			c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("missing query"))})
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+		if validation := graphql.ValidateDocument(&schema, doc, nil); !validation.IsValid {
+			c.JSON(http.StatusBadRequest, graphql.Result{Errors: validation.Errors})
+			return
+		}
+		if err := check(schema, doc, req.OperationName, req.Variables); err != nil {
+			c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), tenantKey, tenant.FromContext(c))
+		if principal, ok := auth.PrincipalFromContext(c); ok {
+			ctx = context.WithValue(ctx, principalKey, principal)
+		}
+
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       ctx,
+		})
+		c.JSON(http.StatusOK, result)
+	}
+}
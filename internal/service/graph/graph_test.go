@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCollection() *collections.OrderCollection {
+	return &collections.OrderCollection{Orders: []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+		{CustomerID: "01", OrderID: "51", Timestamp: "1637245070523", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+		{CustomerID: "02", OrderID: "52", Timestamp: "1637245070533", Items: []models.Item{{ItemID: "20201", CostEur: 2}}},
+	}}
+}
+
+func setupRouter(collection collections.Collections) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/graphql", Handler(collection))
+	router.POST("/graphql", Handler(collection))
+	return router
+}
+
+type response struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func post(t *testing.T, router *gin.Engine, query string, variables map[string]any) (int, response) {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return w.Code, resp
+}
+
+func TestCustomerInOneRoundTrip(t *testing.T) {
+	router := setupRouter(testCollection())
+
+	code, resp := post(t, router, `query($id: ID!) {
+		customer(id: $id) {
+			id
+			summary { nbrOfPurchasedItems totalAmountEur }
+			items(limit: 2) { total nodes { itemId costEur order { orderId totalEur } } }
+		}
+	}`, map[string]any{"id": "01"})
+
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, resp.Errors)
+	expected := `{
+		"customer": {
+			"id": "01",
+			"summary": {"nbrOfPurchasedItems": 3, "totalAmountEur": 10},
+			"items": {
+				"total": 3,
+				"nodes": [
+					{"itemId": "20201", "costEur": 2, "order": {"orderId": "50", "totalEur": 5}},
+					{"itemId": "20202", "costEur": 3, "order": {"orderId": "50", "totalEur": 5}}
+				]
+			}
+		}
+	}`
+	actual := mustJSON(t, resp.Data)
+	assert.JSONEq(t, expected, actual)
+
+	_, resp = post(t, router, `{ customer(id: "99") { id } }`, nil)
+	assert.Empty(t, resp.Errors)
+	assert.Nil(t, resp.Data["customer"])
+}
+
+func TestFiltersAndPagination(t *testing.T) {
+	router := setupRouter(testCollection())
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "Orders of an item",
+			query:    `{ orders(itemId: "20201") { total nodes { orderId customer { id } } } }`,
+			expected: `{"orders": {"total": 2, "nodes": [{"orderId": "50", "customer": {"id": "01"}}, {"orderId": "52", "customer": {"id": "02"}}]}}`,
+		},
+		{
+			name:     "Orders in a time range",
+			query:    `{ orders(since: "1637245070520", until: "1637245070530") { nodes { orderId } } }`,
+			expected: `{"orders": {"nodes": [{"orderId": "51"}]}}`,
+		},
+		{
+			name:     "Orders of a customer paged",
+			query:    `{ orders(customerId: "01", limit: 1, offset: 1) { total limit offset nodes { orderId } } }`,
+			expected: `{"orders": {"total": 2, "limit": 1, "offset": 1, "nodes": [{"orderId": "51"}]}}`,
+		},
+		{
+			name:     "Summaries over an amount",
+			query:    `{ summaries(minTotalAmountEur: 5) { total nodes { customerId customer { orders { total } } } } }`,
+			expected: `{"summaries": {"total": 1, "nodes": [{"customerId": "01", "customer": {"orders": {"total": 2}}}]}}`,
+		},
+		{
+			name:     "Items of a customer over a cost",
+			query:    `{ customer(id: "01") { items(minCostEur: 3) { nodes { itemId } } } }`,
+			expected: `{"customer": {"items": {"nodes": [{"itemId": "20202"}, {"itemId": "20203"}]}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := post(t, router, tt.query, nil)
+			require.Equal(t, http.StatusOK, code)
+			require.Empty(t, resp.Errors)
+			actual := mustJSON(t, resp.Data)
+			assert.JSONEq(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("Page too large", func(t *testing.T) {
+		_, resp := post(t, router, `{ orders(limit: 1000) { total } }`, nil)
+		require.Len(t, resp.Errors, 1)
+		assert.Contains(t, resp.Errors[0].Message, "limit must be between 1 and 100")
+	})
+}
+
+func TestHandlerRequests(t *testing.T) {
+	router := setupRouter(testCollection())
+
+	t.Run("GET", func(t *testing.T) {
+		params := url.Values{"query": {`query($id: ID!) { customer(id: $id) { id } }`}, "variables": {`{"id": "02"}`}}
+		req := httptest.NewRequest(http.MethodGet, "/graphql?"+params.Encode(), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"data": {"customer": {"id": "02"}}}`, w.Body.String())
+	})
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"Missing query", ""},
+		{"Syntax error", "{ customer(id: "},
+		{"Unknown field", `{ customer(id: "01") { password } }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := post(t, router, tt.query, nil)
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.NotEmpty(t, resp.Errors)
+			assert.Nil(t, resp.Data)
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -0,0 +1,187 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// This should be a configuration in a real production environment
+const (
+	// MaxDepth caps how deeply fields can be nested
+	MaxDepth = 8
+	// MaxComplexity caps the estimated number of fields a query resolves
+	MaxComplexity = 2000
+	// MaxIntrospectionDepth caps how deeply introspection fields can be nested, deep enough for the
+	// introspection queries of GraphQL tools, which unwrap the types of arguments through up to nine levels of ofType
+	MaxIntrospectionDepth = 16
+)
+
+// limits estimates the cost of an operation before it runs, so expensive queries never reach the store.
+// Every field costs 1, and the fields selected under a paged field cost once per entry of the requested page.
+// Introspection fields cost 1 too, they aren't paged, and can be nested down to MaxIntrospectionDepth.
+type limits struct {
+	schema    graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// check returns an error when the operation of doc named operationName exceeds MaxDepth or MaxComplexity
+func check(schema graphql.Schema, doc *ast.Document, operationName string, variables map[string]any) error {
+	l := &limits{schema: schema, fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+
+	var operation *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			l.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || definition.Name != nil && definition.Name.Value == operationName {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		// Left to the executor to report
+		return nil
+	}
+
+	complexity, err := l.selectionSet(operation.SelectionSet, schema.QueryType(), 1)
+	if err != nil {
+		return err
+	}
+	if complexity > MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the maximum of %d", complexity, MaxComplexity)
+	}
+	return nil
+}
+
+func (l *limits) selectionSet(set *ast.SelectionSet, parent graphql.Type, depth int) (int, error) {
+	if set == nil {
+		return 0, nil
+	}
+
+	cost := 0
+	for _, selection := range set.Selections {
+		var selectionCost int
+		var err error
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			selectionCost, err = l.field(selection, parent, depth)
+		case *ast.InlineFragment:
+			fragmentType := parent
+			if selection.TypeCondition != nil {
+				fragmentType = l.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			selectionCost, err = l.selectionSet(selection.SelectionSet, fragmentType, depth)
+		case *ast.FragmentSpread:
+			fragment, ok := l.fragments[selection.Name.Value]
+			if !ok {
+				continue
+			}
+			selectionCost, err = l.selectionSet(fragment.SelectionSet, l.schema.Type(fragment.TypeCondition.Name.Value), depth)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		cost += selectionCost
+		// Stops counting early, limits in the query could otherwise overflow the estimate
+		if cost > MaxComplexity {
+			return cost, nil
+		}
+	}
+	return cost, nil
+}
+
+func (l *limits) field(field *ast.Field, parent graphql.Type, depth int) (int, error) {
+	// Fields of the introspection types are introspection fields too
+	introspection := strings.HasPrefix(field.Name.Value, "__") || parent != nil && strings.HasPrefix(parent.Name(), "__")
+	if introspection && depth > MaxIntrospectionDepth {
+		return 0, fmt.Errorf("introspection depth exceeds the maximum of %d", MaxIntrospectionDepth)
+	}
+	if !introspection && depth > MaxDepth {
+		return 0, fmt.Errorf("query depth exceeds the maximum of %d", MaxDepth)
+	}
+
+	// The introspection fields of the query type aren't part of its fields, their selections cost once like any other
+	var introspected graphql.Type
+	switch field.Name.Value {
+	case "__schema":
+		introspected = graphql.SchemaType
+	case "__type":
+		introspected = graphql.TypeType
+	}
+	if introspected != nil {
+		childCost, err := l.selectionSet(field.SelectionSet, introspected, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		return 1 + childCost, nil
+	}
+
+	object, ok := parent.(*graphql.Object)
+	if !ok {
+		return 1, nil
+	}
+	definition, ok := object.Fields()[field.Name.Value]
+	if !ok {
+		return 1, nil
+	}
+
+	childCost, err := l.selectionSet(field.SelectionSet, namedType(definition.Type), depth+1)
+	if err != nil {
+		return 0, err
+	}
+	return 1 + l.pageSize(field, definition)*childCost, nil
+}
+
+// pageSize returns the limit asked for on a paged field, 1 on other fields
+func (l *limits) pageSize(field *ast.Field, definition *graphql.FieldDefinition) int {
+	var argument *graphql.Argument
+	for _, arg := range definition.Args {
+		if arg.Name() == "limit" {
+			argument = arg
+		}
+	}
+	if argument == nil {
+		return 1
+	}
+
+	size, _ := argument.DefaultValue.(int)
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			size, _ = strconv.Atoi(value.Value)
+		case *ast.Variable:
+			switch v := l.variables[value.Name.Value].(type) {
+			case float64:
+				size = int(v)
+			case int:
+				size = v
+			}
+		}
+	}
+	return max(size, 1)
+}
+
+// namedType unwraps the lists and non null wrappers of a type
+func namedType(t graphql.Type) graphql.Type {
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.List:
+			t = wrapped.OfType
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		default:
+			return t
+		}
+	}
+}
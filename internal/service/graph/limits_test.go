@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/graphql-go/graphql/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLimits(t *testing.T) {
+	router := setupRouter(testCollection())
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		error     string
+	}{
+		{
+			name:  "Too deep",
+			query: `{ customer(id: "01") { orders { nodes { customer { orders { nodes { customer { orders { nodes { orderId } } } } } } } } } }`,
+			error: "query depth exceeds the maximum of 8",
+		},
+		{
+			name:  "Too deep through fragments",
+			query: `{ customer(id: "01") { ...Orders } } fragment Orders on Customer { orders { nodes { customer { orders { nodes { customer { orders { nodes { ... on Order { orderId } } } } } } } } } }`,
+			error: "query depth exceeds the maximum of 8",
+		},
+		{
+			name:  "Too deep introspection",
+			query: `{ __schema { types { fields { type { fields { type { fields { type { fields { type { fields { type { fields { type { fields { type { name } } } } } } } } } } } } } } } } }`,
+			error: "introspection depth exceeds the maximum of 16",
+		},
+		{
+			name:  "Introspection nested in the query counts",
+			query: `{ customer(id: "01") { orders { nodes { customer { orders { nodes { customer { orders { nodes { __typename } } } } } } } } } }`,
+			error: "query depth exceeds the maximum of 8",
+		},
+		{
+			name:  "Too complex",
+			query: `{ orders(limit: 100) { nodes { customer { items(limit: 100) { nodes { itemId } } } } } }`,
+			error: "query complexity",
+		},
+		{
+			name:      "Too complex through variables",
+			query:     `query($limit: Int) { orders(limit: $limit) { nodes { customer { items(limit: $limit) { nodes { itemId } } } } } }`,
+			variables: map[string]any{"limit": 100},
+			error:     "query complexity",
+		},
+		{
+			name:  "Default page sizes count",
+			query: `{ summaries { nodes { customer { orders { nodes { items { itemId costEur } customer { id } } } } } } }`,
+			error: "query complexity",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := post(t, router, tt.query, tt.variables)
+			assert.Equal(t, http.StatusBadRequest, code)
+			require.Len(t, resp.Errors, 1)
+			assert.Contains(t, resp.Errors[0].Message, tt.error)
+			assert.Nil(t, resp.Data)
+		})
+	}
+
+	t.Run("Within limits", func(t *testing.T) {
+		code, resp := post(t, router, `query($limit: Int) { orders(limit: $limit) { nodes { customer { items(limit: $limit) { nodes { itemId } } } } } }`, map[string]any{"limit": 10})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, resp.Errors)
+	})
+
+	t.Run("Introspection", func(t *testing.T) {
+		code, resp := post(t, router, testutil.IntrospectionQuery, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, resp.Errors)
+		assert.Contains(t, mustJSON(t, resp.Data), `"CustomerItemPage"`)
+	})
+}
@@ -0,0 +1,330 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/service/customer"
+	"qlikOrders/internal/tracing"
+	"slices"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+)
+
+// Lists are paged, limit defaults to DefaultPageSize and can't exceed MaxPageSize
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// page is the result of a paged list
+type page[T any] struct {
+	Nodes  []T `json:"nodes"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// customerRef is the source of the Customer type, its fields are resolved when asked for
+type customerRef struct {
+	ID string `json:"id"`
+}
+
+// pageArgs are the arguments of every paged field
+var pageArgs = graphql.FieldConfigArgument{
+	"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: DefaultPageSize},
+	"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+}
+
+// withPageArgs adds the page arguments to the filters of a field
+func withPageArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for name, arg := range pageArgs {
+		args[name] = arg
+	}
+	return args
+}
+
+func paginate[T any](entries []T, args map[string]any) (page[T], error) {
+	limit, _ := args["limit"].(int)
+	offset, _ := args["offset"].(int)
+	if limit < 1 || limit > MaxPageSize {
+		return page[T]{}, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+	}
+	if offset < 0 {
+		return page[T]{}, errors.New("offset must not be negative")
+	}
+	return page[T]{Nodes: customer.Paginate(entries, limit, offset), Total: len(entries), Limit: limit, Offset: offset}, nil
+}
+
+func pageType(name string, node graphql.Output) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.Fields{
+			"nodes":  &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(node)))},
+			"total":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Number of entries before paging"},
+			"limit":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"offset": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+}
+
+// timeArg parses a timestamp argument, given in milliseconds since the Unix epoch like order timestamps
+func timeArg(args map[string]any, name string) (int64, bool, error) {
+	value, ok := args[name].(string)
+	if !ok {
+		return 0, false, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s must be in milliseconds since the epoch", name)
+	}
+	return ms, true, nil
+}
+
+// filterOrders keeps the orders matching the itemId, since and until arguments
+func filterOrders(orders []models.Order, args map[string]any) ([]models.Order, error) {
+	since, hasSince, err := timeArg(args, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, hasUntil, err := timeArg(args, "until")
+	if err != nil {
+		return nil, err
+	}
+	itemID, _ := args["itemId"].(string)
+
+	filtered := []models.Order{}
+	for _, order := range orders {
+		ms, err := strconv.ParseInt(order.Timestamp, 10, 64)
+		if (hasSince || hasUntil) && err != nil {
+			continue
+		}
+		if hasSince && ms < since || hasUntil && ms > until {
+			continue
+		}
+		if itemID != "" && !slices.ContainsFunc(order.Items, func(item models.Item) bool { return item.ItemID == itemID }) {
+			continue
+		}
+		filtered = append(filtered, order)
+	}
+	return filtered, nil
+}
+
+// newSchema builds the schema, resolvers read the tenant and scopes of the request from the context
+func newSchema(store collections.Collections) (graphql.Schema, error) {
+	item := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.Fields{
+			"itemId":  &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"costEur": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	// Types referring to each other get their fields once all of them exist
+	order := graphql.NewObject(graphql.ObjectConfig{Name: "Order", Fields: graphql.Fields{}})
+	customerItem := graphql.NewObject(graphql.ObjectConfig{Name: "CustomerItem", Fields: graphql.Fields{}})
+	summary := graphql.NewObject(graphql.ObjectConfig{Name: "Summary", Fields: graphql.Fields{}})
+	customerType := graphql.NewObject(graphql.ObjectConfig{Name: "Customer", Fields: graphql.Fields{}})
+
+	orderPage := pageType("OrderPage", order)
+	customerItemPage := pageType("CustomerItemPage", customerItem)
+	summaryPage := pageType("SummaryPage", summary)
+
+	// Orders of a customer, nil when the customer has none
+	customerOrders := func(p graphql.ResolveParams, customerID string) ([]models.Order, error) {
+		orders, err := tracing.Store(p.Context, store).GetOrdersByCustomer(tenantFromContext(p.Context), customerID)
+		if errors.Is(err, collections.ErrCustomerNotFound) {
+			return nil, nil
+		}
+		return orders, err
+	}
+	resolveCustomer := func(p graphql.ResolveParams) (any, error) {
+		var id string
+		switch source := p.Source.(type) {
+		case models.Order:
+			id = source.CustomerID
+		case models.Summary:
+			id = source.CustomerID
+		}
+		return customerRef{ID: id}, nil
+	}
+
+	order.AddFieldConfig("orderId", &graphql.Field{Type: graphql.NewNonNull(graphql.ID)})
+	order.AddFieldConfig("customerId", &graphql.Field{Type: graphql.NewNonNull(graphql.ID)})
+	order.AddFieldConfig("timestamp", &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "Milliseconds since the Unix epoch"})
+	order.AddFieldConfig("items", &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(item)))})
+	order.AddFieldConfig("totalEur", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.Int),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			total := 0
+			for _, item := range p.Source.(models.Order).Items {
+				total += item.CostEur
+			}
+			return total, nil
+		},
+	})
+	order.AddFieldConfig("customer", &graphql.Field{Type: graphql.NewNonNull(customerType), Resolve: resolveCustomer})
+
+	customerItem.AddFieldConfig("customerId", &graphql.Field{Type: graphql.NewNonNull(graphql.ID)})
+	customerItem.AddFieldConfig("itemId", &graphql.Field{Type: graphql.NewNonNull(graphql.ID)})
+	customerItem.AddFieldConfig("costEur", &graphql.Field{Type: graphql.NewNonNull(graphql.Int)})
+	customerItem.AddFieldConfig("orderId", &graphql.Field{Type: graphql.NewNonNull(graphql.ID)})
+	customerItem.AddFieldConfig("timestamp", &graphql.Field{Type: graphql.NewNonNull(graphql.String)})
+	customerItem.AddFieldConfig("order", &graphql.Field{
+		Type: order,
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			source := p.Source.(models.CustomerItem)
+			orders, err := customerOrders(p, source.CustomerID)
+			if err != nil {
+				return nil, err
+			}
+			for _, order := range orders {
+				if order.OrderID == source.OrderID {
+					return order, nil
+				}
+			}
+			return nil, nil
+		},
+	})
+
+	summary.AddFieldConfig("customerId", &graphql.Field{Type: graphql.NewNonNull(graphql.ID)})
+	summary.AddFieldConfig("nbrOfPurchasedItems", &graphql.Field{Type: graphql.NewNonNull(graphql.Int)})
+	summary.AddFieldConfig("totalAmountEur", &graphql.Field{Type: graphql.NewNonNull(graphql.Int)})
+	summary.AddFieldConfig("customer", &graphql.Field{Type: graphql.NewNonNull(customerType), Resolve: resolveCustomer})
+
+	customerType.AddFieldConfig("id", &graphql.Field{Type: graphql.NewNonNull(graphql.ID)})
+	customerType.AddFieldConfig("summary", &graphql.Field{
+		Type: summary,
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			if err := requireSummaryScope(p.Context); err != nil {
+				return nil, err
+			}
+			summary, err := tracing.Store(p.Context, store).GetCustomerSummary(tenantFromContext(p.Context), p.Source.(customerRef).ID)
+			if errors.Is(err, collections.ErrCustomerNotFound) {
+				return nil, nil
+			}
+			return summary, err
+		},
+	})
+	customerType.AddFieldConfig("items", &graphql.Field{
+		Type:        graphql.NewNonNull(customerItemPage),
+		Description: "Every purchased unit in the order it was bought",
+		Args: withPageArgs(graphql.FieldConfigArgument{
+			"itemId":     &graphql.ArgumentConfig{Type: graphql.ID},
+			"minCostEur": &graphql.ArgumentConfig{Type: graphql.Int},
+		}),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			orders, err := customerOrders(p, p.Source.(customerRef).ID)
+			if err != nil {
+				return nil, err
+			}
+			itemID, _ := p.Args["itemId"].(string)
+			minCost, _ := p.Args["minCostEur"].(int)
+
+			items := []models.CustomerItem{}
+			for _, item := range customer.FlattenItems(orders, true) {
+				if itemID != "" && item.ItemID != itemID || item.CostEur < minCost {
+					continue
+				}
+				items = append(items, item)
+			}
+			return paginate(items, p.Args)
+		},
+	})
+	customerType.AddFieldConfig("orders", &graphql.Field{
+		Type: graphql.NewNonNull(orderPage),
+		Args: withPageArgs(graphql.FieldConfigArgument{
+			"itemId": &graphql.ArgumentConfig{Type: graphql.ID},
+			"since":  &graphql.ArgumentConfig{Type: graphql.String, Description: "Earliest timestamp, inclusive"},
+			"until":  &graphql.ArgumentConfig{Type: graphql.String, Description: "Latest timestamp, inclusive"},
+		}),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			orders, err := customerOrders(p, p.Source.(customerRef).ID)
+			if err != nil {
+				return nil, err
+			}
+			filtered, err := filterOrders(orders, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			return paginate(filtered, p.Args)
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"customer": &graphql.Field{
+				Type:        customerType,
+				Description: "A customer with orders, null when there is none",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id := p.Args["id"].(string)
+					orders, err := customerOrders(p, id)
+					if err != nil || orders == nil {
+						return nil, err
+					}
+					return customerRef{ID: id}, nil
+				},
+			},
+			"orders": &graphql.Field{
+				Type: graphql.NewNonNull(orderPage),
+				Args: withPageArgs(graphql.FieldConfigArgument{
+					"customerId": &graphql.ArgumentConfig{Type: graphql.ID},
+					"itemId":     &graphql.ArgumentConfig{Type: graphql.ID},
+					"since":      &graphql.ArgumentConfig{Type: graphql.String, Description: "Earliest timestamp, inclusive"},
+					"until":      &graphql.ArgumentConfig{Type: graphql.String, Description: "Latest timestamp, inclusive"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var orders []models.Order
+					var err error
+					if customerID, ok := p.Args["customerId"].(string); ok {
+						orders, err = customerOrders(p, customerID)
+					} else {
+						orders, err = tracing.Store(p.Context, store).GetAllOrders(tenantFromContext(p.Context))
+					}
+					if err != nil {
+						return nil, err
+					}
+					filtered, err := filterOrders(orders, p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return paginate(filtered, p.Args)
+				},
+			},
+			"summaries": &graphql.Field{
+				Type: graphql.NewNonNull(summaryPage),
+				Args: withPageArgs(graphql.FieldConfigArgument{
+					"minTotalAmountEur":      &graphql.ArgumentConfig{Type: graphql.Int},
+					"minNbrOfPurchasedItems": &graphql.ArgumentConfig{Type: graphql.Int},
+				}),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if err := requireSummaryScope(p.Context); err != nil {
+						return nil, err
+					}
+					summaries, err := tracing.Store(p.Context, store).GetAllCustomerSummaries(tenantFromContext(p.Context))
+					if err != nil {
+						return nil, err
+					}
+					minAmount, _ := p.Args["minTotalAmountEur"].(int)
+					minItems, _ := p.Args["minNbrOfPurchasedItems"].(int)
+
+					filtered := []models.Summary{}
+					for _, summary := range summaries {
+						if summary.TotalAmountEur >= minAmount && summary.NbrOfPurchasedItems >= minItems {
+							filtered = append(filtered, summary)
+						}
+					}
+					return paginate(filtered, p.Args)
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
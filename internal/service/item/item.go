@@ -0,0 +1,42 @@
+package item
+
+import (
+	"errors"
+	"net/http"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of related items returned when no limit is given
+const DefaultRelatedLimit = 10
+
+// GetRelatedItemsHandler
+// Retrieves the items most often purchased in the same order as the given item
+func GetRelatedItemsHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		itemID := c.Param("itemId")
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultRelatedLimit)))
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		related, err := store.GetRelatedItems(tenant.FromContext(c), itemID, limit)
+		if errors.Is(err, collections.ErrItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve related items"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"itemId": itemID, "related": related})
+	}
+}
@@ -0,0 +1,75 @@
+package item
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRelatedItemsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	testCollection := &collections.OrderCollection{
+		Orders: []models.Order{
+			{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+			{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20203", CostEur: 5}}},
+		},
+	}
+	router.GET("/items/:itemId/related", GetRelatedItemsHandler(testCollection))
+
+	t.Run("Valid Item", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/items/20201/related", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			ItemID  string               `json:"itemId"`
+			Related []models.RelatedItem `json:"related"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "20201", response.ItemID)
+		assert.Len(t, response.Related, 2)
+		for _, related := range response.Related {
+			assert.Equal(t, 1, related.Orders)
+			assert.Equal(t, 0.5, related.Support)
+			assert.Equal(t, 0.5, related.Confidence)
+			assert.Equal(t, 1.0, related.Lift)
+		}
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/items/20201/related?limit=1", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"itemId":"20202"`)
+		assert.NotContains(t, w.Body.String(), `"itemId":"20203"`)
+	})
+
+	t.Run("Invalid Limit", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/items/20201/related?limit=0", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Item", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/items/99/related", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,93 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/jobs"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/ratelimit"
+	"qlikOrders/internal/service/order"
+	"qlikOrders/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateImportJobHandler stores an NDJSON or CSV file and queues a job importing it in the background.
+// It accepts the same format and batchSize parameters as POST /orders/import.
+func CreateImportJobHandler(manager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts, err := order.ParseImportOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "message": err.Error()})
+			return
+		}
+
+		body := c.Request.Body
+		if body == nil {
+			body = http.NoBody
+		}
+		file := http.MaxBytesReader(c.Writer, body, order.MaxImportBytes)
+
+		principal, _ := auth.PrincipalFromContext(c)
+		origin := jobs.Origin{
+			Actor:     audit.Actor(principal),
+			Method:    c.Request.Method,
+			Route:     c.FullPath(),
+			RequestID: logging.RequestIDFromContext(c.Request.Context()),
+		}
+		job, err := manager.Submit(tenant.FromContext(c), ratelimit.ClientKey(c), origin, opts, file)
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Request body too large",
+				"message": fmt.Sprintf("The maximum allowed import is %d bytes.", order.MaxImportBytes),
+			})
+		case errors.Is(err, jobs.ErrQueueFull):
+			c.Header("Retry-After", "60")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many import jobs queued"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create import job"})
+		default:
+			c.Header("Location", "/jobs/"+job.ID)
+			c.JSON(http.StatusAccepted, job)
+		}
+	}
+}
+
+// GetJobHandler reports the status and progress of a job
+func GetJobHandler(manager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := manager.Get(tenant.FromContext(c), c.Param("jobId"))
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// CancelJobHandler cancels a queued or running job, orders imported before the cancellation are kept
+func CancelJobHandler(manager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := manager.Cancel(tenant.FromContext(c), c.Param("jobId"))
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		case errors.Is(err, jobs.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": "Job already finished", "job": job})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
+		default:
+			c.JSON(http.StatusAccepted, job)
+		}
+	}
+}
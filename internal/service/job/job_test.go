@@ -0,0 +1,108 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/jobs"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRouter(manager *jobs.Manager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.RequestID(logging.New(io.Discard, logging.Config{})))
+	router.POST("/jobs/import", CreateImportJobHandler(manager))
+	router.GET("/jobs/:jobId", GetJobHandler(manager))
+	router.POST("/jobs/:jobId/cancel", CancelJobHandler(manager))
+	return router
+}
+
+func serve(router *gin.Engine, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestImportJobHandlers(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	sink := audit.NewMemorySink()
+	manager, err := jobs.NewManager(jobs.Config{Dir: t.TempDir(), Collections: collection, Audit: sink})
+	require.NoError(t, err)
+	defer manager.Close()
+	router := setupRouter(manager)
+
+	csv := "customerId,orderId,timestamp,itemId,costEur\n01,50,1637245070513,20201,2\n01,50,1637245070513,20202,3\n"
+	w := serve(router, http.MethodPost, "/jobs/import", "text/csv", csv)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	var created jobs.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, jobs.StatusQueued, created.Status)
+	assert.Equal(t, "/jobs/"+created.ID, w.Header().Get("Location"))
+
+	manager.Start()
+	var job jobs.Job
+	require.Eventually(t, func() bool {
+		w := serve(router, http.MethodGet, "/jobs/"+created.ID, "", "")
+		_ = json.Unmarshal(w.Body.Bytes(), &job)
+		return job.Status == jobs.StatusSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, job.Report.OrdersImported)
+	assert.Equal(t, 2, job.Report.ItemsImported)
+
+	orders, _ := collection.GetAllOrders(models.DefaultTenantID)
+	assert.Len(t, orders, 1)
+
+	// The committed batch is audited as made by the call that created the job
+	entries, err := sink.Query(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.Anonymous, entries[0].Actor)
+	assert.Equal(t, "/jobs/import", entries[0].Route)
+	assert.Equal(t, w.Header().Get(logging.Header), entries[0].RequestID)
+	assert.Equal(t, []string{"50"}, entries[0].OrderIDs)
+
+	w = serve(router, http.MethodPost, "/jobs/"+created.ID+"/cancel", "", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestImportJobHandlersErrors(t *testing.T) {
+	manager, err := jobs.NewManager(jobs.Config{Dir: t.TempDir(), Collections: &collections.OrderCollection{}})
+	require.NoError(t, err)
+	defer manager.Close()
+	router := setupRouter(manager)
+
+	w := serve(router, http.MethodPost, "/jobs/import", "application/json", "[]")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(router, http.MethodGet, "/jobs/unknown", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(router, http.MethodPost, "/jobs/unknown/cancel", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Jobs queued before the workers start can be cancelled right away
+	w = serve(router, http.MethodPost, "/jobs/import?format=ndjson", "", "")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var created jobs.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = serve(router, http.MethodPost, "/jobs/"+created.ID+"/cancel", "", "")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"cancelled"`)
+}
@@ -0,0 +1,147 @@
+package keys
+
+import (
+	"errors"
+	"net/http"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/validation"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateKeyRequest is the body of CreateKeyHandler, an empty tenant creates a key for every tenant
+type CreateKeyRequest struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// KeyResponse describes a key without its hash
+type KeyResponse struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Tenant    string   `json:"tenant,omitempty"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+func toResponse(key auth.APIKey) KeyResponse {
+	return KeyResponse{ID: key.ID, Name: key.Name, Scopes: key.Scopes, Tenant: key.Tenant, CreatedAt: key.CreatedAt}
+}
+
+// callerTenant returns the tenant the caller's own credentials are bound to, empty for platform keys managing every tenant.
+// Callers without a tenant that aren't platform keys, such as tokens without a tenant claim, are bound to the default tenant.
+func callerTenant(c *gin.Context) string {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		return models.DefaultTenantID
+	}
+	if principal.Tenant == "" && !principal.AnyTenant {
+		return models.DefaultTenantID
+	}
+	return principal.Tenant
+}
+
+// CreateKeyHandler generates a new API key, the secret is only returned in this response
+func CreateKeyHandler(store auth.KeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request CreateKeyRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if err := validation.Struct(request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "message": err.Error()})
+			return
+		}
+
+		for _, scope := range request.Scopes {
+			if !slices.Contains(auth.AllScopes, scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "message": "Unknown scope " + scope})
+				return
+			}
+		}
+
+		// Callers bound to a tenant can only create keys for their own tenant
+		if bound := callerTenant(c); bound != "" {
+			if request.Tenant != "" && request.Tenant != bound {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "Credentials are bound to another tenant"})
+				return
+			}
+			request.Tenant = bound
+		}
+
+		// The debug surface reports on every tenant, only keys acting for any tenant can read it
+		if request.Tenant != "" && slices.Contains(request.Scopes, auth.ScopeDebugRead) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "Scope " + auth.ScopeDebugRead + " is only granted to platform keys"})
+			return
+		}
+
+		key, secret, err := auth.GenerateKey(request.Name, request.Tenant, request.Scopes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create key"})
+			return
+		}
+
+		if err := store.Add(key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create key"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"key": toResponse(key), "secret": secret})
+	}
+}
+
+// ListKeysHandler lists every API key
+func ListKeysHandler(store auth.KeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := store.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve keys"})
+			return
+		}
+
+		bound := callerTenant(c)
+		response := make([]KeyResponse, 0, len(keys))
+		for _, key := range keys {
+			if bound == "" || key.Tenant == bound {
+				response = append(response, toResponse(key))
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"keys": response})
+	}
+}
+
+// DeleteKeyHandler revokes an API key
+func DeleteKeyHandler(store auth.KeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID := c.Param("keyId")
+
+		// Keys of other tenants are reported as missing to callers bound to a tenant
+		if bound := callerTenant(c); bound != "" {
+			keys, err := store.List()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete key"})
+				return
+			}
+			if !slices.ContainsFunc(keys, func(key auth.APIKey) bool { return key.ID == keyID && key.Tenant == bound }) {
+				c.JSON(http.StatusNotFound, gin.H{"error": auth.ErrKeyNotFound.Error()})
+				return
+			}
+		}
+
+		err := store.Delete(keyID)
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete key"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Key deleted successfully"})
+	}
+}
@@ -0,0 +1,92 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/auth"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(store auth.KeyStore) *gin.Engine {
+	router := gin.Default()
+	router.POST("/admin/keys", CreateKeyHandler(store))
+	router.GET("/admin/keys", ListKeysHandler(store))
+	router.DELETE("/admin/keys/:keyId", DeleteKeyHandler(store))
+	return router
+}
+
+func TestKeyHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := auth.NewMemoryKeyStore()
+	router := setupRouter(store)
+
+	var created struct {
+		Key    KeyResponse `json:"key"`
+		Secret string      `json:"secret"`
+	}
+
+	t.Run("Create key", func(t *testing.T) {
+		body := []byte(`{"name":"reporting","scopes":["summary:read","reports:read"]}`)
+		req, _ := http.NewRequest("POST", "/admin/keys", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "reporting", created.Key.Name)
+
+		// Only the hash of the secret is stored
+		key, err := store.GetByHash(auth.HashKey(created.Secret))
+		assert.NoError(t, err)
+		assert.Equal(t, created.Key.ID, key.ID)
+	})
+
+	t.Run("Create key with unknown scope", func(t *testing.T) {
+		body := []byte(`{"name":"reporting","scopes":["everything"]}`)
+		req, _ := http.NewRequest("POST", "/admin/keys", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Create debug key bound to a tenant", func(t *testing.T) {
+		body := []byte(`{"name":"operator","scopes":["debug:read"]}`)
+		req, _ := http.NewRequest("POST", "/admin/keys", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "only granted to platform keys")
+	})
+
+	t.Run("List keys", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/admin/keys", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), created.Key.ID)
+		assert.NotContains(t, w.Body.String(), auth.HashKey(created.Secret))
+	})
+
+	t.Run("Delete key", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/admin/keys/"+created.Key.ID, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ = http.NewRequest("DELETE", "/admin/keys/"+created.Key.ID, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
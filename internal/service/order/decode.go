@@ -0,0 +1,100 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errBatchTooLarge = errors.New("batch size exceeds the allowed limit")
+	errInvalidBody   = errors.New("body is not a list of orders")
+)
+
+// decodeOrders decodes a list of orders from r: a JSON or MessagePack array, or a protobuf OrderList.
+// Decoding fails with errBatchTooLarge when the list holds more than maxOrders.
+func decodeOrders(r io.Reader, format codec.Format, maxOrders int) ([]models.Order, error) {
+	if format == codec.FormatJSON {
+		return StreamJSON[models.Order](r, maxOrders)
+	}
+
+	// Compact formats are read whole, the body is already capped by MaxBodyBytes
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, wrapReadError(err)
+	}
+	var list orderList
+	if format == codec.FormatMsgPack {
+		err = codec.Unmarshal(format, data, &list.Orders)
+	} else {
+		err = codec.Unmarshal(format, data, &list)
+	}
+	if err != nil {
+		return nil, errInvalidBody
+	}
+	if len(list.Orders) > maxOrders {
+		return nil, errBatchTooLarge
+	}
+	if list.Orders == nil {
+		list.Orders = []models.Order{}
+	}
+	return list.Orders, nil
+}
+
+// StreamJSON streams a JSON array of T from r, counting the entries as they are parsed, for the batches of every API version.
+// Decoding stops with errBatchTooLarge as soon as the array holds more than max entries,
+// so the rest of an oversized body is never read into memory.
+func StreamJSON[T any](r io.Reader, max int) ([]T, error) {
+	decoder := json.NewDecoder(r)
+
+	if token, err := decoder.Token(); err != nil {
+		return nil, wrapReadError(err)
+	} else if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errInvalidBody
+	}
+
+	entries := []T{}
+	for decoder.More() {
+		if len(entries) == max {
+			return nil, errBatchTooLarge
+		}
+
+		var entry T
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, wrapReadError(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Consume the closing bracket and make sure nothing follows the array
+	if _, err := decoder.Token(); err != nil {
+		return nil, wrapReadError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errInvalidBody
+	}
+	return entries, nil
+}
+
+// wrapReadError keeps the error of a body over the size limit and reports everything else as an invalid body
+func wrapReadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+	return errInvalidBody
+}
+
+// limitBody caps the request body at n bytes, a missing body reads as empty
+func limitBody(c *gin.Context, n int64) io.Reader {
+	body := c.Request.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	return http.MaxBytesReader(c.Writer, body, n)
+}
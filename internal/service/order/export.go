@@ -0,0 +1,110 @@
+package order
+
+import (
+	"errors"
+	"iter"
+	"net/http"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/export"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orderRow is one item of an order, exports use the same columns as CSV imports so they can be imported again
+type orderRow struct {
+	CustomerID string `json:"customerId" parquet:"customerId"`
+	OrderID    string `json:"orderId" parquet:"orderId"`
+	Timestamp  string `json:"timestamp" parquet:"timestamp"`
+	ItemID     string `json:"itemId" parquet:"itemId"`
+	CostEur    int    `json:"costEur" parquet:"costEur"`
+}
+
+// GetOrdersHandler lists the orders of the tenant, ?customerId= keeps the orders of a single customer.
+// Orders are sent in JSON, MessagePack or Protobuf, or exported as CSV, NDJSON or Parquet with one row per item,
+// depending on the Accept header or ?format=.
+func GetOrdersHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		format, err := codec.Negotiate(c.Query("format"), c.GetHeader("Accept"), codec.ExportFormats...)
+		if err != nil {
+			codec.Render(c, http.StatusNotAcceptable, codec.Status{Error: "Not acceptable", Message: "Supported formats are json, msgpack, protobuf, csv, ndjson and parquet"})
+			return
+		}
+
+		tenantID := tenant.FromContext(c)
+		customerID := c.Query("customerId")
+		if format.IsExport() && customerID == "" {
+			// Every order of the tenant is streamed from the store rather than loaded at once
+			sent, err := export.StreamRows(c.Writer, format, "orders", orderRows(store.EachOrder(tenantID)))
+			if err != nil && !sent {
+				codec.RenderAs(c, http.StatusInternalServerError, format, codec.Status{Error: "Failed to retrieve orders"})
+				return
+			}
+			if err != nil {
+				_ = c.Error(err)
+			}
+			return
+		}
+
+		var orders []models.Order
+		if customerID != "" {
+			orders, err = store.GetOrdersByCustomer(tenantID, customerID)
+			if errors.Is(err, collections.ErrCustomerNotFound) {
+				orders, err = []models.Order{}, nil
+			}
+		} else {
+			orders, err = store.GetAllOrders(tenantID)
+		}
+		if err != nil {
+			codec.RenderAs(c, http.StatusInternalServerError, format, codec.Status{Error: "Failed to retrieve orders"})
+			return
+		}
+
+		if !format.IsExport() {
+			codec.RenderAs(c, http.StatusOK, format, orderList{Orders: orders})
+			return
+		}
+		if _, err := export.StreamRows(c.Writer, format, "orders", orderRows(listed(orders))); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// orderRows flattens orders into rows as they are encoded
+func orderRows(orders iter.Seq2[models.Order, error]) iter.Seq2[orderRow, error] {
+	return func(yield func(orderRow, error) bool) {
+		for order, err := range orders {
+			if err != nil {
+				yield(orderRow{}, err)
+				return
+			}
+			for _, item := range order.Items {
+				row := orderRow{
+					CustomerID: order.CustomerID,
+					OrderID:    order.OrderID,
+					Timestamp:  order.Timestamp,
+					ItemID:     item.ItemID,
+					CostEur:    item.CostEur,
+				}
+				if !yield(row, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// listed yields orders already read from the store
+func listed(orders []models.Order) iter.Seq2[models.Order, error] {
+	return func(yield func(models.Order, error) bool) {
+		for _, order := range orders {
+			if !yield(order, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package order
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/importer"
+	"qlikOrders/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportCollection() *collections.OrderCollection {
+	return &collections.OrderCollection{Orders: []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+		{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+	}}
+}
+
+func getOrders(router *gin.Engine, target, accept string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetOrdersHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders", GetOrdersHandler(exportCollection()))
+
+	t.Run("JSON", func(t *testing.T) {
+		w := getOrders(router, "/orders?customerId=02", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"orders":[{"customerId":"02","orderId":"51","timestamp":"1637245070514","items":[{"itemId":"20203","costEur":5}]}]}`, w.Body.String())
+	})
+
+	t.Run("Unknown customer", func(t *testing.T) {
+		w := getOrders(router, "/orders?customerId=03", "text/csv")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "customerId,orderId,timestamp,itemId,costEur\n", w.Body.String())
+	})
+
+	t.Run("NDJSON", func(t *testing.T) {
+		w := getOrders(router, "/orders?format=ndjson", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 3, strings.Count(w.Body.String(), "\n"))
+	})
+
+	t.Run("Not acceptable", func(t *testing.T) {
+		w := getOrders(router, "/orders", "application/xml")
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	})
+}
+
+// streamedCollection can only stream the orders of a tenant, EachOrder fails with err when set
+type streamedCollection struct {
+	*collections.OrderCollection
+	err error
+}
+
+func (s streamedCollection) GetAllOrders(string) ([]models.Order, error) {
+	return nil, errors.New("orders must be streamed")
+}
+
+func (s streamedCollection) EachOrder(tenantID string) iter.Seq2[models.Order, error] {
+	if s.err != nil {
+		return func(yield func(models.Order, error) bool) { yield(models.Order{}, s.err) }
+	}
+	return s.OrderCollection.EachOrder(tenantID)
+}
+
+func TestGetOrdersHandlerStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders", GetOrdersHandler(streamedCollection{OrderCollection: exportCollection()}))
+
+	w := getOrders(router, "/orders?format=ndjson", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, strings.Count(w.Body.String(), "\n"))
+
+	// A store failing before anything was sent is still reported
+	router = gin.New()
+	router.GET("/orders", GetOrdersHandler(streamedCollection{OrderCollection: exportCollection(), err: errors.New("store down")}))
+	w = getOrders(router, "/orders", "text/csv")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGetOrdersHandlerCSVRoundTrip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders", GetOrdersHandler(exportCollection()))
+
+	w := getOrders(router, "/orders", "text/csv")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="orders.csv"`, w.Header().Get("Content-Disposition"))
+
+	// Exported orders can be imported again as they are
+	var imported []models.Order
+	report, err := importer.Import(context.Background(), w.Body, importer.Options{Format: importer.FormatCSV}, func(orders []models.Order) error {
+		imported = append(imported, orders...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, exportCollection().Orders, imported)
+}
+
+func TestGetOrdersHandlerFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders", GetOrdersHandler(exportCollection()))
+
+	var expected orderList
+	w := getOrders(router, "/orders", "application/json")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expected))
+
+	for _, format := range []codec.Format{codec.FormatMsgPack, codec.FormatProtobuf} {
+		w := getOrders(router, "/orders", format.ContentType())
+		require.Equal(t, http.StatusOK, w.Code, format)
+		assert.Equal(t, format.ContentType(), w.Header().Get("Content-Type"))
+
+		var decoded orderList
+		require.NoError(t, codec.Unmarshal(format, w.Body.Bytes(), &decoded), format)
+		assert.Equal(t, expected, decoded, format)
+	}
+}
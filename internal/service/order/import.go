@@ -0,0 +1,121 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/importer"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxImportBytes caps the size of an import file
+const MaxImportBytes = 256 << 20
+
+// MaxImportBatchSize caps the orders committed together by an import
+const MaxImportBatchSize = 1000
+
+// importResult is the body of import responses, the report is left out when nothing was read
+type importResult struct {
+	Error   string           `json:"error,omitempty"`
+	Message string           `json:"message,omitempty"`
+	Report  *importer.Report `json:"report,omitempty"`
+}
+
+func (r importResult) AppendProto(b []byte) []byte {
+	b = protobuf.AppendString(b, 1, r.Error)
+	b = protobuf.AppendString(b, 2, r.Message)
+	if r.Report != nil {
+		b = protobuf.AppendMessage(b, 3, r.Report)
+	}
+	return b
+}
+
+// ImportOrdersHandler imports historical orders from an NDJSON or CSV body.
+// The format is taken from ?format= or the Content-Type, ?batchSize= sets how many orders are committed together.
+func ImportOrdersHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		opts, err := ParseImportOptions(c)
+		if err != nil {
+			codec.Render(c, http.StatusBadRequest, importResult{Error: "Invalid input", Message: err.Error()})
+			return
+		}
+
+		tenantID := tenant.FromContext(c)
+		body := limitBody(c, MaxImportBytes)
+
+		report, err := importer.Import(c.Request.Context(), body, opts, func(orders []models.Order) error {
+			if err := ratelimit.ReserveOrders(c, len(orders)); err != nil {
+				return err
+			}
+			if err := store.AddOrders(tenantID, orders); err != nil {
+				ratelimit.RefundOrders(c, len(orders))
+				return err
+			}
+			audit.RecordOrders(c, orders)
+			return nil
+		})
+
+		attrs := []slog.Attr{
+			slog.String(logging.KeyTenantID, tenantID),
+			slog.Int("rowsRead", report.RowsRead),
+			slog.Int("ordersImported", report.OrdersImported),
+			slog.Int("ordersRejected", report.OrdersRejected),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String(logging.KeyError, err.Error()))
+		}
+		logging.FromContext(c.Request.Context()).LogAttrs(c.Request.Context(), slog.LevelInfo, "orders imported", attrs...)
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case err == nil:
+			codec.Render(c, http.StatusOK, importResult{Report: &report})
+		case errors.Is(err, importer.ErrInvalidHeader):
+			codec.Render(c, http.StatusBadRequest, importResult{Error: "Invalid input", Message: err.Error(), Report: &report})
+		case errors.As(err, &maxBytesErr):
+			codec.Render(c, http.StatusRequestEntityTooLarge, importResult{
+				Error:   "Request body too large",
+				Message: fmt.Sprintf("The maximum allowed import is %d bytes, orders before the limit were imported.", MaxImportBytes),
+				Report:  &report,
+			})
+		case errors.Is(err, ratelimit.ErrQuotaExceeded):
+			codec.Render(c, http.StatusTooManyRequests, importResult{Error: "Daily order quota exceeded", Report: &report})
+		case errors.Is(err, collections.ErrTenantLimitExceeded):
+			codec.Render(c, http.StatusForbidden, importResult{Error: "Tenant order limit reached", Report: &report})
+		default:
+			codec.Render(c, http.StatusInternalServerError, importResult{Error: "Failed to import orders", Report: &report})
+		}
+	}
+}
+
+// ParseImportOptions reads the format and batch size of an import request
+func ParseImportOptions(c *gin.Context) (importer.Options, error) {
+	format := c.Query("format")
+	if format == "" {
+		format = c.ContentType()
+	}
+	parsed, err := importer.ParseFormat(format)
+	if err != nil {
+		return importer.Options{}, err
+	}
+
+	batchSize, err := strconv.Atoi(c.DefaultQuery("batchSize", strconv.Itoa(importer.DefaultBatchSize)))
+	if err != nil || batchSize < 1 || batchSize > MaxImportBatchSize {
+		return importer.Options{}, fmt.Errorf("batchSize must be between 1 and %d", MaxImportBatchSize)
+	}
+
+	return importer.Options{Format: parsed, BatchSize: batchSize}, nil
+}
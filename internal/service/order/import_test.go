@@ -0,0 +1,129 @@
+package order
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/importer"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const importCSV = `customerId,orderId,timestamp,itemId,costEur
+01,50,1637245070513,20201,2
+01,50,1637245070513,20202,3
+02,51,1637245070513,20203,-1
+03,52,1637245070513,20204,4
+`
+
+func setupImportRouter(collection *collections.OrderCollection, limiter *ratelimit.Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if limiter != nil {
+		router.Use(limiter.Middleware())
+	}
+	router.POST("/orders/import", ImportOrdersHandler(collection))
+	return router
+}
+
+type importResponse struct {
+	Error  string          `json:"error"`
+	Report importer.Report `json:"report"`
+}
+
+func postImport(router *gin.Engine, target, contentType, body string) (int, importResponse) {
+	req, _ := http.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response importResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestImportOrdersHandlerCSV(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	router := setupImportRouter(collection, nil)
+
+	code, response := postImport(router, "/orders/import?batchSize=1", "text/csv", importCSV)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, response.Report.OrdersImported)
+	assert.Equal(t, 3, response.Report.ItemsImported)
+	assert.Equal(t, 2, response.Report.BatchesCommitted)
+	assert.Equal(t, []importer.RowError{
+		{Line: 4, OrderID: "51", Error: "items[0].costEur must be greater than 0"},
+	}, response.Report.Errors)
+
+	orders, _ := collection.GetAllOrders(models.DefaultTenantID)
+	assert.Len(t, orders, 2)
+	assert.Len(t, orders[0].Items, 2)
+}
+
+func TestImportOrdersHandlerNDJSON(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	router := setupImportRouter(collection, nil)
+
+	body := `{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}
+{"customerId":"02","orderId":"51","timestamp":"1637245070513","items":[{"itemId":"20202","costEur":3}]}`
+	code, response := postImport(router, "/orders/import?format=ndjson", "application/octet-stream", body)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, response.Report.OrdersImported)
+	assert.Empty(t, response.Report.Errors)
+}
+
+func TestImportOrdersHandlerInvalidRequest(t *testing.T) {
+	router := setupImportRouter(&collections.OrderCollection{}, nil)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+	}{
+		{name: "Unsupported format", target: "/orders/import", contentType: "application/json", body: "[]"},
+		{name: "Invalid batch size", target: "/orders/import?batchSize=0", contentType: "text/csv", body: importCSV},
+		{name: "Batch size too large", target: "/orders/import?batchSize=1001", contentType: "text/csv", body: importCSV},
+		{name: "Missing CSV column", target: "/orders/import", contentType: "text/csv", body: "customerId,orderId\n01,50\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := postImport(router, tt.target, tt.contentType, tt.body)
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, "Invalid input", response.Error)
+		})
+	}
+}
+
+func TestImportOrdersHandlerTenantLimit(t *testing.T) {
+	collection := &collections.OrderCollection{DefaultLimit: collections.TenantLimit{MaxOrders: 1}}
+	router := setupImportRouter(collection, nil)
+
+	code, response := postImport(router, "/orders/import?batchSize=1", "text/csv", importCSV)
+
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, 1, response.Report.OrdersImported)
+}
+
+func TestImportOrdersHandlerQuota(t *testing.T) {
+	collection := &collections.OrderCollection{}
+	limiter := &ratelimit.Limiter{Store: ratelimit.NewMemoryStore(), DailyOrders: 1}
+	router := setupImportRouter(collection, limiter)
+
+	code, response := postImport(router, "/orders/import?batchSize=1", "text/csv", importCSV)
+
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, 1, response.Report.OrdersImported)
+
+	orders, _ := collection.GetAllOrders(models.DefaultTenantID)
+	assert.Len(t, orders, 1)
+}
@@ -3,9 +3,20 @@ package order
 import (
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
 	"qlikOrders/internal/collections"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/metrics"
 	"qlikOrders/internal/models"
+	"qlikOrders/internal/ratelimit"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"qlikOrders/internal/validation"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,49 +25,153 @@ import (
 // Set intentionally low for testing
 const MaxBatchSize = 5
 
-// AddOrdersHandler adds orders in a batch
-func AddOrdersHandler(collection *collections.OrderCollection) gin.HandlerFunc {
+// MaxBodyBytes caps the size of a request body, larger bodies are rejected before being read in full
+const MaxBodyBytes = 1 << 20
+
+// Reasons batches are rejected for in the metrics when they couldn't be read, invalid fields are counted by their rule
+const (
+	reasonBodyTooLarge  = "body_too_large"
+	reasonBatchTooLarge = "batch_too_large"
+	reasonMalformedBody = "malformed_body"
+)
+
+// Decoder reads a batch of at most maxOrders orders from a request body in format.
+// API versions decode their own payloads into the models, reporting invalid fields with a *validation.Error.
+type Decoder func(r io.Reader, format codec.Format, maxOrders int) ([]models.Order, error)
+
+// AddOrdersHandler adds orders in a batch.
+// The batch is a JSON or MessagePack array, or a protobuf OrderList, depending on the Content-Type.
+func AddOrdersHandler(collection collections.Collections) gin.HandlerFunc {
+	return AddOrdersWith(collection, decodeOrders)
+}
+
+// AddOrdersWith adds batches of orders read by decode, with the limits, validation and quota of AddOrdersHandler
+func AddOrdersWith(collection collections.Collections, decode Decoder) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		logger := logging.FromContext(c.Request.Context())
+		metric := metrics.FromContext(c.Request.Context())
 
-		var newOrders []models.Order
+		// Decoding includes the validation of v2 payloads, which are converted as they are read
+		body := limitBody(c, MaxBodyBytes)
+		_, span := tracing.Start(c.Request.Context(), "order.decode")
+		newOrders, err := decode(body, codec.RequestFormat(c.GetHeader("Content-Type")), MaxBatchSize)
+		span.SetAttributes(tracing.KeyOrders.Int(len(newOrders)))
+		tracing.End(span, err)
 
-		if err := c.BindJSON(&newOrders); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			metric.ValidationFailed(reasonBodyTooLarge)
+			codec.Render(c, http.StatusRequestEntityTooLarge, codec.Status{
+				Error:   "Request body too large",
+				Message: fmt.Sprintf("The maximum allowed request body is %d bytes.", MaxBodyBytes),
+			})
+			return
+		}
+		if errors.Is(err, errBatchTooLarge) {
+			metric.ValidationFailed(reasonBatchTooLarge)
+			codec.Render(c, http.StatusRequestEntityTooLarge, codec.Status{
+				Error:   "Batch size exceeds the allowed limit",
+				Message: fmt.Sprintf("The maximum allowed number of orders in a single request is %d. Please split your request and try again.", MaxBatchSize),
+			})
+			return
+		}
+		var invalid *validation.Error
+		if errors.As(err, &invalid) {
+			logger.Info("orders rejected", slog.String("reason", err.Error()))
+			metric.ValidationFailed(rules(invalid)...)
+			codec.Render(c, http.StatusBadRequest, codec.Status{Error: "Invalid input", Message: err.Error()})
+			return
+		}
+		if err != nil {
+			logger.Info("orders rejected", slog.String("reason", err.Error()))
+			metric.ValidationFailed(reasonMalformedBody)
+			codec.Render(c, http.StatusBadRequest, codec.Status{Error: "Invalid input"})
 			return
 		}
 
-		if err := validateOrder(newOrders); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		_, span = tracing.Start(c.Request.Context(), "order.validate", tracing.KeyOrders.Int(len(newOrders)))
+		err = ValidateOrders(newOrders)
+		tracing.End(span, err)
+		if err != nil {
+			logger.Info("orders rejected", slog.String("reason", err.Error()))
+			if errors.As(err, &invalid) {
+				metric.ValidationFailed(rules(invalid)...)
+			}
+			codec.Render(c, http.StatusBadRequest, codec.Status{Error: "Invalid input", Message: err.Error()})
 			return
 		}
 
-		if len(newOrders) > MaxBatchSize {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Batch size exceeds the allowed limit",
-				"message": fmt.Sprintf("The maximum allowed number of orders in a single request is %d. Please split your request and try again.", MaxBatchSize),
-			})
+		// Valid orders are recorded whether or not they end up stored, the outcome of the entry tells
+		audit.RecordOrders(c, newOrders)
+
+		if !ratelimit.ConsumeOrders(c, len(newOrders)) {
 			return
 		}
 
-		if err := collection.AddOrders(newOrders); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add orders"})
+		tenantID := tenant.FromContext(c)
+		err = tracing.Store(c.Request.Context(), collection).AddOrders(tenantID, newOrders)
+		if err != nil {
+			// Nothing was stored, so the orders don't count against the quota
+			ratelimit.RefundOrders(c, len(newOrders))
+		}
+		if errors.Is(err, collections.ErrTenantLimitExceeded) {
+			logger.Warn("tenant order limit reached", slog.String(logging.KeyTenantID, tenantID))
+			codec.Render(c, http.StatusForbidden, codec.Status{Error: "Tenant order limit reached"})
+			return
+		}
+		if err != nil {
+			_ = c.Error(err)
+			codec.Render(c, http.StatusInternalServerError, codec.Status{Error: "Failed to add orders"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"message": "Orders added successfully"})
+		logger.Info("orders added", slog.String(logging.KeyTenantID, tenantID), slog.Int("orders", len(newOrders)), slog.Int("items", countItems(newOrders)))
+		codec.Render(c, http.StatusCreated, codec.Status{Message: "Orders added successfully"})
 	}
 }
 
-func validateOrder(orders []models.Order) error {
+// rules lists the rule broken by every invalid field, the reasons batches are rejected for in the metrics
+func rules(invalid *validation.Error) []string {
+	broken := make([]string, len(invalid.Fields))
+	for i, field := range invalid.Fields {
+		broken[i] = field.Rule
+	}
+	return broken
+}
+
+func countItems(orders []models.Order) int {
+	items := 0
 	for _, order := range orders {
-		if order.CustomerID == "" || order.OrderID == "" || order.Timestamp == "" || len(order.Items) == 0 {
-			return errors.New("order is missing required fields or has invalid cost")
-		}
-		for _, item := range order.Items {
-			if item.ItemID == "" || item.CostEur <= 0 {
-				return errors.New("item is missing required fields or has invalid cost")
-			}
+		items += len(order.Items)
+	}
+	return items
+}
+
+// ValidateOrders checks every order of a batch, invalid fields are reported under the index of their order
+func ValidateOrders(orders []models.Order) error {
+	return validation.Each(orders)
+}
+
+// orderList is the body of GET /orders, and of POST /orders in protobuf
+type orderList struct {
+	Orders []models.Order `json:"orders"`
+}
+
+func (l orderList) AppendProto(b []byte) []byte {
+	return protobuf.AppendMessages(b, 1, l.Orders)
+}
+
+func (l *orderList) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			var order models.Order
+			r.Message(&order)
+			l.Orders = append(l.Orders, order)
+		default:
+			r.Skip()
 		}
 	}
-	return nil
+	return r.Err()
 }
@@ -3,14 +3,22 @@ package order
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
 	"qlikOrders/internal/collections"
 	"qlikOrders/internal/models"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupRouter(collection *collections.OrderCollection) *gin.Engine {
@@ -55,7 +63,7 @@ func TestAddOrdersHandler(t *testing.T) {
 				},
 			},
 			expectedCode: http.StatusBadRequest,
-			expectedBody: `{"error":"Invalid input"}`,
+			expectedBody: `{"error":"Invalid input","message":"[0].customerId is required"}`,
 		},
 		{
 			name: "Invalid Input - Empty Items",
@@ -68,7 +76,7 @@ func TestAddOrdersHandler(t *testing.T) {
 				},
 			},
 			expectedCode: http.StatusBadRequest,
-			expectedBody: `{"error":"Invalid input"}`,
+			expectedBody: `{"error":"Invalid input","message":"[0].items must not be empty"}`,
 		},
 		{
 			name: "Invalid Input - Batch Size Exceeds Limit",
@@ -80,7 +88,7 @@ func TestAddOrdersHandler(t *testing.T) {
 				{CustomerID: "05", OrderID: "54", Timestamp: "1637245070517", Items: []models.Item{{ItemID: "20205", CostEur: 6}}},
 				{CustomerID: "06", OrderID: "55", Timestamp: "1637245070518", Items: []models.Item{{ItemID: "20206", CostEur: 7}}},
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusRequestEntityTooLarge,
 			expectedBody: `{"error":"Batch size exceeds the allowed limit","message":"The maximum allowed number of orders in a single request is 5. Please split your request and try again."}`,
 		},
 	}
@@ -108,3 +116,205 @@ func TestAddOrdersHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestAddOrdersHandlerStreaming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	order := `{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2}]}`
+
+	tests := []struct {
+		name         string
+		body         io.Reader
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Not an array",
+			body:         bytes.NewBufferString(order),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid input"}`,
+		},
+		{
+			name:         "Trailing data",
+			body:         bytes.NewBufferString("[" + order + "] []"),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid input"}`,
+		},
+		{
+			name:         "Truncated array",
+			body:         bytes.NewBufferString("[" + order + ","),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid input"}`,
+		},
+		{
+			// A single order with a huge item list stays within the batch size but not the body limit
+			name:         "Body too large",
+			body:         bytes.NewBufferString(`[{"customerId":"01","orderId":"50","timestamp":"1637245070513","items":[` + strings.Repeat(`{"itemId":"20201","costEur":2},`, MaxBodyBytes/30) + `{"itemId":"20201","costEur":2}]}]`),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: fmt.Sprintf(`{"error":"Request body too large","message":"The maximum allowed request body is %d bytes."}`, MaxBodyBytes),
+		},
+		{
+			// The reader fails if decoding reads past the first orders of the batch
+			name:         "Oversized batch is rejected early",
+			body:         io.MultiReader(bytes.NewBufferString("["+strings.Repeat(order+",", MaxBatchSize+1)), failingReader{}),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: `{"error":"Batch size exceeds the allowed limit","message":"The maximum allowed number of orders in a single request is 5. Please split your request and try again."}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupRouter(&collections.OrderCollection{})
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", tt.body)
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+// failingReader stands in for the unread rest of a body
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read past the batch size limit")
+}
+
+// largePayload builds a JSON array of n orders, each with a few items
+func largePayload(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `{"customerId":"%d","orderId":"%d","timestamp":"1637245070513","items":[{"itemId":"20201","costEur":2},{"itemId":"20202","costEur":3},{"itemId":"20203","costEur":4}]}`, i%100, i)
+	}
+	buf.WriteString("]")
+	return buf.Bytes()
+}
+
+// Rejecting a multi-megabyte batch should only cost the first MaxBatchSize orders,
+// compare the allocations with BenchmarkAddOrdersHandlerValidBatch
+func BenchmarkAddOrdersHandlerOversizedBatch(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.POST("/orders", AddOrdersHandler(&collections.OrderCollection{}))
+
+	payload := largePayload(40000) // About 6 MB
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(payload))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			b.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+}
+
+func BenchmarkAddOrdersHandlerValidBatch(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.POST("/orders", AddOrdersHandler(&collections.OrderCollection{}))
+
+	payload := largePayload(MaxBatchSize)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(payload))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			b.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+}
+
+func TestAddOrdersHandlerFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	orders := []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+		{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+	}
+	msgpackBody, err := codec.Marshal(codec.FormatMsgPack, orders)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{"JSON", "application/json", mustMarshalJSON(t, orders)},
+		{"MessagePack", "application/msgpack", msgpackBody},
+		{"Protobuf", "application/x-protobuf", protobuf.Marshal(orderList{Orders: orders})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := &collections.OrderCollection{}
+			router := setupRouter(collection)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Accept", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusCreated, w.Code)
+			stored, err := collection.GetAllOrders(models.DefaultTenantID)
+			require.NoError(t, err)
+			for i := range stored {
+				stored[i].TenantID = ""
+			}
+			assert.Equal(t, orders, stored)
+
+			// The response is in the format of the request
+			var status codec.Status
+			require.NoError(t, codec.Unmarshal(codec.RequestFormat(tt.contentType), w.Body.Bytes(), &status))
+			assert.Equal(t, codec.Status{Message: "Orders added successfully"}, status)
+		})
+	}
+
+	t.Run("Invalid protobuf", func(t *testing.T) {
+		router := setupRouter(&collections.OrderCollection{})
+
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("\x0a\xff"))
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"Invalid input"}`, w.Body.String())
+	})
+
+	t.Run("Batch too large in MessagePack", func(t *testing.T) {
+		router := setupRouter(&collections.OrderCollection{})
+		body, err := codec.Marshal(codec.FormatMsgPack, slices.Repeat(orders[:1], MaxBatchSize+1))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/msgpack")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+}
+
+func mustMarshalJSON(t *testing.T, v any) []byte {
+	body, err := json.Marshal(v)
+	require.NoError(t, err)
+	return body
+}
@@ -0,0 +1,115 @@
+package privacy
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"qlikOrders/internal/audit"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportCustomerHandler
+// Retrieves a machine-readable bundle of everything stored about a customer
+func ExportCustomerHandler(collections collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collections)
+		bundle, err := Export(store, tenant.FromContext(c), c.Param("customerId"))
+		if err != nil {
+			writeLookupError(c, err)
+			return
+		}
+
+		// Served as a download so the bundle can be handed over as-is
+		c.Header("Content-Disposition", `attachment; filename="customer-export.json"`)
+		c.JSON(http.StatusOK, bundle)
+	}
+}
+
+// Export gathers everything stored about a customer, it fails with collections.ErrCustomerNotFound for unknown customers.
+// Items and summary are derived from the orders of a single read, so they always agree with them.
+func Export(collections collections.Collections, tenantID, customerID string) (models.CustomerExport, error) {
+	orders, err := collections.GetOrdersByCustomer(tenantID, customerID)
+	if err != nil {
+		return models.CustomerExport{}, err
+	}
+
+	items := []models.CustomerItem{}
+	summary := models.Summary{CustomerID: customerID}
+	for _, order := range orders {
+		for _, item := range order.Items {
+			items = append(items, models.CustomerItem{CustomerID: customerID, ItemID: item.ItemID, CostEur: item.CostEur})
+			summary.NbrOfPurchasedItems++
+			summary.TotalAmountEur += item.CostEur
+		}
+	}
+
+	return models.CustomerExport{
+		CustomerID: customerID,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Orders:     orders,
+		Items:      items,
+		Summary:    summary,
+	}, nil
+}
+
+// EraseCustomerHandler
+// Removes or pseudonymizes all orders of a customer, mode is set with the ?mode= query parameter
+func EraseCustomerHandler(collections collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collections)
+		customerID := c.Param("customerId")
+
+		mode := models.ErasureMode(c.DefaultQuery("mode", string(models.ErasureModeDelete)))
+		if mode != models.ErasureModeDelete && mode != models.ErasureModePseudonymize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid erasure mode"})
+			return
+		}
+
+		record, err := store.EraseCustomer(tenant.FromContext(c), customerID, mode)
+		if err != nil {
+			writeLookupError(c, err)
+			return
+		}
+		audit.RecordErasure(c, record)
+
+		logging.FromContext(c.Request.Context()).Info("customer erased",
+			slog.String(logging.KeyCustomerID, customerID),
+			slog.String("erasureId", record.ErasureID),
+			slog.String("mode", string(mode)),
+			slog.Int("ordersAffected", record.OrdersAffected),
+		)
+
+		c.JSON(http.StatusOK, gin.H{"erasure": record})
+	}
+}
+
+// ListErasuresHandler
+// Retrieves the erasure records of the caller's tenant, oldest first, so erasures can be accounted for
+func ListErasuresHandler(collections collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collections)
+		records, err := store.GetErasureRecords(tenant.FromContext(c))
+		if err != nil {
+			_ = c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve erasures"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"erasures": records})
+	}
+}
+
+func writeLookupError(c *gin.Context, err error) {
+	if errors.Is(err, collections.ErrCustomerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	_ = c.Error(err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process customer data"})
+}
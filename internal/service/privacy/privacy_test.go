@@ -0,0 +1,197 @@
+package privacy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(collection *collections.OrderCollection) *gin.Engine {
+	router := gin.Default()
+	router.GET("/customers/:customerId/export", ExportCustomerHandler(collection))
+	router.DELETE("/customers/:customerId/data", EraseCustomerHandler(collection))
+	router.GET("/customers/erasures", ListErasuresHandler(collection))
+	return router
+}
+
+func seedCollection() *collections.OrderCollection {
+	return &collections.OrderCollection{
+		Orders: []models.Order{
+			{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+			{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+			{CustomerID: "01", OrderID: "52", Timestamp: "1637245070515", Items: []models.Item{{ItemID: "20204", CostEur: 7}}},
+		},
+	}
+}
+
+func TestExportCustomerHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(seedCollection())
+
+	t.Run("Valid Customer", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customers/01/export", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+		var export models.CustomerExport
+		err := json.Unmarshal(w.Body.Bytes(), &export)
+		assert.NoError(t, err)
+		assert.Equal(t, "01", export.CustomerID)
+		assert.NotEmpty(t, export.ExportedAt)
+		assert.Len(t, export.Orders, 2)
+		assert.Len(t, export.Items, 3)
+		assert.Equal(t, models.Summary{CustomerID: "01", NbrOfPurchasedItems: 3, TotalAmountEur: 12}, export.Summary)
+	})
+
+	t.Run("Invalid Customer", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customers/99/export", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+// ordersOnly fails every read of a customer other than their orders
+type ordersOnly struct {
+	collections.Collections
+}
+
+func (ordersOnly) GetItemsByCustomer(tenantID, customerID string) ([]models.CustomerItem, error) {
+	return nil, errors.New("items read separately")
+}
+
+func (ordersOnly) GetCustomerSummary(tenantID, customerID string) (models.Summary, error) {
+	return models.Summary{}, errors.New("summary read separately")
+}
+
+// Items and summary come from the same read as the orders, a concurrent change can't make them disagree
+func TestExportSingleRead(t *testing.T) {
+	export, err := Export(ordersOnly{seedCollection()}, models.DefaultTenantID, "01")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.CustomerItem{
+		{CustomerID: "01", ItemID: "20201", CostEur: 2},
+		{CustomerID: "01", ItemID: "20202", CostEur: 3},
+		{CustomerID: "01", ItemID: "20204", CostEur: 7},
+	}, export.Items)
+	assert.Equal(t, models.Summary{CustomerID: "01", NbrOfPurchasedItems: 3, TotalAmountEur: 12}, export.Summary)
+}
+
+func TestEraseCustomerHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type response struct {
+		Erasure models.ErasureRecord `json:"erasure"`
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		collection := seedCollection()
+		router := setupRouter(collection)
+
+		req, _ := http.NewRequest("DELETE", "/customers/01/data", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp response
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ErasureModeDelete, resp.Erasure.Mode)
+		assert.Equal(t, 2, resp.Erasure.OrdersAffected)
+		assert.Equal(t, 3, resp.Erasure.ItemsAffected)
+		assert.Equal(t, collections.SubjectRef(nil, "01"), resp.Erasure.SubjectRef)
+		assert.NotContains(t, w.Body.String(), `"01"`)
+
+		// The customer is gone and summaries only hold the remaining customer
+		_, err = collection.GetOrdersByCustomer(models.DefaultTenantID, "01")
+		assert.ErrorIs(t, err, collections.ErrCustomerNotFound)
+		summaries, _ := collection.GetAllCustomerSummaries(models.DefaultTenantID)
+		assert.Len(t, summaries, 1)
+
+		records, _ := collection.GetErasureRecords(models.DefaultTenantID)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, resp.Erasure.ErasureID, records[0].ErasureID)
+		}
+	})
+
+	t.Run("Pseudonymize", func(t *testing.T) {
+		collection := seedCollection()
+		router := setupRouter(collection)
+
+		req, _ := http.NewRequest("DELETE", "/customers/01/data?mode=pseudonymize", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Orders are kept for reporting but no longer linked to the customer
+		_, err := collection.GetOrdersByCustomer(models.DefaultTenantID, "01")
+		assert.ErrorIs(t, err, collections.ErrCustomerNotFound)
+		assert.Len(t, collection.Orders, 3)
+		summaries, _ := collection.GetAllCustomerSummaries(models.DefaultTenantID)
+		assert.Len(t, summaries, 2)
+	})
+
+	t.Run("Invalid Mode", func(t *testing.T) {
+		router := setupRouter(seedCollection())
+
+		req, _ := http.NewRequest("DELETE", "/customers/01/data?mode=shred", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Customer", func(t *testing.T) {
+		router := setupRouter(seedCollection())
+
+		req, _ := http.NewRequest("DELETE", "/customers/99/data", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestListErasuresHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(seedCollection())
+
+	list := func() []models.ErasureRecord {
+		req, _ := http.NewRequest("GET", "/customers/erasures", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Erasures []models.ErasureRecord `json:"erasures"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Erasures
+	}
+	assert.Empty(t, list())
+
+	for _, target := range []string{"/customers/01/data", "/customers/02/data?mode=pseudonymize"} {
+		req, _ := http.NewRequest("DELETE", target, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	erasures := list()
+	if assert.Len(t, erasures, 2) {
+		assert.Equal(t, collections.SubjectRef(nil, "01"), erasures[0].SubjectRef)
+		assert.Equal(t, models.ErasureModeDelete, erasures[0].Mode)
+		assert.Equal(t, models.ErasureModePseudonymize, erasures[1].Mode)
+	}
+}
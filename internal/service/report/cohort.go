@@ -0,0 +1,162 @@
+package report
+
+import (
+	"math"
+	"net/http"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// customerActivity tracks when and how much a single customer purchased
+type customerActivity struct {
+	firstMonth   int
+	orders       int
+	totalSpend   int
+	monthlySpend map[int]int // Keyed by month index
+}
+
+// GetCohortsHandler
+// Retrieves retention, repeat-purchase rate and spend for customers grouped by first order month.
+// The optional ?months= query parameter limits how many months after the first order are reported
+func GetCohortsHandler(collections collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collections)
+		maxMonths, ok := ParseMonths(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		orders, err := store.GetAllOrders(tenant.FromContext(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"cohorts": BuildCohorts(orders, maxMonths)})
+	}
+}
+
+// ParseMonths reads the ?months= query parameter, -1 when it is missing and false when it is invalid
+func ParseMonths(c *gin.Context) (int, bool) {
+	months := c.Query("months")
+	if months == "" {
+		return -1, true
+	}
+	n, err := strconv.Atoi(months)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// BuildCohorts groups customers by the month of their first order.
+// Months after the first order are reported up to the latest month with any order,
+// or up to maxMonths when it isn't negative. Orders without a usable timestamp are left out of every figure,
+// so the total spend of a cohort is the sum of its months.
+func BuildCohorts(orders []models.Order, maxMonths int) []models.Cohort {
+	activity := make(map[string]*customerActivity)
+	latestMonth := math.MinInt
+
+	for _, order := range orders {
+		t, err := order.Time()
+		if err != nil {
+			// Orders without a usable timestamp can't be placed in a cohort
+			continue
+		}
+		month := monthIndex(t)
+		latestMonth = max(latestMonth, month)
+
+		customer, ok := activity[order.CustomerID]
+		if !ok {
+			customer = &customerActivity{firstMonth: month, monthlySpend: make(map[int]int)}
+			activity[order.CustomerID] = customer
+		}
+		customer.firstMonth = min(customer.firstMonth, month)
+		customer.orders++
+		customer.totalSpend += orderAmount(order)
+		customer.monthlySpend[month] += orderAmount(order)
+	}
+
+	cohorts := make(map[int]*models.Cohort)
+	members := make(map[int][]*customerActivity)
+	repeaters := make(map[int]int)
+
+	for _, customer := range activity {
+		cohort, ok := cohorts[customer.firstMonth]
+		if !ok {
+			cohort = &models.Cohort{Cohort: monthLabel(customer.firstMonth)}
+			cohorts[customer.firstMonth] = cohort
+		}
+		cohort.Customers++
+		cohort.TotalAmountEur += customer.totalSpend
+		if customer.orders > 1 {
+			repeaters[customer.firstMonth]++
+		}
+		members[customer.firstMonth] = append(members[customer.firstMonth], customer)
+	}
+
+	result := make([]models.Cohort, 0, len(cohorts))
+	for firstMonth, cohort := range cohorts {
+		cohort.RepeatPurchaseRate = rate(repeaters[firstMonth], cohort.Customers)
+
+		lastOffset := latestMonth - firstMonth
+		if maxMonths >= 0 {
+			lastOffset = min(lastOffset, maxMonths)
+		}
+
+		cumulative := 0
+		for offset := 0; offset <= lastOffset; offset++ {
+			month := firstMonth + offset
+			cohortMonth := models.CohortMonth{Offset: offset, Month: monthLabel(month)}
+			for _, customer := range members[firstMonth] {
+				if spend, ok := customer.monthlySpend[month]; ok {
+					cohortMonth.ActiveCustomers++
+					cohortMonth.AmountEur += spend
+				}
+			}
+			cumulative += cohortMonth.AmountEur
+			cohortMonth.CumulativeAmountEur = cumulative
+			cohortMonth.RetentionRate = rate(cohortMonth.ActiveCustomers, cohort.Customers)
+			cohort.Months = append(cohort.Months, cohortMonth)
+		}
+		result = append(result, *cohort)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Cohort < result[j].Cohort
+	})
+	return result
+}
+
+func orderAmount(order models.Order) int {
+	amount := 0
+	for _, item := range order.Items {
+		amount += item.CostEur
+	}
+	return amount
+}
+
+// monthIndex counts months since year zero so consecutive months differ by one
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+func monthLabel(index int) string {
+	return time.Date(index/12, time.Month(index%12+1), 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+}
+
+// rate returns part/total rounded to four decimals
+func rate(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*10000) / 10000
+}
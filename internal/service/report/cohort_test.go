@@ -0,0 +1,125 @@
+package report
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// timestamp formats a date the way orders carry it, in milliseconds since the epoch
+func timestamp(year int, month time.Month, day int) string {
+	return strconv.FormatInt(time.Date(year, month, day, 12, 0, 0, 0, time.UTC).UnixMilli(), 10)
+}
+
+func seedCollection() *collections.OrderCollection {
+	return &collections.OrderCollection{
+		Orders: []models.Order{
+			{CustomerID: "01", OrderID: "50", Timestamp: timestamp(2021, time.January, 5), Items: []models.Item{{ItemID: "20201", CostEur: 2}}},
+			{CustomerID: "02", OrderID: "51", Timestamp: timestamp(2021, time.January, 20), Items: []models.Item{{ItemID: "20202", CostEur: 3}}},
+			{CustomerID: "03", OrderID: "52", Timestamp: timestamp(2021, time.February, 1), Items: []models.Item{{ItemID: "20203", CostEur: 4}}},
+			{CustomerID: "03", OrderID: "53", Timestamp: timestamp(2021, time.February, 9), Items: []models.Item{{ItemID: "20204", CostEur: 5}}},
+			{CustomerID: "01", OrderID: "54", Timestamp: timestamp(2021, time.March, 2), Items: []models.Item{{ItemID: "20205", CostEur: 6}, {ItemID: "20206", CostEur: 1}}},
+		},
+	}
+}
+
+func TestGetCohortsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/reports/cohorts", GetCohortsHandler(seedCollection()))
+
+	type response struct {
+		Cohorts []models.Cohort `json:"cohorts"`
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/reports/cohorts", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp response
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.NoError(t, err)
+
+		expected := []models.Cohort{
+			{
+				Cohort:             "2021-01",
+				Customers:          2,
+				RepeatPurchaseRate: 0.5,
+				TotalAmountEur:     12,
+				Months: []models.CohortMonth{
+					{Offset: 0, Month: "2021-01", ActiveCustomers: 2, RetentionRate: 1, AmountEur: 5, CumulativeAmountEur: 5},
+					{Offset: 1, Month: "2021-02", ActiveCustomers: 0, RetentionRate: 0, AmountEur: 0, CumulativeAmountEur: 5},
+					{Offset: 2, Month: "2021-03", ActiveCustomers: 1, RetentionRate: 0.5, AmountEur: 7, CumulativeAmountEur: 12},
+				},
+			},
+			{
+				Cohort:             "2021-02",
+				Customers:          1,
+				RepeatPurchaseRate: 1,
+				TotalAmountEur:     9,
+				Months: []models.CohortMonth{
+					{Offset: 0, Month: "2021-02", ActiveCustomers: 1, RetentionRate: 1, AmountEur: 9, CumulativeAmountEur: 9},
+					{Offset: 1, Month: "2021-03", ActiveCustomers: 0, RetentionRate: 0, AmountEur: 0, CumulativeAmountEur: 9},
+				},
+			},
+		}
+		assert.Equal(t, expected, resp.Cohorts)
+	})
+
+	t.Run("Limit months", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/reports/cohorts?months=0", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp response
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.NoError(t, err)
+		for _, cohort := range resp.Cohorts {
+			assert.Len(t, cohort.Months, 1)
+		}
+	})
+
+	t.Run("Invalid months", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/reports/cohorts?months=-1", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestBuildCohortsSkipsInvalidTimestamps(t *testing.T) {
+	orders := []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "not-a-timestamp", Items: []models.Item{{ItemID: "20201", CostEur: 2}}},
+	}
+
+	assert.Empty(t, BuildCohorts(orders, -1))
+}
+
+func TestBuildCohortsTotalsMatchMonths(t *testing.T) {
+	// The second order can't be placed in a month, so it isn't part of the total either
+	orders := []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: timestamp(2021, time.January, 5), Items: []models.Item{{ItemID: "20201", CostEur: 2}}},
+		{CustomerID: "01", OrderID: "51", Timestamp: "not-a-timestamp", Items: []models.Item{{ItemID: "20202", CostEur: 30}}},
+	}
+
+	cohorts := BuildCohorts(orders, -1)
+	if assert.Len(t, cohorts, 1) {
+		assert.Equal(t, 2, cohorts[0].TotalAmountEur)
+		assert.Equal(t, 2, cohorts[0].Months[len(cohorts[0].Months)-1].CumulativeAmountEur)
+		assert.Zero(t, cohorts[0].RepeatPurchaseRate)
+	}
+}
@@ -0,0 +1,109 @@
+package report
+
+import (
+	"net/http"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRFMHandler
+// Retrieves the Recency, Frequency and Monetary scores of all customers
+func GetRFMHandler(collections collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collections)
+		orders, err := store.GetAllOrders(tenant.FromContext(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"rfm": ListRFM(orders, time.Now())})
+	}
+}
+
+// ListRFM scores every customer like ScoreRFM, ordered by customer ID
+func ListRFM(orders []models.Order, now time.Time) []models.RFM {
+	scores := ScoreRFM(orders, now)
+
+	rfm := make([]models.RFM, 0, len(scores))
+	for _, score := range scores {
+		rfm = append(rfm, score)
+	}
+	sort.Slice(rfm, func(i, j int) bool {
+		return rfm[i].CustomerID < rfm[j].CustomerID
+	})
+	return rfm
+}
+
+// ScoreRFM computes the RFM values of every customer with a valid order timestamp and assigns
+// quintile scores relative to all other customers. Higher scores are better: recent, frequent and big spenders get 5.
+func ScoreRFM(orders []models.Order, now time.Time) map[string]models.RFM {
+	lastOrders := make(map[string]time.Time)
+	scores := make(map[string]models.RFM)
+
+	for _, order := range orders {
+		t, err := order.Time()
+		if err != nil {
+			continue
+		}
+
+		score := scores[order.CustomerID]
+		score.CustomerID = order.CustomerID
+		score.Orders++
+		score.TotalAmountEur += orderAmount(order)
+		scores[order.CustomerID] = score
+
+		if last, ok := lastOrders[order.CustomerID]; !ok || t.After(last) {
+			lastOrders[order.CustomerID] = t
+		}
+	}
+
+	customerIDs := make([]string, 0, len(scores))
+	for customerID := range scores {
+		customerIDs = append(customerIDs, customerID)
+	}
+
+	recency := quintiles(customerIDs, func(id string) int64 { return lastOrders[id].UnixMilli() })
+	frequency := quintiles(customerIDs, func(id string) int64 { return int64(scores[id].Orders) })
+	monetary := quintiles(customerIDs, func(id string) int64 { return int64(scores[id].TotalAmountEur) })
+
+	for _, customerID := range customerIDs {
+		score := scores[customerID]
+		last := lastOrders[customerID]
+
+		score.LastOrderAt = last.Format(time.RFC3339)
+		score.DaysSinceLastOrder = max(0, int(now.Sub(last).Hours()/24))
+		score.Recency = recency[customerID]
+		score.Frequency = frequency[customerID]
+		score.Monetary = monetary[customerID]
+		score.Segment = strconv.Itoa(score.Recency) + strconv.Itoa(score.Frequency) + strconv.Itoa(score.Monetary)
+		scores[customerID] = score
+	}
+	return scores
+}
+
+// quintiles ranks the customers by value and splits them into five equally sized groups scored 1 to 5.
+// Customers sharing a value always share the score of the first of them.
+func quintiles(customerIDs []string, value func(string) int64) map[string]int {
+	ranked := append([]string(nil), customerIDs...)
+	sort.Slice(ranked, func(i, j int) bool {
+		return value(ranked[i]) < value(ranked[j])
+	})
+
+	scores := make(map[string]int, len(ranked))
+	for i, customerID := range ranked {
+		if i > 0 && value(ranked[i-1]) == value(customerID) {
+			scores[customerID] = scores[ranked[i-1]]
+			continue
+		}
+		scores[customerID] = i*5/len(ranked) + 1
+	}
+	return scores
+}
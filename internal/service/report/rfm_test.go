@@ -0,0 +1,74 @@
+package report
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreRFM(t *testing.T) {
+	// Customer 05 ordered most recently, most often and spent the most
+	orders := []models.Order{
+		{CustomerID: "01", OrderID: "1", Timestamp: timestamp(2021, time.January, 1), Items: []models.Item{{ItemID: "a", CostEur: 1}}},
+		{CustomerID: "02", OrderID: "2", Timestamp: timestamp(2021, time.February, 1), Items: []models.Item{{ItemID: "a", CostEur: 2}}},
+		{CustomerID: "02", OrderID: "3", Timestamp: timestamp(2021, time.February, 2), Items: []models.Item{{ItemID: "a", CostEur: 1}}},
+		{CustomerID: "03", OrderID: "4", Timestamp: timestamp(2021, time.March, 1), Items: []models.Item{{ItemID: "a", CostEur: 5}}},
+		{CustomerID: "04", OrderID: "5", Timestamp: timestamp(2021, time.April, 1), Items: []models.Item{{ItemID: "a", CostEur: 10}}},
+		{CustomerID: "05", OrderID: "6", Timestamp: timestamp(2021, time.May, 1), Items: []models.Item{{ItemID: "a", CostEur: 10}}},
+		{CustomerID: "05", OrderID: "7", Timestamp: timestamp(2021, time.May, 2), Items: []models.Item{{ItemID: "a", CostEur: 10}}},
+		{CustomerID: "05", OrderID: "8", Timestamp: timestamp(2021, time.May, 3), Items: []models.Item{{ItemID: "a", CostEur: 10}}},
+		{CustomerID: "06", OrderID: "9", Timestamp: "invalid", Items: []models.Item{{ItemID: "a", CostEur: 10}}},
+	}
+	now := time.Date(2021, time.May, 13, 12, 0, 0, 0, time.UTC)
+
+	scores := ScoreRFM(orders, now)
+	assert.Len(t, scores, 5)
+
+	assert.Equal(t, models.RFM{
+		CustomerID:         "05",
+		LastOrderAt:        "2021-05-03T12:00:00Z",
+		DaysSinceLastOrder: 10,
+		Orders:             3,
+		TotalAmountEur:     30,
+		Recency:            5,
+		Frequency:          5,
+		Monetary:           5,
+		Segment:            "555",
+	}, scores["05"])
+
+	assert.Equal(t, "111", scores["01"].Segment)
+	assert.Equal(t, 4, scores["02"].Frequency)
+
+	// Customers 01, 03 and 04 all placed one order so they share the lowest frequency score
+	assert.Equal(t, 1, scores["03"].Frequency)
+	assert.Equal(t, 1, scores["04"].Frequency)
+}
+
+func TestGetRFMHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/reports/rfm", GetRFMHandler(seedCollection()))
+
+	req, _ := http.NewRequest("GET", "/reports/rfm", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		RFM []models.RFM `json:"rfm"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Len(t, resp.RFM, 3)
+	for i, customerID := range []string{"01", "02", "03"} {
+		assert.Equal(t, customerID, resp.RFM[i].CustomerID)
+		assert.Len(t, resp.RFM[i].Segment, 3)
+	}
+}
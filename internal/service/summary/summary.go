@@ -1,24 +1,110 @@
 package summary
 
 import (
+	"errors"
 	"net/http"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
 	"qlikOrders/internal/collections"
+	"qlikOrders/internal/export"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/service/report"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // GetSummariesHandler
-// Retrieves a summary total spend and number of items for all customers
-func GetSummariesHandler(collections *collections.OrderCollection) gin.HandlerFunc {
+// Retrieves a summary total spend and number of items for all customers.
+// The summaries are sent in JSON, MessagePack or Protobuf, or exported as CSV, NDJSON or Parquet,
+// depending on the Accept header or ?format=.
+func GetSummariesHandler(collections collections.Collections) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collections)
+		format, err := codec.Negotiate(c.Query("format"), c.GetHeader("Accept"), codec.ExportFormats...)
+		if err != nil {
+			codec.Render(c, http.StatusNotAcceptable, codec.Status{Error: "Not acceptable", Message: "Supported formats are json, msgpack, protobuf, csv, ndjson and parquet"})
+			return
+		}
 
-		summaries, err := collections.GetAllCustomerSummaries()
+		tenantID := tenant.FromContext(c)
+		if format.IsExport() {
+			// Summaries are streamed from the store rather than loaded at once
+			sent, err := export.StreamRows(c.Writer, format, "summaries", store.EachCustomerSummary(tenantID))
+			if err != nil && !sent {
+				codec.RenderAs(c, http.StatusInternalServerError, format, codec.Status{Error: "Failed to retrieve summaries"})
+				return
+			}
+			if err != nil {
+				_ = c.Error(err)
+			}
+			return
+		}
 
+		summaries, err := store.GetAllCustomerSummaries(tenantID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve summaries"})
+			codec.RenderAs(c, http.StatusInternalServerError, format, codec.Status{Error: "Failed to retrieve summaries"})
 			return
 		}
+		codec.RenderAs(c, http.StatusOK, format, summaryList{Summaries: summaries})
+	}
+}
+
+// summaryList is the body of GET /summaries
+type summaryList struct {
+	Summaries []models.Summary `json:"summaries"`
+}
+
+func (l summaryList) AppendProto(b []byte) []byte {
+	return protobuf.AppendMessages(b, 1, l.Summaries)
+}
+
+// summaryResponse is the body of GET /customers/:customerId/summary, a plain Summary in protobuf
+type summaryResponse struct {
+	Summary models.Summary `json:"summary"`
+}
+
+func (r summaryResponse) AppendProto(b []byte) []byte {
+	return r.Summary.AppendProto(b)
+}
+
+// GetCustomerSummaryHandler
+// Retrieves the summary of a single customer including their RFM scores
+func GetCustomerSummaryHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		summary, err := CustomerSummary(store, tenant.FromContext(c), c.Param("customerId"), time.Now())
+		if errors.Is(err, collections.ErrCustomerNotFound) {
+			codec.Render(c, http.StatusNotFound, codec.Status{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			codec.Render(c, http.StatusInternalServerError, codec.Status{Error: "Failed to retrieve summary"})
+			return
+		}
+
+		codec.Render(c, http.StatusOK, summaryResponse{Summary: summary})
+	}
+}
+
+// CustomerSummary returns the summary of a customer with their RFM scores as of now
+func CustomerSummary(collection collections.Collections, tenantID, customerID string, now time.Time) (models.Summary, error) {
+	summary, err := collection.GetCustomerSummary(tenantID, customerID)
+	if err != nil {
+		return models.Summary{}, err
+	}
+
+	// RFM scores are relative to all customers so every order is needed
+	orders, err := collection.GetAllOrders(tenantID)
+	if err != nil {
+		return models.Summary{}, err
+	}
 
-		c.JSON(http.StatusOK, gin.H{"summaries": summaries})
+	if rfm, ok := report.ScoreRFM(orders, now)[customerID]; ok {
+		rfm.CustomerID = ""
+		summary.RFM = &rfm
 	}
+	return summary, nil
 }
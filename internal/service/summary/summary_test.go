@@ -1,15 +1,20 @@
 package summary
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/codec/protobuf"
 	"qlikOrders/internal/collections"
 	"qlikOrders/internal/models"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/parquet-go/parquet-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetSummariesHandler(t *testing.T) {
@@ -93,3 +98,166 @@ func TestGetSummariesHandler(t *testing.T) {
 		assert.Equal(t, 0, len(response.Summaries))
 	})
 }
+
+func TestGetCustomerSummaryHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	testCollection := &collections.OrderCollection{
+		Orders: []models.Order{
+			{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+			{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+		},
+	}
+	router.GET("/customer/:customerId/summary", GetCustomerSummaryHandler(testCollection))
+
+	t.Run("Valid Customer", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customer/01/summary", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Summary models.Summary `json:"summary"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "01", response.Summary.CustomerID)
+		assert.Equal(t, 2, response.Summary.NbrOfPurchasedItems)
+		assert.Equal(t, 5, response.Summary.TotalAmountEur)
+
+		// The RFM block is scored against customer 02
+		if assert.NotNil(t, response.Summary.RFM) {
+			assert.Equal(t, 1, response.Summary.RFM.Orders)
+			assert.Equal(t, "111", response.Summary.RFM.Segment)
+			assert.Empty(t, response.Summary.RFM.CustomerID)
+		}
+	})
+
+	t.Run("Invalid Customer", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/customer/99/summary", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestGetSummariesHandlerParquet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	testCollection := &collections.OrderCollection{Orders: []models.Order{
+		{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+	}}
+	router.GET("/summary", GetSummariesHandler(testCollection))
+
+	req, _ := http.NewRequest("GET", "/summary", nil)
+	req.Header.Set("Accept", "application/vnd.apache.parquet")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.apache.parquet", w.Header().Get("Content-Type"))
+
+	summaries, err := parquet.Read[models.Summary](bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Summary{
+		{CustomerID: "01", NbrOfPurchasedItems: 2, TotalAmountEur: 5},
+		{CustomerID: "02", NbrOfPurchasedItems: 1, TotalAmountEur: 5},
+	}, summaries)
+}
+
+// summaryListMessage decodes a SummaryList
+type summaryListMessage struct {
+	Summaries []models.Summary `json:"summaries"`
+}
+
+func (l *summaryListMessage) UnmarshalProto(b []byte) error {
+	r := protobuf.NewReader(b)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			var summary models.Summary
+			r.Message(&summary)
+			l.Summaries = append(l.Summaries, summary)
+		default:
+			r.Skip()
+		}
+	}
+	return r.Err()
+}
+
+func TestSummaryHandlersFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	testCollection := &collections.OrderCollection{
+		Orders: []models.Order{
+			{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+			{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+		},
+	}
+	router.GET("/summary", GetSummariesHandler(testCollection))
+	router.GET("/customer/:customerId/summary", GetCustomerSummaryHandler(testCollection))
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Summaries", func(t *testing.T) {
+		var expected summaryListMessage
+		w := get("/summary", "application/json")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expected))
+
+		for _, format := range []codec.Format{codec.FormatMsgPack, codec.FormatProtobuf} {
+			w := get("/summary", format.ContentType())
+			require.Equal(t, http.StatusOK, w.Code, format)
+
+			var decoded summaryListMessage
+			require.NoError(t, codec.Unmarshal(format, w.Body.Bytes(), &decoded), format)
+			assert.Equal(t, expected, decoded, format)
+		}
+	})
+
+	t.Run("Customer summary", func(t *testing.T) {
+		var expected struct {
+			Summary models.Summary `json:"summary"`
+		}
+		w := get("/customer/01/summary", "application/json")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expected))
+		require.NotNil(t, expected.Summary.RFM)
+
+		var fromMsgPack struct {
+			Summary models.Summary `json:"summary"`
+		}
+		w = get("/customer/01/summary", "application/msgpack")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, codec.Unmarshal(codec.FormatMsgPack, w.Body.Bytes(), &fromMsgPack))
+		assert.Equal(t, expected, fromMsgPack)
+
+		// Protobuf sends the Summary message itself
+		var fromProtobuf models.Summary
+		w = get("/customer/01/summary", "application/x-protobuf")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, codec.Unmarshal(codec.FormatProtobuf, w.Body.Bytes(), &fromProtobuf))
+		assert.Equal(t, expected.Summary, fromProtobuf)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		w := get("/customer/99/summary", "application/x-protobuf")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		var status codec.Status
+		require.NoError(t, codec.Unmarshal(codec.FormatProtobuf, w.Body.Bytes(), &status))
+		assert.NotEmpty(t, status.Error)
+	})
+}
@@ -0,0 +1,196 @@
+package v2
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/service/customer"
+	"qlikOrders/internal/service/order"
+	"qlikOrders/internal/service/privacy"
+	"qlikOrders/internal/service/report"
+	"qlikOrders/internal/service/summary"
+	"qlikOrders/internal/tenant"
+	"qlikOrders/internal/tracing"
+	"qlikOrders/internal/validation"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errUnsupportedBody rejects request bodies in other formats than JSON, the only one v2 accepts
+var errUnsupportedBody = errors.New("v2 bodies are JSON")
+
+// AddOrdersHandler adds a batch of v2 orders, with the limits and quota of v1 batches
+func AddOrdersHandler(collection collections.Collections) gin.HandlerFunc {
+	return order.AddOrdersWith(collection, decodeOrders)
+}
+
+func decodeOrders(r io.Reader, format codec.Format, maxOrders int) ([]models.Order, error) {
+	if format != codec.FormatJSON {
+		return nil, errUnsupportedBody
+	}
+	orders, err := order.StreamJSON[Order](r, maxOrders)
+	if err != nil {
+		return nil, err
+	}
+	if err := validation.Each(orders); err != nil {
+		return nil, err
+	}
+	return ToModels(orders)
+}
+
+// GetOrdersHandler lists the orders of the tenant, ?customerId= keeps the orders of a single customer
+func GetOrdersHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		tenantID := tenant.FromContext(c)
+		var orders []models.Order
+		var err error
+		if customerID := c.Query("customerId"); customerID != "" {
+			orders, err = store.GetOrdersByCustomer(tenantID, customerID)
+			if errors.Is(err, collections.ErrCustomerNotFound) {
+				orders, err = []models.Order{}, nil
+			}
+		} else {
+			orders, err = store.GetAllOrders(tenantID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, codec.Status{Error: "Failed to retrieve orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"orders": fromOrders(orders)})
+	}
+}
+
+// GetItemsByCustomerHandler pages through the order lines of a customer, or through their purchases per item with ?groupBy=item
+func GetItemsByCustomerHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		query, ok := customer.ParseItemsQuery(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, codec.Status{Error: "Invalid input"})
+			return
+		}
+
+		orders, err := store.GetOrdersByCustomer(tenant.FromContext(c), c.Param("customerId"))
+		if err != nil {
+			writeLookupError(c, err, "Failed to retrieve items")
+			return
+		}
+
+		if query.GroupByItem {
+			c.JSON(http.StatusOK, page(fromItemHistory(customer.GroupByItem(orders, query.ExpandOrder)), query))
+			return
+		}
+		c.JSON(http.StatusOK, page(customerLines(orders, query.ExpandOrder), query))
+	}
+}
+
+func page[T any](entries []T, query customer.ItemsQuery) Page[T] {
+	return Page[T]{
+		Items:  customer.Paginate(entries, query.Limit, query.Offset),
+		Limit:  query.Limit,
+		Offset: query.Offset,
+		Total:  len(entries),
+	}
+}
+
+// GetSummariesHandler lists the summaries of every customer
+func GetSummariesHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		summaries, err := store.GetAllCustomerSummaries(tenant.FromContext(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, codec.Status{Error: "Failed to retrieve summaries"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"summaries": fromSummaries(summaries)})
+	}
+}
+
+// GetCustomerSummaryHandler retrieves the summary of a customer including their RFM scores
+func GetCustomerSummaryHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		result, err := summary.CustomerSummary(store, tenant.FromContext(c), c.Param("customerId"), time.Now())
+		if err != nil {
+			writeLookupError(c, err, "Failed to retrieve summary")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"summary": fromSummary(result)})
+	}
+}
+
+// ExportCustomerHandler retrieves everything stored about a customer as a download
+func ExportCustomerHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		bundle, err := privacy.Export(store, tenant.FromContext(c), c.Param("customerId"))
+		if err != nil {
+			writeLookupError(c, err, "Failed to process customer data")
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="customer-export.json"`)
+		c.JSON(http.StatusOK, Export{
+			CustomerID: bundle.CustomerID,
+			ExportedAt: bundle.ExportedAt,
+			Orders:     fromOrders(bundle.Orders),
+			Lines:      customerLines(bundle.Orders, false),
+			Summary:    fromSummary(bundle.Summary),
+		})
+	}
+}
+
+// GetCohortsHandler reports retention and spend of customers grouped by first order month, limited by ?months=
+func GetCohortsHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		maxMonths, ok := report.ParseMonths(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, codec.Status{Error: "Invalid input"})
+			return
+		}
+
+		orders, err := store.GetAllOrders(tenant.FromContext(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, codec.Status{Error: "Failed to retrieve orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"cohorts": fromCohorts(report.BuildCohorts(orders, maxMonths))})
+	}
+}
+
+// GetRFMHandler retrieves the Recency, Frequency and Monetary scores of all customers
+func GetRFMHandler(collection collections.Collections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := tracing.Store(c.Request.Context(), collection)
+		orders, err := store.GetAllOrders(tenant.FromContext(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, codec.Status{Error: "Failed to retrieve orders"})
+			return
+		}
+
+		scores := report.ListRFM(orders, time.Now())
+		rfm := make([]RFM, len(scores))
+		for i, score := range scores {
+			rfm[i] = fromRFM(score)
+		}
+		c.JSON(http.StatusOK, gin.H{"rfm": rfm})
+	}
+}
+
+func writeLookupError(c *gin.Context, err error, message string) {
+	if errors.Is(err, collections.ErrCustomerNotFound) {
+		c.JSON(http.StatusNotFound, codec.Status{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, codec.Status{Error: message})
+}
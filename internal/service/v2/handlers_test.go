@@ -0,0 +1,154 @@
+package v2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCollection() *collections.OrderCollection {
+	return &collections.OrderCollection{Orders: []models.Order{
+		{CustomerID: "01", OrderID: "50", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}}},
+		{CustomerID: "02", OrderID: "51", Timestamp: "1637245070514", Items: []models.Item{{ItemID: "20203", CostEur: 5}}},
+	}}
+}
+
+func TestAddOrdersHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Success",
+			contentType:  "application/json",
+			body:         `[{"customerId":"03","orderId":"52","timestamp":"1637245070515","currency":"EUR","lines":[{"itemId":"20201","quantity":3,"unitPriceMinor":200}]}]`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"message":"Orders added successfully"}`,
+		},
+		{
+			name:         "Invalid fields",
+			contentType:  "application/json",
+			body:         `[{"customerId":"03","orderId":"52","timestamp":"1637245070515","currency":"USD","lines":[{"itemId":"20201","quantity":0,"unitPriceMinor":200}]}]`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid input","message":"[0].currency must be one of EUR, [0].lines[0].quantity must be greater than 0"}`,
+		},
+		{
+			name:         "Too many units",
+			contentType:  "application/json",
+			body:         `[{"customerId":"03","orderId":"52","timestamp":"1637245070515","currency":"EUR","lines":[{"itemId":"20201","quantity":1000,"unitPriceMinor":200},{"itemId":"20202","quantity":1,"unitPriceMinor":200}]}]`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid input","message":"[0].lines must hold at most 1000 units"}`,
+		},
+		{
+			name:         "Cents",
+			contentType:  "application/json",
+			body:         `[{"customerId":"03","orderId":"52","timestamp":"1637245070515","currency":"EUR","lines":[{"itemId":"20201","quantity":1,"unitPriceMinor":250}]}]`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid input","message":"[0].lines[0].unitPriceMinor must be a multiple of 100"}`,
+		},
+		{
+			name:         "Not JSON",
+			contentType:  "application/msgpack",
+			body:         "\x90",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid input"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := testCollection()
+			router := gin.New()
+			router.POST("/orders", AddOrdersHandler(collection))
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			if tt.expectedCode == http.StatusCreated {
+				items, err := collection.GetItemsByCustomer(models.DefaultTenantID, "03")
+				assert.NoError(t, err)
+				assert.Len(t, items, 3, "a line of 3 is stored as 3 units")
+			}
+		})
+	}
+}
+
+func TestGetHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	collection := testCollection()
+	router.GET("/orders", GetOrdersHandler(collection))
+	router.GET("/customer/:customerId/items", GetItemsByCustomerHandler(collection))
+	router.GET("/summary", GetSummariesHandler(collection))
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Orders",
+			url:          "/orders?customerId=01",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"orders":[{"customerId":"01","orderId":"50","timestamp":"1637245070513","currency":"EUR","lines":[
+				{"itemId":"20201","quantity":2,"unitPriceMinor":200},
+				{"itemId":"20202","quantity":1,"unitPriceMinor":300}]}]}`,
+		},
+		{
+			name:         "Lines",
+			url:          "/customer/01/items?expand=order&limit=1",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"items":[{"customerId":"01","itemId":"20201","quantity":2,"unitPriceMinor":200,"currency":"EUR","orderId":"50","timestamp":"1637245070513"}],
+				"limit":1,"offset":0,"total":2}`,
+		},
+		{
+			name:         "Grouped",
+			url:          "/customer/01/items?groupBy=item",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"items":[
+				{"itemId":"20201","quantity":2,"totalMinor":400,"currency":"EUR","firstPurchasedAt":"1637245070513","lastPurchasedAt":"1637245070513"},
+				{"itemId":"20202","quantity":1,"totalMinor":300,"currency":"EUR","firstPurchasedAt":"1637245070513","lastPurchasedAt":"1637245070513"}],
+				"limit":0,"offset":0,"total":2}`,
+		},
+		{
+			name:         "Customer not found",
+			url:          "/customer/99/items",
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"error":"customer not found or no items"}`,
+		},
+		{
+			name:         "Summaries",
+			url:          "/summary",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"summaries":[
+				{"customerId":"01","quantity":3,"totalMinor":700,"currency":"EUR"},
+				{"customerId":"02","quantity":1,"totalMinor":500,"currency":"EUR"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,315 @@
+// Package v2 serves version 2 of the API, which states money in minor units with its currency
+// and bought items as lines with a quantity. The payloads are adapted to and from the models
+// stored by the collections, which version 1 serves as they are.
+package v2
+
+import (
+	"fmt"
+	"qlikOrders/internal/codec"
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/validation"
+)
+
+// Currency of every amount, the collections store whole euros
+const Currency = "EUR"
+
+// MinorUnits is the number of minor units, cents, in a euro
+const MinorUnits = 100
+
+// Every unit of a line is stored as an item, these caps keep a batch as large as a v1 body at most
+const (
+	// MaxOrderUnits caps the quantities of the lines of an order added up
+	MaxOrderUnits = 1000
+	// MaxBatchUnits caps the quantities of the lines of every order of a batch added up
+	MaxBatchUnits = 2000
+)
+
+// Order is an order as sent and returned by v2
+type Order struct {
+	CustomerID string `json:"customerId" validate:"required"`
+	OrderID    string `json:"orderId" validate:"required"`
+	Timestamp  string `json:"timestamp" validate:"required,timestamp"`
+	Currency   string `json:"currency" validate:"required,oneof=EUR"`
+	Lines      []Line `json:"lines" validate:"required,min=1,max=100,dive"`
+}
+
+// Line is a quantity of one item bought at the same unit price
+type Line struct {
+	ItemID         string `json:"itemId" validate:"required"`
+	Quantity       int    `json:"quantity" validate:"gt=0,lte=1000"`
+	UnitPriceMinor int64  `json:"unitPriceMinor" validate:"gt=0"`
+}
+
+// CustomerLine is a line of one of a customer's orders
+type CustomerLine struct {
+	CustomerID     string `json:"customerId"`
+	ItemID         string `json:"itemId"`
+	Quantity       int    `json:"quantity"`
+	UnitPriceMinor int64  `json:"unitPriceMinor"`
+	Currency       string `json:"currency"`
+	OrderID        string `json:"orderId,omitempty"`   // Only set when expanded with the order
+	Timestamp      string `json:"timestamp,omitempty"` // Only set when expanded with the order
+}
+
+// ItemSummary aggregates every purchase of one item by a customer
+type ItemSummary struct {
+	ItemID           string   `json:"itemId"`
+	Quantity         int      `json:"quantity"`
+	TotalMinor       int64    `json:"totalMinor"`
+	Currency         string   `json:"currency"`
+	FirstPurchasedAt string   `json:"firstPurchasedAt"`
+	LastPurchasedAt  string   `json:"lastPurchasedAt"`
+	OrderIDs         []string `json:"orderIds,omitempty"` // Only set when expanded with the order
+}
+
+// Page is a page of customer lines or item summaries
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
+
+type Summary struct {
+	CustomerID string `json:"customerId"`
+	Quantity   int    `json:"quantity"`
+	TotalMinor int64  `json:"totalMinor"`
+	Currency   string `json:"currency"`
+	RFM        *RFM   `json:"rfm,omitempty"` // Only set on per-customer summaries
+}
+
+// RFM holds the Recency, Frequency and Monetary values of a customer and their quintile scores from 1 to 5
+type RFM struct {
+	CustomerID         string `json:"customerId,omitempty"`
+	LastOrderAt        string `json:"lastOrderAt"`
+	DaysSinceLastOrder int    `json:"daysSinceLastOrder"`
+	Orders             int    `json:"orders"`
+	TotalMinor         int64  `json:"totalMinor"`
+	Currency           string `json:"currency"`
+	Recency            int    `json:"recency"`
+	Frequency          int    `json:"frequency"`
+	Monetary           int    `json:"monetary"`
+	Segment            string `json:"segment"`
+}
+
+// Cohort groups customers by the month of their first order
+type Cohort struct {
+	Cohort             string        `json:"cohort"`
+	Customers          int           `json:"customers"`
+	RepeatPurchaseRate float64       `json:"repeatPurchaseRate"`
+	TotalMinor         int64         `json:"totalMinor"`
+	Currency           string        `json:"currency"`
+	Months             []CohortMonth `json:"months"`
+}
+
+type CohortMonth struct {
+	Offset                int     `json:"offset"`
+	Month                 string  `json:"month"`
+	ActiveCustomers       int     `json:"activeCustomers"`
+	RetentionRate         float64 `json:"retentionRate"`
+	AmountMinor           int64   `json:"amountMinor"`
+	CumulativeAmountMinor int64   `json:"cumulativeAmountMinor"`
+}
+
+// Export bundles everything stored about a single customer
+type Export struct {
+	CustomerID string         `json:"customerId"`
+	ExportedAt string         `json:"exportedAt"`
+	Orders     []Order        `json:"orders"`
+	Lines      []CustomerLine `json:"lines"`
+	Summary    Summary        `json:"summary"`
+}
+
+// Status is the body of v2 error responses, the server adds the ID of the request to the v1 bodies
+type Status struct {
+	RequestID string `json:"requestId"`
+	codec.Status
+}
+
+// ToModels converts validated orders to the stored models, expanding every line into one item per unit.
+// Orders and batches holding more units than MaxOrderUnits and MaxBatchUnits are rejected before they are expanded,
+// and so are unit prices that aren't whole euros, the amounts the collections store.
+func ToModels(orders []Order) ([]models.Order, error) {
+	var fields []validation.FieldError
+	batchUnits := 0
+	for i, order := range orders {
+		units := 0
+		for j, line := range order.Lines {
+			units += line.Quantity
+			if line.UnitPriceMinor%MinorUnits != 0 {
+				fields = append(fields, validation.FieldError{
+					Field:   fmt.Sprintf("[%d].lines[%d].unitPriceMinor", i, j),
+					Message: fmt.Sprintf("must be a multiple of %d", MinorUnits),
+					Rule:    "multiple",
+				})
+			}
+		}
+		if units > MaxOrderUnits {
+			fields = append(fields, validation.FieldError{
+				Field:   fmt.Sprintf("[%d].lines", i),
+				Message: fmt.Sprintf("must hold at most %d units", MaxOrderUnits),
+				Rule:    "max",
+			})
+		}
+		batchUnits += units
+	}
+	if batchUnits > MaxBatchUnits {
+		fields = append(fields, validation.FieldError{
+			Field:   "lines",
+			Message: fmt.Sprintf("of a batch must hold at most %d units", MaxBatchUnits),
+			Rule:    "max",
+		})
+	}
+	if len(fields) > 0 {
+		return nil, &validation.Error{Fields: fields}
+	}
+
+	converted := make([]models.Order, len(orders))
+	for i, order := range orders {
+		converted[i] = models.Order{CustomerID: order.CustomerID, OrderID: order.OrderID, Timestamp: order.Timestamp}
+		for _, line := range order.Lines {
+			item := models.Item{ItemID: line.ItemID, CostEur: int(line.UnitPriceMinor / MinorUnits)}
+			for range line.Quantity {
+				converted[i].Items = append(converted[i].Items, item)
+			}
+		}
+	}
+	return converted, nil
+}
+
+// FromOrder converts a stored order, units of the same item at the same price become one line,
+// in the order the item was first listed
+func FromOrder(order models.Order) Order {
+	type key struct {
+		itemID  string
+		costEur int
+	}
+
+	converted := Order{CustomerID: order.CustomerID, OrderID: order.OrderID, Timestamp: order.Timestamp, Currency: Currency, Lines: []Line{}}
+	index := make(map[key]int)
+	for _, item := range order.Items {
+		k := key{item.ItemID, item.CostEur}
+		i, ok := index[k]
+		if !ok {
+			i = len(converted.Lines)
+			index[k] = i
+			converted.Lines = append(converted.Lines, Line{ItemID: item.ItemID, UnitPriceMinor: minor(item.CostEur)})
+		}
+		converted.Lines[i].Quantity++
+	}
+	return converted
+}
+
+func fromOrders(orders []models.Order) []Order {
+	converted := make([]Order, len(orders))
+	for i, order := range orders {
+		converted[i] = FromOrder(order)
+	}
+	return converted
+}
+
+// customerLines lists the lines of every order, with their order when expandOrder is set
+func customerLines(orders []models.Order, expandOrder bool) []CustomerLine {
+	lines := []CustomerLine{}
+	for _, order := range orders {
+		for _, line := range FromOrder(order).Lines {
+			customerLine := CustomerLine{
+				CustomerID:     order.CustomerID,
+				ItemID:         line.ItemID,
+				Quantity:       line.Quantity,
+				UnitPriceMinor: line.UnitPriceMinor,
+				Currency:       Currency,
+			}
+			if expandOrder {
+				customerLine.OrderID = order.OrderID
+				customerLine.Timestamp = order.Timestamp
+			}
+			lines = append(lines, customerLine)
+		}
+	}
+	return lines
+}
+
+func fromItemHistory(history []models.ItemHistory) []ItemSummary {
+	converted := make([]ItemSummary, len(history))
+	for i, entry := range history {
+		converted[i] = ItemSummary{
+			ItemID:           entry.ItemID,
+			Quantity:         entry.Units,
+			TotalMinor:       minor(entry.TotalAmountEur),
+			Currency:         Currency,
+			FirstPurchasedAt: entry.FirstPurchasedAt,
+			LastPurchasedAt:  entry.LastPurchasedAt,
+			OrderIDs:         entry.OrderIDs,
+		}
+	}
+	return converted
+}
+
+func fromSummary(summary models.Summary) Summary {
+	converted := Summary{
+		CustomerID: summary.CustomerID,
+		Quantity:   summary.NbrOfPurchasedItems,
+		TotalMinor: minor(summary.TotalAmountEur),
+		Currency:   Currency,
+	}
+	if summary.RFM != nil {
+		rfm := fromRFM(*summary.RFM)
+		converted.RFM = &rfm
+	}
+	return converted
+}
+
+func fromSummaries(summaries []models.Summary) []Summary {
+	converted := make([]Summary, len(summaries))
+	for i, summary := range summaries {
+		converted[i] = fromSummary(summary)
+	}
+	return converted
+}
+
+func fromRFM(rfm models.RFM) RFM {
+	return RFM{
+		CustomerID:         rfm.CustomerID,
+		LastOrderAt:        rfm.LastOrderAt,
+		DaysSinceLastOrder: rfm.DaysSinceLastOrder,
+		Orders:             rfm.Orders,
+		TotalMinor:         minor(rfm.TotalAmountEur),
+		Currency:           Currency,
+		Recency:            rfm.Recency,
+		Frequency:          rfm.Frequency,
+		Monetary:           rfm.Monetary,
+		Segment:            rfm.Segment,
+	}
+}
+
+func fromCohorts(cohorts []models.Cohort) []Cohort {
+	converted := make([]Cohort, len(cohorts))
+	for i, cohort := range cohorts {
+		months := make([]CohortMonth, len(cohort.Months))
+		for j, month := range cohort.Months {
+			months[j] = CohortMonth{
+				Offset:                month.Offset,
+				Month:                 month.Month,
+				ActiveCustomers:       month.ActiveCustomers,
+				RetentionRate:         month.RetentionRate,
+				AmountMinor:           minor(month.AmountEur),
+				CumulativeAmountMinor: minor(month.CumulativeAmountEur),
+			}
+		}
+		converted[i] = Cohort{
+			Cohort:             cohort.Cohort,
+			Customers:          cohort.Customers,
+			RepeatPurchaseRate: cohort.RepeatPurchaseRate,
+			TotalMinor:         minor(cohort.TotalAmountEur),
+			Currency:           Currency,
+			Months:             months,
+		}
+	}
+	return converted
+}
+
+// minor converts whole euros to cents
+func minor(eur int) int64 {
+	return int64(eur) * MinorUnits
+}
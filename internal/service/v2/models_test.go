@@ -0,0 +1,97 @@
+package v2
+
+import (
+	"qlikOrders/internal/models"
+	"qlikOrders/internal/validation"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToModels(t *testing.T) {
+	orders := []Order{{
+		CustomerID: "01",
+		OrderID:    "50",
+		Timestamp:  "1637245070513",
+		Currency:   Currency,
+		Lines:      []Line{{ItemID: "20201", Quantity: 2, UnitPriceMinor: 200}, {ItemID: "20202", Quantity: 1, UnitPriceMinor: 300}},
+	}}
+
+	converted, err := ToModels(orders)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Order{{
+		CustomerID: "01",
+		OrderID:    "50",
+		Timestamp:  "1637245070513",
+		Items:      []models.Item{{ItemID: "20201", CostEur: 2}, {ItemID: "20201", CostEur: 2}, {ItemID: "20202", CostEur: 3}},
+	}}, converted)
+
+	t.Run("Prices in cents", func(t *testing.T) {
+		order := orders[0]
+		order.Lines = []Line{order.Lines[0], {ItemID: "20202", Quantity: 1, UnitPriceMinor: 350}}
+
+		_, err := ToModels([]Order{order})
+		var invalid *validation.Error
+		require.ErrorAs(t, err, &invalid)
+		assert.Equal(t, []validation.FieldError{{Field: "[0].lines[1].unitPriceMinor", Message: "must be a multiple of 100", Rule: "multiple"}}, invalid.Fields)
+	})
+
+	t.Run("Too many lines", func(t *testing.T) {
+		order := orders[0]
+		order.Lines = slices.Repeat(order.Lines[:1], 101)
+
+		err := validation.Each([]Order{order})
+		var invalid *validation.Error
+		require.ErrorAs(t, err, &invalid)
+		assert.Equal(t, "[0].lines", invalid.Fields[0].Field)
+		assert.Equal(t, "max", invalid.Fields[0].Rule)
+	})
+
+	t.Run("Too many units", func(t *testing.T) {
+		large := orders[0]
+		large.Lines = []Line{{ItemID: "20201", Quantity: 1000, UnitPriceMinor: 200}}
+		batch := []Order{orders[0], large, large}
+		batch[0].Lines = append([]Line{{ItemID: "20203", Quantity: 1000, UnitPriceMinor: 200}}, batch[0].Lines...)
+
+		_, err := ToModels(batch)
+		var invalid *validation.Error
+		require.ErrorAs(t, err, &invalid)
+		assert.Equal(t, []validation.FieldError{
+			{Field: "[0].lines", Message: "must hold at most 1000 units", Rule: "max"},
+			{Field: "lines", Message: "of a batch must hold at most 2000 units", Rule: "max"},
+		}, invalid.Fields)
+	})
+}
+
+func TestFromOrder(t *testing.T) {
+	order := models.Order{
+		CustomerID: "01",
+		OrderID:    "50",
+		Timestamp:  "1637245070513",
+		Items: []models.Item{
+			{ItemID: "20201", CostEur: 2},
+			{ItemID: "20202", CostEur: 3},
+			{ItemID: "20201", CostEur: 2},
+			{ItemID: "20201", CostEur: 4},
+		},
+	}
+
+	assert.Equal(t, Order{
+		CustomerID: "01",
+		OrderID:    "50",
+		Timestamp:  "1637245070513",
+		Currency:   Currency,
+		Lines: []Line{
+			{ItemID: "20201", Quantity: 2, UnitPriceMinor: 200},
+			{ItemID: "20202", Quantity: 1, UnitPriceMinor: 300},
+			{ItemID: "20201", Quantity: 1, UnitPriceMinor: 400},
+		},
+	}, FromOrder(order))
+
+	// Orders survive the round trip up to the order of their items
+	converted, err := ToModels([]Order{FromOrder(order)})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, order.Items, converted[0].Items)
+}
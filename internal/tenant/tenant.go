@@ -0,0 +1,79 @@
+package tenant
+
+import (
+	"errors"
+	"net/http"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/models"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header lets platform API keys, those not bound to a tenant, pick the tenant they act for
+const Header = "X-Tenant-ID"
+
+// The key the resolved tenant ID is stored under in the gin context
+const tenantKey = "tenant.id"
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var (
+	// ErrInvalidTenant is returned by Decide when the requested tenant isn't a valid ID
+	ErrInvalidTenant = errors.New("invalid tenant")
+	// ErrForeignTenant is returned by Decide when a caller asks for another tenant than the one they are bound to
+	ErrForeignTenant = errors.New("credentials are bound to another tenant")
+)
+
+// Decide returns the tenant a caller acts for, requested is the tenant they asked for, if any.
+// principal is nil for anonymous callers. Only platform API keys can pick any tenant, every other caller
+// is bound to their own tenant, the default tenant when their credentials name none.
+func Decide(principal *auth.Principal, requested string) (string, error) {
+	if requested != "" && !validID.MatchString(requested) {
+		return "", ErrInvalidTenant
+	}
+	if principal != nil && principal.AnyTenant && principal.Tenant == "" {
+		if requested != "" {
+			return requested, nil
+		}
+		return models.DefaultTenantID, nil
+	}
+
+	bound := models.DefaultTenantID
+	if principal != nil && principal.Tenant != "" {
+		bound = principal.Tenant
+	}
+	if requested != "" && requested != bound {
+		return "", ErrForeignTenant
+	}
+	return bound, nil
+}
+
+// Resolve returns a middleware deciding which tenant a request acts for.
+// Platform API keys pick the tenant with the X-Tenant-ID header and fall back to the default tenant.
+// Every other caller acts for the tenant of their credentials, or the default tenant, asking for another one is rejected with 403.
+func Resolve() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := auth.PrincipalFromContext(c)
+		tenantID, err := Decide(principal, c.GetHeader(Header))
+		if errors.Is(err, ErrInvalidTenant) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "Credentials are bound to another tenant"})
+			return
+		}
+
+		c.Set(tenantKey, tenantID)
+		c.Next()
+	}
+}
+
+// FromContext returns the tenant resolved for the request, the default tenant when Resolve didn't run
+func FromContext(c *gin.Context) string {
+	if tenantID := c.GetString(tenantKey); tenantID != "" {
+		return tenantID
+	}
+	return models.DefaultTenantID
+}
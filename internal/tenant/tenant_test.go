@@ -0,0 +1,97 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/auth"
+	"qlikOrders/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(principal *auth.Principal) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if principal != nil {
+		store := auth.NewMemoryKeyStore(auth.APIKey{ID: principal.ID, Hash: auth.HashKey("secret"), Tenant: principal.Tenant})
+		router.Use(auth.New(auth.APIKeyAuthenticator{Store: store}).Authenticate())
+	}
+	router.Use(Resolve())
+	router.GET("/tenant", func(c *gin.Context) {
+		c.String(http.StatusOK, FromContext(c))
+	})
+	return router
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name           string
+		principal      *auth.Principal
+		header         string
+		expectedCode   int
+		expectedTenant string
+	}{
+		{name: "Default tenant", expectedCode: http.StatusOK, expectedTenant: models.DefaultTenantID},
+		{name: "Anonymous tenant header", header: "acme", expectedCode: http.StatusForbidden},
+		{name: "Anonymous default tenant header", header: models.DefaultTenantID, expectedCode: http.StatusOK, expectedTenant: models.DefaultTenantID},
+		{name: "Invalid tenant header", header: "acme/../globex", expectedCode: http.StatusBadRequest},
+		{name: "Bound credentials", principal: &auth.Principal{ID: "1", Tenant: "acme"}, expectedCode: http.StatusOK, expectedTenant: "acme"},
+		{name: "Bound credentials with matching header", principal: &auth.Principal{ID: "1", Tenant: "acme"}, header: "acme", expectedCode: http.StatusOK, expectedTenant: "acme"},
+		{name: "Bound credentials with other header", principal: &auth.Principal{ID: "1", Tenant: "acme"}, header: "globex", expectedCode: http.StatusForbidden},
+		{name: "Unbound credentials with header", principal: &auth.Principal{ID: "1"}, header: "globex", expectedCode: http.StatusOK, expectedTenant: "globex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupRouter(tt.principal)
+
+			req, _ := http.NewRequest("GET", "/tenant", nil)
+			if tt.principal != nil {
+				req.Header.Set("X-API-Key", "secret")
+			}
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, tt.expectedTenant, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	platform := &auth.Principal{ID: "platform", AnyTenant: true}
+	bound := &auth.Principal{ID: "acme", Tenant: "acme"}
+	// Tokens without a tenant claim aren't platform keys, they can't reach other tenants
+	unboundToken := &auth.Principal{ID: "user-1"}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		requested string
+		expected  string
+		err       error
+	}{
+		{"Platform key", platform, "globex", "globex", nil},
+		{"Platform key without header", platform, "", models.DefaultTenantID, nil},
+		{"Bound key", bound, "", "acme", nil},
+		{"Bound key naming another tenant", bound, "globex", "", ErrForeignTenant},
+		{"Token without tenant", unboundToken, "", models.DefaultTenantID, nil},
+		{"Token without tenant naming a tenant", unboundToken, "globex", "", ErrForeignTenant},
+		{"Anonymous naming a tenant", nil, "globex", "", ErrForeignTenant},
+		{"Invalid tenant", platform, "a b", "", ErrInvalidTenant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantID, err := Decide(tt.principal, tt.requested)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expected, tenantID)
+		})
+	}
+}
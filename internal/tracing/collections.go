@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"iter"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/models"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Store returns collections tracing every call in a span, a child of the span in ctx.
+// Handlers wrap the collections they were given for each request, as the collections don't take a context.
+// Customer IDs are never recorded, spans only name the tenant.
+func Store(ctx context.Context, store collections.Collections) collections.Collections {
+	return &tracedStore{ctx: ctx, store: store}
+}
+
+type tracedStore struct {
+	ctx   context.Context
+	store collections.Collections
+}
+
+var _ collections.Collections = (*tracedStore)(nil)
+
+// span starts the span of an operation of the collections
+func (s *tracedStore) span(operation, tenantID string, attrs ...attribute.KeyValue) func(error) {
+	_, span := Start(s.ctx, "Collections."+operation, append(attrs, KeyTenantID.String(tenantID))...)
+	return func(err error) { End(span, err) }
+}
+
+func (s *tracedStore) AddOrders(tenantID string, newOrders []models.Order) error {
+	items := 0
+	for _, order := range newOrders {
+		items += len(order.Items)
+	}
+	end := s.span("AddOrders", tenantID, KeyOrders.Int(len(newOrders)), KeyItems.Int(items))
+	err := s.store.AddOrders(tenantID, newOrders)
+	end(err)
+	return err
+}
+
+func (s *tracedStore) GetItemsByCustomer(tenantID, customerID string) ([]models.CustomerItem, error) {
+	end := s.span("GetItemsByCustomer", tenantID)
+	items, err := s.store.GetItemsByCustomer(tenantID, customerID)
+	end(err)
+	return items, err
+}
+
+func (s *tracedStore) GetOrdersByCustomer(tenantID, customerID string) ([]models.Order, error) {
+	end := s.span("GetOrdersByCustomer", tenantID)
+	orders, err := s.store.GetOrdersByCustomer(tenantID, customerID)
+	end(err)
+	return orders, err
+}
+
+func (s *tracedStore) GetAllOrders(tenantID string) ([]models.Order, error) {
+	end := s.span("GetAllOrders", tenantID)
+	orders, err := s.store.GetAllOrders(tenantID)
+	end(err)
+	return orders, err
+}
+
+// EachOrder traces the iteration as a whole, its span ends once the orders are consumed
+func (s *tracedStore) EachOrder(tenantID string) iter.Seq2[models.Order, error] {
+	return traceEach(s, "EachOrder", tenantID, s.store.EachOrder(tenantID))
+}
+
+func (s *tracedStore) GetCustomerSummary(tenantID, customerID string) (models.Summary, error) {
+	end := s.span("GetCustomerSummary", tenantID)
+	summary, err := s.store.GetCustomerSummary(tenantID, customerID)
+	end(err)
+	return summary, err
+}
+
+func (s *tracedStore) GetAllCustomerSummaries(tenantID string) ([]models.Summary, error) {
+	end := s.span("GetAllCustomerSummaries", tenantID)
+	summaries, err := s.store.GetAllCustomerSummaries(tenantID)
+	end(err)
+	return summaries, err
+}
+
+func (s *tracedStore) EachCustomerSummary(tenantID string) iter.Seq2[models.Summary, error] {
+	return traceEach(s, "EachCustomerSummary", tenantID, s.store.EachCustomerSummary(tenantID))
+}
+
+// traceEach wraps an iteration of the collections in a span
+func traceEach[T any](s *tracedStore, operation, tenantID string, seq iter.Seq2[T, error]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		end := s.span(operation, tenantID)
+		var err error
+		defer func() { end(err) }()
+		for value, valueErr := range seq {
+			err = valueErr
+			if !yield(value, valueErr) {
+				return
+			}
+		}
+	}
+}
+
+func (s *tracedStore) GetRelatedItems(tenantID, itemID string, limit int) ([]models.RelatedItem, error) {
+	end := s.span("GetRelatedItems", tenantID, attribute.String("item.id", itemID))
+	related, err := s.store.GetRelatedItems(tenantID, itemID, limit)
+	end(err)
+	return related, err
+}
+
+func (s *tracedStore) EraseCustomer(tenantID, customerID string, mode models.ErasureMode) (models.ErasureRecord, error) {
+	end := s.span("EraseCustomer", tenantID, attribute.String("erasure.mode", string(mode)))
+	record, err := s.store.EraseCustomer(tenantID, customerID, mode)
+	end(err)
+	return record, err
+}
+
+func (s *tracedStore) GetErasureRecords(tenantID string) ([]models.ErasureRecord, error) {
+	end := s.span("GetErasureRecords", tenantID)
+	records, err := s.store.GetErasureRecords(tenantID)
+	end(err)
+	return records, err
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"qlikOrders/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// Keys of the attributes otelgin sets on server spans
+const (
+	keyHTTPRoute  = attribute.Key("http.route")
+	keyHTTPTarget = attribute.Key("http.target")
+)
+
+// Middleware returns a middleware starting a server span for every request with provider, named by the route.
+// Requests carrying a traceparent header continue the caller's trace. The http.target of the spans is the route
+// rather than the path, which holds customer IDs.
+func Middleware(provider trace.TracerProvider) gin.HandlerFunc {
+	return otelgin.Middleware(ServiceName, otelgin.WithTracerProvider(routeTargets{provider}), otelgin.WithPropagators(Propagator()))
+}
+
+// routeTargets hands out tracers starting spans with their http.target replaced by their http.route
+type routeTargets struct {
+	trace.TracerProvider
+}
+
+func (p routeTargets) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return routeTargetTracer{p.TracerProvider.Tracer(name, opts...)}
+}
+
+type routeTargetTracer struct {
+	trace.Tracer
+}
+
+// Start overrides http.target with the route, the attributes set last win
+func (t routeTargetTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	for _, attr := range config.Attributes() {
+		if attr.Key == keyHTTPRoute {
+			opts = append(opts, trace.WithAttributes(keyHTTPTarget.String(attr.Value.AsString())))
+		}
+	}
+	return t.Tracer.Start(ctx, name, opts...)
+}
+
+// Correlate tags the span of every request with its request ID, and the logger of the request with the trace ID,
+// so logs and traces can be joined. It relies on Middleware and logging.RequestID running first.
+func Correlate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+		if span.SpanContext().IsValid() {
+			span.SetAttributes(KeyRequestID.String(logging.RequestIDFromContext(ctx)))
+			logger := logging.FromContext(ctx).With(logging.KeyTraceID, span.SpanContext().TraceID().String())
+			c.Request = c.Request.WithContext(logging.WithLogger(ctx, logger))
+		}
+		c.Next()
+	}
+}
+
+// ServerOption traces the calls served by a gRPC server with provider, continuing the caller's trace
+func ServerOption(provider trace.TracerProvider) grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(provider), otelgrpc.WithPropagators(Propagator())))
+}
+
+// DialOption traces the outbound calls of a gRPC client with provider, propagating the trace to the server
+func DialOption(provider trace.TracerProvider) grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithTracerProvider(provider), otelgrpc.WithPropagators(Propagator())))
+}
@@ -0,0 +1,66 @@
+// Package tracing traces requests with OpenTelemetry, from the HTTP and gRPC servers through validation into the collections.
+// Spans are started with the provider of the span in the context, so nothing is recorded when tracing isn't configured.
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName names the service in the traces
+const ServiceName = "qlikOrders"
+
+// instrumentation names the tracer of the spans started by this service
+const instrumentation = "qlikOrders/internal/tracing"
+
+// Attribute keys of the spans
+const (
+	KeyTenantID  = attribute.Key("tenant.id")
+	KeyRequestID = attribute.Key("request.id")
+	KeyOrders    = attribute.Key("orders.count")
+	KeyItems     = attribute.Key("items.count")
+)
+
+// Propagator reads and writes the W3C traceparent, tracestate and baggage headers
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// NewProvider creates a provider sampling every trace and sending the spans to exporter in batches.
+// Any exporter of the OpenTelemetry SDK can be plugged in, e.g. OTLP, shut the provider down to flush the last spans.
+func NewProvider(exporter sdktrace.SpanExporter, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	}, opts...)
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// NewWriterExporter exports every span as a line of JSON to w, e.g. stdout or a file, for local debugging and tests
+func NewWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// Start starts a span as a child of the span in ctx, with the same provider
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(instrumentation)
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
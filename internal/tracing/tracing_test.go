@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qlikOrders/internal/collections"
+	"qlikOrders/internal/logging"
+	"qlikOrders/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newRecorder returns a provider recording every span in memory
+func newRecorder(t *testing.T) (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return provider, recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+func TestStore(t *testing.T) {
+	provider, recorder := newRecorder(t)
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	store := Store(ctx, &collections.OrderCollection{})
+	require.NoError(t, store.AddOrders("acme", []models.Order{
+		{CustomerID: "01", OrderID: "100", Timestamp: "1637245070513", Items: []models.Item{{ItemID: "item1", CostEur: 10}, {ItemID: "item2", CostEur: 5}}},
+	}))
+	_, err := store.GetOrdersByCustomer("acme", "02")
+	assert.ErrorIs(t, err, collections.ErrCustomerNotFound)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	added := spans[0]
+	assert.Equal(t, "Collections.AddOrders", added.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), added.Parent().SpanID())
+	assert.Equal(t, "acme", attributes(added)[KeyTenantID].AsString())
+	assert.Equal(t, int64(1), attributes(added)[KeyOrders].AsInt64())
+	assert.Equal(t, int64(2), attributes(added)[KeyItems].AsInt64())
+	assert.Equal(t, codes.Unset, added.Status().Code)
+
+	lookup := spans[1]
+	assert.Equal(t, "Collections.GetOrdersByCustomer", lookup.Name())
+	assert.Equal(t, codes.Error, lookup.Status().Code)
+	assert.NotContains(t, attributes(lookup), attribute.Key("customer.id"), "customer IDs are never recorded")
+}
+
+func TestStart(t *testing.T) {
+	// Without a span in the context nothing is recorded
+	_, span := Start(context.Background(), "orphan")
+	assert.False(t, span.SpanContext().IsValid())
+	End(span, nil)
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter, err := NewWriterExporter(&buf)
+	require.NoError(t, err)
+	provider := NewProvider(exporter)
+
+	_, span := provider.Tracer("test").Start(context.Background(), "written")
+	span.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	var exported struct {
+		Name     string
+		Resource []struct {
+			Key   string
+			Value struct{ Value any }
+		}
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &exported))
+	assert.Equal(t, "written", exported.Name)
+	assert.Contains(t, exported.Resource, struct {
+		Key   string
+		Value struct{ Value any }
+	}{Key: "service.name", Value: struct{ Value any }{Value: ServiceName}})
+}
+
+func TestMiddleware(t *testing.T) {
+	provider, recorder := newRecorder(t)
+	var logs bytes.Buffer
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(provider), logging.RequestID(logging.New(&logs, logging.Config{})), Correlate())
+	router.GET("/customer/:customerId/items", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("handled")
+		c.Status(http.StatusOK)
+	})
+
+	// The caller's trace is continued
+	req := httptest.NewRequest(http.MethodGet, "/customer/01/items", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(logging.Header, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "/customer/:customerId/items", spans[0].Name())
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, "req-1", attributes(spans[0])[KeyRequestID].AsString())
+	assert.Contains(t, logs.String(), `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+
+	// Customer IDs in the path are never recorded
+	assert.Equal(t, "/customer/:customerId/items", attributes(spans[0])[keyHTTPTarget].AsString())
+	assert.Equal(t, "/customer/:customerId/items", attributes(spans[0])[keyHTTPRoute].AsString())
+	for _, attr := range spans[0].Attributes() {
+		assert.NotContains(t, attr.Value.Emit(), "/customer/01", "attribute %s", attr.Key)
+	}
+}
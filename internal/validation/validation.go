@@ -0,0 +1,145 @@
+// Package validation enforces the validate tags of request types, so constraints are declared once on the types
+// and checked the same way by every endpoint, whatever the transport or body format.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Rules supported on top of the validator's built-in ones
+const (
+	// RuleTimestamp accepts strings holding milliseconds since the epoch
+	RuleTimestamp = "timestamp"
+)
+
+var engine = newEngine()
+
+func newEngine() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// Fields are reported under their JSON names, the names callers send
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	_ = v.RegisterValidation(RuleTimestamp, func(fl validator.FieldLevel) bool {
+		value := fl.Field().String()
+		if value == "" || strings.TrimLeft(value, "0123456789") != "" {
+			return false
+		}
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	})
+	return v
+}
+
+// FieldError describes a field breaking one of its rules
+type FieldError struct {
+	// Field is the path of the field in the JSON body, e.g. items[0].costEur
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Rule is the broken rule, e.g. required or gt
+	Rule string `json:"-"`
+}
+
+// Error lists every field breaking its rules
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Struct checks v against its validate tags, it returns an *Error listing the invalid fields
+func Struct(v any) error {
+	return convert(engine.Struct(v), "")
+}
+
+// Each checks every element of values, fields are reported under the index of their element, e.g. [1].items[0].costEur
+func Each[T any](values []T) error {
+	var fields []FieldError
+	for i, value := range values {
+		err := convert(engine.Struct(value), fmt.Sprintf("[%d].", i))
+		var invalid *Error
+		if errors.As(err, &invalid) {
+			fields = append(fields, invalid.Fields...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return nil
+}
+
+func convert(err error, prefix string) error {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return err
+	}
+
+	fields := make([]FieldError, len(invalid))
+	for i, fieldErr := range invalid {
+		// The namespace starts with the name of the validated type
+		_, path, _ := strings.Cut(fieldErr.Namespace(), ".")
+		fields[i] = FieldError{Field: prefix + path, Message: message(fieldErr), Rule: fieldErr.Tag()}
+	}
+	return &Error{Fields: fields}
+}
+
+func message(err validator.FieldError) string {
+	isList := err.Kind() == reflect.Slice || err.Kind() == reflect.Array || err.Kind() == reflect.Map
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case RuleTimestamp:
+		return "must be milliseconds since the epoch"
+	case "gt":
+		return "must be greater than " + err.Param()
+	case "gte":
+		return "must be at least " + err.Param()
+	case "lt":
+		return "must be less than " + err.Param()
+	case "lte":
+		return "must be at most " + err.Param()
+	case "min":
+		if err.Param() == "1" && (isList || err.Kind() == reflect.String) {
+			return "must not be empty"
+		}
+		if isList {
+			return "must have at least " + err.Param() + " entries"
+		}
+		if err.Kind() == reflect.String {
+			return "must have at least " + err.Param() + " characters"
+		}
+		return "must be at least " + err.Param()
+	case "max":
+		if isList {
+			return "must have at most " + err.Param() + " entries"
+		}
+		if err.Kind() == reflect.String {
+			return "must have at most " + err.Param() + " characters"
+		}
+		return "must be at most " + err.Param()
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(err.Param()), ", ")
+	}
+	return "is invalid"
+}
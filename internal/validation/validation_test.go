@@ -0,0 +1,95 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type line struct {
+	SKU      string `json:"sku" validate:"required"`
+	Quantity int    `json:"quantity" validate:"gt=0"`
+}
+
+type request struct {
+	ID        string   `json:"id" validate:"required"`
+	Timestamp string   `json:"timestamp" validate:"required,timestamp"`
+	Kind      string   `json:"kind,omitempty" validate:"omitempty,oneof=retail wholesale"`
+	Lines     []line   `json:"lines" validate:"required,min=1,dive"`
+	Tags      []string `json:"tags" validate:"max=2"`
+	Internal  string   `json:"-" validate:"required"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := request{ID: "1", Timestamp: "1637245070513", Lines: []line{{SKU: "a", Quantity: 1}}, Internal: "x"}
+	require.NoError(t, Struct(valid))
+
+	tests := []struct {
+		name     string
+		modify   func(r *request)
+		expected []FieldError
+	}{
+		{
+			name:     "Missing field",
+			modify:   func(r *request) { r.ID = "" },
+			expected: []FieldError{{Field: "id", Message: "is required", Rule: "required"}},
+		},
+		{
+			name:     "Timestamp not in milliseconds",
+			modify:   func(r *request) { r.Timestamp = "2021-11-18T14:17:50Z" },
+			expected: []FieldError{{Field: "timestamp", Message: "must be milliseconds since the epoch", Rule: "timestamp"}},
+		},
+		{
+			name:     "Timestamp overflowing",
+			modify:   func(r *request) { r.Timestamp = "99999999999999999999" },
+			expected: []FieldError{{Field: "timestamp", Message: "must be milliseconds since the epoch", Rule: "timestamp"}},
+		},
+		{
+			name:     "Not one of",
+			modify:   func(r *request) { r.Kind = "other" },
+			expected: []FieldError{{Field: "kind", Message: "must be one of retail, wholesale", Rule: "oneof"}},
+		},
+		{
+			name:     "Empty list",
+			modify:   func(r *request) { r.Lines = []line{} },
+			expected: []FieldError{{Field: "lines", Message: "must not be empty", Rule: "min"}},
+		},
+		{
+			name:     "Too many entries",
+			modify:   func(r *request) { r.Tags = []string{"a", "b", "c"} },
+			expected: []FieldError{{Field: "tags", Message: "must have at most 2 entries", Rule: "max"}},
+		},
+		{
+			name: "Nested fields",
+			modify: func(r *request) {
+				r.Lines = []line{{SKU: "a", Quantity: 1}, {Quantity: 0}}
+			},
+			expected: []FieldError{
+				{Field: "lines[1].sku", Message: "is required", Rule: "required"},
+				{Field: "lines[1].quantity", Message: "must be greater than 0", Rule: "gt"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid
+			tt.modify(&r)
+
+			var invalid *Error
+			require.True(t, errors.As(Struct(r), &invalid))
+			assert.Equal(t, tt.expected, invalid.Fields)
+		})
+	}
+}
+
+func TestEach(t *testing.T) {
+	lines := []line{{SKU: "a", Quantity: 1}, {SKU: "b"}, {Quantity: 2}}
+
+	err := Each(lines)
+	assert.EqualError(t, err, "[1].quantity must be greater than 0, [2].sku is required")
+	assert.NoError(t, Each(lines[:1]))
+	assert.NoError(t, Each([]line{}))
+}